@@ -1,7 +1,13 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
@@ -37,13 +43,22 @@ func cmdBackup() *cli.Command {
 					},
 					&cli.StringFlag{
 						Name:  "since",
-						Usage: "last backup timestamp (for incremental)",
+						Usage: "previous backup file, or timestamp, to back up changes from (for incremental, defaults to the latest backup in the output directory)",
+					},
+					&cli.StringFlag{
+						Name:  "types",
+						Usage: "comma separated item types to back up (default: all): " + strings.Join(sncli.BackupTypeNames(), ", "),
 					},
 					&cli.BoolFlag{
 						Name:    "encrypt",
 						Aliases: []string{"e"},
 						Usage:   "encrypt the backup",
 					},
+					&cli.StringFlag{
+						Name:  "kdf",
+						Usage: "key derivation function for encrypted backups: pbkdf2 or argon2id",
+						Value: "pbkdf2",
+					},
 				},
 				Action: func(c *cli.Context) error {
 					return runBackupCreate(c, getOpts(c))
@@ -54,15 +69,51 @@ func cmdBackup() *cli.Command {
 				Usage: "restore from a backup file",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:     "input",
-						Aliases:  []string{"i"},
-						Usage:    "backup file path (.zip)",
-						Required: true,
+						Name:    "input",
+						Aliases: []string{"i"},
+						Usage:   "backup file path (.zip)",
+					},
+					&cli.StringFlag{
+						Name:  "chain",
+						Usage: "directory of backups to restore a full backup and its incrementals from",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "restore the chain as it was at this time (RFC3339, defaults to the latest backup)",
 					},
 					&cli.BoolFlag{
 						Name:  "dry-run",
 						Usage: "preview restore without making changes",
 					},
+					&cli.StringFlag{
+						Name:  "types",
+						Usage: "comma separated item types to restore (default: all): " + strings.Join(sncli.BackupTypeNames(), ", "),
+					},
+					&cli.StringFlag{
+						Name:  "conflict",
+						Usage: "how to handle items that already exist: skip, overwrite or copy",
+						Value: string(sncli.RestoreConflictSkip),
+					},
+					&cli.StringFlag{
+						Name:  "uuid",
+						Usage: "only restore items with these uuids (separate multiple with commas)",
+					},
+					&cli.StringFlag{
+						Name:  "title",
+						Usage: "only restore notes and tags with these titles (separate multiple with commas)",
+					},
+					&cli.StringFlag{
+						Name:  "tag",
+						Usage: "only restore notes with these tags (separate multiple with commas)",
+					},
+					&cli.StringFlag{
+						Name:  "updated-before",
+						Usage: "only restore items last updated before this time (RFC3339)",
+					},
+					&cli.BoolFlag{
+						Name:  "as-copy",
+						Usage: "restore items that already exist as copies next to the current version",
+					},
 				},
 				Action: func(c *cli.Context) error {
 					return runBackupRestore(c, getOpts(c))
@@ -83,6 +134,101 @@ func cmdBackup() *cli.Command {
 					return runBackupInfo(c)
 				},
 			},
+			{
+				Name:  "verify",
+				Usage: "check a backup file for corrupted, missing or undecryptable entries",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Usage:    "backup file path (.zip)",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Value: "table",
+						Usage: "output format (table, json)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runBackupVerify(c)
+				},
+			},
+			{
+				Name:  "rotate",
+				Usage: "prune old backups from a directory using a retention policy",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "dir",
+						Aliases:  []string{"d"},
+						Usage:    "directory containing backups",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  "keep-daily",
+						Usage: "number of most recent days to keep the latest backup of",
+					},
+					&cli.IntFlag{
+						Name:  "keep-weekly",
+						Usage: "number of most recent weeks to keep the latest backup of",
+					},
+					&cli.IntFlag{
+						Name:  "keep-monthly",
+						Usage: "number of most recent months to keep the latest backup of",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "show what would be pruned without deleting anything",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runBackupRotate(c)
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "show notes and tags added, removed or modified between two backups, or a backup and the account",
+				ArgsUsage: "<backup.zip> [other.zip]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "live",
+						Usage: "compare the backup with the live account",
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Value: "table",
+						Usage: "output format (table, json)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runBackupDiff(c, getOpts(c))
+				},
+			},
+			{
+				Name:  "rekey",
+				Usage: "re-encrypt a backup file under a new password",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Usage:    "backup file path (.zip)",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "write the re-encrypted backup to this path instead of replacing the original",
+					},
+					&cli.StringFlag{
+						Name:  "kdf",
+						Usage: "key derivation function: pbkdf2 or argon2id",
+						Value: "pbkdf2",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runBackupRekey(c)
+				},
+			},
 		},
 	}
 }
@@ -99,31 +245,22 @@ func runBackupCreate(c *cli.Context, opts configOptsOutput) error {
 		return err
 	}
 
-	// Get password if encryption requested
-	var password string
-	if c.Bool("encrypt") {
-		fmt.Print("Encryption password: ")
-		passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
-		fmt.Println()
-		if err != nil {
-			return fmt.Errorf("failed to read password: %w", err)
-		}
-		password = string(passwordBytes)
+	// Resolve the parent of an incremental backup
+	var parent, since string
 
-		if len(password) < 8 {
-			return fmt.Errorf("password must be at least 8 characters")
-		}
-
-		// Confirm password
-		fmt.Print("Confirm password: ")
-		confirmBytes, err := term.ReadPassword(int(syscall.Stdin))
-		fmt.Println()
+	if c.Bool("incremental") {
+		parent, since, err = resolveBackupSince(c.String("since"), c.String("output"))
 		if err != nil {
-			return fmt.Errorf("failed to read confirmation: %w", err)
+			return err
 		}
+	}
 
-		if string(confirmBytes) != password {
-			return fmt.Errorf("passwords do not match")
+	// Get password if encryption requested
+	var password string
+	if c.Bool("encrypt") {
+		password, err = readNewBackupPassword("Encryption password: ")
+		if err != nil {
+			return err
 		}
 	}
 
@@ -132,10 +269,13 @@ func runBackupCreate(c *cli.Context, opts configOptsOutput) error {
 		Session:        &session,
 		OutputFile:     c.String("output"),
 		Incremental:    c.Bool("incremental"),
-		LastBackupTime: c.String("since"),
+		Types:          sncli.CommaSplit(c.String("types")),
 		Encrypt:        c.Bool("encrypt"),
 		Password:       password,
+		KDF:            c.String("kdf"),
 		Debug:          opts.debug,
+		Parent:         parent,
+		LastBackupTime: since,
 	}
 
 	// Show configuration
@@ -147,9 +287,15 @@ func runBackupCreate(c *cli.Context, opts configOptsOutput) error {
 	pterm.Info.Println("Backup Configuration:")
 	pterm.Printf("  Output File: %s\n", backupConfig.OutputFile)
 	pterm.Printf("  Incremental: %v\n", backupConfig.Incremental)
+	if backupConfig.Incremental && backupConfig.Parent != "" {
+		pterm.Printf("  Parent: %s\n", backupConfig.Parent)
+	}
 	if backupConfig.Incremental && backupConfig.LastBackupTime != "" {
 		pterm.Printf("  Since: %s\n", backupConfig.LastBackupTime)
 	}
+	if len(backupConfig.Types) > 0 {
+		pterm.Printf("  Types: %s\n", strings.Join(backupConfig.Types, ", "))
+	}
 	pterm.Printf("  Encrypted: %v\n", backupConfig.Encrypt)
 	pterm.Println()
 
@@ -168,6 +314,49 @@ func runBackupCreate(c *cli.Context, opts configOptsOutput) error {
 }
 
 func runBackupRestore(c *cli.Context, opts configOptsOutput) error {
+	policy, err := sncli.ParseRestoreConflictPolicy(c.String("conflict"))
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("as-copy") {
+		if c.IsSet("conflict") && policy != sncli.RestoreConflictCopy {
+			return fmt.Errorf("--as-copy cannot be used with --conflict %s", policy)
+		}
+
+		policy = sncli.RestoreConflictCopy
+	}
+
+	filter := sncli.RestoreFilter{
+		UUIDs:  sncli.CommaSplit(c.String("uuid")),
+		Titles: sncli.CommaSplit(c.String("title")),
+		Tags:   sncli.CommaSplit(c.String("tag")),
+	}
+
+	if c.String("updated-before") != "" {
+		filter.UpdatedBefore, err = time.Parse(time.RFC3339, c.String("updated-before"))
+		if err != nil {
+			return fmt.Errorf("invalid --updated-before time, expected RFC3339: %w", err)
+		}
+	}
+
+	if (c.String("input") == "") == (c.String("chain") == "") {
+		return fmt.Errorf("specify either --input or --chain")
+	}
+
+	var until time.Time
+
+	if c.String("until") != "" {
+		if c.String("chain") == "" {
+			return fmt.Errorf("--until can only be used with --chain")
+		}
+
+		until, err = time.Parse(time.RFC3339, c.String("until"))
+		if err != nil {
+			return fmt.Errorf("invalid --until time, expected RFC3339: %w", err)
+		}
+	}
+
 	// Get session
 	session, _, err := cache.GetSession(common.NewHTTPClient(), opts.useSession, opts.sessKey, opts.server, opts.debug)
 	if err != nil {
@@ -180,30 +369,32 @@ func runBackupRestore(c *cli.Context, opts configOptsOutput) error {
 	}
 
 	// Get backup info first
-	manifest, err := sncli.GetBackupInfo(c.String("input"), "")
+	encrypted, err := restoreSourceEncrypted(c.String("input"), c.String("chain"), until)
 	if err != nil {
-		return fmt.Errorf("failed to read backup info: %w", err)
+		return err
 	}
 
 	// Get password if encrypted
 	var password string
-	if manifest.Encrypted {
-		fmt.Print("Decryption password: ")
-		passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
-		fmt.Println()
+	if encrypted {
+		password, err = readBackupPassword("Decryption password: ")
 		if err != nil {
-			return fmt.Errorf("failed to read password: %w", err)
+			return err
 		}
-		password = string(passwordBytes)
 	}
 
 	// Create restore config
 	restoreConfig := sncli.RestoreConfig{
-		Session:   &session,
-		InputFile: c.String("input"),
-		DryRun:    c.Bool("dry-run"),
-		Password:  password,
-		Debug:     opts.debug,
+		Session:        &session,
+		InputFile:      c.String("input"),
+		ChainDir:       c.String("chain"),
+		Until:          until,
+		Types:          sncli.CommaSplit(c.String("types")),
+		Filter:         filter,
+		DryRun:         c.Bool("dry-run"),
+		Password:       password,
+		ConflictPolicy: policy,
+		Debug:          opts.debug,
 	}
 
 	// Show header
@@ -237,17 +428,31 @@ func runBackupRestore(c *cli.Context, opts configOptsOutput) error {
 		{"Incremental", fmt.Sprintf("%v", result.Manifest.Incremental)},
 		{"Encrypted", fmt.Sprintf("%v", result.Manifest.Encrypted)},
 		{"Version", result.Manifest.Version},
+		{"Conflict Policy", string(result.Policy)},
 	}
 	pterm.DefaultTable.WithHasHeader(false).
 		WithData(tableData).
 		Render()
 
+	if len(result.Chain) > 0 {
+		pterm.Println()
+		pterm.DefaultSection.Println("Backup Chain")
+
+		for x, path := range result.Chain {
+			pterm.Printf("  %d. %s\n", x+1, path)
+		}
+	}
+
 	pterm.Println()
 	pterm.DefaultSection.Println("Items to Restore")
 	itemData := [][]string{
 		{color.Cyan.Sprint("Type"), color.Cyan.Sprint("Count")},
-		{"Notes", fmt.Sprintf("%d", result.NotesCount)},
-		{"Tags", fmt.Sprintf("%d", result.TagsCount)},
+	}
+
+	for _, name := range sncli.BackupTypeNames() {
+		if count, ok := result.ItemCounts[name]; ok {
+			itemData = append(itemData, []string{name, fmt.Sprintf("%d", count)})
+		}
 	}
 	pterm.DefaultTable.WithHasHeader(true).
 		WithHeaderStyle(pterm.NewStyle(pterm.FgLightCyan, pterm.Bold)).
@@ -255,6 +460,33 @@ func runBackupRestore(c *cli.Context, opts configOptsOutput) error {
 		WithBoxed(true).
 		Render()
 
+	if !filter.IsEmpty() && len(result.Created)+len(result.Updated) > 0 {
+		pterm.Println()
+		pterm.DefaultSection.Println("Restored Items")
+		renderRestoredItems(append(result.Created, result.Updated...))
+	}
+
+	pterm.Println()
+	pterm.DefaultSection.Println("Restore Summary")
+	summaryData := [][]string{
+		{color.Cyan.Sprint("Outcome"), color.Cyan.Sprint("Count")},
+		{"Created", fmt.Sprintf("%d", len(result.Created))},
+		{"Updated", fmt.Sprintf("%d", len(result.Updated))},
+		{"Skipped", fmt.Sprintf("%d", len(result.Skipped))},
+		{"Conflicted", fmt.Sprintf("%d", len(result.Conflicted))},
+	}
+	pterm.DefaultTable.WithHasHeader(true).
+		WithHeaderStyle(pterm.NewStyle(pterm.FgLightCyan, pterm.Bold)).
+		WithData(summaryData).
+		WithBoxed(true).
+		Render()
+
+	if len(result.Conflicted) > 0 {
+		pterm.Println()
+		pterm.DefaultSection.Println("Conflicts")
+		renderRestoredItems(result.Conflicted)
+	}
+
 	if restoreConfig.DryRun {
 		pterm.Println()
 		pterm.Info.Println("This was a dry run. No changes were made.")
@@ -271,6 +503,18 @@ func runBackupInfo(c *cli.Context) error {
 	filename := c.String("file")
 
 	manifest, err := sncli.GetBackupInfo(filename, "")
+	if errors.Is(err, sncli.ErrBackupPasswordRequired) {
+		// version 1 archives encrypt the manifest
+		var password string
+
+		password, err = readBackupPassword("Decryption password: ")
+		if err != nil {
+			return err
+		}
+
+		manifest, err = sncli.GetBackupInfo(filename, password)
+	}
+
 	if err != nil {
 		return err
 	}
@@ -292,6 +536,23 @@ func runBackupInfo(c *cli.Context) error {
 		{"Version", manifest.Version},
 	}
 
+	if manifest.KDF != nil {
+		tableData = append(tableData, []string{"Key Derivation", manifest.KDF.Algorithm})
+	}
+
+	if manifest.ID != "" {
+		tableData = append(tableData, []string{"Backup ID", manifest.ID})
+	}
+
+	if manifest.Parent != nil {
+		tableData = append(tableData,
+			[]string{"Parent", manifest.Parent.File},
+			[]string{"Parent ID", manifest.Parent.ID},
+			[]string{"Parent SHA-256", manifest.Parent.SHA256},
+			[]string{"Parent Timestamp", manifest.Parent.Timestamp},
+		)
+	}
+
 	pterm.DefaultTable.WithHasHeader(false).
 		WithData(tableData).
 		WithBoxed(true).
@@ -304,10 +565,10 @@ func runBackupInfo(c *cli.Context) error {
 		{color.Cyan.Sprint("Type"), color.Cyan.Sprint("Count")},
 	}
 
-	for itemType, count := range manifest.ItemCounts {
+	for _, itemType := range sortedKeys(manifest.ItemCounts) {
 		itemData = append(itemData, []string{
 			itemType,
-			fmt.Sprintf("%d", count),
+			fmt.Sprintf("%d", manifest.ItemCounts[itemType]),
 		})
 	}
 
@@ -319,3 +580,466 @@ func runBackupInfo(c *cli.Context) error {
 
 	return nil
 }
+
+func runBackupVerify(c *cli.Context) error {
+	filename := c.String("file")
+
+	manifest, err := sncli.GetBackupInfo(filename, "")
+	if err != nil && !errors.Is(err, sncli.ErrBackupPasswordRequired) {
+		return fmt.Errorf("failed to read backup info: %w", err)
+	}
+
+	// items can only be checked with the password, which can't be prompted for when run from cron
+	var password string
+	if manifest.Encrypted && term.IsTerminal(int(syscall.Stdin)) {
+		password, err = readBackupPassword("Decryption password: ")
+		if err != nil {
+			return err
+		}
+	}
+
+	verifyConfig := sncli.VerifyConfig{
+		InputFile: filename,
+		Password:  password,
+	}
+
+	result, err := verifyConfig.Run()
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(c.String("output")) == "json" {
+		bOutput, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(bOutput))
+	} else {
+		renderVerifyResult(filename, result)
+	}
+
+	if !result.OK() {
+		return fmt.Errorf("backup verification failed with %d problem(s)", len(result.Problems))
+	}
+
+	return nil
+}
+
+func renderVerifyResult(filename string, result sncli.VerifyResult) {
+	pterm.DefaultHeader.WithBackgroundStyle(pterm.NewStyle(pterm.BgCyan)).
+		WithMargin(5).
+		Println("🔎 Verify Backup")
+	pterm.Println()
+
+	tableData := [][]string{
+		{"File", filename},
+		{"Version", result.Manifest.Version},
+		{"Encrypted", fmt.Sprintf("%v", result.Manifest.Encrypted)},
+		{"Entries Checked", fmt.Sprintf("%d", result.EntriesChecked)},
+		{"Items Checked", fmt.Sprintf("%d", result.ItemsChecked)},
+	}
+
+	if result.HasChecksums {
+		tableData = append(tableData, []string{"Archive Digest", fmt.Sprintf("%v", result.DigestValid)})
+	}
+
+	pterm.DefaultTable.WithHasHeader(false).
+		WithData(tableData).
+		WithBoxed(true).
+		Render()
+
+	if !result.HasChecksums {
+		pterm.Warning.Println("Backup has no recorded checksums (created by an older version); only readability was checked")
+	}
+
+	if !result.ItemsVerified {
+		pterm.Warning.Println("Items were not checked as the backup is encrypted and no password was given")
+	}
+
+	if result.OK() {
+		pterm.Println()
+		pterm.Success.Println("Backup verified successfully")
+
+		return
+	}
+
+	pterm.Println()
+	pterm.DefaultSection.Println("Problems")
+
+	problemData := [][]string{
+		{color.Cyan.Sprint("Entry"), color.Cyan.Sprint("UUID"), color.Cyan.Sprint("Problem"), color.Cyan.Sprint("Detail")},
+	}
+
+	for _, problem := range result.Problems {
+		problemData = append(problemData, []string{problem.Entry, problem.UUID, string(problem.Kind), problem.Detail})
+	}
+
+	pterm.DefaultTable.WithHasHeader(true).
+		WithHeaderStyle(pterm.NewStyle(pterm.FgLightCyan, pterm.Bold)).
+		WithData(problemData).
+		WithBoxed(true).
+		Render()
+}
+
+func runBackupRotate(c *cli.Context) error {
+	rotateConfig := sncli.RotateConfig{
+		Dir:         c.String("dir"),
+		KeepDaily:   c.Int("keep-daily"),
+		KeepWeekly:  c.Int("keep-weekly"),
+		KeepMonthly: c.Int("keep-monthly"),
+		DryRun:      c.Bool("dry-run"),
+	}
+
+	result, err := rotateConfig.Run()
+	if err != nil {
+		return err
+	}
+
+	if result.DryRun {
+		pterm.DefaultHeader.WithBackgroundStyle(pterm.NewStyle(pterm.BgYellow)).
+			WithMargin(5).
+			Println("🔍 Preview Rotation (Dry Run)")
+	} else {
+		pterm.DefaultHeader.WithBackgroundStyle(pterm.NewStyle(pterm.BgCyan)).
+			WithMargin(5).
+			Println("♻️  Rotate Backups")
+	}
+	pterm.Println()
+
+	tableData := [][]string{
+		{color.Cyan.Sprint("File"), color.Cyan.Sprint("Timestamp"), color.Cyan.Sprint("Incremental"), color.Cyan.Sprint("Action")},
+	}
+
+	for _, entry := range result.Kept {
+		tableData = append(tableData, []string{
+			filepath.Base(entry.Path), entry.Timestamp, fmt.Sprintf("%v", entry.Incremental),
+			"keep (" + strings.Join(entry.Reasons, ", ") + ")",
+		})
+	}
+
+	for _, entry := range result.Pruned {
+		tableData = append(tableData, []string{
+			filepath.Base(entry.Path), entry.Timestamp, fmt.Sprintf("%v", entry.Incremental),
+			color.Red.Sprint("prune"),
+		})
+	}
+
+	pterm.DefaultTable.WithHasHeader(true).
+		WithHeaderStyle(pterm.NewStyle(pterm.FgLightCyan, pterm.Bold)).
+		WithData(tableData).
+		WithBoxed(true).
+		Render()
+
+	for _, warning := range result.Warnings {
+		pterm.Warning.Println(warning)
+	}
+
+	pterm.Println()
+
+	if result.DryRun {
+		pterm.Info.Printf("This was a dry run. %d backup(s) would be pruned.\n", len(result.Pruned))
+
+		return nil
+	}
+
+	pterm.Success.Printf("Kept %d backup(s), pruned %d\n", len(result.Kept), len(result.Pruned))
+
+	return nil
+}
+
+func runBackupDiff(c *cli.Context, opts configOptsOutput) error {
+	args := c.Args().Slice()
+
+	switch {
+	case c.Bool("live") && len(args) != 1:
+		return fmt.Errorf("specify one backup file to compare with the live account")
+	case !c.Bool("live") && len(args) != 2:
+		return fmt.Errorf("specify two backup files to compare, or one with --live")
+	}
+
+	diffConfig := sncli.DiffConfig{
+		FileA: args[0],
+		Live:  c.Bool("live"),
+	}
+
+	var err error
+
+	if diffConfig.PasswordA, err = readPasswordIfEncrypted(args[0]); err != nil {
+		return err
+	}
+
+	if diffConfig.Live {
+		session, _, err := cache.GetSession(common.NewHTTPClient(), opts.useSession, opts.sessKey, opts.server, opts.debug)
+		if err != nil {
+			return err
+		}
+
+		session.CacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, snAppName)
+		if err != nil {
+			return err
+		}
+
+		diffConfig.Session = &session
+	} else {
+		diffConfig.FileB = args[1]
+
+		if diffConfig.PasswordB, err = readPasswordIfEncrypted(args[1]); err != nil {
+			return err
+		}
+	}
+
+	result, err := diffConfig.Run()
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(c.String("output")) == "json" {
+		bOutput, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(bOutput))
+
+		return nil
+	}
+
+	renderBackupDiff(result)
+
+	return nil
+}
+
+// readPasswordIfEncrypted prompts for a backup's password if it is encrypted
+func readPasswordIfEncrypted(filename string) (string, error) {
+	manifest, err := sncli.GetBackupInfo(filename, "")
+	if err != nil && !errors.Is(err, sncli.ErrBackupPasswordRequired) {
+		return "", fmt.Errorf("failed to read backup info: %w", err)
+	}
+
+	if !manifest.Encrypted {
+		return "", nil
+	}
+
+	return readBackupPassword(fmt.Sprintf("Decryption password for %s: ", filepath.Base(filename)))
+}
+
+func renderBackupDiff(result sncli.BackupDiff) {
+	pterm.DefaultHeader.WithBackgroundStyle(pterm.NewStyle(pterm.BgCyan)).
+		WithMargin(5).
+		Println("🔀 Backup Diff")
+	pterm.Println()
+
+	pterm.Printf("  From: %s\n", result.From)
+	pterm.Printf("  To:   %s\n", result.To)
+	pterm.Println()
+
+	if len(result.Added)+len(result.Removed)+len(result.Modified) == 0 {
+		pterm.Success.Println("No differences")
+
+		return
+	}
+
+	tableData := [][]string{
+		{color.Cyan.Sprint("Change"), color.Cyan.Sprint("Type"), color.Cyan.Sprint("Title"), color.Cyan.Sprint("UUID"), color.Cyan.Sprint("Fields")},
+	}
+
+	for _, group := range [][]sncli.DiffEntry{result.Added, result.Removed, result.Modified} {
+		for _, entry := range group {
+			change := string(entry.Change)
+
+			switch entry.Change {
+			case sncli.DiffAdded:
+				change = color.Green.Sprint(change)
+			case sncli.DiffRemoved:
+				change = color.Red.Sprint(change)
+			case sncli.DiffModified:
+				change = color.Yellow.Sprint(change)
+			}
+
+			tableData = append(tableData, []string{change, entry.Type, entry.Title, entry.UUID, strings.Join(entry.Fields, ", ")})
+		}
+	}
+
+	pterm.DefaultTable.WithHasHeader(true).
+		WithHeaderStyle(pterm.NewStyle(pterm.FgLightCyan, pterm.Bold)).
+		WithData(tableData).
+		WithBoxed(true).
+		Render()
+
+	for _, entry := range result.Modified {
+		if entry.Diff == "" {
+			continue
+		}
+
+		pterm.Println()
+		pterm.DefaultSection.Println(entry.Title)
+		fmt.Print(entry.Diff)
+	}
+}
+
+func runBackupRekey(c *cli.Context) error {
+	filename := c.String("file")
+
+	manifest, err := sncli.GetBackupInfo(filename, "")
+	if err != nil && !errors.Is(err, sncli.ErrBackupPasswordRequired) {
+		return fmt.Errorf("failed to read backup info: %w", err)
+	}
+
+	var oldPassword string
+	if manifest.Encrypted {
+		oldPassword, err = readBackupPassword("Current password: ")
+		if err != nil {
+			return err
+		}
+	}
+
+	newPassword, err := readNewBackupPassword("New password: ")
+	if err != nil {
+		return err
+	}
+
+	rekeyConfig := sncli.RekeyConfig{
+		InputFile:   filename,
+		OutputFile:  c.String("output"),
+		OldPassword: oldPassword,
+		NewPassword: newPassword,
+		KDF:         c.String("kdf"),
+	}
+
+	spinner, _ := pterm.DefaultSpinner.Start("Re-encrypting backup...")
+
+	manifest, err = rekeyConfig.Run()
+	if err != nil {
+		spinner.Fail("Rekey failed")
+		return err
+	}
+
+	spinner.Success("Backup re-encrypted")
+
+	output := rekeyConfig.OutputFile
+	if output == "" {
+		output = filename
+	}
+
+	pterm.Success.Printf("Backup saved to: %s (format %s, %s)\n", output, manifest.Version, manifest.KDF.Algorithm)
+
+	return nil
+}
+
+// resolveBackupSince works out what an incremental backup is taken against.
+// The value may be a previous backup file or a timestamp. If empty, the latest
+// backup in the output directory is used.
+func resolveBackupSince(since, output string) (string, string, error) {
+	if since == "" {
+		parent, err := sncli.FindLatestBackup(filepath.Dir(output), output)
+		if err != nil {
+			return "", "", fmt.Errorf("incremental backup needs a previous backup: %w", err)
+		}
+
+		return parent, "", nil
+	}
+
+	if _, err := os.Stat(since); err == nil {
+		return since, "", nil
+	}
+
+	if _, err := time.Parse(time.RFC3339, since); err != nil {
+		return "", "", fmt.Errorf("--since must be a backup file or an RFC3339 timestamp: %s", since)
+	}
+
+	return "", since, nil
+}
+
+// restoreSourceEncrypted reports whether the backup, or any backup in the chain, is encrypted
+func restoreSourceEncrypted(input, chainDir string, until time.Time) (bool, error) {
+	if chainDir == "" {
+		manifest, err := sncli.GetBackupInfo(input, "")
+		if err != nil && !errors.Is(err, sncli.ErrBackupPasswordRequired) {
+			return false, fmt.Errorf("failed to read backup info: %w", err)
+		}
+
+		return manifest.Encrypted, nil
+	}
+
+	chain, err := sncli.ResolveBackupChain(chainDir, until)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range chain {
+		if entry.Manifest.Encrypted {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// readBackupPassword prompts for a password without echoing it
+func readBackupPassword(prompt string) (string, error) {
+	fmt.Print(prompt)
+	passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+
+	return string(passwordBytes), nil
+}
+
+// readNewBackupPassword prompts for a new password and asks for it to be confirmed
+func readNewBackupPassword(prompt string) (string, error) {
+	password, err := readBackupPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	if len(password) < sncli.MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", sncli.MinPasswordLength)
+	}
+
+	// Confirm password
+	confirm, err := readBackupPassword("Confirm password: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read confirmation: %w", err)
+	}
+
+	if confirm != password {
+		return "", fmt.Errorf("passwords do not match")
+	}
+
+	return password, nil
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func renderRestoredItems(restored []sncli.RestoredItem) {
+	tableData := [][]string{
+		{color.Cyan.Sprint("Type"), color.Cyan.Sprint("Title"), color.Cyan.Sprint("UUID"), color.Cyan.Sprint("Action")},
+	}
+
+	for _, item := range restored {
+		action := string(item.Action)
+		if item.NewUUID != "" && item.NewUUID != item.UUID {
+			action = fmt.Sprintf("%s as %s", action, item.NewUUID)
+		}
+
+		tableData = append(tableData, []string{item.ContentType, item.Title, item.UUID, action})
+	}
+
+	pterm.DefaultTable.WithHasHeader(true).
+		WithHeaderStyle(pterm.NewStyle(pterm.FgLightCyan, pterm.Bold)).
+		WithData(tableData).
+		WithBoxed(true).
+		Render()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gookit/color"
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
+	"github.com/pterm/pterm"
+	"github.com/urfave/cli/v2"
+)
+
+func cmdDaemon() *cli.Command {
+	return &cli.Command{
+		Name:  "daemon",
+		Usage: "run in the foreground, holding the cache open and syncing in the background",
+		Description: `Other commands use the daemon while it's running, borrowing the cache from it
+rather than syncing each time, which makes scripted batch edits faster.
+Set SN_NO_DAEMON to stop commands using it.`,
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:  "interval",
+				Value: sncli.DefaultDaemonInterval,
+				Usage: "how often to sync",
+			},
+			&cli.DurationFlag{
+				Name:  "max-age",
+				Value: sncli.DefaultDaemonMaxAge,
+				Usage: "how old the last sync can be before a command triggers another",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return processDaemon(c, getOpts(c))
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:  "status",
+				Usage: "show whether the daemon is running and when it last synced",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Value: "table",
+						Usage: "output format (table, json)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return processDaemonStatus(c, getOpts(c))
+				},
+			},
+			{
+				Name:  "sync",
+				Usage: "ask the daemon to sync now",
+				Action: func(c *cli.Context) error {
+					return callDaemon(getOpts(c), "sync", map[string]bool{"force": true}, "synced")
+				},
+			},
+			{
+				Name:  "stop",
+				Usage: "stop the daemon",
+				Action: func(c *cli.Context) error {
+					return callDaemon(getOpts(c), "stop", nil, "daemon stopped")
+				},
+			},
+		},
+	}
+}
+
+func processDaemon(c *cli.Context, opts configOptsOutput) error {
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	daemon := &sncli.Daemon{
+		Session:  session,
+		Interval: c.Duration("interval"),
+		MaxAge:   c.Duration("max-age"),
+	}
+
+	_, _ = fmt.Fprintf(c.App.Writer, "listening on %s\n", sncli.DaemonSocketPath(session.CacheDBPath))
+
+	return daemon.Run(ctx)
+}
+
+func dialDaemon(opts configOptsOutput) (*sncli.DaemonClient, error) {
+	session, err := getSession(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sncli.DialDaemon(session.CacheDBPath)
+	if err != nil {
+		return nil, fmt.Errorf("daemon is not running: %w", err)
+	}
+
+	return client, nil
+}
+
+func callDaemon(opts configOptsOutput, method string, params any, done string) error {
+	client, err := dialDaemon(opts)
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	if err = client.Call(method, params, nil); err != nil {
+		return err
+	}
+
+	fmt.Println(color.Green.Sprint(done))
+
+	return nil
+}
+
+func processDaemonStatus(c *cli.Context, opts configOptsOutput) error {
+	client, err := dialDaemon(opts)
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	status, err := client.Status()
+	if err != nil {
+		return err
+	}
+
+	if c.String("output") == "json" {
+		out, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(out))
+
+		return nil
+	}
+
+	lastError := status.LastError
+	if lastError == "" {
+		lastError = "-"
+	}
+
+	data := pterm.TableData{
+		{"PID", fmt.Sprint(status.PID)},
+		{"Cache", status.CacheDBPath},
+		{"Last sync", status.LastSync.Local().Format(time.DateTime)},
+		{"Last error", lastError},
+		{"In use", fmt.Sprint(status.Leased)},
+		{"Interval", status.Interval},
+	}
+
+	return pterm.DefaultTable.WithData(data).Render()
+}
@@ -42,6 +42,10 @@ func cmdGet() *cli.Command {
 						Value: "json",
 						Usage: "output format",
 					},
+					&cli.BoolFlag{
+						Name:  "offline",
+						Usage: "read from the local cache without syncing",
+					},
 				},
 				OnUsageError: func(c *cli.Context, err error, isSubcommand bool) error {
 					return err
@@ -179,7 +183,7 @@ func cmdGet() *cli.Command {
 				Usage:   "get tags",
 				BashComplete: func(c *cli.Context) {
 					tagTasks := []string{
-						"--title", "--uuid", "--regex", "--match-all", "--count", "--output",
+						"--title", "--uuid", "--regex", "--match-all", "--count", "--output", "--offline",
 					}
 					if c.NArg() > 0 {
 						return
@@ -229,7 +233,7 @@ func cmdGet() *cli.Command {
 				Aliases: []string{"notes"},
 				Usage:   "get notes",
 				BashComplete: func(c *cli.Context) {
-					addTasks := []string{"--title", "--text", "--tag", "--uuid", "--editor", "--include-trash", "--count"}
+					addTasks := []string{"--title", "--text", "--tag", "--uuid", "--editor", "--include-trash", "--count", "--offline"}
 					if c.NArg() > 0 {
 						return
 					}
@@ -285,6 +289,10 @@ func cmdGet() *cli.Command {
 						Name:  "metadata",
 						Usage: "show metadata in rich view",
 					},
+					&cli.BoolFlag{
+						Name:  "offline",
+						Usage: "read from the local cache without syncing",
+					},
 				},
 				Action: func(c *cli.Context) error {
 					opts := getOpts(c)
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
+	"github.com/urfave/cli/v2"
+)
+
+func cmdImport() *cli.Command {
+	importFlags := func(path, usage string, folders bool) []cli.Flag {
+		flags := []cli.Flag{
+			&cli.StringFlag{
+				Name:     path,
+				Usage:    usage,
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "show what would be imported without changing anything",
+			},
+		}
+
+		if folders {
+			flags = append(flags, &cli.BoolFlag{
+				Name:  "folder-tags",
+				Value: true,
+				Usage: "tag notes with their folders, nested as the folders are",
+			})
+		}
+
+		return flags
+	}
+
+	return &cli.Command{
+		Name:  "import",
+		Usage: "import notes from other applications",
+		Description: `Notes are imported with their tags, and links between notes become note references.
+The notes created are recorded in ` + sncli.ImportStateFile + `, in the directory imported or
+next to the file, so importing again only adds new notes and updates changed ones.
+
+Supported formats:
+  - obsidian: Obsidian vault
+  - markdown: directory of Markdown files
+  - backup: decrypted Standard Notes backup (.txt or .json)
+  - enex: Evernote export, tagged with the notebook named after the file
+
+Example:
+  sn import obsidian --vault ~/vault --dry-run`,
+		Subcommands: []*cli.Command{
+			{
+				Name:    "obsidian",
+				Aliases: []string{"obs"},
+				Usage:   "import an Obsidian vault",
+				Flags:   importFlags("vault", "path of the vault", true),
+				Action: func(c *cli.Context) error {
+					return processImport(c, getOpts(c), "obsidian", c.String("vault"))
+				},
+			},
+			{
+				Name:    "markdown",
+				Aliases: []string{"md"},
+				Usage:   "import a directory of Markdown files",
+				Flags:   importFlags("dir", "path of the directory", true),
+				Action: func(c *cli.Context) error {
+					return processImport(c, getOpts(c), "markdown", c.String("dir"))
+				},
+			},
+			{
+				Name:  "backup",
+				Usage: "import notes from a decrypted Standard Notes backup",
+				Flags: importFlags("file", "path of the backup", false),
+				Action: func(c *cli.Context) error {
+					return processImport(c, getOpts(c), "backup", c.String("file"))
+				},
+			},
+			{
+				Name:    "enex",
+				Aliases: []string{"evernote"},
+				Usage:   "import an Evernote .enex export",
+				Flags:   importFlags("file", "path of the .enex file", false),
+				Action: func(c *cli.Context) error {
+					return processImport(c, getOpts(c), "enex", c.String("file"))
+				},
+			},
+		},
+	}
+}
+
+func processImport(c *cli.Context, opts configOptsOutput, format, path string) error {
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	i := sncli.ImportConfig{
+		Session:    session,
+		Format:     format,
+		Path:       path,
+		FolderTags: c.Bool("folder-tags"),
+		DryRun:     c.Bool("dry-run"),
+		Debug:      opts.debug,
+	}
+
+	result, err := i.Run()
+	if err != nil {
+		return err
+	}
+
+	printImportResult(c, result, i.DryRun)
+
+	return nil
+}
+
+func printImportResult(c *cli.Context, result sncli.ImportResult, dryRun bool) {
+	prefix := ""
+	if dryRun {
+		prefix = "would have "
+	}
+
+	for _, group := range []struct {
+		verb    string
+		sources []string
+	}{
+		{"created note", result.Created},
+		{"updated note", result.Updated},
+		{"created tag", result.TagsCreated},
+	} {
+		for _, source := range group.sources {
+			_, _ = fmt.Fprintf(c.App.Writer, "%s%s %s\n", prefix, group.verb, source)
+		}
+	}
+
+	_, _ = fmt.Fprintf(c.App.Writer, "%d created, %d updated, %d unchanged, %d tags created, %d links\n",
+		len(result.Created), len(result.Updated), result.Unchanged, len(result.TagsCreated), result.Links)
+}
@@ -8,6 +8,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
 	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
 	"github.com/spf13/viper"
 	"github.com/urfave/cli/v2"
@@ -87,6 +89,21 @@ func getOpts(c *cli.Context) (out configOptsOutput) {
 	return
 }
 
+// getSession returns the session for the options, with the path of its cache database set
+func getSession(opts configOptsOutput) (*cache.Session, error) {
+	session, _, err := cache.GetSession(common.NewHTTPClient(), opts.useSession, opts.sessKey, opts.server, opts.debug)
+	if err != nil {
+		return nil, err
+	}
+
+	session.CacheDBPath, err = cache.GenCacheDBPath(session, opts.cacheDBDir, snAppName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
 func appSetup() (app *cli.App) {
 	viper.SetEnvPrefix("sn")
 	viper.AutomaticEnv()
@@ -130,22 +147,30 @@ func appSetup() (app *cli.App) {
 	app.Commands = []*cli.Command{
 		cmdAdd(),
 		cmdBackup(),
+		cmdDaemon(),
 		cmdDebug(),
 		cmdDelete(),
 		cmdEdit(),
 		cmdExport(),
 		cmdGet(),
 		cmdHealthcheck(),
+		cmdImport(),
 		cmdMigrate(),
+		cmdMirror(),
 		cmdOrganize(),
 		cmdRegister(),
+		cmdRelated(),
 		cmdResync(),
 		cmdSearch(),
+		cmdServe(),
 		cmdSession(),
 		cmdStats(),
 		cmdTask(),
 		cmdTag(),
 		cmdTemplate(),
+		cmdTUI(),
+		cmdView(),
+		cmdWatch(),
 		cmdWipe(),
 	}
 
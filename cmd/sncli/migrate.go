@@ -21,58 +21,74 @@ with intelligent organization and automatic MOC generation.
 
 Supported providers:
   - obsidian: Export to Obsidian vault (markdown + wikilinks)
+  - logseq:   Export to Logseq graph (outliner pages + journals)
+  - joplin:   Export to Joplin RAW export directory (markdown + metadata)
+  - zettel:   Export to plain Zettelkasten (timestamp IDs)
 
 Example:
   sn migrate obsidian --output ./my-vault --moc`,
 		Subcommands: []*cli.Command{
-			{
-				Name:    "obsidian",
-				Aliases: []string{"obs"},
-				Usage:   "migrate to Obsidian vault",
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:     "output",
-						Aliases:  []string{"o"},
-						Usage:    "output directory for Obsidian vault",
-						Required: true,
-					},
-					&cli.BoolFlag{
-						Name:    "moc",
-						Aliases: []string{"m"},
-						Usage:   "generate Maps of Content (MOCs)",
-						Value:   true,
-					},
-					&cli.StringFlag{
-						Name:  "moc-style",
-						Usage: "MOC generation style: flat, hierarchical, para, topic, auto",
-						Value: "flat",
-					},
-					&cli.IntFlag{
-						Name:  "moc-depth",
-						Usage: "maximum MOC hierarchy depth",
-						Value: 2,
-					},
-					&cli.StringFlag{
-						Name:  "tag-filter",
-						Usage: "only export notes with these tags (comma-separated)",
-					},
-					&cli.BoolFlag{
-						Name:  "dry-run",
-						Usage: "preview migration without writing files",
-					},
-				},
-				Action: func(c *cli.Context) error {
-					opts := getOpts(c)
-					return processMigrateObsidian(c, opts)
-				},
+			migrateProviderCommand("obsidian", []string{"obs"}, "Obsidian vault", &cli.StringFlag{
+				Name:  "link-style",
+				Usage: "how links between notes are written: wikilink, markdown, relative",
+				Value: string(sncli.LinkStyleWikilink),
+			}),
+			migrateProviderCommand("logseq", nil, "Logseq graph"),
+			migrateProviderCommand("joplin", nil, "Joplin RAW export directory"),
+			migrateProviderCommand("zettel", []string{"zettelkasten"}, "plain Zettelkasten"),
+		},
+	}
+}
+
+// migrateProviderCommand returns the subcommand for migrating to the provider, which all share flags,
+// along with any of the provider's own
+func migrateProviderCommand(provider string, aliases []string, target string, extra ...cli.Flag) *cli.Command {
+	return &cli.Command{
+		Name:    provider,
+		Aliases: aliases,
+		Usage:   "migrate to " + target,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "output",
+				Aliases:  []string{"o"},
+				Usage:    "output directory for " + target,
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:    "moc",
+				Aliases: []string{"m"},
+				Usage:   "generate Maps of Content (MOCs)",
+				Value:   true,
+			},
+			&cli.StringFlag{
+				Name:  "moc-style",
+				Usage: "MOC generation style: flat, hierarchical, para, topic, auto",
+				Value: "flat",
+			},
+			&cli.IntFlag{
+				Name:  "moc-depth",
+				Usage: "maximum MOC hierarchy depth",
+				Value: 2,
+			},
+			&cli.StringFlag{
+				Name:  "tag-filter",
+				Usage: "only export notes with these tags (comma-separated)",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "preview migration without writing files",
 			},
+		}, extra...),
+		Action: func(c *cli.Context) error {
+			opts := getOpts(c)
+			return processMigrate(c, opts, provider)
 		},
 	}
 }
 
-func processMigrateObsidian(c *cli.Context, opts configOptsOutput) error {
+func processMigrate(c *cli.Context, opts configOptsOutput, provider string) error {
 	// Show migration start
-	pterm.Info.Println("Starting migration to Obsidian...")
+	pterm.Info.Printfln("Starting migration to %s...", migrateProviderNames[provider])
 
 	// Get session
 	session, _, err := cache.GetSession(common.NewHTTPClient(), opts.useSession, opts.sessKey, opts.server, opts.debug)
@@ -96,7 +112,7 @@ func processMigrateObsidian(c *cli.Context, opts configOptsOutput) error {
 	// Create migration config
 	migrateConfig := sncli.MigrateConfig{
 		Session:      &session,
-		Provider:     "obsidian",
+		Provider:     provider,
 		OutputDir:    c.String("output"),
 		GenerateMOCs: c.Bool("moc"),
 		MOCStyle:     sncli.MOCStyle(c.String("moc-style")),
@@ -104,6 +120,7 @@ func processMigrateObsidian(c *cli.Context, opts configOptsOutput) error {
 		TagFilter:    tagFilter,
 		DryRun:       c.Bool("dry-run"),
 		Debug:        opts.debug,
+		LinkStyle:    sncli.LinkStyle(c.String("link-style")),
 	}
 
 	// Show progress
@@ -126,12 +143,20 @@ func processMigrateObsidian(c *cli.Context, opts configOptsOutput) error {
 	}
 
 	// Display results
-	displayMigrationResults(c, result)
+	displayMigrationResults(c, provider, result)
 
 	return nil
 }
 
-func displayMigrationResults(c *cli.Context, result *sncli.MigrationResult) {
+// migrateProviderNames are the names of the applications migrated to, for messages
+var migrateProviderNames = map[string]string{
+	"obsidian": "Obsidian",
+	"logseq":   "Logseq",
+	"joplin":   "Joplin",
+	"zettel":   "Zettelkasten",
+}
+
+func displayMigrationResults(c *cli.Context, provider string, result *sncli.MigrationResult) {
 	pterm.Println()
 	pterm.Success.Println("Migration completed successfully!")
 	pterm.Println()
@@ -146,8 +171,16 @@ func displayMigrationResults(c *cli.Context, result *sncli.MigrationResult) {
 		{"Output Path", result.OutputPath},
 	}
 
+	if result.MOCStyle != "" {
+		tableData = append(tableData, []string{"MOC Style", string(result.MOCStyle)})
+	}
+
 	pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
 
+	if result.MOCStyleReason != "" {
+		pterm.Info.Printfln("Chose %s MOCs as %s", result.MOCStyle, result.MOCStyleReason)
+	}
+
 	// Show warnings if any
 	if len(result.Warnings) > 0 {
 		pterm.Println()
@@ -169,12 +202,27 @@ func displayMigrationResults(c *cli.Context, result *sncli.MigrationResult) {
 	// Show next steps
 	if !c.Bool("dry-run") {
 		pterm.Println()
-		pterm.Info.Printfln("Your Obsidian vault is ready at: %s", color.Cyan.Sprint(result.OutputPath))
+		pterm.Info.Printfln("Your %s export is ready at: %s", migrateProviderNames[provider], color.Cyan.Sprint(result.OutputPath))
 		pterm.Info.Println("Next steps:")
-		fmt.Fprintf(c.App.Writer, "  1. Open Obsidian\n")
-		fmt.Fprintf(c.App.Writer, "  2. Click 'Open folder as vault'\n")
-		fmt.Fprintf(c.App.Writer, "  3. Select: %s\n", result.OutputPath)
-		fmt.Fprintf(c.App.Writer, "  4. Start exploring your notes!\n")
+
+		switch provider {
+		case "obsidian":
+			fmt.Fprintf(c.App.Writer, "  1. Open Obsidian\n")
+			fmt.Fprintf(c.App.Writer, "  2. Click 'Open folder as vault'\n")
+			fmt.Fprintf(c.App.Writer, "  3. Select: %s\n", result.OutputPath)
+		case "logseq":
+			fmt.Fprintf(c.App.Writer, "  1. Open Logseq\n")
+			fmt.Fprintf(c.App.Writer, "  2. Choose 'Add a graph' and then 'Choose a folder'\n")
+			fmt.Fprintf(c.App.Writer, "  3. Select: %s\n", result.OutputPath)
+		case "joplin":
+			fmt.Fprintf(c.App.Writer, "  1. Open Joplin\n")
+			fmt.Fprintf(c.App.Writer, "  2. Choose File > Import > RAW - Joplin Export Directory\n")
+			fmt.Fprintf(c.App.Writer, "  3. Select: %s\n", result.OutputPath)
+		default:
+			fmt.Fprintf(c.App.Writer, "  1. Open %s in your Zettelkasten app, such as Zettlr or The Archive\n", result.OutputPath)
+		}
+
+		fmt.Fprintf(c.App.Writer, "  Then start exploring your notes!\n")
 	}
 
 	pterm.Println()
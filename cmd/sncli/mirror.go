@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gookit/color"
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
+	"github.com/urfave/cli/v2"
+)
+
+func cmdMirror() *cli.Command {
+	return &cli.Command{
+		Name:  "mirror",
+		Usage: "keep a directory of Markdown files in two-way sync with your notes",
+		Description: `Each note is a Markdown file with YAML frontmatter holding its title, uuid and tags.
+Files created or edited locally are pushed, notes created or edited in the account are
+pulled, and deleting a file moves its note to the trash. Where both sides changed, the
+account's version is written and the local one kept in a .conflict- file next to it.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "dir",
+				Usage:    "directory to mirror notes in",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "tag-folders",
+				Usage: "place notes in folders named after their first tag, and tag notes moved into a folder",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "show what would change without changing anything",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return processMirror(c, getOpts(c))
+		},
+	}
+}
+
+func processMirror(c *cli.Context, opts configOptsOutput) error {
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	m := sncli.MirrorConfig{
+		Session:    session,
+		Dir:        c.String("dir"),
+		TagFolders: c.Bool("tag-folders"),
+		DryRun:     c.Bool("dry-run"),
+	}
+
+	result, err := m.Run()
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if m.DryRun {
+		prefix = "would have "
+	}
+
+	for _, group := range []struct {
+		verb  string
+		paths []string
+	}{
+		{"pushed", result.Pushed},
+		{"pulled", result.Pulled},
+		{"trashed", result.Trashed},
+		{"removed", result.Removed},
+	} {
+		for _, path := range group.paths {
+			_, _ = fmt.Fprintf(c.App.Writer, "%s%s %s\n", prefix, group.verb, path)
+		}
+	}
+
+	for _, path := range result.Conflicts {
+		_, _ = fmt.Fprintln(c.App.Writer, color.Yellow.Sprintf("%sconflict: local changes kept in %s", prefix, path))
+	}
+
+	total := len(result.Pushed) + len(result.Pulled) + len(result.Trashed) + len(result.Removed)
+	if total == 0 && len(result.Conflicts) == 0 {
+		_, _ = fmt.Fprintln(c.App.Writer, "up to date")
+
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(c.App.Writer, "%d changed, %d conflicts\n", total, len(result.Conflicts))
+
+	return nil
+}
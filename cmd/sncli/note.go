@@ -38,7 +38,7 @@ func getNoteByUUID(sess cache.Session, uuid string) (tag items.Note, err error)
 		Close:   false,
 	}
 
-	so, err = cache.Sync(si)
+	so, err = sncli.SyncCache(si)
 	if err != nil {
 		return
 	}
@@ -73,7 +73,7 @@ func getNotesByTitle(sess cache.Session, title string, close bool) (notes items.
 			Close:   false,
 		}
 
-		so, err = cache.Sync(si)
+		so, err = sncli.SyncCache(si)
 		if err != nil {
 			return
 		}
@@ -206,7 +206,7 @@ func processEditNote(c *cli.Context, opts configOptsOutput) (err error) {
 
 	var cso cache.SyncOutput
 
-	cso, err = cache.Sync(si)
+	cso, err = sncli.SyncCache(si)
 	if err != nil {
 		return
 	}
@@ -275,7 +275,7 @@ func processEditNote(c *cli.Context, opts configOptsOutput) (err error) {
 	}
 
 	si.Close = false
-	if _, err = cache.Sync(si); err != nil {
+	if _, err = sncli.SyncCache(si); err != nil {
 		return
 	}
 
@@ -396,6 +396,7 @@ func processGetNotes(c *cli.Context, opts configOptsOutput) (err error) {
 	getNoteConfig := sncli.GetNoteConfig{
 		Session: &session,
 		Filters: getNotesIF,
+		Offline: c.Bool("offline"),
 		Debug:   opts.debug,
 	}
 
@@ -571,42 +572,7 @@ func outputNotes(c *cli.Context, count bool, output string, getNoteConfig sncli.
 		}
 
 		if strings.ToLower(output) == "json" {
-			noteContentOrgStandardNotesSNDetailJSON := sncli.OrgStandardNotesSNDetailJSON{
-				ClientUpdatedAt:    rt.(*items.Note).Content.GetAppData().OrgStandardNotesSN.ClientUpdatedAt,
-				Pinned:             rt.(*items.Note).Content.GetAppData().OrgStandardNotesSN.Pinned,
-				PrefersPlainEditor: rt.(*items.Note).Content.GetAppData().OrgStandardNotesSN.PrefersPlainEditor,
-			}
-
-			noteContentAppDataContent := sncli.AppDataContentJSON{
-				OrgStandardNotesSN:           noteContentOrgStandardNotesSNDetailJSON,
-				OrgStandardNotesSNComponents: rt.(*items.Note).Content.GetAppData().OrgStandardNotesSNComponents,
-			}
-			var isTrashed *bool
-			if rt.(*items.Note).Content.Trashed != nil {
-				isTrashed = rt.(*items.Note).Content.Trashed
-			}
-
-			nc := rt.(*items.Note).Content
-
-			noteContentJSON := sncli.NoteContentJSON{
-				Title:            rt.(*items.Note).Content.GetTitle(),
-				Text:             rt.(*items.Note).Content.GetText(),
-				ItemReferences:   sncli.ItemRefsToJSON(rt.(*items.Note).Content.References()),
-				AppData:          noteContentAppDataContent,
-				EditorIdentifier: nc.EditorIdentifier,
-				PreviewPlain:     nc.PreviewPlain,
-				PreviewHtml:      nc.PreviewHtml,
-				Spellcheck:       nc.Spellcheck,
-				Trashed:          isTrashed,
-			}
-
-			notesJSON = append(notesJSON, sncli.NoteJSON{
-				UUID:        rt.(*items.Note).UUID,
-				ContentType: rt.(*items.Note).ContentType,
-				Content:     noteContentJSON,
-				UpdatedAt:   rt.(*items.Note).UpdatedAt,
-				CreatedAt:   rt.(*items.Note).CreatedAt,
-			})
+			notesJSON = append(notesJSON, sncli.NoteToJSON(rt.(*items.Note)))
 		}
 	}
 
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/gookit/color"
+	"github.com/jonhadfield/gosn-v2/items"
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
+	"github.com/pterm/pterm"
+	"github.com/urfave/cli/v2"
+)
+
+const defaultRelatedLimit = 10
+
+// embedderFlags select the embedder used to compare notes
+func embedderFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "embed-url",
+			Usage:   "compare notes using a local embedding model served with the Ollama embed API, e.g. http://localhost:11434/api/embed, instead of TF-IDF",
+			EnvVars: []string{"SN_EMBED_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "embed-model",
+			Usage:   "model to request from --embed-url",
+			Value:   "nomic-embed-text",
+			EnvVars: []string{"SN_EMBED_MODEL"},
+		},
+	}
+}
+
+func cmdRelated() *cli.Command {
+	return &cli.Command{
+		Name:      "related",
+		Usage:     "list the notes most similar to a note",
+		ArgsUsage: "<uuid>",
+		Flags: append([]cli.Flag{
+			&cli.IntFlag{
+				Name:    "limit",
+				Aliases: []string{"l"},
+				Usage:   "maximum number of results",
+				Value:   defaultRelatedLimit,
+			},
+			&cli.StringFlag{
+				Name:  "tag",
+				Usage: "only include notes with any of these tags (comma separated)",
+			},
+			&cli.BoolFlag{
+				Name:  "include-trash",
+				Usage: "include notes in the trash",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Value: "table",
+				Usage: "output format (table, json)",
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "use the local cache without syncing",
+			},
+		}, embedderFlags()...),
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return fmt.Errorf("specify the uuid of the note to find related notes for")
+			}
+
+			return processSimilar(c, getOpts(c), c.Args().First())
+		},
+	}
+}
+
+// processSimilar shows the notes most similar to the note with the uuid, for both related and search --similar-to
+func processSimilar(c *cli.Context, opts configOptsOutput, uuid string) error {
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	similarConfig := sncli.SimilarConfig{
+		Session:      session,
+		UUID:         uuid,
+		Tags:         sncli.CommaSplit(c.String("tag")),
+		IncludeTrash: c.Bool("include-trash"),
+		Limit:        c.Int("limit"),
+		Offline:      c.Bool("offline"),
+		Debug:        opts.debug,
+	}
+
+	if url := c.String("embed-url"); url != "" {
+		similarConfig.Embedder = &sncli.HTTPEmbedder{URL: url, Model: c.String("embed-model")}
+	}
+
+	note, matches, err := similarConfig.Run()
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("files-with-matches") {
+		notes := make([]*items.Note, 0, len(matches))
+		for _, m := range matches {
+			notes = append(notes, m.Note)
+		}
+
+		printFilesWithMatches(c.App.Writer, notes, c.Bool("uuids"))
+
+		return nil
+	}
+
+	if c.String("output") == "json" {
+		return printSimilarJSON(c.App.Writer, matches)
+	}
+
+	if len(matches) == 0 {
+		pterm.Info.Printf("No notes similar to %q found\n", note.Content.GetTitle())
+
+		return nil
+	}
+
+	return displaySimilarNotes(note, matches)
+}
+
+// printSimilarJSON prints the similar notes with their similarity, most similar first
+func printSimilarJSON(w io.Writer, matches []sncli.SearchMatch) error {
+	type similarJSON struct {
+		UUID       string  `json:"uuid"`
+		Title      string  `json:"title"`
+		Similarity float64 `json:"similarity"`
+	}
+
+	out := make([]similarJSON, 0, len(matches))
+	for _, m := range matches {
+		out = append(out, similarJSON{UUID: m.Note.UUID, Title: m.Note.Content.GetTitle(), Similarity: m.Score})
+	}
+
+	data, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(w, string(data))
+
+	return nil
+}
+
+// displaySimilarNotes shows the similar notes in a table
+func displaySimilarNotes(note *items.Note, matches []sncli.SearchMatch) error {
+	pterm.DefaultSection.Printf("Notes similar to \"%s\"", note.Content.GetTitle())
+	pterm.Println()
+
+	tableData := [][]string{
+		{color.Cyan.Sprint("#"), color.Cyan.Sprint("Title"), color.Cyan.Sprint("Similarity"), color.Cyan.Sprint("UUID")},
+	}
+
+	for i, m := range matches {
+		tableData = append(tableData, []string{
+			color.Gray.Sprint(fmt.Sprintf("%d", i+1)),
+			truncateTitle(m.Note.Content.GetTitle(), 35),
+			fmt.Sprintf("%.0f%%", m.Score*100),
+			color.Gray.Sprint(m.Note.UUID),
+		})
+	}
+
+	return pterm.DefaultTable.WithHasHeader(true).
+		WithHeaderStyle(pterm.NewStyle(pterm.FgLightCyan, pterm.Bold)).
+		WithData(tableData).
+		WithBoxed(true).
+		Render()
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"regexp"
 	"strings"
 
 	"github.com/gookit/color"
@@ -19,12 +22,42 @@ func cmdSearch() *cli.Command {
 		Name:    "search",
 		Usage:   "search notes by title and content",
 		Aliases: []string{"find"},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
-				Name:     "query",
-				Aliases:  []string{"q"},
-				Usage:    "search query",
-				Required: true,
+				Name:    "query",
+				Aliases: []string{"q"},
+				Usage:   `search query, e.g. title:"standup" AND tag:work -tag:archive updated:>2026-01-01 pinned:true "exact phrase"`,
+			},
+			&cli.StringFlag{
+				Name:  "regex",
+				Usage: "print the lines of note text matching a regular expression, like grep -n (--query then only selects the notes to search)",
+			},
+			&cli.IntFlag{
+				Name:    "context",
+				Aliases: []string{"C"},
+				Usage:   "with --regex, print this many lines of context around each match",
+			},
+			&cli.IntFlag{
+				Name:    "before-context",
+				Aliases: []string{"B"},
+				Usage:   "with --regex, print this many lines of context before each match",
+			},
+			&cli.IntFlag{
+				Name:    "after-context",
+				Aliases: []string{"A"},
+				Usage:   "with --regex, print this many lines of context after each match",
+			},
+			&cli.StringFlag{
+				Name:  "similar-to",
+				Usage: "rank notes by similarity to the note with this uuid, like related",
+			},
+			&cli.BoolFlag{
+				Name:  "files-with-matches",
+				Usage: "print only the titles of matching notes, one per line",
+			},
+			&cli.BoolFlag{
+				Name:  "uuids",
+				Usage: "with --files-with-matches, print note uuids instead of titles",
 			},
 			&cli.BoolFlag{
 				Name:    "content",
@@ -58,9 +91,9 @@ func cmdSearch() *cli.Command {
 			},
 			&cli.BoolFlag{
 				Name:  "offline",
-				Usage: "search offline without syncing (faster, uses cached data)",
+				Usage: "search the local cache without syncing",
 			},
-		},
+		}, embedderFlags()...),
 		Action: func(c *cli.Context) error {
 			return processSearch(c, getOpts(c))
 		},
@@ -69,8 +102,23 @@ func cmdSearch() *cli.Command {
 
 func processSearch(c *cli.Context, opts configOptsOutput) error {
 	query := c.String("query")
-	if query == "" {
-		return fmt.Errorf("search query is required")
+
+	if uuid := c.String("similar-to"); uuid != "" {
+		if query != "" || c.String("regex") != "" {
+			return fmt.Errorf("--similar-to cannot be combined with --query or --regex")
+		}
+
+		return processSimilar(c, opts, uuid)
+	}
+
+	if query == "" && c.String("regex") == "" {
+		return fmt.Errorf("search query, --regex or --similar-to is required")
+	}
+
+	// check the query before syncing
+	searchQuery, err := sncli.ParseSearchQuery(query)
+	if err != nil {
+		return queryError(query, err)
 	}
 
 	// Get session
@@ -84,64 +132,40 @@ func processSearch(c *cli.Context, opts configOptsOutput) error {
 		return err
 	}
 
-	// Build filters for notes
-	noteFilter := items.Filter{
-		Type: common.SNItemTypeNote,
+	if c.String("regex") != "" {
+		return processGrep(c, opts, &session, query)
 	}
 
-	filters := []items.Filter{noteFilter}
-
-	// Add tag filter if specified
-	if c.String("tag") != "" {
-		tagFilter := items.Filter{
-			Type:       common.SNItemTypeNote,
-			Key:        common.SNItemTypeTag,
-			Comparison: "contains",
-			Value:      c.String("tag"),
-		}
-		filters = append(filters, tagFilter)
-	}
-
-	// Don't include trash by default
-	trashFilter := items.Filter{
-		Type:       common.SNItemTypeNote,
-		Key:        "Trash",
-		Comparison: "!=",
-		Value:      "true",
-	}
-	filters = append(filters, trashFilter)
-
-	// GetNoteConfig.Run() handles syncing internally
-	getNoteConfig := sncli.GetNoteConfig{
-		Session: &session,
-		Filters: items.ItemFilters{
-			MatchAny: false,
-			Filters:  filters,
-		},
-		Debug: opts.debug,
-	}
+	var results []SearchResult
 
-	// Get notes (this will sync automatically unless offline flag is used)
-	offline := c.Bool("offline")
-	if offline {
-		pterm.Info.Println("Searching offline (cached data)")
-		// TODO: Add offline support to GetNoteConfig
+	// fuzzy, case-sensitive and title only matching need the note text, so scan every note
+	if c.Bool("fuzzy") || c.Bool("case-sensitive") || !c.Bool("content") {
+		results, err = scanNotes(c, opts, &session, query, searchQuery.Text)
+	} else {
+		results, err = searchIndex(c, opts, &session, query, searchQuery.Text)
 	}
 
-	rawNotes, err := getNoteConfig.Run()
 	if err != nil {
 		return err
 	}
 
-	// Perform search
-	results := searchNotes(rawNotes, query, c.Bool("content"), c.Bool("fuzzy"), c.Bool("case-sensitive"))
-
 	// Apply limit if specified
 	limit := c.Int("limit")
 	if limit > 0 && len(results) > limit {
 		results = results[:limit]
 	}
 
+	if c.Bool("files-with-matches") {
+		notes := make([]*items.Note, 0, len(results))
+		for _, r := range results {
+			notes = append(notes, r.Note)
+		}
+
+		printFilesWithMatches(c.App.Writer, notes, c.Bool("uuids"))
+
+		return nil
+	}
+
 	// Display results
 	if len(results) == 0 {
 		pterm.Info.Println("No matches found")
@@ -169,10 +193,96 @@ func processSearch(c *cli.Context, opts configOptsOutput) error {
 	}
 }
 
+// queryError shows where a query couldn't be parsed
+func queryError(query string, err error) error {
+	var qe *sncli.QueryError
+	if !errors.As(err, &qe) {
+		return err
+	}
+
+	return fmt.Errorf("%w\n  %s\n  %s^", err, query, strings.Repeat(" ", qe.Pos))
+}
+
+// searchIndex ranks notes using the search index, which is created on first use
+func searchIndex(c *cli.Context, opts configOptsOutput, session *cache.Session, query, text string) ([]SearchResult, error) {
+	searchConfig := sncli.SearchConfig{
+		Session: session,
+		Query:   query,
+		Tags:    sncli.CommaSplit(c.String("tag")),
+		Limit:   c.Int("limit"),
+		Offline: c.Bool("offline"),
+		Debug:   opts.debug,
+	}
+
+	if searchConfig.Offline && !c.Bool("files-with-matches") {
+		pterm.Info.Println("Searching offline (cached data)")
+	}
+
+	matches, err := searchConfig.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(matches))
+
+	for _, m := range matches {
+		results = append(results, SearchResult{
+			Note:         m.Note,
+			Score:        m.Score,
+			MatchInTitle: m.InTitle,
+			MatchInBody:  m.InBody,
+			Preview:      generateSearchPreview(m.Note.Content.GetText(), text, false),
+		})
+	}
+
+	return results, nil
+}
+
+// scanNotes matches the query's free text against every note matching the rest of the query
+func scanNotes(c *cli.Context, opts configOptsOutput, session *cache.Session, query, text string) ([]SearchResult, error) {
+	searchConfig := sncli.SearchConfig{
+		Session: session,
+		Query:   query,
+		Tags:    sncli.CommaSplit(c.String("tag")),
+		Offline: c.Bool("offline"),
+		Scan:    true,
+		Debug:   opts.debug,
+	}
+
+	if searchConfig.Offline && !c.Bool("files-with-matches") {
+		pterm.Info.Println("Searching offline (cached data)")
+	}
+
+	matches, err := searchConfig.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	// only fields and operators were given, so every note left is a match
+	if text == "" {
+		results := make([]SearchResult, 0, len(matches))
+		for _, m := range matches {
+			results = append(results, SearchResult{
+				Note:    m.Note,
+				Preview: generateSearchPreview(m.Note.Content.GetText(), "", false),
+			})
+		}
+
+		return results, nil
+	}
+
+	notes := make(items.Items, 0, len(matches))
+	for _, m := range matches {
+		notes = append(notes, m.Note)
+	}
+
+	return searchNotes(notes, text, c.Bool("content"), c.Bool("fuzzy"), c.Bool("case-sensitive")), nil
+}
+
 // SearchResult represents a search match
 type SearchResult struct {
 	Note         *items.Note
-	Score        int
+	Score        float64
 	MatchInTitle bool
 	MatchInBody  bool
 	Preview      string
@@ -200,7 +310,7 @@ func searchNotes(notes items.Items, query string, searchContent bool, fuzzyMatch
 		}
 
 		var matchInTitle, matchInBody bool
-		var score int
+		var score float64
 
 		if fuzzyMatch {
 			// Fuzzy matching using fuzzy.Find
@@ -349,3 +459,129 @@ func outputNotesFormat(c *cli.Context, notes items.Items, format string) error {
 	fmt.Printf("Found %d notes (format: %s)\n", len(notes), format)
 	return nil
 }
+
+// processGrep prints the lines of note text matching --regex, like grep -n, from the notes matching the query
+func processGrep(c *cli.Context, opts configOptsOutput, session *cache.Session, query string) error {
+	pattern := c.String("regex")
+	if !c.Bool("case-sensitive") {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regex: %w", err)
+	}
+
+	searchQuery, err := sncli.ParseSearchQuery(query)
+	if err != nil {
+		return queryError(query, err)
+	}
+
+	// free text in the query is matched with the index, otherwise every note matching the query is searched
+	searchConfig := sncli.SearchConfig{
+		Session: session,
+		Query:   query,
+		Tags:    sncli.CommaSplit(c.String("tag")),
+		Offline: c.Bool("offline"),
+		Scan:    searchQuery.Text == "",
+		Debug:   opts.debug,
+	}
+
+	matches, err := searchConfig.Run()
+	if err != nil {
+		return err
+	}
+
+	before, after := c.Int("context"), c.Int("context")
+	if c.IsSet("before-context") {
+		before = c.Int("before-context")
+	}
+
+	if c.IsSet("after-context") {
+		after = c.Int("after-context")
+	}
+
+	var matched []*items.Note
+
+	var lines []string
+
+	for _, m := range matches {
+		groups := sncli.GrepText(m.Note.Content.GetText(), re, before, after)
+		if len(groups) == 0 {
+			continue
+		}
+
+		matched = append(matched, m.Note)
+		lines = append(lines, formatGrepGroups(m.Note.Content.GetTitle(), groups, before > 0 || after > 0, len(lines) > 0)...)
+
+		if limit := c.Int("limit"); limit > 0 && len(matched) == limit {
+			break
+		}
+	}
+
+	if c.Bool("files-with-matches") {
+		printFilesWithMatches(c.App.Writer, matched, c.Bool("uuids"))
+
+		return nil
+	}
+
+	for _, line := range lines {
+		_, _ = fmt.Fprintln(c.App.Writer, line)
+	}
+
+	return nil
+}
+
+// formatGrepGroups formats a note's matching lines as grep -n does, with the note title in place of the
+// file name: title:line:text for matches and title-line-text for context. With context, groups of lines
+// are separated by --, including from the groups of earlier notes.
+func formatGrepGroups(title string, groups [][]sncli.GrepLine, withContext, afterEarlierNote bool) []string {
+	var lines []string
+
+	for x, group := range groups {
+		if withContext && (x > 0 || afterEarlierNote) {
+			lines = append(lines, color.Cyan.Sprint("--"))
+		}
+
+		for _, line := range group {
+			sep, text := "-", line.Text
+
+			if len(line.Matches) > 0 {
+				sep, text = ":", highlightMatches(line.Text, line.Matches)
+			}
+
+			lines = append(lines, color.Magenta.Sprint(title)+color.Cyan.Sprint(sep)+
+				color.Green.Sprint(line.Number)+color.Cyan.Sprint(sep)+text)
+		}
+	}
+
+	return lines
+}
+
+// highlightMatches colours the matched parts of a line
+func highlightMatches(line string, matches [][]int) string {
+	var sb strings.Builder
+
+	last := 0
+
+	for _, m := range matches {
+		sb.WriteString(line[last:m[0]])
+		sb.WriteString(color.Style{color.FgRed, color.OpBold}.Sprint(line[m[0]:m[1]]))
+		last = m[1]
+	}
+
+	sb.WriteString(line[last:])
+
+	return sb.String()
+}
+
+// printFilesWithMatches prints the title, or uuid, of each note one per line, for piping to other commands
+func printFilesWithMatches(w io.Writer, notes []*items.Note, uuids bool) {
+	for _, note := range notes {
+		if uuids {
+			_, _ = fmt.Fprintln(w, note.UUID)
+		} else {
+			_, _ = fmt.Fprintln(w, note.Content.GetTitle())
+		}
+	}
+}
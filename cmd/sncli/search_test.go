@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/gookit/color"
 	"github.com/jonhadfield/gosn-v2/items"
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -214,3 +217,50 @@ func TestTruncateString(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatGrepGroups(t *testing.T) {
+	groups := [][]sncli.GrepLine{
+		{
+			{Number: 1, Text: "before"},
+			{Number: 2, Text: "a TODO(alice) here", Matches: [][]int{{2, 13}}},
+		},
+		{
+			{Number: 9, Text: "TODO(bob)", Matches: [][]int{{0, 9}}},
+		},
+	}
+
+	plain := func(lines []string) []string {
+		for x := range lines {
+			lines[x] = color.ClearCode(lines[x])
+		}
+
+		return lines
+	}
+
+	assert.Equal(t, []string{
+		"Standup-1-before",
+		"Standup:2:a TODO(alice) here",
+		"--",
+		"Standup:9:TODO(bob)",
+	}, plain(formatGrepGroups("Standup", groups, true, false)))
+
+	// without context there are no separators, but notes after the first are separated when there is
+	assert.Equal(t, []string{"Plan:9:TODO(bob)"}, plain(formatGrepGroups("Plan", groups[1:], false, true)))
+	assert.Equal(t, []string{"--", "Plan:9:TODO(bob)"}, plain(formatGrepGroups("Plan", groups[1:], true, true)))
+
+	highlighted := highlightMatches("a TODO(alice) here", [][]int{{2, 13}})
+	assert.Equal(t, "a TODO(alice) here", color.ClearCode(highlighted))
+}
+
+func TestPrintFilesWithMatches(t *testing.T) {
+	note1, _ := items.NewNote("First", "TODO", nil)
+	note2, _ := items.NewNote("Second", "TODO", nil)
+
+	var buf bytes.Buffer
+	printFilesWithMatches(&buf, []*items.Note{&note1, &note2}, false)
+	assert.Equal(t, "First\nSecond\n", buf.String())
+
+	buf.Reset()
+	printFilesWithMatches(&buf, []*items.Note{&note1, &note2}, true)
+	assert.Equal(t, note1.UUID+"\n"+note2.UUID+"\n", buf.String())
+}
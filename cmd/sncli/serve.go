@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gookit/color"
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
+	"github.com/urfave/cli/v2"
+)
+
+func cmdServe() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "serve a REST API for notes, tags and checklists",
+		Description: `Requests need an "Authorization: Bearer <token>" header. A token is generated and
+printed at startup unless one is given. The OpenAPI document is at /openapi.json.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "listen",
+				Value: sncli.DefaultServerListen,
+				Usage: "address to listen on",
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "bearer token required by requests",
+				EnvVars: []string{"SN_API_TOKEN"},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return processServe(c, getOpts(c))
+		},
+	}
+}
+
+func processServe(c *cli.Context, opts configOptsOutput) error {
+	listen := c.String("listen")
+
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", listen, err)
+	}
+
+	token := c.String("token")
+	if token == "" {
+		if token, err = sncli.GenerateAPIToken(); err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "token: %s\n", token)
+	}
+
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		_, _ = fmt.Fprintln(os.Stderr, color.Yellow.Sprint("warning: the API is served over plain HTTP and is reachable from other hosts"))
+	}
+
+	server := sncli.NewServer(sncli.SessionStore{Session: session}, token).HTTPServer(listen)
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	_, _ = fmt.Fprintf(c.App.Writer, "listening on http://%s\n", listen)
+
+	select {
+	case err = <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	// let requests finish syncing their changes
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err = server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
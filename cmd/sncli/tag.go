@@ -34,7 +34,7 @@ func getTagByUUID(sess *cache.Session, uuid string) (tag items.Tag, err error) {
 		Close:   false,
 	}
 
-	so, err = cache.Sync(si)
+	so, err = sncli.SyncCache(si)
 	if err != nil {
 		return
 	}
@@ -68,7 +68,7 @@ func getTagsByTitle(sess cache.Session, title string) (tags items.Tags, err erro
 		Close:   false,
 	}
 
-	so, err = cache.Sync(si)
+	so, err = sncli.SyncCache(si)
 	if err != nil {
 		return
 	}
@@ -185,7 +185,7 @@ func processEditTag(c *cli.Context, opts configOptsOutput) (err error) {
 
 	var so cache.SyncOutput
 
-	so, err = cache.Sync(si)
+	so, err = sncli.SyncCache(si)
 	if err != nil {
 		return
 	}
@@ -196,7 +196,7 @@ func processEditTag(c *cli.Context, opts configOptsOutput) (err error) {
 		return
 	}
 
-	if _, err = cache.Sync(si); err != nil {
+	if _, err = sncli.SyncCache(si); err != nil {
 		return
 	}
 
@@ -280,6 +280,7 @@ func processGetTags(c *cli.Context, opts configOptsOutput) (err error) {
 		Session: &sess,
 		Filters: getTagsIF,
 		Output:  output,
+		Offline: c.Bool("offline"),
 		Debug:   opts.debug,
 	}
 
@@ -332,26 +333,7 @@ func processGetTags(c *cli.Context, opts configOptsOutput) (err error) {
 		}
 
 		if !count && strings.ToLower(output) == "json" {
-			tagContentOrgStandardNotesSNDetailJSON := sncli.OrgStandardNotesSNDetailJSON{
-				ClientUpdatedAt: rt.(*items.Tag).Content.GetAppData().OrgStandardNotesSN.ClientUpdatedAt,
-			}
-			tagContentAppDataContent := sncli.AppDataContentJSON{
-				OrgStandardNotesSN: tagContentOrgStandardNotesSNDetailJSON,
-			}
-
-			tagContentJSON := sncli.TagContentJSON{
-				Title:          rt.(*items.Tag).Content.GetTitle(),
-				ItemReferences: sncli.ItemRefsToJSON(rt.(*items.Tag).Content.References()),
-				AppData:        tagContentAppDataContent,
-			}
-
-			tagsJSON = append(tagsJSON, sncli.TagJSON{
-				UUID:        rt.(*items.Tag).UUID,
-				ContentType: rt.(*items.Tag).ContentType,
-				Content:     tagContentJSON,
-				UpdatedAt:   rt.(*items.Tag).UpdatedAt,
-				CreatedAt:   rt.(*items.Tag).CreatedAt,
-			})
+			tagsJSON = append(tagsJSON, sncli.TagToJSON(rt.(*items.Tag)))
 		}
 	}
 	// if !opts.useStdOut {
@@ -6,12 +6,11 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/asdine/storm/v3"
 	"github.com/gookit/color"
 	"github.com/jonhadfield/gosn-v2/cache"
 	"github.com/jonhadfield/gosn-v2/common"
 	"github.com/jonhadfield/gosn-v2/items"
-	"github.com/jonhadfield/gosn-v2/session"
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
 	"github.com/pterm/pterm"
 )
 
@@ -23,7 +22,7 @@ type TagStats struct {
 	CreatedAt string
 }
 
-// getItemsViaSync uses cache.Sync to properly load items, handling network errors gracefully
+// getItemsViaSync syncs to properly load items, handling network errors gracefully
 func getItemsViaSync(session *cache.Session, debug bool) (items.Items, items.Items, error) {
 	// Sync to load items from cache (and server if available)
 	si := cache.SyncInput{
@@ -31,7 +30,7 @@ func getItemsViaSync(session *cache.Session, debug bool) (items.Items, items.Ite
 		Close:   false,
 	}
 
-	so, syncErr := cache.Sync(si)
+	so, syncErr := sncli.SyncCache(si)
 
 	// Check if we got a database connection even if sync failed
 	if so.DB == nil {
@@ -82,38 +81,9 @@ func getItemsViaSync(session *cache.Session, debug bool) (items.Items, items.Ite
 
 // getItemsFromCache reads tags and notes directly from cache without syncing
 func getItemsFromCache(session *cache.Session, debug bool) (items.Items, items.Items, error) {
-	// Open cache database directly
-	cacheDB, err := storm.Open(session.CacheDBPath)
+	allItems, err := sncli.LoadCachedItems(session)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open cache database: %w (have you run a sync recently?)", err)
-	}
-	defer cacheDB.Close()
-
-	// Get all cached items
-	var allPersistedItems cache.Items
-	if err = cacheDB.All(&allPersistedItems); err != nil {
-		return nil, nil, fmt.Errorf("failed to read cached items: %w", err)
-	}
-
-	if len(allPersistedItems) == 0 {
-		// No cached data - need to sync first
-		return nil, nil, fmt.Errorf("no cached data found - please run 'sncli get note' first to populate cache")
-	}
-
-	// Load items keys from cache (mimics cache.Sync behavior)
-	cachedKeys, err := retrieveItemsKeysFromCache(session.Session, allPersistedItems)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to retrieve items keys from cache: %w", err)
-	}
-
-	if err = processCachedItemsKeys(session, cachedKeys); err != nil {
-		return nil, nil, fmt.Errorf("failed to process cached items keys: %w", err)
-	}
-
-	// Convert to items (session now has keys)
-	allItems, err := allPersistedItems.ToItems(session)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to convert cached items: %w", err)
+		return nil, nil, err
 	}
 
 	// Separate tags and notes
@@ -149,105 +119,6 @@ func getItemsFromCache(session *cache.Session, debug bool) (items.Items, items.I
 	return tags, notes, nil
 }
 
-// retrieveItemsKeysFromCache gets items keys from cached items (from gosn-v2/cache)
-func retrieveItemsKeysFromCache(s *session.Session, cachedItems cache.Items) (items.EncryptedItems, error) {
-	var itemsKeys items.EncryptedItems
-
-	for _, ci := range cachedItems {
-		if ci.ContentType == common.SNItemTypeItemsKey && !ci.Deleted {
-			itemsKeys = append(itemsKeys, items.EncryptedItem{
-				UUID:        ci.UUID,
-				Content:     ci.Content,
-				ContentType: ci.ContentType,
-				ItemsKeyID:  ci.ItemsKeyID,
-				EncItemKey:  ci.EncItemKey,
-			})
-		}
-	}
-
-	return itemsKeys, nil
-}
-
-// processCachedItemsKeys processes items keys and adds to session (from gosn-v2/cache)
-func processCachedItemsKeys(cs *cache.Session, eiks items.EncryptedItems) error {
-	if len(eiks) == 0 {
-		return nil
-	}
-
-	// Decrypt and parse items keys
-	iks, err := items.DecryptAndParseItemKeys(cs.MasterKey, eiks)
-	if err != nil {
-		return err
-	}
-
-	// Convert to session items keys
-	var syncedItemsKeys []session.SessionItemsKey
-	for x := range iks {
-		syncedItemsKeys = append(syncedItemsKeys, session.SessionItemsKey{
-			UUID:               iks[x].UUID,
-			ItemsKey:           iks[x].ItemsKey,
-			Default:            iks[x].Default,
-			UpdatedAtTimestamp: iks[x].UpdatedAtTimestamp,
-			CreatedAtTimestamp: iks[x].CreatedAtTimestamp,
-		})
-	}
-
-	// Merge with existing items keys in session
-	cs.Session.ItemsKeys = mergeItemsKeysSlices(cs.Session.ItemsKeys, syncedItemsKeys)
-
-	// Set default items key using Standard Notes priority logic:
-	// 1. Prioritize keys marked as default
-	// 2. Fall back to most recent by timestamp
-	var defaultItemsKey session.SessionItemsKey
-	var latestItemsKey session.SessionItemsKey
-
-	for x := range cs.Session.ItemsKeys {
-		key := cs.Session.ItemsKeys[x]
-
-		// Track the most recent key regardless
-		if key.CreatedAtTimestamp > latestItemsKey.CreatedAtTimestamp {
-			latestItemsKey = key
-		}
-
-		// Prefer keys marked as default
-		if key.Default {
-			defaultItemsKey = key
-			break
-		}
-	}
-
-	// Use default key if found, otherwise use most recent
-	if defaultItemsKey.UUID != "" {
-		cs.Session.DefaultItemsKey = defaultItemsKey
-	} else if latestItemsKey.UUID != "" {
-		cs.Session.DefaultItemsKey = latestItemsKey
-	}
-
-	return nil
-}
-
-// mergeItemsKeysSlices merges two slices of items keys (from gosn-v2/cache)
-func mergeItemsKeysSlices(existing, new []session.SessionItemsKey) []session.SessionItemsKey {
-	// Create map of existing keys by UUID
-	existingMap := make(map[string]session.SessionItemsKey)
-	for _, k := range existing {
-		existingMap[k.UUID] = k
-	}
-
-	// Add or update with new keys
-	for _, k := range new {
-		existingMap[k.UUID] = k
-	}
-
-	// Convert back to slice
-	var result []session.SessionItemsKey
-	for _, k := range existingMap {
-		result = append(result, k)
-	}
-
-	return result
-}
-
 // getTagUUIDs returns a slice of tag UUIDs for debugging
 func getTagUUIDs(tagStats map[string]*TagStats) []string {
 	var uuids []string
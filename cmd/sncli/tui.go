@@ -0,0 +1,851 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/items"
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	tuiSidebarWidth = 26
+	// tuiSyncInterval is how often the TUI syncs in the background
+	tuiSyncInterval = 2 * time.Minute
+)
+
+const tuiHelp = "tab pane · j/k move · / search · enter/e edit · t tag · p pin · x trash · D delete · r sync · q quit"
+
+type tuiPane int
+
+const (
+	tuiPaneSidebar tuiPane = iota
+	tuiPaneNotes
+	tuiPanePreview
+)
+
+type tuiMode int
+
+const (
+	tuiModeNormal tuiMode = iota
+	tuiModeSearch
+	tuiModeTag
+	tuiModeConfirmDelete
+)
+
+// tuiSidebarEntry is a row of the sidebar: all notes, the trash, or a tag
+type tuiSidebarEntry struct {
+	label string
+	tag   *items.Tag
+	trash bool
+	depth int
+}
+
+// key identifies the entry, so it stays selected when the sidebar is rebuilt
+func (e tuiSidebarEntry) key() string {
+	if e.tag != nil {
+		return e.tag.UUID
+	}
+
+	return e.label
+}
+
+type (
+	tuiSyncedMsg struct {
+		lib *sncli.Library
+		err error
+	}
+	tuiEditedMsg struct {
+		uuid   string
+		output []byte
+		err    error
+	}
+	tuiTickMsg struct{}
+)
+
+var (
+	tuiBorderStyle  = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("240"))
+	tuiFocusStyle   = tuiBorderStyle.BorderForeground(lipgloss.Color("39"))
+	tuiCursorStyle  = lipgloss.NewStyle().Reverse(true)
+	tuiDimStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))
+	tuiErrorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	tuiHeadingStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39"))
+)
+
+func cmdTUI() *cli.Command {
+	return &cli.Command{
+		Name:  "tui",
+		Usage: "browse and edit notes in a full-screen interface",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "editor",
+				Usage:   "path to editor",
+				EnvVars: []string{"EDITOR"},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return processTUI(c, getOpts(c))
+		},
+	}
+}
+
+func processTUI(c *cli.Context, opts configOptsOutput) error {
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	// start with the cache, if there is one, and sync in the background
+	lib, err := sncli.LoadLibrary(session)
+	if err != nil {
+		if !errors.Is(err, sncli.ErrNoCache) {
+			return err
+		}
+
+		if lib, err = sncli.SyncLibrary(session, nil); err != nil {
+			return err
+		}
+	}
+
+	// the style is chosen before starting, as detecting the background reads from the terminal
+	style := "light"
+	if lipgloss.HasDarkBackground() {
+		style = "dark"
+	}
+
+	m := newTUIModel(session, lib, c.String("editor"), style)
+
+	final, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	if err != nil {
+		return err
+	}
+
+	fm, ok := final.(*tuiModel)
+	if !ok {
+		return nil
+	}
+
+	// changes being synced when the program quit are unsaved too
+	if unsaved := len(fm.pending) + len(fm.inFlight); unsaved > 0 {
+		if fm.err != nil {
+			return fmt.Errorf("%d change(s) could not be saved: %w", unsaved, fm.err)
+		}
+
+		return fmt.Errorf("quit before %d change(s) were saved", unsaved)
+	}
+
+	return nil
+}
+
+type tuiModel struct {
+	session      *cache.Session
+	lib          *sncli.Library
+	editor       string
+	glamourStyle string
+
+	sidebar       []tuiSidebarEntry
+	sidebarCursor int
+	notes         []*items.Note
+	noteCursor    int
+	focus         tuiPane
+	mode          tuiMode
+
+	search   textinput.Model
+	prompt   textinput.Model
+	preview  viewport.Model
+	renderer *glamour.TermRenderer
+	// previewKey identifies the note shown in the preview, so it's only rendered when it changes
+	previewKey string
+
+	// pending holds changes not yet synced, inFlight the changes being synced
+	pending    items.Items
+	inFlight   items.Items
+	syncing    bool
+	syncQueued bool
+	quitting   bool
+	lastSync   time.Time
+
+	status string
+	err    error
+	width  int
+	height int
+}
+
+func newTUIModel(session *cache.Session, lib *sncli.Library, editor, glamourStyle string) *tuiModel {
+	search := textinput.New()
+	search.Prompt = "/"
+	search.Placeholder = "search"
+
+	prompt := textinput.New()
+	prompt.Prompt = "tags: "
+	prompt.Placeholder = "comma separated"
+
+	m := &tuiModel{
+		session:      session,
+		lib:          lib,
+		editor:       editor,
+		glamourStyle: glamourStyle,
+		focus:        tuiPaneNotes,
+		search:       search,
+		prompt:       prompt,
+		preview:      viewport.New(0, 0),
+	}
+
+	m.refresh()
+
+	return m
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.startSync(), tuiTick())
+}
+
+func tuiTick() tea.Cmd {
+	return tea.Tick(tuiSyncInterval, func(time.Time) tea.Msg {
+		return tuiTickMsg{}
+	})
+}
+
+// queue records changes to sync and shows them straight away
+func (m *tuiModel) queue(changed items.Items) tea.Cmd {
+	for _, item := range changed {
+		replaced := false
+
+		for x := range m.pending {
+			if m.pending[x].GetUUID() == item.GetUUID() {
+				m.pending[x] = item
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			m.pending = append(m.pending, item)
+		}
+	}
+
+	m.lib.Apply(changed)
+	m.refresh()
+
+	return m.startSync()
+}
+
+// startSync syncs the pending changes in the background, or once the current sync has finished
+func (m *tuiModel) startSync() tea.Cmd {
+	if m.syncing {
+		m.syncQueued = true
+
+		return nil
+	}
+
+	m.syncing = true
+	m.syncQueued = false
+	m.inFlight, m.pending = m.pending, nil
+	m.status = "syncing…"
+
+	session, changed := m.session, m.inFlight
+
+	return func() tea.Msg {
+		lib, err := sncli.SyncLibrary(session, changed)
+
+		return tuiSyncedMsg{lib: lib, err: err}
+	}
+}
+
+func (m *tuiModel) synced(msg tuiSyncedMsg) tea.Cmd {
+	m.syncing = false
+
+	if msg.err != nil {
+		// keep the changes to retry with the next sync
+		m.pending = append(m.inFlight, m.pending...)
+		m.err = fmt.Errorf("sync failed: %w", msg.err)
+		m.status = ""
+	} else {
+		m.lib = msg.lib
+		// changes made during the sync still need showing
+		m.lib.Apply(m.pending)
+		m.err = nil
+		m.lastSync = time.Now()
+		m.status = "synced " + m.lastSync.Format("15:04")
+		m.refresh()
+	}
+
+	m.inFlight = nil
+
+	if m.quitting {
+		if msg.err != nil || len(m.pending) == 0 {
+			return tea.Quit
+		}
+
+		return m.startSync()
+	}
+
+	// after a failure, retry with the next change or background sync
+	if msg.err == nil && (len(m.pending) > 0 || m.syncQueued) {
+		return m.startSync()
+	}
+
+	return nil
+}
+
+// refresh rebuilds the sidebar and the list of notes for the selected sidebar entry and search
+func (m *tuiModel) refresh() {
+	var selected string
+	if m.sidebarCursor < len(m.sidebar) {
+		selected = m.sidebar[m.sidebarCursor].key()
+	}
+
+	m.sidebar = []tuiSidebarEntry{{label: "All notes"}, {label: "Trash", trash: true}}
+	for _, entry := range m.lib.TagTree() {
+		m.sidebar = append(m.sidebar, tuiSidebarEntry{label: entry.Tag.Content.GetTitle(), tag: entry.Tag, depth: entry.Depth})
+	}
+
+	m.sidebarCursor = 0
+
+	for x, entry := range m.sidebar {
+		if entry.key() == selected {
+			m.sidebarCursor = x
+		}
+	}
+
+	var current string
+	if note := m.selectedNote(); note != nil {
+		current = note.UUID
+	}
+
+	entry := m.sidebar[m.sidebarCursor]
+
+	var tagged map[string]bool
+	if entry.tag != nil {
+		tagged = m.lib.TaggedNotes(entry.tag.UUID)
+	}
+
+	words := strings.Fields(strings.ToLower(m.search.Value()))
+
+	m.notes = m.notes[:0]
+
+	for _, note := range m.lib.Notes {
+		if sncli.NoteTrashed(note) != entry.trash {
+			continue
+		}
+
+		if tagged != nil && !tagged[note.UUID] {
+			continue
+		}
+
+		if !tuiNoteMatches(note, words) {
+			continue
+		}
+
+		m.notes = append(m.notes, note)
+	}
+
+	m.noteCursor = min(m.noteCursor, max(len(m.notes)-1, 0))
+
+	for x, note := range m.notes {
+		if note.UUID == current {
+			m.noteCursor = x
+		}
+	}
+
+	m.refreshPreview()
+}
+
+// tuiNoteMatches reports whether the note's title or text contains every word
+func tuiNoteMatches(note *items.Note, words []string) bool {
+	if len(words) == 0 {
+		return true
+	}
+
+	text := strings.ToLower(note.Content.GetTitle() + "\n" + note.Content.GetText())
+
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *tuiModel) selectedNote() *items.Note {
+	if m.noteCursor < 0 || m.noteCursor >= len(m.notes) {
+		return nil
+	}
+
+	return m.notes[m.noteCursor]
+}
+
+// refreshPreview renders the selected note as markdown, if it has changed
+func (m *tuiModel) refreshPreview() {
+	note := m.selectedNote()
+
+	key := ""
+	if note != nil {
+		// changes are made to copies, so a different note means a different revision
+		key = fmt.Sprintf("%p:%d", note, m.preview.Width)
+	}
+
+	if key == m.previewKey {
+		return
+	}
+
+	m.previewKey = key
+
+	if note == nil {
+		m.preview.SetContent(tuiDimStyle.Render("No notes"))
+
+		return
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(tuiHeadingStyle.Render(note.Content.GetTitle()) + "\n")
+
+	if tags := m.lib.NoteTags(note.UUID); len(tags) > 0 {
+		sb.WriteString(tuiDimStyle.Render("#"+strings.Join(tags, " #")) + "\n")
+	}
+
+	text := note.Content.GetText()
+
+	if m.renderer != nil {
+		if rendered, err := m.renderer.Render(text); err == nil {
+			text = rendered
+		}
+	}
+
+	sb.WriteString(text)
+
+	m.preview.SetContent(sb.String())
+	m.preview.GotoTop()
+}
+
+// resize lays out the panes and recreates the markdown renderer for the preview's width
+func (m *tuiModel) resize(width, height int) {
+	m.width, m.height = width, height
+
+	_, previewWidth := m.paneWidths()
+
+	m.preview.Width = max(previewWidth-2, 1)
+	m.preview.Height = max(m.paneHeight()-2, 1)
+
+	if r, err := glamour.NewTermRenderer(glamour.WithStandardStyle(m.glamourStyle), glamour.WithWordWrap(m.preview.Width-2)); err == nil {
+		m.renderer = r
+	}
+
+	m.previewKey = ""
+	m.refreshPreview()
+}
+
+func (m *tuiModel) paneWidths() (int, int) {
+	rest := max(m.width-tuiSidebarWidth, 0)
+	notesWidth := rest * 2 / 5
+
+	return notesWidth, rest - notesWidth
+}
+
+func (m *tuiModel) paneHeight() int {
+	// the status line is below the panes
+	return max(m.height-1, 3)
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.resize(msg.Width, msg.Height)
+
+		return m, nil
+	case tuiSyncedMsg:
+		return m, m.synced(msg)
+	case tuiTickMsg:
+		return m, tea.Batch(m.startSync(), tuiTick())
+	case tuiEditedMsg:
+		return m, m.edited(msg)
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, m.quit()
+		}
+
+		switch m.mode {
+		case tuiModeSearch:
+			return m, m.updateSearch(msg)
+		case tuiModeTag:
+			return m, m.updateTagPrompt(msg)
+		case tuiModeConfirmDelete:
+			return m, m.confirmDelete(msg)
+		default:
+			return m, m.updateNormal(msg)
+		}
+	}
+
+	return m, nil
+}
+
+// quit waits for changes to be synced before quitting, unless asked twice
+func (m *tuiModel) quit() tea.Cmd {
+	if m.quitting || !m.syncing && len(m.pending) == 0 {
+		return tea.Quit
+	}
+
+	m.quitting = true
+	m.status = "saving changes…"
+
+	if m.syncing {
+		return nil
+	}
+
+	return m.startSync()
+}
+
+func (m *tuiModel) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.search.SetValue("")
+		m.search.Blur()
+		m.mode = tuiModeNormal
+		m.refresh()
+
+		return nil
+	case tea.KeyEnter, tea.KeyDown, tea.KeyUp:
+		m.search.Blur()
+		m.mode = tuiModeNormal
+		m.focus = tuiPaneNotes
+
+		return nil
+	}
+
+	var cmd tea.Cmd
+
+	m.search, cmd = m.search.Update(msg)
+	m.noteCursor = 0
+	m.refresh()
+
+	return cmd
+}
+
+func (m *tuiModel) updateTagPrompt(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.prompt.Blur()
+		m.mode = tuiModeNormal
+
+		return nil
+	case tea.KeyEnter:
+		m.prompt.Blur()
+		m.mode = tuiModeNormal
+
+		note := m.selectedNote()
+		if note == nil {
+			return nil
+		}
+
+		changed, err := m.lib.TagNote(note, sncli.CommaSplit(m.prompt.Value()))
+		if err != nil {
+			m.err = err
+
+			return nil
+		}
+
+		if len(changed) == 0 {
+			return nil
+		}
+
+		return m.queue(changed)
+	}
+
+	var cmd tea.Cmd
+
+	m.prompt, cmd = m.prompt.Update(msg)
+
+	return cmd
+}
+
+func (m *tuiModel) confirmDelete(msg tea.KeyMsg) tea.Cmd {
+	m.mode = tuiModeNormal
+
+	note := m.selectedNote()
+	if note == nil || msg.String() != "y" {
+		m.status = "delete cancelled"
+
+		return nil
+	}
+
+	m.status = fmt.Sprintf("deleted %q", note.Content.GetTitle())
+
+	return m.queue(m.lib.DeleteNote(note))
+}
+
+func (m *tuiModel) updateNormal(msg tea.KeyMsg) tea.Cmd {
+	m.err = nil
+
+	switch msg.String() {
+	case "q":
+		return m.quit()
+	case "tab":
+		m.focus = (m.focus + 1) % 3
+	case "shift+tab":
+		m.focus = (m.focus + 2) % 3
+	case "/":
+		m.mode = tuiModeSearch
+
+		return m.search.Focus()
+	case "r":
+		return m.startSync()
+	case "j", "down":
+		m.move(1)
+	case "k", "up":
+		m.move(-1)
+	case "enter":
+		if m.focus == tuiPaneSidebar {
+			m.focus = tuiPaneNotes
+
+			return nil
+		}
+
+		return m.edit()
+	case "e":
+		return m.edit()
+	}
+
+	note := m.selectedNote()
+	if note == nil {
+		return nil
+	}
+
+	switch msg.String() {
+	case "t":
+		m.mode = tuiModeTag
+		m.prompt.SetValue("")
+
+		return m.prompt.Focus()
+	case "p":
+		return m.queue(m.lib.PinNote(note, !sncli.NotePinned(note)))
+	case "x":
+		return m.queue(m.lib.TrashNote(note, !sncli.NoteTrashed(note)))
+	case "D":
+		m.mode = tuiModeConfirmDelete
+	}
+
+	return nil
+}
+
+func (m *tuiModel) move(delta int) {
+	switch m.focus {
+	case tuiPaneSidebar:
+		m.sidebarCursor = min(max(m.sidebarCursor+delta, 0), len(m.sidebar)-1)
+		m.noteCursor = 0
+		m.refresh()
+	case tuiPaneNotes:
+		m.noteCursor = min(max(m.noteCursor+delta, 0), max(len(m.notes)-1, 0))
+		m.refreshPreview()
+	case tuiPanePreview:
+		if delta > 0 {
+			m.preview.ScrollDown(delta)
+		} else {
+			m.preview.ScrollUp(-delta)
+		}
+	}
+}
+
+// tuiEditorCommand runs the editor the same way edit note does, once the TUI has released the terminal
+type tuiEditorCommand struct {
+	title, text, editor string
+	output              []byte
+}
+
+func (e *tuiEditorCommand) Run() (err error) {
+	e.output, err = captureInputFromEditor(e.title, e.text, e.editor)
+
+	return err
+}
+
+// the editor is attached to the terminal by openInEditor
+func (e *tuiEditorCommand) SetStdin(io.Reader)  {}
+func (e *tuiEditorCommand) SetStdout(io.Writer) {}
+func (e *tuiEditorCommand) SetStderr(io.Writer) {}
+
+func (m *tuiModel) edit() tea.Cmd {
+	note := m.selectedNote()
+	if note == nil {
+		return nil
+	}
+
+	if m.editor == "" {
+		m.err = errors.New("set $EDITOR or --editor to edit notes")
+
+		return nil
+	}
+
+	ec := &tuiEditorCommand{title: note.Content.GetTitle(), text: note.Content.GetText(), editor: m.editor}
+	uuid := note.UUID
+
+	return tea.Exec(ec, func(err error) tea.Msg {
+		return tuiEditedMsg{uuid: uuid, output: ec.output, err: err}
+	})
+}
+
+func (m *tuiModel) edited(msg tuiEditedMsg) tea.Cmd {
+	if msg.err != nil {
+		m.err = msg.err
+
+		return nil
+	}
+
+	note := m.lib.Note(msg.uuid)
+	if note == nil {
+		m.err = errors.New("note was removed while editing")
+
+		return nil
+	}
+
+	title, text, err := parseEditorOutput(msg.output)
+	if err != nil {
+		m.err = err
+
+		return nil
+	}
+
+	if title == note.Content.GetTitle() && text == note.Content.GetText() {
+		return nil
+	}
+
+	return m.queue(m.lib.EditNote(note, title, text))
+}
+
+func (m *tuiModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	notesWidth, previewWidth := m.paneWidths()
+	height := m.paneHeight()
+
+	panes := lipgloss.JoinHorizontal(lipgloss.Top,
+		m.pane(tuiPaneSidebar, tuiSidebarWidth, height, m.sidebarLines(tuiSidebarWidth-2)),
+		m.pane(tuiPaneNotes, notesWidth, height, m.noteLines(notesWidth-2)),
+		m.pane(tuiPanePreview, previewWidth, height, strings.Split(m.preview.View(), "\n")),
+	)
+
+	return panes + "\n" + m.statusLine()
+}
+
+// pane draws a bordered pane, scrolled so any highlighted line is visible
+func (m *tuiModel) pane(p tuiPane, width, height int, lines []string) string {
+	style := tuiBorderStyle
+	if m.focus == p {
+		style = tuiFocusStyle
+	}
+
+	inner := max(height-2, 1)
+
+	cursor := -1
+
+	switch p {
+	case tuiPaneSidebar:
+		cursor = m.sidebarCursor
+	case tuiPaneNotes:
+		cursor = m.noteCursor
+	}
+
+	if start := cursor - inner + 1; start > 0 {
+		lines = lines[start:]
+	}
+
+	if len(lines) > inner {
+		lines = lines[:inner]
+	}
+
+	for x := range lines {
+		lines[x] = ansi.Truncate(lines[x], max(width-2, 0), "…")
+	}
+
+	return style.Width(max(width-2, 0)).Height(inner).Render(strings.Join(lines, "\n"))
+}
+
+func (m *tuiModel) sidebarLines(width int) []string {
+	lines := make([]string, 0, len(m.sidebar))
+
+	for x, entry := range m.sidebar {
+		line := strings.Repeat("  ", entry.depth) + entry.label
+		if entry.tag != nil {
+			line = strings.Repeat("  ", entry.depth) + "#" + entry.label
+		}
+
+		if x == m.sidebarCursor {
+			line = tuiCursorStyle.Render(ansi.Truncate(fmt.Sprintf("%-*s", width, line), width, "…"))
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func (m *tuiModel) noteLines(width int) []string {
+	if len(m.notes) == 0 {
+		return []string{tuiDimStyle.Render("No notes")}
+	}
+
+	lines := make([]string, 0, len(m.notes))
+
+	for x, note := range m.notes {
+		marker := "  "
+		if sncli.NotePinned(note) {
+			marker = "★ "
+		}
+
+		title := note.Content.GetTitle()
+		if title == "" {
+			title = "(Untitled)"
+		}
+
+		line := marker + title
+
+		if x == m.noteCursor {
+			line = tuiCursorStyle.Render(ansi.Truncate(fmt.Sprintf("%-*s", width, line), width, "…"))
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func (m *tuiModel) statusLine() string {
+	switch m.mode {
+	case tuiModeSearch:
+		return m.search.View()
+	case tuiModeTag:
+		return m.prompt.View()
+	case tuiModeConfirmDelete:
+		if note := m.selectedNote(); note != nil {
+			return tuiErrorStyle.Render(fmt.Sprintf("delete %q permanently? (y/n)", note.Content.GetTitle()))
+		}
+	}
+
+	var parts []string
+
+	if m.search.Value() != "" {
+		parts = append(parts, "/"+m.search.Value())
+	}
+
+	if m.err != nil {
+		parts = append(parts, tuiErrorStyle.Render(m.err.Error()))
+	} else if m.status != "" {
+		parts = append(parts, m.status)
+	}
+
+	parts = append(parts, tuiDimStyle.Render(tuiHelp))
+
+	return ansi.Truncate(strings.Join(parts, "  "), m.width, "…")
+}
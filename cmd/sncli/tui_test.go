@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTUIModel(t *testing.T) *tuiModel {
+	t.Helper()
+
+	lib := &sncli.Library{}
+
+	for _, title := range []string{"Standup", "Groceries", "Design doc"} {
+		note, err := items.NewNote(title, "# "+title+"\n\nsome text", nil)
+		require.NoError(t, err)
+
+		note.UUID = "note-" + title
+		lib.Notes = append(lib.Notes, &note)
+	}
+
+	tag, err := items.NewTag("work", items.ItemReferences{{UUID: "note-Standup", ContentType: common.SNItemTypeNote}})
+	require.NoError(t, err)
+
+	lib.Tags = append(lib.Tags, &tag)
+
+	m := newTUIModel(nil, lib, "", "dark")
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+
+	return m
+}
+
+func tuiKeys(m *tuiModel, keys ...string) {
+	for _, key := range keys {
+		switch key {
+		case "enter":
+			m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		case "esc":
+			m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+		case "tab":
+			m.Update(tea.KeyMsg{Type: tea.KeyTab})
+		default:
+			m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)})
+		}
+	}
+}
+
+func tuiTitles(m *tuiModel) []string {
+	var titles []string
+	for _, note := range m.notes {
+		titles = append(titles, note.Content.GetTitle())
+	}
+
+	return titles
+}
+
+func TestTUISearchAndSidebar(t *testing.T) {
+	m := testTUIModel(t)
+	assert.Equal(t, []string{"Standup", "Groceries", "Design doc"}, tuiTitles(m))
+	assert.Contains(t, m.View(), "Standup")
+
+	tuiKeys(m, "/", "d", "o", "c")
+	assert.Equal(t, []string{"Design doc"}, tuiTitles(m))
+
+	// enter keeps the search, esc in search mode clears it
+	tuiKeys(m, "enter")
+	assert.Equal(t, tuiModeNormal, m.mode)
+	assert.Equal(t, []string{"Design doc"}, tuiTitles(m))
+
+	tuiKeys(m, "/", "esc")
+	assert.Len(t, m.notes, 3)
+
+	// select the work tag in the sidebar
+	tuiKeys(m, "tab", "tab", "j", "j")
+	assert.Equal(t, tuiPaneSidebar, m.focus)
+	assert.Equal(t, []string{"Standup"}, tuiTitles(m))
+
+	tuiKeys(m, "k")
+	assert.Empty(t, m.notes)
+	assert.Contains(t, m.View(), "No notes")
+}
+
+func TestTUIChanges(t *testing.T) {
+	m := testTUIModel(t)
+
+	tuiKeys(m, "j", "p")
+	assert.True(t, m.syncing)
+	require.Len(t, m.inFlight, 1)
+	// pinned notes move to the top and stay selected
+	assert.Equal(t, "Groceries", m.notes[0].Content.GetTitle())
+	assert.Equal(t, 0, m.noteCursor)
+
+	// changes made while syncing wait for the next sync
+	tuiKeys(m, "t")
+	assert.Equal(t, tuiModeTag, m.mode)
+	tuiKeys(m, "h", "o", "m", "e", "enter")
+	require.Len(t, m.pending, 1)
+	assert.Equal(t, []string{"home"}, m.lib.NoteTags("note-Groceries"))
+
+	// trashed notes leave the list
+	tuiKeys(m, "x")
+	assert.Equal(t, []string{"Standup", "Design doc"}, tuiTitles(m))
+	require.Len(t, m.pending, 2)
+
+	// the synced notes don't have the pending changes yet, so they're applied again
+	synced := &sncli.Library{Notes: append([]*items.Note{}, testTUIModel(t).lib.Notes...)}
+	cmd := m.synced(tuiSyncedMsg{lib: synced})
+	require.NotNil(t, cmd)
+	assert.True(t, m.syncing)
+	assert.Len(t, m.inFlight, 2)
+	assert.True(t, sncli.NoteTrashed(m.lib.Note("note-Groceries")))
+
+	// failed syncs keep the changes
+	m.synced(tuiSyncedMsg{err: errors.New("offline")})
+	assert.Len(t, m.pending, 2)
+	assert.ErrorContains(t, m.err, "offline")
+}
+
+func TestTUIDelete(t *testing.T) {
+	m := testTUIModel(t)
+
+	tuiKeys(m, "D")
+	assert.Contains(t, m.View(), `delete "Standup" permanently?`)
+
+	tuiKeys(m, "n")
+	assert.Len(t, m.notes, 3)
+
+	tuiKeys(m, "D", "y")
+	assert.Equal(t, []string{"Groceries", "Design doc"}, tuiTitles(m))
+	require.Len(t, m.inFlight, 1)
+	assert.True(t, m.inFlight[0].IsDeleted())
+}
+
+func TestTUIEdited(t *testing.T) {
+	m := testTUIModel(t)
+
+	assert.Nil(t, m.edit())
+	assert.ErrorContains(t, m.err, "EDITOR")
+
+	m.edited(tuiEditedMsg{uuid: "note-Standup", output: []byte("Standup notes\nupdated")})
+	assert.Equal(t, "Standup notes", m.notes[0].Content.GetTitle())
+	assert.Equal(t, "updated", m.notes[0].Content.GetText())
+	assert.True(t, m.syncing)
+
+	// unchanged notes aren't saved
+	m.syncing = false
+	m.inFlight = nil
+	assert.Nil(t, m.edited(tuiEditedMsg{uuid: "note-Standup", output: []byte("Standup notes\nupdated")}))
+}
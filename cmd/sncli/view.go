@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gookit/color"
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
+	"github.com/pterm/pterm"
+	"github.com/urfave/cli/v2"
+)
+
+func cmdView() *cli.Command {
+	return &cli.Command{
+		Name:  "view",
+		Usage: "manage saved searches, synced as smart views",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "add",
+				Usage: "save a search query as a smart view",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "title",
+						Usage:    "view title",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "query",
+						Aliases:  []string{"q"},
+						Usage:    `search query, e.g. tag:work -tag:archive updated:>7.days.ago`,
+						Required: true,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return processAddView(c, getOpts(c))
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "list smart views with their queries",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Value: "table",
+						Usage: "output format (table, json)",
+					},
+					&cli.BoolFlag{
+						Name:  "offline",
+						Usage: "read views from the local cache without syncing",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return processListViews(c, getOpts(c))
+				},
+			},
+			{
+				Name:      "run",
+				Usage:     "show the notes matching a smart view",
+				ArgsUsage: "<title or uuid>",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:    "limit",
+						Aliases: []string{"l"},
+						Usage:   "maximum number of results",
+					},
+					&cli.BoolFlag{
+						Name:  "offline",
+						Usage: "run the view against the local cache without syncing",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return processRunView(c, getOpts(c))
+				},
+			},
+		},
+	}
+}
+
+func processAddView(c *cli.Context, opts configOptsOutput) error {
+	query := c.String("query")
+
+	// check the query before syncing
+	if _, err := sncli.ParseSearchQuery(query); err != nil {
+		return queryError(query, err)
+	}
+
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	addViewInput := sncli.AddViewInput{
+		Session: session,
+		Title:   c.String("title"),
+		Query:   query,
+		Debug:   opts.debug,
+	}
+
+	view, err := addViewInput.Run()
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(c.App.Writer, "%s view %q with query: %s\n", color.Green.Sprint(msgAddSuccess), view.Title, view.Query)
+
+	return nil
+}
+
+func processListViews(c *cli.Context, opts configOptsOutput) error {
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	getViewsConfig := sncli.GetViewsConfig{
+		Session: session,
+		Offline: c.Bool("offline"),
+		Debug:   opts.debug,
+	}
+
+	views, err := getViewsConfig.Run()
+	if err != nil {
+		return err
+	}
+
+	if c.String("output") == "json" {
+		type viewJSON struct {
+			UUID      string `json:"uuid"`
+			Title     string `json:"title"`
+			Query     string `json:"query,omitempty"`
+			Predicate any    `json:"predicate"`
+		}
+
+		out := make([]viewJSON, 0, len(views))
+		for _, view := range views {
+			out = append(out, viewJSON{UUID: view.UUID, Title: view.Title, Query: view.Query, Predicate: view.Predicate})
+		}
+
+		data, err := json.MarshalIndent(out, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintln(c.App.Writer, string(data))
+
+		return nil
+	}
+
+	if len(views) == 0 {
+		pterm.Info.Println("No views found")
+
+		return nil
+	}
+
+	tableData := [][]string{
+		{color.Cyan.Sprint("Title"), color.Cyan.Sprint("Query"), color.Cyan.Sprint("UUID")},
+	}
+
+	for _, view := range views {
+		query := view.Query
+		if view.Err != nil {
+			query = color.Yellow.Sprint(view.Err.Error())
+		}
+
+		tableData = append(tableData, []string{view.Title, query, color.Gray.Sprint(view.UUID)})
+	}
+
+	return pterm.DefaultTable.WithHasHeader(true).
+		WithHeaderStyle(pterm.NewStyle(pterm.FgLightCyan, pterm.Bold)).
+		WithData(tableData).
+		WithBoxed(true).
+		Render()
+}
+
+func processRunView(c *cli.Context, opts configOptsOutput) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("specify the title or uuid of the view to run")
+	}
+
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	runViewConfig := sncli.RunViewConfig{
+		Session: session,
+		View:    c.Args().First(),
+		Limit:   c.Int("limit"),
+		Offline: c.Bool("offline"),
+		Debug:   opts.debug,
+	}
+
+	view, matches, err := runViewConfig.Run()
+	if err != nil {
+		return err
+	}
+
+	if len(matches) == 0 {
+		pterm.Info.Println("No matches found")
+
+		return nil
+	}
+
+	text := ""
+	if q, err := sncli.ParseSearchQuery(view.Query); err == nil {
+		text = q.Text
+	}
+
+	results := make([]SearchResult, 0, len(matches))
+
+	for _, m := range matches {
+		results = append(results, SearchResult{
+			Note:         m.Note,
+			Score:        m.Score,
+			MatchInTitle: m.InTitle,
+			MatchInBody:  m.InBody,
+			Preview:      generateSearchPreview(m.Note.Content.GetText(), text, false),
+		})
+	}
+
+	return displaySearchResults(results, view.Title)
+}
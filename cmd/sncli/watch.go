@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	sncli "github.com/jonhadfield/sn-cli/internal/sncli"
+	"github.com/urfave/cli/v2"
+)
+
+func cmdWatch() *cli.Command {
+	return &cli.Command{
+		Name:  "watch",
+		Usage: "sync periodically and print a JSON line for each item that changes",
+		Description: `Each line has the event (created, updated, trashed or deleted), uuid, type, title
+and, for updates, the fields that changed. Changes are found by comparing the cache
+before and after each sync.
+
+With --exec, the command is run for each event with {uuid}, {type}, {title} and
+{event} replaced by the quoted values, e.g. --exec 'notify-send {title}'. On Windows
+{title} is left empty, so read the title from SN_TITLE instead.`,
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:  "interval",
+				Value: sncli.DefaultWatchInterval,
+				Usage: "how often to sync",
+			},
+			&cli.StringFlag{
+				Name:  "type",
+				Usage: "only report items of these types, e.g. Note,Tag (comma separated)",
+			},
+			&cli.StringFlag{
+				Name:  "tag",
+				Usage: "only report notes with any of these tags (comma separated)",
+			},
+			&cli.StringFlag{
+				Name:  "exec",
+				Usage: "command to run for each event",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return processWatch(c, getOpts(c))
+		},
+	}
+}
+
+func processWatch(c *cli.Context, opts configOptsOutput) error {
+	session, err := getSession(opts)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	enc := json.NewEncoder(c.App.Writer)
+
+	w := sncli.WatchConfig{
+		Session:  session,
+		Interval: c.Duration("interval"),
+		Types:    sncli.CommaSplit(c.String("type")),
+		Tags:     sncli.CommaSplit(c.String("tag")),
+		Exec:     c.String("exec"),
+		OnError: func(err error) {
+			_, _ = fmt.Fprintf(os.Stderr, "watch: %s\n", err)
+		},
+	}
+
+	return w.Run(ctx, func(event sncli.WatchEvent) error {
+		return enc.Encode(event)
+	})
+}
@@ -2,20 +2,17 @@ package sncli
 
 import (
 	"archive/zip"
-	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/jonhadfield/gosn-v2/cache"
-	"github.com/jonhadfield/gosn-v2/common"
 	"github.com/jonhadfield/gosn-v2/items"
-	"golang.org/x/crypto/pbkdf2"
 )
 
 // BackupConfig holds backup configuration
@@ -24,27 +21,45 @@ type BackupConfig struct {
 	OutputFile     string
 	Incremental    bool
 	LastBackupTime string
+	Parent         string
+	Types          []string
 	Encrypt        bool
 	Password       string
+	KDF            string
 	Debug          bool
 }
 
 // RestoreConfig holds restore configuration
 type RestoreConfig struct {
-	Session   *cache.Session
-	InputFile string
-	DryRun    bool
-	Password  string
-	Debug     bool
+	Session        *cache.Session
+	InputFile      string
+	ChainDir       string
+	Until          time.Time
+	Types          []string
+	Filter         RestoreFilter
+	DryRun         bool
+	Password       string
+	ConflictPolicy RestoreConflictPolicy
+	Debug          bool
 }
 
 // BackupManifest contains metadata about the backup
 type BackupManifest struct {
+	// ID identifies the backup to its incrementals, and is kept when it's re-encrypted
+	ID          string         `json:"id,omitempty"`
 	Timestamp   string         `json:"timestamp"`
 	ItemCounts  map[string]int `json:"item_counts"`
 	Incremental bool           `json:"incremental"`
 	Encrypted   bool           `json:"encrypted"`
 	Version     string         `json:"version"`
+	Types       []string       `json:"types,omitempty"`
+	KDF         *BackupKDF     `json:"kdf,omitempty"`
+	Parent      *BackupParent  `json:"parent,omitempty"`
+	// Rekeyed is when the backup was last re-encrypted, which changes its SHA-256
+	Rekeyed string `json:"rekeyed,omitempty"`
+	// Entries holds the SHA-256 of each entry as stored in the archive
+	Entries map[string]string `json:"entries,omitempty"`
+	Digest  string            `json:"digest,omitempty"`
 }
 
 // BackupItem represents an item in the backup
@@ -54,222 +69,135 @@ type BackupItem struct {
 	Content   string `json:"content"`
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
+	SHA256    string `json:"sha256,omitempty"`
 }
 
 // Run executes the backup
 func (b *BackupConfig) Run() error {
-	// Create zip file
-	zipFile, err := os.Create(b.OutputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create backup file: %w", err)
-	}
-	defer zipFile.Close()
-
-	var writer io.Writer = zipFile
 	var gcm cipher.AEAD
 
-	// Set up encryption if requested
-	if b.Encrypt {
-		if b.Password == "" {
-			return fmt.Errorf("password required for encrypted backup")
-		}
-
-		// Derive key from password
-		key := pbkdf2.Key([]byte(b.Password), []byte("sn-cli-backup-salt"), 100000, 32, sha256.New)
-
-		// Create AES cipher
-		block, err := aes.NewCipher(key)
-		if err != nil {
-			return fmt.Errorf("failed to create cipher: %w", err)
-		}
-
-		gcm, err = cipher.NewGCM(block)
-		if err != nil {
-			return fmt.Errorf("failed to create GCM: %w", err)
-		}
+	types, err := parseBackupTypes(b.Types)
+	if err != nil {
+		return err
 	}
 
-	zipWriter := zip.NewWriter(writer)
-	defer zipWriter.Close()
+	backupID, err := newBackupID()
+	if err != nil {
+		return err
+	}
 
 	// Create manifest
 	manifest := BackupManifest{
+		ID:          backupID,
 		Timestamp:   time.Now().Format(time.RFC3339),
 		ItemCounts:  make(map[string]int),
 		Incremental: b.Incremental,
 		Encrypted:   b.Encrypt,
-		Version:     "1.0",
-	}
-
-	// Backup notes
-	if err := b.backupNotes(zipWriter, &manifest, gcm); err != nil {
-		return fmt.Errorf("failed to backup notes: %w", err)
+		Version:     BackupFormatVersion3,
 	}
 
-	// Backup tags
-	if err := b.backupTags(zipWriter, &manifest, gcm); err != nil {
-		return fmt.Errorf("failed to backup tags: %w", err)
+	for _, bt := range types {
+		manifest.Types = append(manifest.Types, bt.Name)
 	}
 
-	// Write manifest
-	manifestData, err := json.MarshalIndent(manifest, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal manifest: %w", err)
-	}
-
-	if err := b.writeZipFile(zipWriter, "manifest.json", manifestData, gcm); err != nil {
-		return fmt.Errorf("failed to write manifest: %w", err)
-	}
+	// Read the parent before the output is created in case it's being replaced
+	var parentIndex []BackupItemRef
 
-	return nil
-}
-
-// backupNotes backs up all notes
-func (b *BackupConfig) backupNotes(zipWriter *zip.Writer, manifest *BackupManifest, gcm cipher.AEAD) error {
-	noteFilter := items.Filter{
-		Type: common.SNItemTypeNote,
-	}
-
-	getNoteConfig := GetNoteConfig{
-		Session: b.Session,
-		Filters: items.ItemFilters{
-			MatchAny: false,
-			Filters:  []items.Filter{noteFilter},
-		},
-		Debug: b.Debug,
-	}
-
-	rawNotes, err := getNoteConfig.Run()
-	if err != nil {
-		return err
+	if b.Incremental {
+		parentIndex, err = b.resolveParent(&manifest)
+		if err != nil {
+			return err
+		}
 	}
 
-	var notesToBackup []BackupItem
-
-	for _, item := range rawNotes {
-		note := item.(*items.Note)
+	// Set up encryption if requested
+	if b.Encrypt {
+		if b.Password == "" {
+			return fmt.Errorf("password required for encrypted backup")
+		}
 
-		// Skip if incremental and not modified since last backup
-		if b.Incremental && b.LastBackupTime != "" {
-			if note.UpdatedAt < b.LastBackupTime {
-				continue
-			}
+		// Derive key from password using a salt unique to this backup
+		kdf, err := NewBackupKDF(b.KDF)
+		if err != nil {
+			return err
 		}
 
-		// Marshal note content
-		contentData, err := json.Marshal(note.Content)
+		gcm, err = newBackupCipher(b.Password, kdf)
 		if err != nil {
-			return fmt.Errorf("failed to marshal note content: %w", err)
+			return err
 		}
 
-		notesToBackup = append(notesToBackup, BackupItem{
-			UUID:      note.UUID,
-			Type:      common.SNItemTypeNote,
-			Content:   string(contentData),
-			CreatedAt: note.CreatedAt,
-			UpdatedAt: note.UpdatedAt,
-		})
+		manifest.KDF = &kdf
 	}
 
-	// Write notes to zip
-	notesData, err := json.MarshalIndent(notesToBackup, "", "  ")
+	sourceItems, err := syncAllItems(b.Session)
 	if err != nil {
-		return fmt.Errorf("failed to marshal notes: %w", err)
-	}
-
-	if err := b.writeZipFile(zipWriter, "notes.json", notesData, gcm); err != nil {
-		return err
+		return fmt.Errorf("failed to get items: %w", err)
 	}
 
-	manifest.ItemCounts["notes"] = len(notesToBackup)
-	return nil
+	return writeBackupFile(b.OutputFile, func(w io.Writer) error {
+		return b.writeArchive(w, &manifest, gcm, types, sourceItems, parentIndex)
+	})
 }
 
-// backupTags backs up all tags
-func (b *BackupConfig) backupTags(zipWriter *zip.Writer, manifest *BackupManifest, gcm cipher.AEAD) error {
-	tagFilter := items.Filter{
-		Type: common.SNItemTypeTag,
+// writeBackupFile writes a backup to a temporary file alongside the output and only replaces
+// the output once it's complete, so a failed backup doesn't destroy an existing one
+func writeBackupFile(outputFile string, write func(io.Writer) error) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(outputFile), ".sn-backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
 	}
 
-	getTagConfig := GetTagConfig{
-		Session: b.Session,
-		Filters: items.ItemFilters{
-			MatchAny: false,
-			Filters:  []items.Filter{tagFilter},
-		},
-		Debug: b.Debug,
-	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+
+	if err := write(tmpFile); err != nil {
+		_ = tmpFile.Close()
 
-	rawTags, err := getTagConfig.Run()
-	if err != nil {
 		return err
 	}
 
-	var tagsToBackup []BackupItem
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to finalise backup: %w", err)
+	}
 
-	for _, item := range rawTags {
-		tag := item.(*items.Tag)
+	if err := os.Rename(tmpName, outputFile); err != nil {
+		return fmt.Errorf("failed to write backup file: %w", err)
+	}
 
-		// Skip if incremental and not modified since last backup
-		if b.Incremental && b.LastBackupTime != "" {
-			if tag.UpdatedAt < b.LastBackupTime {
-				continue
-			}
-		}
+	return nil
+}
 
-		// Marshal tag content
-		contentData, err := json.Marshal(tag.Content)
-		if err != nil {
-			return fmt.Errorf("failed to marshal tag content: %w", err)
-		}
+// writeArchive streams the items of each type to the archive in chunks, followed by the index and manifest
+func (b *BackupConfig) writeArchive(w io.Writer, manifest *BackupManifest, gcm cipher.AEAD, types []backupItemType, sourceItems items.Items, parentIndex []BackupItemRef) error {
+	zipWriter := zip.NewWriter(w)
 
-		tagsToBackup = append(tagsToBackup, BackupItem{
-			UUID:      tag.UUID,
-			Type:      common.SNItemTypeTag,
-			Content:   string(contentData),
-			CreatedAt: tag.CreatedAt,
-			UpdatedAt: tag.UpdatedAt,
-		})
-	}
+	// index of every item present, used to detect deletions in later incrementals
+	var index []BackupItemRef
 
-	// Write tags to zip
-	tagsData, err := json.MarshalIndent(tagsToBackup, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal tags: %w", err)
+	for _, bt := range types {
+		if err := b.backupItemsOfType(zipWriter, manifest, gcm, &index, bt, sourceItems); err != nil {
+			return fmt.Errorf("failed to backup %s: %w", bt.Name, err)
+		}
 	}
 
-	if err := b.writeZipFile(zipWriter, "tags.json", tagsData, gcm); err != nil {
-		return err
+	if err := writeBackupIndex(zipWriter, manifest, gcm, index, parentIndex); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
 	}
 
-	manifest.ItemCounts["tags"] = len(tagsToBackup)
-	return nil
-}
-
-// writeZipFile writes data to zip file with optional encryption
-func (b *BackupConfig) writeZipFile(zipWriter *zip.Writer, filename string, data []byte, gcm cipher.AEAD) error {
-	fileWriter, err := zipWriter.Create(filename)
+	// Write manifest
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to create zip entry: %w", err)
+		return fmt.Errorf("failed to marshal manifest: %w", err)
 	}
 
-	if b.Encrypt && gcm != nil {
-		// Generate nonce
-		nonce := make([]byte, gcm.NonceSize())
-		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-			return fmt.Errorf("failed to generate nonce: %w", err)
-		}
-
-		// Encrypt data
-		encrypted := gcm.Seal(nonce, nonce, data, nil)
+	// The manifest is left unencrypted so the key derivation parameters can be read
+	if err := writeZipEntry(zipWriter, backupManifestFile, manifestData, nil); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
 
-		if _, err := fileWriter.Write(encrypted); err != nil {
-			return fmt.Errorf("failed to write encrypted data: %w", err)
-		}
-	} else {
-		if _, err := fileWriter.Write(data); err != nil {
-			return fmt.Errorf("failed to write data: %w", err)
-		}
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finalise backup: %w", err)
 	}
 
 	return nil
@@ -281,6 +209,10 @@ func (r *RestoreConfig) Run() (RestoreResult, error) {
 		DryRun: r.DryRun,
 	}
 
+	if r.ChainDir != "" {
+		return r.runChain(result)
+	}
+
 	// Open zip file
 	zipReader, err := zip.OpenReader(r.InputFile)
 	if err != nil {
@@ -289,137 +221,60 @@ func (r *RestoreConfig) Run() (RestoreResult, error) {
 	defer zipReader.Close()
 
 	// Read manifest
-	manifestData, encrypted, err := r.readZipFile(&zipReader.Reader, "manifest.json")
-	if err != nil {
-		return result, fmt.Errorf("failed to read manifest: %w", err)
-	}
-
-	var manifest BackupManifest
-	if err := json.Unmarshal(manifestData, &manifest); err != nil {
-		return result, fmt.Errorf("failed to parse manifest: %w", err)
-	}
-
+	manifest, gcm, err := readBackupManifest(&zipReader.Reader, r.Password)
 	result.Manifest = manifest
 
-	// Verify encryption
-	if manifest.Encrypted && r.Password == "" {
-		return result, fmt.Errorf("password required for encrypted backup")
-	}
-
-	var gcm cipher.AEAD
-	if manifest.Encrypted {
-		// Derive key from password
-		key := pbkdf2.Key([]byte(r.Password), []byte("sn-cli-backup-salt"), 100000, 32, sha256.New)
-
-		// Create AES cipher
-		block, err := aes.NewCipher(key)
-		if err != nil {
-			return result, fmt.Errorf("failed to create cipher: %w", err)
-		}
-
-		gcm, err = cipher.NewGCM(block)
-		if err != nil {
-			return result, fmt.Errorf("failed to create GCM: %w", err)
-		}
-	}
-
-	// Read notes
-	notesData, _, err := r.readZipFile(&zipReader.Reader, "notes.json")
 	if err != nil {
-		return result, fmt.Errorf("failed to read notes: %w", err)
-	}
-
-	// Decrypt if needed
-	if encrypted && gcm != nil {
-		notesData, err = r.decrypt(notesData, gcm)
-		if err != nil {
-			return result, fmt.Errorf("failed to decrypt notes: %w", err)
-		}
-	}
-
-	var notes []BackupItem
-	if err := json.Unmarshal(notesData, &notes); err != nil {
-		return result, fmt.Errorf("failed to parse notes: %w", err)
+		return result, fmt.Errorf("failed to read manifest: %w", err)
 	}
 
-	result.NotesCount = len(notes)
-
-	// Read tags
-	tagsData, _, err := r.readZipFile(&zipReader.Reader, "tags.json")
+	types, err := parseBackupTypes(r.Types)
 	if err != nil {
-		return result, fmt.Errorf("failed to read tags: %w", err)
+		return result, err
 	}
 
-	// Decrypt if needed
-	if encrypted && gcm != nil {
-		tagsData, err = r.decrypt(tagsData, gcm)
-		if err != nil {
-			return result, fmt.Errorf("failed to decrypt tags: %w", err)
-		}
+	backupItems, err := readArchiveItems(&zipReader.Reader, gcm, types)
+	if err != nil {
+		return result, err
 	}
 
-	var tags []BackupItem
-	if err := json.Unmarshal(tagsData, &tags); err != nil {
-		return result, fmt.Errorf("failed to parse tags: %w", err)
+	if err := r.restoreItems(backupItems, &result); err != nil {
+		return result, err
 	}
 
-	result.TagsCount = len(tags)
-
-	// TODO: Implement actual restore logic (not in dry-run mode)
-	// This would involve creating notes and tags in the session
-
 	return result, nil
 }
 
-// readZipFile reads a file from the zip archive
-func (r *RestoreConfig) readZipFile(zipReader *zip.Reader, filename string) ([]byte, bool, error) {
-	for _, file := range zipReader.File {
-		if file.Name == filename {
-			rc, err := file.Open()
-			if err != nil {
-				return nil, false, err
-			}
-			defer rc.Close()
-
-			data, err := io.ReadAll(rc)
-			if err != nil {
-				return nil, false, err
-			}
-
-			// Check if encrypted (has nonce prefix)
-			encrypted := len(data) > 12 // Minimal size for nonce + ciphertext
-			return data, encrypted, nil
-		}
-	}
-
-	return nil, false, fmt.Errorf("file %s not found in backup", filename)
-}
-
-// decrypt decrypts data using GCM
-func (r *RestoreConfig) decrypt(data []byte, gcm cipher.AEAD) ([]byte, error) {
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return nil, fmt.Errorf("ciphertext too short")
+// readBackupItems reads, and decrypts if needed, a list of backup items from the zip archive
+func readBackupItems(zipReader *zip.Reader, filename string, gcm cipher.AEAD) ([]BackupItem, error) {
+	data, err := readZipEntry(zipReader, filename, gcm)
+	if err != nil {
+		return nil, err
 	}
 
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, fmt.Errorf("decryption failed: %w", err)
+	var backupItems []BackupItem
+	if err := json.Unmarshal(data, &backupItems); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
 	}
 
-	return plaintext, nil
+	return backupItems, nil
 }
 
 // RestoreResult contains the result of a restore operation
 type RestoreResult struct {
 	DryRun     bool
+	Policy     RestoreConflictPolicy
 	Manifest   BackupManifest
-	NotesCount int
-	TagsCount  int
+	Chain      []string
+	ItemCounts map[string]int
+	Created    []RestoredItem
+	Updated    []RestoredItem
+	Skipped    []RestoredItem
+	Conflicted []RestoredItem
 }
 
-// GetBackupInfo reads backup metadata without restoring
+// GetBackupInfo reads backup metadata without restoring.
+// The password is only needed for version 1 archives, whose manifest is encrypted.
 func GetBackupInfo(filename string, password string) (BackupManifest, error) {
 	zipReader, err := zip.OpenReader(filename)
 	if err != nil {
@@ -427,33 +282,9 @@ func GetBackupInfo(filename string, password string) (BackupManifest, error) {
 	}
 	defer zipReader.Close()
 
-	// Find manifest file
-	var manifestFile *zip.File
-	for _, file := range zipReader.File {
-		if file.Name == "manifest.json" {
-			manifestFile = file
-			break
-		}
-	}
-
-	if manifestFile == nil {
-		return BackupManifest{}, fmt.Errorf("manifest not found in backup")
-	}
-
-	rc, err := manifestFile.Open()
-	if err != nil {
-		return BackupManifest{}, err
-	}
-	defer rc.Close()
-
-	data, err := io.ReadAll(rc)
-	if err != nil {
-		return BackupManifest{}, err
-	}
-
-	var manifest BackupManifest
-	if err := json.Unmarshal(data, &manifest); err != nil {
-		return BackupManifest{}, fmt.Errorf("failed to parse manifest: %w", err)
+	manifest, _, err := readBackupManifest(&zipReader.Reader, password)
+	if err != nil && !(errors.Is(err, ErrBackupPasswordRequired) && manifest.Version != BackupFormatVersion1) {
+		return manifest, err
 	}
 
 	return manifest, nil
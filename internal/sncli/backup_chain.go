@@ -0,0 +1,490 @@
+package sncli
+
+import (
+	"archive/zip"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	backupIndexFile   = "index.json"
+	backupDeletedFile = "deleted.json"
+)
+
+// BackupParent identifies the backup an incremental backup was taken against. Parents are found
+// by ID, as re-encrypting a backup changes its SHA-256, which only identifies parents without one.
+type BackupParent struct {
+	ID        string `json:"id,omitempty"`
+	File      string `json:"file"`
+	SHA256    string `json:"sha256"`
+	Timestamp string `json:"timestamp"`
+}
+
+// BackupItemRef identifies an item without its content. It's used for the index of
+// items present at backup time and for tombstones of items deleted since the parent.
+type BackupItemRef struct {
+	UUID string `json:"uuid"`
+	Type string `json:"type"`
+}
+
+// BackupChainEntry is a single archive in a chain of backups
+type BackupChainEntry struct {
+	Path     string
+	SHA256   string
+	Manifest BackupManifest
+}
+
+// newBackupID returns a random ID for a new backup
+func newBackupID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return "", fmt.Errorf("failed to generate backup ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// hashFile returns the hex encoded SHA-256 digest of a file
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// modifiedSince reports whether an item's updated time is at or after the given time.
+// Items with times that can't be parsed are treated as modified.
+func modifiedSince(updatedAt, since string) bool {
+	if since == "" {
+		return true
+	}
+
+	sinceTime, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return updatedAt >= since
+	}
+
+	updatedTime, err := time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return true
+	}
+
+	return !updatedTime.Before(sinceTime)
+}
+
+// resolveParent reads the parent of an incremental backup, records it in the manifest and,
+// unless a time was given explicitly, uses the parent's timestamp as the time to back up from.
+// It returns the items present when the parent was taken so deletions can be detected.
+func (b *BackupConfig) resolveParent(manifest *BackupManifest) ([]BackupItemRef, error) {
+	if b.Parent == "" {
+		if b.LastBackupTime == "" {
+			return nil, fmt.Errorf("incremental backup requires a parent backup or a time to back up from")
+		}
+
+		return nil, nil
+	}
+
+	zipReader, err := zip.OpenReader(b.Parent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open parent backup: %w", err)
+	}
+	defer zipReader.Close()
+
+	parentManifest, gcm, err := readBackupManifest(&zipReader.Reader, b.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parent backup manifest: %w", err)
+	}
+
+	parentIndex, err := readBackupIndex(&zipReader.Reader, backupIndexFile, gcm)
+	if err != nil {
+		return nil, fmt.Errorf("parent backup has no item index, create a new full backup first: %w", err)
+	}
+
+	parentHash, err := hashFile(b.Parent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash parent backup: %w", err)
+	}
+
+	manifest.Parent = &BackupParent{
+		ID:        parentManifest.ID,
+		File:      filepath.Base(b.Parent),
+		SHA256:    parentHash,
+		Timestamp: parentManifest.Timestamp,
+	}
+
+	if b.LastBackupTime == "" {
+		b.LastBackupTime = parentManifest.Timestamp
+	}
+
+	return parentIndex, nil
+}
+
+// writeBackupIndex writes the index of current items and, for incremental backups,
+// tombstones for the items in the parent's index that no longer exist.
+func writeBackupIndex(zipWriter *zip.Writer, manifest *BackupManifest, gcm cipher.AEAD, index, parentIndex []BackupItemRef) error {
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+
+	if err := writeBackupEntry(zipWriter, manifest, backupIndexFile, indexData, gcm); err != nil {
+		return err
+	}
+
+	if !manifest.Incremental || manifest.Parent == nil {
+		return nil
+	}
+
+	// only items of the types in this backup can be known to be deleted
+	tombstones := findTombstones(parentIndex, index, manifest.Types)
+
+	deletedData, err := json.MarshalIndent(tombstones, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal deleted items: %w", err)
+	}
+
+	if err := writeBackupEntry(zipWriter, manifest, backupDeletedFile, deletedData, gcm); err != nil {
+		return err
+	}
+
+	manifest.ItemCounts["deleted"] = len(tombstones)
+
+	return nil
+}
+
+// findTombstones returns the items of the given types in the parent index that are missing from the current index
+func findTombstones(parentIndex, index []BackupItemRef, types []string) []BackupItemRef {
+	current := make(map[string]bool, len(index))
+	for _, ref := range index {
+		current[ref.UUID] = true
+	}
+
+	tombstones := []BackupItemRef{}
+
+	for _, ref := range parentIndex {
+		bt, ok := backupTypeByContentType(ref.Type)
+		if !ok || !StringInSlice(bt.Name, types, true) {
+			continue
+		}
+
+		if !current[ref.UUID] {
+			tombstones = append(tombstones, ref)
+		}
+	}
+
+	return tombstones
+}
+
+// readBackupIndex reads a list of item references from the zip archive
+func readBackupIndex(zipReader *zip.Reader, filename string, gcm cipher.AEAD) ([]BackupItemRef, error) {
+	data, err := readZipEntry(zipReader, filename, gcm)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []BackupItemRef
+	if err := json.Unmarshal(data, &refs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+
+	return refs, nil
+}
+
+// zipHasEntry reports whether the archive contains the named file
+func zipHasEntry(zipReader *zip.Reader, filename string) bool {
+	for _, file := range zipReader.File {
+		if file.Name == filename {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readBackupDir reads the manifest of every backup archive in a directory.
+// Archives that can't be read without a password, or aren't backups, are ignored.
+func readBackupDir(dir string) ([]BackupChainEntry, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.zip"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []BackupChainEntry
+
+	for _, path := range paths {
+		manifest, err := GetBackupInfo(path, "")
+		if err != nil {
+			continue
+		}
+
+		hash, err := hashFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+		}
+
+		entries = append(entries, BackupChainEntry{
+			Path:     path,
+			SHA256:   hash,
+			Manifest: manifest,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return backupTime(entries[i].Manifest).Before(backupTime(entries[j].Manifest))
+	})
+
+	return entries, nil
+}
+
+// backupTime parses the manifest timestamp, returning the zero time if it's invalid
+func backupTime(manifest BackupManifest) time.Time {
+	t, _ := time.Parse(time.RFC3339, manifest.Timestamp)
+
+	return t
+}
+
+// FindLatestBackup returns the most recent backup in a directory, ignoring the excluded path
+func FindLatestBackup(dir, exclude string) (string, error) {
+	entries, err := readBackupDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	excludeAbs, _ := filepath.Abs(exclude)
+
+	for x := len(entries) - 1; x >= 0; x-- {
+		path, _ := filepath.Abs(entries[x].Path)
+		if path != excludeAbs {
+			return entries[x].Path, nil
+		}
+	}
+
+	return "", fmt.Errorf("no previous backup found in %s", dir)
+}
+
+// ResolveBackupChain returns the archives needed to restore the state at the given time,
+// starting with a full backup and followed by its incrementals in order.
+// A zero time selects the most recent backup in the directory.
+func ResolveBackupChain(dir string, until time.Time) ([]BackupChainEntry, error) {
+	entries, err := readBackupDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *BackupChainEntry
+
+	for x := range entries {
+		if until.IsZero() || !backupTime(entries[x].Manifest).After(until) {
+			latest = &entries[x]
+		}
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("no backup found in %s before %s", dir, until.Format(time.RFC3339))
+	}
+
+	return walkBackupChain(*latest, entries)
+}
+
+// findBackupParent returns the entry for an incremental's parent. Parents recording an ID are
+// matched on it, and the SHA-256 must still match unless the parent has been re-encrypted since
+// the incremental was taken.
+func findBackupParent(incremental BackupManifest, entries []BackupChainEntry) (BackupChainEntry, bool) {
+	parent := incremental.Parent
+
+	for _, entry := range entries {
+		if parent.ID == "" {
+			if entry.SHA256 == parent.SHA256 {
+				return entry, true
+			}
+
+			continue
+		}
+
+		if entry.Manifest.ID != parent.ID {
+			continue
+		}
+
+		if entry.SHA256 == parent.SHA256 {
+			return entry, true
+		}
+
+		rekeyed, err := time.Parse(time.RFC3339, entry.Manifest.Rekeyed)
+		if err == nil && rekeyed.After(backupTime(incremental)) {
+			return entry, true
+		}
+	}
+
+	return BackupChainEntry{}, false
+}
+
+// walkBackupChain follows the parents of a backup back to its full backup and returns the chain oldest first
+func walkBackupChain(latest BackupChainEntry, entries []BackupChainEntry) ([]BackupChainEntry, error) {
+	chain := []BackupChainEntry{latest}
+
+	for current := latest; current.Manifest.Incremental; {
+		parent := current.Manifest.Parent
+		if parent == nil {
+			return nil, fmt.Errorf("incremental backup %s does not record its parent", current.Path)
+		}
+
+		next, ok := findBackupParent(current.Manifest, entries)
+		if !ok {
+			return nil, fmt.Errorf("parent %s (%s) of %s is missing or has been modified", parent.File, parent.Timestamp, current.Path)
+		}
+
+		for _, link := range chain {
+			if link.Path == next.Path {
+				return nil, fmt.Errorf("backup chain contains a cycle at %s", next.Path)
+			}
+		}
+
+		chain = append([]BackupChainEntry{next}, chain...)
+		current = next
+	}
+
+	return chain, nil
+}
+
+// resolveChainFor returns the chain ending at the given backup, looking for its parents in the same directory
+func resolveChainFor(path string) ([]BackupChainEntry, error) {
+	entries, err := readBackupDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *BackupChainEntry
+
+	for x := range entries {
+		if abs, _ := filepath.Abs(entries[x].Path); abs == target {
+			latest = &entries[x]
+		}
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("%s is not a readable backup", path)
+	}
+
+	return walkBackupChain(*latest, entries)
+}
+
+// runChain restores the state recorded by a chain of backups in a directory
+func (r *RestoreConfig) runChain(result RestoreResult) (RestoreResult, error) {
+	types, err := parseBackupTypes(r.Types)
+	if err != nil {
+		return result, err
+	}
+
+	chain, err := ResolveBackupChain(r.ChainDir, r.Until)
+	if err != nil {
+		return result, err
+	}
+
+	for _, entry := range chain {
+		result.Chain = append(result.Chain, entry.Path)
+	}
+
+	result.Manifest = chain[len(chain)-1].Manifest
+
+	backupItems, err := replayBackupChain(chain, r.Password, types)
+	if err != nil {
+		return result, err
+	}
+
+	if err := r.restoreItems(backupItems, &result); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// replayBackupChain applies each archive in the chain in order and returns the resulting items
+// of the given types, in restore order
+func replayBackupChain(chain []BackupChainEntry, password string, types []backupItemType) ([]BackupItem, error) {
+	state := make(map[string]BackupItem)
+
+	var order []string
+
+	for _, entry := range chain {
+		backupItems, tombstones, err := readChainEntry(entry, password, types)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, bi := range backupItems {
+			if _, exists := state[bi.UUID]; !exists {
+				order = append(order, bi.UUID)
+			}
+
+			state[bi.UUID] = bi
+		}
+
+		for _, ref := range tombstones {
+			delete(state, ref.UUID)
+		}
+	}
+
+	var replayed []BackupItem
+
+	for _, bt := range types {
+		for _, uuid := range order {
+			if bi, ok := state[uuid]; ok && bi.Type == bt.ContentType {
+				replayed = append(replayed, bi)
+			}
+		}
+	}
+
+	return replayed, nil
+}
+
+// readChainEntry reads the items and tombstones of a single archive in a chain
+func readChainEntry(entry BackupChainEntry, password string, types []backupItemType) ([]BackupItem, []BackupItemRef, error) {
+	zipReader, err := zip.OpenReader(entry.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", entry.Path, err)
+	}
+	defer zipReader.Close()
+
+	_, gcm, err := readBackupManifest(&zipReader.Reader, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest of %s: %w", entry.Path, err)
+	}
+
+	backupItems, err := readArchiveItems(&zipReader.Reader, gcm, types)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", entry.Path, err)
+	}
+
+	var tombstones []BackupItemRef
+
+	if zipHasEntry(&zipReader.Reader, backupDeletedFile) {
+		tombstones, err = readBackupIndex(&zipReader.Reader, backupDeletedFile, gcm)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read deleted items from %s: %w", entry.Path, err)
+		}
+	}
+
+	return backupItems, tombstones, nil
+}
@@ -0,0 +1,453 @@
+package sncli
+
+import (
+	"archive/zip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// BackupFormatVersion1 archives encrypt every entry, including the manifest, using a fixed salt
+	BackupFormatVersion1 = "1.0"
+	// BackupFormatVersion2 archives keep the manifest unencrypted and record a per-backup salt and KDF
+	BackupFormatVersion2 = "2.0"
+	// BackupFormatVersion3 archives store items in chunks, with encrypted chunks sealed as a stream of frames
+	BackupFormatVersion3 = "3.0"
+
+	BackupKDFPBKDF2   = "pbkdf2-sha256"
+	BackupKDFArgon2id = "argon2id"
+
+	backupManifestFile = "manifest.json"
+	backupSaltLength   = 16
+	backupKeyLength    = 32
+
+	legacyBackupSalt       = "sn-cli-backup-salt"
+	legacyBackupIterations = 100000
+
+	pbkdf2Iterations = 600000
+	argon2Time       = 3
+	argon2Memory     = 64 * 1024
+	argon2Threads    = 4
+
+	// the parameters are read from the unencrypted manifest, so are bounded before use to stop
+	// a crafted backup making key derivation take hours or exhaust memory
+	maxPBKDF2Iterations = 10000000
+	maxArgon2Time       = 100
+	maxArgon2Memory     = 4 * 1024 * 1024 // KiB, 4 GiB
+	maxArgon2Threads    = 64
+)
+
+// ErrBackupPasswordRequired is returned when a backup cannot be read without its password
+var ErrBackupPasswordRequired = errors.New("password required for encrypted backup")
+
+// BackupKDF records how the encryption key of a backup was derived from its password
+type BackupKDF struct {
+	Algorithm  string `json:"algorithm"`
+	Salt       string `json:"salt"`
+	Iterations uint32 `json:"iterations"`
+	Memory     uint32 `json:"memory,omitempty"`
+	Threads    uint8  `json:"threads,omitempty"`
+	KeyLength  uint32 `json:"key_length"`
+}
+
+// NewBackupKDF returns KDF parameters for the named algorithm with a random salt
+func NewBackupKDF(algorithm string) (BackupKDF, error) {
+	salt := make([]byte, backupSaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return BackupKDF{}, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	kdf := BackupKDF{
+		Salt:      base64.StdEncoding.EncodeToString(salt),
+		KeyLength: backupKeyLength,
+	}
+
+	switch algorithm {
+	case "", BackupKDFPBKDF2, "pbkdf2":
+		kdf.Algorithm = BackupKDFPBKDF2
+		kdf.Iterations = pbkdf2Iterations
+	case BackupKDFArgon2id:
+		kdf.Algorithm = BackupKDFArgon2id
+		kdf.Iterations = argon2Time
+		kdf.Memory = argon2Memory
+		kdf.Threads = argon2Threads
+	default:
+		return BackupKDF{}, fmt.Errorf("unsupported key derivation function: %s (use pbkdf2 or argon2id)", algorithm)
+	}
+
+	return kdf, nil
+}
+
+// legacyBackupKDF returns the fixed parameters used by version 1 archives
+func legacyBackupKDF() BackupKDF {
+	return BackupKDF{
+		Algorithm:  BackupKDFPBKDF2,
+		Salt:       base64.StdEncoding.EncodeToString([]byte(legacyBackupSalt)),
+		Iterations: legacyBackupIterations,
+		KeyLength:  backupKeyLength,
+	}
+}
+
+// deriveKey derives the encryption key for the given password
+func (k BackupKDF) deriveKey(password string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(k.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+
+	if k.KeyLength == 0 || k.Iterations == 0 {
+		return nil, fmt.Errorf("invalid key derivation parameters")
+	}
+
+	if k.KeyLength > backupKeyLength {
+		return nil, fmt.Errorf("key length %d exceeds the maximum of %d", k.KeyLength, backupKeyLength)
+	}
+
+	switch k.Algorithm {
+	case BackupKDFPBKDF2:
+		if k.Iterations > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("%d iterations exceeds the maximum of %d", k.Iterations, maxPBKDF2Iterations)
+		}
+
+		return pbkdf2.Key([]byte(password), salt, int(k.Iterations), int(k.KeyLength), sha256.New), nil
+	case BackupKDFArgon2id:
+		if k.Memory == 0 || k.Threads == 0 {
+			return nil, fmt.Errorf("invalid key derivation parameters")
+		}
+
+		if k.Iterations > maxArgon2Time || k.Memory > maxArgon2Memory || k.Threads > maxArgon2Threads {
+			return nil, fmt.Errorf("argon2id parameters (time %d, memory %d KiB, threads %d) exceed the maximum of (time %d, memory %d KiB, threads %d)",
+				k.Iterations, k.Memory, k.Threads, maxArgon2Time, maxArgon2Memory, maxArgon2Threads)
+		}
+
+		return argon2.IDKey([]byte(password), salt, k.Iterations, k.Memory, k.Threads, k.KeyLength), nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function: %s", k.Algorithm)
+	}
+}
+
+// newBackupCipher derives a key from the password and returns an AES-GCM cipher
+func newBackupCipher(password string, kdf BackupKDF) (cipher.AEAD, error) {
+	key, err := kdf.deriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return gcm, nil
+}
+
+// encryptBackupData seals data with a random nonce prefix
+func encryptBackupData(data []byte, gcm cipher.AEAD) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// decryptBackupData opens data sealed by encryptBackupData
+func decryptBackupData(data []byte, gcm cipher.AEAD) ([]byte, error) {
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// writeZipEntry writes data to the zip archive, encrypting it if a cipher is provided
+func writeZipEntry(zipWriter *zip.Writer, filename string, data []byte, gcm cipher.AEAD) error {
+	fileWriter, err := zipWriter.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create zip entry: %w", err)
+	}
+
+	if gcm != nil {
+		encrypted, err := encryptBackupData(data, gcm)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fileWriter.Write(encrypted); err != nil {
+			return fmt.Errorf("failed to write encrypted data: %w", err)
+		}
+
+		return nil
+	}
+
+	if _, err := fileWriter.Write(data); err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+
+	return nil
+}
+
+// readZipEntry reads a file from the zip archive, decrypting it if a cipher is provided
+func readZipEntry(zipReader *zip.Reader, filename string, gcm cipher.AEAD) ([]byte, error) {
+	for _, file := range zipReader.File {
+		if file.Name != filename {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+
+		if gcm != nil {
+			return decryptBackupData(data, gcm)
+		}
+
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("file %s not found in backup", filename)
+}
+
+// readBackupManifest reads the manifest and returns the cipher needed to read the remaining entries.
+// Version 1 archives encrypted the manifest itself, so a password is needed just to read it.
+func readBackupManifest(zipReader *zip.Reader, password string) (BackupManifest, cipher.AEAD, error) {
+	var manifest BackupManifest
+
+	data, err := readZipEntry(zipReader, backupManifestFile, nil)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("manifest not found in backup")
+	}
+
+	if !json.Valid(data) {
+		// version 1 encrypted manifest
+		manifest = BackupManifest{Encrypted: true, Version: BackupFormatVersion1}
+		if password == "" {
+			return manifest, nil, ErrBackupPasswordRequired
+		}
+
+		gcm, err := newBackupCipher(password, legacyBackupKDF())
+		if err != nil {
+			return manifest, nil, err
+		}
+
+		if data, err = decryptBackupData(data, gcm); err != nil {
+			return manifest, nil, fmt.Errorf("failed to decrypt manifest: %w", err)
+		}
+
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return manifest, nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+
+		return manifest, gcm, nil
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	if !manifest.Encrypted {
+		return manifest, nil, nil
+	}
+
+	if password == "" {
+		return manifest, nil, ErrBackupPasswordRequired
+	}
+
+	kdf := legacyBackupKDF()
+	if manifest.KDF != nil {
+		kdf = *manifest.KDF
+	}
+
+	gcm, err := newBackupCipher(password, kdf)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	return manifest, gcm, nil
+}
+
+// RekeyConfig holds configuration for re-encrypting a backup under a new password
+type RekeyConfig struct {
+	InputFile   string
+	OutputFile  string
+	OldPassword string
+	NewPassword string
+	KDF         string
+}
+
+// rekeyEntry copies an entry to the new archive, re-encrypting it with the new cipher.
+// Chunks are streamed so they never need to be held in memory.
+func rekeyEntry(zipReader *zip.Reader, file *zip.File, zipWriter *zip.Writer, manifest *BackupManifest, oldGCM, newGCM cipher.AEAD) error {
+	if !backupChunkPattern.MatchString(file.Name) {
+		data, err := readZipEntry(zipReader, file.Name, oldGCM)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+
+		if err := writeBackupEntry(zipWriter, manifest, file.Name, data, newGCM); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Name, err)
+		}
+
+		return nil
+	}
+
+	rc, err := openBackupChunk(file, oldGCM)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	defer rc.Close()
+
+	entry, err := createBackupEntry(zipWriter, manifest, rekeyChunkName(file.Name), newGCM)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(entry, rc); err != nil {
+		return fmt.Errorf("failed to re-encrypt %s: %w", file.Name, err)
+	}
+
+	return entry.Close()
+}
+
+// Run re-encrypts every entry of the backup with a key derived from the new password.
+// Version 1 archives are upgraded to version 2. If no output file is given the input is replaced.
+func (r *RekeyConfig) Run() (BackupManifest, error) {
+	if len(r.NewPassword) < MinPasswordLength {
+		return BackupManifest{}, fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+
+	zipReader, err := zip.OpenReader(r.InputFile)
+	if err != nil {
+		return BackupManifest{}, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer zipReader.Close()
+
+	manifest, oldGCM, err := readBackupManifest(&zipReader.Reader, r.OldPassword)
+	if err != nil {
+		return manifest, err
+	}
+
+	kdf, err := NewBackupKDF(r.KDF)
+	if err != nil {
+		return manifest, err
+	}
+
+	newGCM, err := newBackupCipher(r.NewPassword, kdf)
+	if err != nil {
+		return manifest, err
+	}
+
+	outputFile := r.OutputFile
+	if outputFile == "" {
+		outputFile = r.InputFile
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(outputFile), ".sn-backup-rekey-*")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+
+	zipWriter := zip.NewWriter(tmpFile)
+
+	// checksums change with the new encryption
+	manifest.Entries = nil
+	manifest.Digest = ""
+
+	for _, file := range zipReader.File {
+		if file.Name == backupManifestFile {
+			continue
+		}
+
+		if err := rekeyEntry(&zipReader.Reader, file, zipWriter, &manifest, oldGCM, newGCM); err != nil {
+			_ = tmpFile.Close()
+
+			return manifest, err
+		}
+	}
+
+	manifest.Encrypted = true
+	manifest.KDF = &kdf
+	// incrementals find the backup by ID, so they still do once its hash has changed
+	manifest.Rekeyed = time.Now().UTC().Format(time.RFC3339)
+
+	if manifest.ID == "" {
+		if manifest.ID, err = newBackupID(); err != nil {
+			_ = tmpFile.Close()
+
+			return manifest, err
+		}
+	}
+
+	if manifest.Version == BackupFormatVersion1 {
+		manifest.Version = BackupFormatVersion2
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		_ = tmpFile.Close()
+
+		return manifest, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if err := writeZipEntry(zipWriter, backupManifestFile, manifestData, nil); err != nil {
+		_ = tmpFile.Close()
+
+		return manifest, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		_ = tmpFile.Close()
+
+		return manifest, fmt.Errorf("failed to finalise backup: %w", err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to finalise backup: %w", err)
+	}
+
+	// release the input before it's replaced
+	_ = zipReader.Close()
+
+	if err := os.Rename(tmpName, outputFile); err != nil {
+		return manifest, fmt.Errorf("failed to write backup file: %w", err)
+	}
+
+	return manifest, nil
+}
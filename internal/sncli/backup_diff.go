@@ -0,0 +1,258 @@
+package sncli
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DiffChange describes how an item differs between two snapshots
+type DiffChange string
+
+const (
+	DiffAdded    DiffChange = "added"
+	DiffRemoved  DiffChange = "removed"
+	DiffModified DiffChange = "modified"
+)
+
+// DiffEntry describes a single item that differs between two snapshots
+type DiffEntry struct {
+	UUID   string     `json:"uuid"`
+	Type   string     `json:"type"`
+	Title  string     `json:"title"`
+	Change DiffChange `json:"change"`
+	// Fields lists the content fields that changed for modified items
+	Fields []string `json:"fields,omitempty"`
+	// Diff is a unified diff of a modified note's text
+	Diff string `json:"diff,omitempty"`
+}
+
+// BackupDiff contains the differences between two snapshots, from the first to the second
+type BackupDiff struct {
+	From     string      `json:"from"`
+	To       string      `json:"to"`
+	Added    []DiffEntry `json:"added"`
+	Removed  []DiffEntry `json:"removed"`
+	Modified []DiffEntry `json:"modified"`
+}
+
+// DiffConfig holds configuration for comparing a backup with another backup or the live account
+type DiffConfig struct {
+	Session   *cache.Session
+	FileA     string
+	FileB     string
+	PasswordA string
+	PasswordB string
+	// Live compares FileA with the account instead of FileB
+	Live bool
+}
+
+// diffTypes are the item types compared by a diff
+var diffTypes = []string{"tags", "notes"}
+
+// Run compares the snapshots. Incremental backups are compared as the state
+// they represent, by replaying their chain.
+func (d *DiffConfig) Run() (BackupDiff, error) {
+	result := BackupDiff{From: d.FileA, To: d.FileB}
+
+	from, err := loadBackupSnapshot(d.FileA, d.PasswordA)
+	if err != nil {
+		return result, err
+	}
+
+	var to []BackupItem
+
+	if d.Live {
+		result.To = "live account"
+
+		if d.Session == nil {
+			return result, fmt.Errorf("session is required to compare with the live account")
+		}
+
+		to, err = loadLiveSnapshot(d.Session)
+	} else {
+		to, err = loadBackupSnapshot(d.FileB, d.PasswordB)
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	diffBackupItems(from, to, &result)
+
+	return result, nil
+}
+
+// loadBackupSnapshot returns the notes and tags in a backup
+func loadBackupSnapshot(path, password string) ([]BackupItem, error) {
+	types, err := parseBackupTypes(diffTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	zipReader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer zipReader.Close()
+
+	manifest, gcm, err := readBackupManifest(&zipReader.Reader, password)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if !manifest.Incremental {
+		return readArchiveItems(&zipReader.Reader, gcm, types)
+	}
+
+	chain, err := resolveChainFor(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return replayBackupChain(chain, password, types)
+}
+
+// loadLiveSnapshot returns the notes and tags in the account in their backup form
+func loadLiveSnapshot(session *cache.Session) ([]BackupItem, error) {
+	types, err := parseBackupTypes(diffTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	allItems, err := syncAllItems(session)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot []BackupItem
+
+	for _, bt := range types {
+		for _, item := range allItems {
+			if item.GetContentType() != bt.ContentType {
+				continue
+			}
+
+			bi, err := newBackupItem(item)
+			if err != nil {
+				return nil, err
+			}
+
+			snapshot = append(snapshot, bi)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// diffBackupItems matches items by UUID and records those added, removed or modified
+func diffBackupItems(from, to []BackupItem, result *BackupDiff) {
+	fromByUUID := make(map[string]BackupItem, len(from))
+	for _, bi := range from {
+		fromByUUID[bi.UUID] = bi
+	}
+
+	toByUUID := make(map[string]BackupItem, len(to))
+	for _, bi := range to {
+		toByUUID[bi.UUID] = bi
+	}
+
+	for _, bi := range to {
+		before, ok := fromByUUID[bi.UUID]
+		if !ok {
+			result.Added = append(result.Added, DiffEntry{
+				UUID:   bi.UUID,
+				Type:   bi.Type,
+				Title:  backupItemTitle(bi),
+				Change: DiffAdded,
+			})
+
+			continue
+		}
+
+		if entry, modified := diffBackupItem(before, bi); modified {
+			result.Modified = append(result.Modified, entry)
+		}
+	}
+
+	for _, bi := range from {
+		if _, ok := toByUUID[bi.UUID]; !ok {
+			result.Removed = append(result.Removed, DiffEntry{
+				UUID:   bi.UUID,
+				Type:   bi.Type,
+				Title:  backupItemTitle(bi),
+				Change: DiffRemoved,
+			})
+		}
+	}
+}
+
+// diffBackupItem compares the content of two versions of an item
+func diffBackupItem(before, after BackupItem) (DiffEntry, bool) {
+	entry := DiffEntry{
+		UUID:   after.UUID,
+		Type:   after.Type,
+		Title:  backupItemTitle(after),
+		Change: DiffModified,
+	}
+
+	var beforeContent, afterContent map[string]interface{}
+
+	_ = json.Unmarshal([]byte(before.Content), &beforeContent)
+	_ = json.Unmarshal([]byte(after.Content), &afterContent)
+
+	fields := make(map[string]bool)
+	for field := range beforeContent {
+		fields[field] = true
+	}
+
+	for field := range afterContent {
+		fields[field] = true
+	}
+
+	for field := range fields {
+		if !reflect.DeepEqual(beforeContent[field], afterContent[field]) {
+			entry.Fields = append(entry.Fields, field)
+		}
+	}
+
+	if len(entry.Fields) == 0 {
+		return entry, false
+	}
+
+	sort.Strings(entry.Fields)
+
+	if after.Type == common.SNItemTypeNote {
+		beforeText, _ := beforeContent["text"].(string)
+		afterText, _ := afterContent["text"].(string)
+
+		if beforeText != afterText {
+			entry.Diff, _ = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(beforeText),
+				B:        difflib.SplitLines(afterText),
+				FromFile: backupItemTitle(before),
+				ToFile:   entry.Title,
+				Context:  3,
+			})
+		}
+	}
+
+	return entry, true
+}
+
+// backupItemTitle returns the title recorded in a backup item's content
+func backupItemTitle(bi BackupItem) string {
+	var content struct {
+		Title string `json:"title"`
+	}
+
+	_ = json.Unmarshal([]byte(bi.Content), &content)
+
+	return content.Title
+}
@@ -0,0 +1,425 @@
+package sncli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// RestoreConflictPolicy determines how backup items that already exist in the account are handled
+type RestoreConflictPolicy string
+
+const (
+	// RestoreConflictSkip leaves existing items untouched
+	RestoreConflictSkip RestoreConflictPolicy = "skip"
+	// RestoreConflictOverwrite replaces existing items with the backed up version
+	RestoreConflictOverwrite RestoreConflictPolicy = "overwrite"
+	// RestoreConflictCopy restores existing items as copies with new UUIDs
+	RestoreConflictCopy RestoreConflictPolicy = "copy"
+)
+
+// RestoreAction describes what happened, or would happen, to a backup item
+type RestoreAction string
+
+const (
+	RestoreActionCreated     RestoreAction = "created"
+	RestoreActionCopied      RestoreAction = "copied"
+	RestoreActionOverwritten RestoreAction = "overwritten"
+	RestoreActionRelinked    RestoreAction = "relinked"
+	RestoreActionSkipped     RestoreAction = "skipped"
+)
+
+// RestoredItem records the outcome of restoring a single item
+type RestoredItem struct {
+	UUID        string
+	NewUUID     string
+	ContentType string
+	Title       string
+	Action      RestoreAction
+	Reason      string
+}
+
+// ParseRestoreConflictPolicy converts a policy name into a RestoreConflictPolicy
+func ParseRestoreConflictPolicy(name string) (RestoreConflictPolicy, error) {
+	switch RestoreConflictPolicy(name) {
+	case "", RestoreConflictSkip:
+		return RestoreConflictSkip, nil
+	case RestoreConflictOverwrite:
+		return RestoreConflictOverwrite, nil
+	case RestoreConflictCopy:
+		return RestoreConflictCopy, nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy: %s (use skip, overwrite or copy)", name)
+	}
+}
+
+// restorePlan contains the items to persist and the outcome for each backup item
+type restorePlan struct {
+	toSave     items.Items
+	created    []RestoredItem
+	updated    []RestoredItem
+	skipped    []RestoredItem
+	conflicted []RestoredItem
+}
+
+// restoreItems works out what to restore and, unless this is a dry run, persists it
+func (r *RestoreConfig) restoreItems(backupItems []BackupItem, result *RestoreResult) error {
+	policy, err := ParseRestoreConflictPolicy(string(r.ConflictPolicy))
+	if err != nil {
+		return err
+	}
+
+	result.Policy = policy
+
+	backupItems, dependencies := selectBackupItems(backupItems, r.Filter)
+	result.ItemCounts = countBackupItems(backupItems)
+
+	if r.Session == nil {
+		return fmt.Errorf("session is required to restore")
+	}
+
+	existing, err := syncAllItems(r.Session)
+	if err != nil {
+		return fmt.Errorf("failed to load existing items: %w", err)
+	}
+
+	plan, err := planRestore(backupItems, existing, policy, dependencies)
+	if err != nil {
+		return err
+	}
+
+	result.Created = plan.created
+	result.Updated = plan.updated
+	result.Skipped = plan.skipped
+	result.Conflicted = plan.conflicted
+
+	if r.DryRun || len(plan.toSave) == 0 {
+		return nil
+	}
+
+	return r.saveItems(plan.toSave)
+}
+
+// saveItems persists the restored items to the cache and syncs them to the account
+func (r *RestoreConfig) saveItems(toSave items.Items) error {
+	so, err := Sync(cache.SyncInput{
+		Session: r.Session,
+	}, true)
+	if err != nil {
+		return err
+	}
+
+	if err = cache.SaveItems(r.Session, so.DB, toSave, true); err != nil {
+		return fmt.Errorf("failed to save restored items: %w", err)
+	}
+
+	_, err = Sync(cache.SyncInput{
+		Session: r.Session,
+		Close:   true,
+	}, true)
+
+	return err
+}
+
+// planRestore decides, for each backup item, whether it is created, copied, overwritten or skipped
+// and re-links references so they point at the UUIDs the items will have after the restore.
+// Dependencies are tags restored only because they reference selected items. Existing ones are
+// never replaced, just linked to the restored items, and new ones only reference items that will exist.
+func planRestore(backupItems []BackupItem, existing items.Items, policy RestoreConflictPolicy, dependencies map[string]bool) (restorePlan, error) {
+	var plan restorePlan
+
+	existingByUUID := make(map[string]items.Item, len(existing))
+	existingByType := make(map[string]items.Item)
+
+	for _, item := range existing {
+		existingByUUID[item.GetUUID()] = item
+		existingByType[item.GetContentType()] = item
+	}
+
+	// first pass: parse items and allocate the UUID each will be restored as
+	type pending struct {
+		item     items.Item
+		existing items.Item
+		action   RestoreAction
+		reason   string
+	}
+
+	var pendingItems []pending
+
+	uuidMap := make(map[string]string, len(backupItems))
+	restored := make(map[string]bool, len(backupItems))
+
+	for _, bi := range backupItems {
+		bt, supported := backupTypeByContentType(bi.Type)
+		if !supported {
+			plan.skipped = append(plan.skipped, RestoredItem{
+				UUID:        bi.UUID,
+				ContentType: bi.Type,
+				Action:      RestoreActionSkipped,
+				Reason:      "content type cannot be restored",
+			})
+
+			continue
+		}
+
+		item, err := parseBackupItem(bi)
+		if err != nil {
+			return plan, err
+		}
+
+		reason := "uuid already exists in account"
+
+		current, exists := existingByUUID[bi.UUID]
+		if !exists && bt.Singleton {
+			// an account only has one of these, so the existing one is replaced rather than duplicated
+			current, exists = existingByType[bt.ContentType]
+			reason = "account already has " + bt.Name
+		}
+
+		if !exists {
+			uuidMap[bi.UUID] = bi.UUID
+			restored[bi.UUID] = true
+			pendingItems = append(pendingItems, pending{item: item, action: RestoreActionCreated})
+
+			continue
+		}
+
+		if dependencies[bi.UUID] {
+			uuidMap[bi.UUID] = current.GetUUID()
+			pendingItems = append(pendingItems, pending{
+				item:     item,
+				existing: current,
+				action:   RestoreActionSkipped,
+				reason:   "already exists, linked to restored items",
+			})
+
+			continue
+		}
+
+		var action RestoreAction
+
+		switch {
+		case policy == RestoreConflictOverwrite:
+			action = RestoreActionOverwritten
+			uuidMap[bi.UUID] = current.GetUUID()
+			restored[bi.UUID] = true
+		case policy == RestoreConflictCopy && !bt.Singleton:
+			action = RestoreActionCopied
+			uuidMap[bi.UUID] = items.GenUUID()
+			restored[bi.UUID] = true
+		default:
+			action = RestoreActionSkipped
+			uuidMap[bi.UUID] = current.GetUUID()
+		}
+
+		plan.conflicted = append(plan.conflicted, RestoredItem{
+			UUID:        bi.UUID,
+			NewUUID:     uuidMap[bi.UUID],
+			ContentType: bi.Type,
+			Title:       itemTitle(item),
+			Action:      action,
+			Reason:      reason,
+		})
+
+		pendingItems = append(pendingItems, pending{item: item, existing: current, action: action, reason: reason})
+	}
+
+	// second pass: rewrite references and build the list of items to save
+	for _, p := range pendingItems {
+		oldUUID := p.item.GetUUID()
+		outcome := RestoredItem{
+			UUID:        oldUUID,
+			NewUUID:     uuidMap[oldUUID],
+			ContentType: p.item.GetContentType(),
+			Title:       itemTitle(p.item),
+			Action:      p.action,
+		}
+
+		switch p.action {
+		case RestoreActionSkipped:
+			outcome.Reason = p.reason
+			plan.skipped = append(plan.skipped, outcome)
+
+			// make sure an existing tag still references the items restored alongside it
+			if relinked := relinkExistingTag(p.existing, p.item, uuidMap, restored); relinked != nil {
+				plan.toSave = append(plan.toSave, relinked)
+				plan.updated = append(plan.updated, RestoredItem{
+					UUID:        oldUUID,
+					NewUUID:     oldUUID,
+					ContentType: outcome.ContentType,
+					Title:       outcome.Title,
+					Action:      RestoreActionRelinked,
+					Reason:      "added references to restored items",
+				})
+			}
+
+			continue
+		case RestoreActionOverwritten:
+			// keep the server's UUID and timestamps so the update is not treated as a conflict
+			p.item.SetUUID(p.existing.GetUUID())
+			p.item.SetUpdatedAt(p.existing.GetUpdatedAt())
+			p.item.SetUpdatedAtTimestamp(p.existing.GetUpdatedAtTimestamp())
+			plan.updated = append(plan.updated, outcome)
+		case RestoreActionCopied:
+			p.item.SetUUID(uuidMap[oldUUID])
+			p.item.SetUpdatedAt("")
+			p.item.SetUpdatedAtTimestamp(0)
+			plan.created = append(plan.created, outcome)
+		default:
+			p.item.SetUpdatedAt("")
+			p.item.SetUpdatedAtTimestamp(0)
+			plan.created = append(plan.created, outcome)
+
+			if dependencies[oldUUID] {
+				dropDanglingReferences(p.item, restored, existingByUUID)
+			}
+		}
+
+		remapReferences(p.item, uuidMap)
+		plan.toSave = append(plan.toSave, p.item)
+	}
+
+	return plan, nil
+}
+
+// relinkExistingTag returns the existing tag with references added for any restored items
+// the backed up tag referenced, or nil if nothing needs to change.
+func relinkExistingTag(existing, backedUp items.Item, uuidMap map[string]string, restored map[string]bool) items.Item {
+	existingTag, ok := existing.(*items.Tag)
+	if !ok {
+		return nil
+	}
+
+	backedUpTag, ok := backedUp.(*items.Tag)
+	if !ok {
+		return nil
+	}
+
+	var newRefs items.ItemReferences
+
+	for _, ref := range backedUpTag.Content.References() {
+		if !restored[ref.UUID] {
+			continue
+		}
+
+		mapped := ref
+		mapped.UUID = uuidMap[ref.UUID]
+
+		if referenceExists(*existingTag, mapped.UUID) {
+			continue
+		}
+
+		newRefs = append(newRefs, mapped)
+	}
+
+	if len(newRefs) == 0 {
+		return nil
+	}
+
+	existingTag.Content.UpsertReferences(newRefs)
+
+	return existingTag
+}
+
+// dropDanglingReferences removes references to items that are neither being restored nor in the account
+func dropDanglingReferences(item items.Item, restored map[string]bool, existing map[string]items.Item) {
+	content := item.GetContent()
+	if content == nil {
+		return
+	}
+
+	var kept items.ItemReferences
+
+	for _, ref := range content.References() {
+		if _, ok := existing[ref.UUID]; ok || restored[ref.UUID] {
+			kept = append(kept, ref)
+		}
+	}
+
+	content.SetReferences(kept)
+	item.SetContent(content)
+}
+
+// remapReferences updates an item's references to use the UUIDs allocated during restore
+func remapReferences(item items.Item, uuidMap map[string]string) {
+	content := item.GetContent()
+	if content == nil {
+		return
+	}
+
+	refs := content.References()
+	if len(refs) > 0 {
+		remapped := make(items.ItemReferences, 0, len(refs))
+
+		for _, ref := range refs {
+			if newUUID, ok := uuidMap[ref.UUID]; ok {
+				ref.UUID = newUUID
+			}
+
+			remapped = append(remapped, ref)
+		}
+
+		content.SetReferences(remapped)
+		item.SetContent(content)
+	}
+
+	if tag, ok := item.(*items.Tag); ok && tag.Content.ParentId != "" {
+		if newUUID, ok := uuidMap[tag.Content.ParentId]; ok {
+			tag.Content.ParentId = newUUID
+		}
+	}
+}
+
+// parseBackupItem converts a backup item back into a gosn item. The parser panics on some types
+// when their content doesn't match, so that's recovered from and returned as an error.
+func parseBackupItem(bi BackupItem) (item items.Item, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			item, err = nil, fmt.Errorf("backup item %s cannot be parsed: %v", bi.UUID, r)
+		}
+	}()
+
+	if bi.UUID == "" {
+		return nil, fmt.Errorf("backup item of type %s is missing a uuid", bi.Type)
+	}
+
+	if !json.Valid([]byte(bi.Content)) {
+		return nil, fmt.Errorf("backup item %s has invalid content", bi.UUID)
+	}
+
+	item, err = items.ParseItem(items.DecryptedItem{
+		UUID:        bi.UUID,
+		ContentType: bi.Type,
+		Content:     bi.Content,
+		CreatedAt:   bi.CreatedAt,
+		UpdatedAt:   bi.UpdatedAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse backup item %s: %w", bi.UUID, err)
+	}
+
+	if item == nil {
+		return nil, fmt.Errorf("unsupported backup item type: %s", bi.Type)
+	}
+
+	return item, nil
+}
+
+// itemTitle returns the title or name of an item, or an empty string if it has neither
+func itemTitle(item items.Item) string {
+	switch item.GetContentType() {
+	case common.SNItemTypeNote:
+		return item.(*items.Note).Content.GetTitle()
+	case common.SNItemTypeTag:
+		return item.(*items.Tag).Content.GetTitle()
+	case common.SNItemTypeSmartTag:
+		return item.(*items.SmartView).Content.GetTitle()
+	case common.SNItemTypeComponent:
+		return item.(*items.Component).Content.GetName()
+	default:
+		return ""
+	}
+}
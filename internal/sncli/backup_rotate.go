@@ -0,0 +1,206 @@
+package sncli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// RotateConfig holds configuration for pruning old backups from a directory
+type RotateConfig struct {
+	Dir         string
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	DryRun      bool
+}
+
+// RotateEntry records what happened, or would happen, to a backup during rotation
+type RotateEntry struct {
+	Path        string
+	Timestamp   string
+	Incremental bool
+	Reasons     []string
+}
+
+// RotateResult contains the outcome of a rotation
+type RotateResult struct {
+	DryRun   bool
+	Kept     []RotateEntry
+	Pruned   []RotateEntry
+	Warnings []string
+}
+
+// Run applies the retention policy to the backups in the directory. A backup is kept if it is
+// the latest of one of the most recent days, weeks or months, or if a kept incremental depends on it.
+func (r *RotateConfig) Run() (RotateResult, error) {
+	result := RotateResult{DryRun: r.DryRun}
+
+	if r.KeepDaily < 0 || r.KeepWeekly < 0 || r.KeepMonthly < 0 {
+		return result, fmt.Errorf("retention counts cannot be negative")
+	}
+
+	if r.KeepDaily+r.KeepWeekly+r.KeepMonthly == 0 {
+		return result, fmt.Errorf("at least one of keep-daily, keep-weekly or keep-monthly is required")
+	}
+
+	entries, err := readBackupDir(r.Dir)
+	if err != nil {
+		return result, err
+	}
+
+	reasons := selectRetainedBackups(entries, r.KeepDaily, r.KeepWeekly, r.KeepMonthly)
+	result.Warnings = retainBackupDependencies(entries, reasons)
+
+	// newest first
+	for x := len(entries) - 1; x >= 0; x-- {
+		entry := RotateEntry{
+			Path:        entries[x].Path,
+			Timestamp:   entries[x].Manifest.Timestamp,
+			Incremental: entries[x].Manifest.Incremental,
+			Reasons:     reasons[entries[x].Path],
+		}
+
+		if len(entry.Reasons) > 0 {
+			result.Kept = append(result.Kept, entry)
+
+			continue
+		}
+
+		if !r.DryRun {
+			if err := os.Remove(entry.Path); err != nil {
+				return result, fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+			}
+		}
+
+		result.Pruned = append(result.Pruned, entry)
+	}
+
+	return result, nil
+}
+
+// selectRetainedBackups returns the reasons each backup is kept under the daily, weekly
+// and monthly rules, keyed by path. entries must be sorted oldest first.
+func selectRetainedBackups(entries []BackupChainEntry, keepDaily, keepWeekly, keepMonthly int) map[string][]string {
+	reasons := make(map[string][]string)
+
+	rules := []struct {
+		name   string
+		keep   int
+		period func(time.Time) string
+	}{
+		{"daily", keepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", keepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{"monthly", keepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+
+	for _, rule := range rules {
+		seen := make(map[string]bool)
+
+		for x := len(entries) - 1; x >= 0 && len(seen) < rule.keep; x-- {
+			ts := backupTime(entries[x].Manifest)
+			if ts.IsZero() {
+				continue
+			}
+
+			period := rule.period(ts)
+			if seen[period] {
+				continue
+			}
+
+			seen[period] = true
+			reasons[entries[x].Path] = append(reasons[entries[x].Path], rule.name)
+		}
+	}
+
+	// backups without a readable timestamp can't be placed, so are left alone
+	for _, entry := range entries {
+		if backupTime(entry.Manifest).IsZero() {
+			reasons[entry.Path] = append(reasons[entry.Path], "unknown timestamp")
+		}
+	}
+
+	return reasons
+}
+
+// retainBackupDependencies keeps every backup a retained incremental needs to be restored,
+// back to its full backup, and makes sure at least one full backup is kept.
+// It returns warnings for retained incrementals whose chain is broken.
+func retainBackupDependencies(entries []BackupChainEntry, reasons map[string][]string) []string {
+	var warnings []string
+
+	// sort retained paths so warnings are stable
+	var retained []string
+
+	for path := range reasons {
+		retained = append(retained, path)
+	}
+
+	sort.Strings(retained)
+
+	byPath := make(map[string]BackupChainEntry, len(entries))
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+
+	keptFull := false
+
+	for _, path := range retained {
+		current := byPath[path]
+		visited := map[string]bool{path: true}
+
+		for current.Manifest.Incremental {
+			parent := current.Manifest.Parent
+			if parent == nil {
+				warnings = append(warnings, fmt.Sprintf("%s does not record its parent and cannot be restored", current.Path))
+
+				break
+			}
+
+			next, ok := findBackupParent(current.Manifest, entries)
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("parent %s of %s is missing, so it cannot be restored", parent.File, current.Path))
+
+				break
+			}
+
+			// a chain that loops back on itself never reaches a full backup
+			if visited[next.Path] {
+				warnings = append(warnings, fmt.Sprintf("backup chain of %s contains a cycle at %s, so it cannot be restored", path, next.Path))
+
+				break
+			}
+
+			visited[next.Path] = true
+
+			if !StringInSlice("parent of "+current.Path, reasons[next.Path], true) {
+				reasons[next.Path] = append(reasons[next.Path], "parent of "+current.Path)
+			}
+
+			current = next
+		}
+
+		if !current.Manifest.Incremental {
+			keptFull = true
+		}
+	}
+
+	if keptFull {
+		return warnings
+	}
+
+	for x := len(entries) - 1; x >= 0; x-- {
+		if !entries[x].Manifest.Incremental {
+			reasons[entries[x].Path] = append(reasons[entries[x].Path], "latest full backup")
+
+			break
+		}
+	}
+
+	return warnings
+}
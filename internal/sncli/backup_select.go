@@ -0,0 +1,170 @@
+package sncli
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/common"
+)
+
+// RestoreFilter selects which backup items are restored. Criteria are combined,
+// so an item must match all that are set. An empty filter selects everything.
+type RestoreFilter struct {
+	UUIDs  []string
+	Titles []string
+	// Tags selects the notes referenced by tags with these titles
+	Tags          []string
+	UpdatedBefore time.Time
+}
+
+// IsEmpty reports whether the filter has no criteria
+func (f RestoreFilter) IsEmpty() bool {
+	return len(f.UUIDs) == 0 && len(f.Titles) == 0 && len(f.Tags) == 0 && f.UpdatedBefore.IsZero()
+}
+
+// backupItemRefs is the part of an item's content needed to follow its references
+type backupItemRefs struct {
+	References []struct {
+		UUID        string `json:"uuid"`
+		ContentType string `json:"content_type"`
+	} `json:"references"`
+	ParentID string `json:"parentId"`
+}
+
+func parseBackupItemRefs(bi BackupItem) backupItemRefs {
+	var refs backupItemRefs
+
+	_ = json.Unmarshal([]byte(bi.Content), &refs)
+
+	return refs
+}
+
+// selectBackupItems returns the items matching the filter along with the tags that reference them,
+// and their parent tags, so restored notes keep their tags. The UUIDs of tags brought along
+// only as dependencies are returned separately.
+func selectBackupItems(backupItems []BackupItem, filter RestoreFilter) ([]BackupItem, map[string]bool) {
+	if filter.IsEmpty() {
+		return backupItems, nil
+	}
+
+	byUUID := make(map[string]BackupItem, len(backupItems))
+	for _, bi := range backupItems {
+		byUUID[bi.UUID] = bi
+	}
+
+	tagged := taggedNoteUUIDs(backupItems, filter.Tags)
+
+	selected := make(map[string]bool)
+
+	for _, bi := range backupItems {
+		if matchesRestoreFilter(bi, filter, tagged) {
+			selected[bi.UUID] = true
+		}
+	}
+
+	dependencies := make(map[string]bool)
+
+	// bring along tags that reference selected items, then their parents
+	for _, bi := range backupItems {
+		if bi.Type != common.SNItemTypeTag || selected[bi.UUID] {
+			continue
+		}
+
+		for _, ref := range parseBackupItemRefs(bi).References {
+			if selected[ref.UUID] {
+				dependencies[bi.UUID] = true
+
+				break
+			}
+		}
+	}
+
+	for pending := mapKeys(dependencies); len(pending) > 0; {
+		uuid := pending[0]
+		pending = pending[1:]
+
+		refs := parseBackupItemRefs(byUUID[uuid])
+		parents := []string{refs.ParentID}
+
+		for _, ref := range refs.References {
+			if ref.ContentType == common.SNItemTypeTag {
+				parents = append(parents, ref.UUID)
+			}
+		}
+
+		for _, parent := range parents {
+			if _, ok := byUUID[parent]; !ok || selected[parent] || dependencies[parent] {
+				continue
+			}
+
+			dependencies[parent] = true
+			pending = append(pending, parent)
+		}
+	}
+
+	var result []BackupItem
+
+	for _, bi := range backupItems {
+		if selected[bi.UUID] || dependencies[bi.UUID] {
+			result = append(result, bi)
+		}
+	}
+
+	return result, dependencies
+}
+
+// matchesRestoreFilter reports whether an item matches every criterion set in the filter
+func matchesRestoreFilter(bi BackupItem, filter RestoreFilter, tagged map[string]bool) bool {
+	if len(filter.UUIDs) > 0 && !StringInSlice(bi.UUID, filter.UUIDs, false) {
+		return false
+	}
+
+	if len(filter.Titles) > 0 && !StringInSlice(backupItemTitle(bi), filter.Titles, true) {
+		return false
+	}
+
+	if len(filter.Tags) > 0 && !tagged[bi.UUID] {
+		return false
+	}
+
+	if !filter.UpdatedBefore.IsZero() {
+		updated, err := time.Parse(time.RFC3339, bi.UpdatedAt)
+		if err != nil || !updated.Before(filter.UpdatedBefore) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// taggedNoteUUIDs returns the UUIDs of notes referenced by tags with the given titles
+func taggedNoteUUIDs(backupItems []BackupItem, tagTitles []string) map[string]bool {
+	tagged := make(map[string]bool)
+
+	if len(tagTitles) == 0 {
+		return tagged
+	}
+
+	for _, bi := range backupItems {
+		if bi.Type != common.SNItemTypeTag || !StringInSlice(backupItemTitle(bi), tagTitles, true) {
+			continue
+		}
+
+		for _, ref := range parseBackupItemRefs(bi).References {
+			if ref.ContentType == common.SNItemTypeNote {
+				tagged[ref.UUID] = true
+			}
+		}
+	}
+
+	return tagged
+}
+
+func mapKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
@@ -0,0 +1,489 @@
+package sncli
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// backupChunkItems is the maximum number of items in each chunk of a version 3 archive
+	backupChunkItems = 1000
+	// backupFrameSize is the amount of plaintext sealed in each frame of an encrypted chunk
+	backupFrameSize = 64 * 1024
+	// backupNoncePrefixSize leaves room in the 12 byte GCM nonce for a frame counter and final frame flag
+	backupNoncePrefixSize = 7
+)
+
+var backupChunkPattern = regexp.MustCompile(`^([a-z]+)/(\d{4,})\.json(\.enc)?$`)
+
+// Encrypted chunks are a sequence of frames, each sealed separately, so memory use is bounded by the
+// frame size and damage is limited to the frames affected. Following the STREAM construction, each
+// nonce is a random per-entry prefix, the frame number and a flag marking the final frame. The entry
+// name is used as additional data so frames can't be reordered, truncated or moved between entries.
+//
+//	prefix (7 bytes) | length (4 bytes) | sealed frame | length | sealed frame | ...
+
+// backupStreamWriter seals data written to it into frames
+type backupStreamWriter struct {
+	w       io.Writer
+	gcm     cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+}
+
+func newBackupStreamWriter(w io.Writer, gcm cipher.AEAD, name string) (*backupStreamWriter, error) {
+	prefix := make([]byte, backupNoncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+
+	return &backupStreamWriter{
+		w:      w,
+		gcm:    gcm,
+		aad:    []byte(name),
+		prefix: prefix,
+		buf:    make([]byte, 0, backupFrameSize),
+	}, nil
+}
+
+func (s *backupStreamWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		n := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+
+		// only seal a full buffer once more data arrives, so the final frame is never empty unless the entry is
+		if len(s.buf) == cap(s.buf) && len(p) > 0 {
+			if err := s.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// Close seals the final frame
+func (s *backupStreamWriter) Close() error {
+	return s.seal(true)
+}
+
+func (s *backupStreamWriter) seal(final bool) error {
+	sealed := s.gcm.Seal(nil, streamNonce(s.prefix, s.counter, final), s.buf, s.aad)
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+
+	if _, err := s.w.Write(length[:]); err != nil {
+		return err
+	}
+
+	if _, err := s.w.Write(sealed); err != nil {
+		return err
+	}
+
+	s.counter++
+	s.buf = s.buf[:0]
+
+	return nil
+}
+
+// backupStreamReader opens frames written by backupStreamWriter
+type backupStreamReader struct {
+	r       io.Reader
+	gcm     cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	done    bool
+}
+
+func newBackupStreamReader(r io.Reader, gcm cipher.AEAD, name string) (*backupStreamReader, error) {
+	prefix := make([]byte, backupNoncePrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read nonce: %w", err)
+	}
+
+	return &backupStreamReader{
+		r:      r,
+		gcm:    gcm,
+		aad:    []byte(name),
+		prefix: prefix,
+	}, nil
+}
+
+func (s *backupStreamReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+
+		if err := s.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+
+	return n, nil
+}
+
+func (s *backupStreamReader) open() error {
+	var length [4]byte
+	if _, err := io.ReadFull(s.r, length[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("decryption failed: stream is truncated")
+		}
+
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size > backupFrameSize+uint32(s.gcm.Overhead()) {
+		return fmt.Errorf("decryption failed: invalid frame length")
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(s.r, sealed); err != nil {
+		return fmt.Errorf("decryption failed: stream is truncated")
+	}
+
+	// a frame only opens with the final flag set if it really is the last one
+	plaintext, err := s.gcm.Open(nil, streamNonce(s.prefix, s.counter, false), sealed, s.aad)
+	if err != nil {
+		plaintext, err = s.gcm.Open(nil, streamNonce(s.prefix, s.counter, true), sealed, s.aad)
+		if err != nil {
+			return fmt.Errorf("decryption failed: %w", err)
+		}
+
+		s.done = true
+
+		if n, _ := s.r.Read(make([]byte, 1)); n > 0 {
+			return fmt.Errorf("decryption failed: data after final frame")
+		}
+	}
+
+	s.counter++
+	s.buf = plaintext
+
+	return nil
+}
+
+func streamNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 0, backupNoncePrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+
+	if final {
+		return append(nonce, 1)
+	}
+
+	return append(nonce, 0)
+}
+
+// backupEntryWriter writes an entry, encrypting it if a cipher is provided, and records
+// the checksum of the stored bytes in the manifest when closed
+type backupEntryWriter struct {
+	name     string
+	manifest *BackupManifest
+	hash     hash.Hash
+	out      io.Writer
+	stream   *backupStreamWriter
+}
+
+func createBackupEntry(zipWriter *zip.Writer, manifest *BackupManifest, name string, gcm cipher.AEAD) (*backupEntryWriter, error) {
+	fileWriter, err := zipWriter.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zip entry: %w", err)
+	}
+
+	h := sha256.New()
+	stored := io.MultiWriter(fileWriter, h)
+
+	ew := &backupEntryWriter{
+		name:     name,
+		manifest: manifest,
+		hash:     h,
+		out:      stored,
+	}
+
+	if gcm != nil {
+		ew.stream, err = newBackupStreamWriter(stored, gcm, name)
+		if err != nil {
+			return nil, err
+		}
+
+		ew.out = ew.stream
+	}
+
+	return ew, nil
+}
+
+func (e *backupEntryWriter) Write(p []byte) (int, error) {
+	return e.out.Write(p)
+}
+
+func (e *backupEntryWriter) Close() error {
+	if e.stream != nil {
+		if err := e.stream.Close(); err != nil {
+			return err
+		}
+	}
+
+	if e.manifest.Entries == nil {
+		e.manifest.Entries = make(map[string]string)
+	}
+
+	e.manifest.Entries[e.name] = hex.EncodeToString(e.hash.Sum(nil))
+	e.manifest.Digest = archiveDigest(e.manifest.Entries)
+
+	return nil
+}
+
+// backupChunkWriter writes the items of a type as a series of chunks, each a JSON array
+type backupChunkWriter struct {
+	zipWriter *zip.Writer
+	manifest  *BackupManifest
+	gcm       cipher.AEAD
+	bt        backupItemType
+	chunkSize int
+
+	chunks  int
+	inChunk int
+	entry   *backupEntryWriter
+	buf     *bufio.Writer
+}
+
+func newBackupChunkWriter(zipWriter *zip.Writer, manifest *BackupManifest, gcm cipher.AEAD, bt backupItemType, chunkSize int) *backupChunkWriter {
+	return &backupChunkWriter{
+		zipWriter: zipWriter,
+		manifest:  manifest,
+		gcm:       gcm,
+		bt:        bt,
+		chunkSize: chunkSize,
+	}
+}
+
+// chunkName returns the name of a chunk entry, e.g. notes/0001.json.enc
+func chunkName(typeName string, chunk int, encrypted bool) string {
+	name := fmt.Sprintf("%s/%04d.json", typeName, chunk)
+	if encrypted {
+		name += ".enc"
+	}
+
+	return name
+}
+
+// Add writes an item to the current chunk, starting a new one if it's full
+func (c *backupChunkWriter) Add(bi BackupItem) error {
+	if c.entry != nil && c.inChunk == c.chunkSize {
+		if err := c.closeChunk(); err != nil {
+			return err
+		}
+	}
+
+	if c.entry == nil {
+		c.chunks++
+
+		entry, err := createBackupEntry(c.zipWriter, c.manifest, chunkName(c.bt.Name, c.chunks, c.gcm != nil), c.gcm)
+		if err != nil {
+			return err
+		}
+
+		c.entry = entry
+		c.buf = bufio.NewWriter(entry)
+		c.inChunk = 0
+
+		if _, err := c.buf.WriteString("["); err != nil {
+			return err
+		}
+	}
+
+	if c.inChunk > 0 {
+		if _, err := c.buf.WriteString(","); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(bi)
+	if err != nil {
+		return fmt.Errorf("failed to marshal item %s: %w", bi.UUID, err)
+	}
+
+	if _, err := c.buf.Write(data); err != nil {
+		return err
+	}
+
+	c.inChunk++
+
+	return nil
+}
+
+// Close finishes the last chunk
+func (c *backupChunkWriter) Close() error {
+	if c.entry == nil {
+		return nil
+	}
+
+	return c.closeChunk()
+}
+
+func (c *backupChunkWriter) closeChunk() error {
+	if _, err := c.buf.WriteString("]"); err != nil {
+		return err
+	}
+
+	if err := c.buf.Flush(); err != nil {
+		return err
+	}
+
+	if err := c.entry.Close(); err != nil {
+		return err
+	}
+
+	c.entry = nil
+
+	return nil
+}
+
+// chunkEntries returns the chunk entries of a type in order
+func chunkEntries(zipReader *zip.Reader, typeName string) []*zip.File {
+	var chunks []*zip.File
+
+	for _, file := range zipReader.File {
+		if match := backupChunkPattern.FindStringSubmatch(file.Name); match != nil && match[1] == typeName {
+			chunks = append(chunks, file)
+		}
+	}
+
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].Name < chunks[j].Name
+	})
+
+	return chunks
+}
+
+// isEncryptedChunk reports whether an entry is an encrypted chunk
+func isEncryptedChunk(name string) bool {
+	match := backupChunkPattern.FindStringSubmatch(name)
+
+	return match != nil && match[3] != ""
+}
+
+// openBackupChunk returns a reader of the plaintext of a chunk
+func openBackupChunk(file *zip.File, gcm cipher.AEAD) (io.ReadCloser, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	if !isEncryptedChunk(file.Name) {
+		return rc, nil
+	}
+
+	if gcm == nil {
+		_ = rc.Close()
+
+		return nil, ErrBackupPasswordRequired
+	}
+
+	stream, err := newBackupStreamReader(rc, gcm, file.Name)
+	if err != nil {
+		_ = rc.Close()
+
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{stream, rc}, nil
+}
+
+// decodeBackupChunk streams the items in a chunk to fn, one at a time
+func decodeBackupChunk(file *zip.File, gcm cipher.AEAD, fn func(BackupItem) error) error {
+	rc, err := openBackupChunk(file, gcm)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	decoder := json.NewDecoder(rc)
+
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return fmt.Errorf("failed to parse %s: expected a list of items", file.Name)
+	}
+
+	for decoder.More() {
+		var bi BackupItem
+		if err := decoder.Decode(&bi); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file.Name, err)
+		}
+
+		if err := fn(bi); err != nil {
+			return err
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file.Name, err)
+	}
+
+	return nil
+}
+
+// forEachArchiveItem streams the items of a type to fn, reading chunk by chunk,
+// or from the single entry used by version 1 and 2 archives
+func forEachArchiveItem(zipReader *zip.Reader, gcm cipher.AEAD, bt backupItemType, fn func(BackupItem) error) error {
+	if zipHasEntry(zipReader, bt.File) {
+		legacyItems, err := readBackupItems(zipReader, bt.File, gcm)
+		if err != nil {
+			return err
+		}
+
+		for _, bi := range legacyItems {
+			if err := fn(bi); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, chunk := range chunkEntries(zipReader, bt.Name) {
+		if err := decodeBackupChunk(chunk, gcm, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rekeyChunkName returns the name a chunk has once re-encrypted
+func rekeyChunkName(name string) string {
+	return strings.TrimSuffix(name, ".enc") + ".enc"
+}
@@ -0,0 +1,1156 @@
+package sncli
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func toBackupItem(t *testing.T, item items.Item) BackupItem {
+	t.Helper()
+
+	content, err := json.Marshal(item.GetContent())
+	require.NoError(t, err)
+
+	return BackupItem{
+		UUID:      item.GetUUID(),
+		Type:      item.GetContentType(),
+		Content:   string(content),
+		CreatedAt: item.GetCreatedAt(),
+		UpdatedAt: "2024-01-02T03:04:05.000Z",
+	}
+}
+
+func TestParseRestoreConflictPolicy(t *testing.T) {
+	policy, err := ParseRestoreConflictPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, RestoreConflictSkip, policy)
+
+	policy, err = ParseRestoreConflictPolicy("copy")
+	require.NoError(t, err)
+	assert.Equal(t, RestoreConflictCopy, policy)
+
+	_, err = ParseRestoreConflictPolicy("merge")
+	require.Error(t, err)
+}
+
+func TestPlanRestoreNewItems(t *testing.T) {
+	note, err := items.NewNote("Restored", "text", nil)
+	require.NoError(t, err)
+
+	tag, err := items.NewTag("work", items.ItemReferences{{UUID: note.UUID, ContentType: common.SNItemTypeNote}})
+	require.NoError(t, err)
+
+	plan, err := planRestore([]BackupItem{toBackupItem(t, &tag), toBackupItem(t, &note)}, nil, RestoreConflictSkip, nil)
+	require.NoError(t, err)
+
+	assert.Len(t, plan.created, 2)
+	assert.Empty(t, plan.skipped)
+	assert.Empty(t, plan.conflicted)
+	require.Len(t, plan.toSave, 2)
+	assert.Equal(t, tag.UUID, plan.toSave[0].GetUUID())
+	assert.Equal(t, note.UUID, plan.toSave[0].GetContent().References()[0].UUID)
+	assert.Equal(t, "Restored", plan.created[1].Title)
+}
+
+func TestPlanRestoreSkipRelinksExistingTag(t *testing.T) {
+	note, err := items.NewNote("Deleted note", "text", nil)
+	require.NoError(t, err)
+
+	tag, err := items.NewTag("work", items.ItemReferences{{UUID: note.UUID, ContentType: common.SNItemTypeNote}})
+	require.NoError(t, err)
+
+	backup := []BackupItem{toBackupItem(t, &tag), toBackupItem(t, &note)}
+
+	existingTag, err := items.NewTag("work", nil)
+	require.NoError(t, err)
+	existingTag.UUID = tag.UUID
+
+	plan, err := planRestore(backup, items.Items{&existingTag}, RestoreConflictSkip, nil)
+	require.NoError(t, err)
+
+	require.Len(t, plan.conflicted, 1)
+	assert.Equal(t, RestoreActionSkipped, plan.conflicted[0].Action)
+	require.Len(t, plan.skipped, 1)
+	require.Len(t, plan.created, 1)
+	assert.Equal(t, note.UUID, plan.created[0].UUID)
+
+	require.Len(t, plan.updated, 1)
+	assert.Equal(t, RestoreActionRelinked, plan.updated[0].Action)
+	assert.True(t, referenceExists(existingTag, note.UUID))
+	assert.Len(t, plan.toSave, 2)
+}
+
+func TestPlanRestoreOverwrite(t *testing.T) {
+	note, err := items.NewNote("Original", "old text", nil)
+	require.NoError(t, err)
+
+	backup := []BackupItem{toBackupItem(t, &note)}
+
+	current, err := items.NewNote("Edited", "new text", nil)
+	require.NoError(t, err)
+	current.UUID = note.UUID
+	current.UpdatedAt = "2025-05-05T05:05:05.000Z"
+
+	plan, err := planRestore(backup, items.Items{&current}, RestoreConflictOverwrite, nil)
+	require.NoError(t, err)
+
+	require.Len(t, plan.updated, 1)
+	assert.Equal(t, RestoreActionOverwritten, plan.updated[0].Action)
+	require.Len(t, plan.toSave, 1)
+
+	restored := plan.toSave[0].(*items.Note)
+	assert.Equal(t, note.UUID, restored.UUID)
+	assert.Equal(t, "old text", restored.Content.GetText())
+	assert.Equal(t, current.UpdatedAt, restored.UpdatedAt)
+}
+
+func TestPlanRestoreCopy(t *testing.T) {
+	note, err := items.NewNote("Original", "text", nil)
+	require.NoError(t, err)
+
+	tag, err := items.NewTag("work", items.ItemReferences{{UUID: note.UUID, ContentType: common.SNItemTypeNote}})
+	require.NoError(t, err)
+
+	backup := []BackupItem{toBackupItem(t, &tag), toBackupItem(t, &note)}
+
+	plan, err := planRestore(backup, items.Items{&note, &tag}, RestoreConflictCopy, nil)
+	require.NoError(t, err)
+
+	require.Len(t, plan.conflicted, 2)
+	require.Len(t, plan.created, 2)
+	require.Len(t, plan.toSave, 2)
+
+	restoredTag := plan.toSave[0].(*items.Tag)
+	restoredNote := plan.toSave[1].(*items.Note)
+
+	assert.NotEqual(t, tag.UUID, restoredTag.UUID)
+	assert.NotEqual(t, note.UUID, restoredNote.UUID)
+	assert.Equal(t, restoredNote.UUID, restoredTag.Content.References()[0].UUID)
+	assert.Equal(t, restoredNote.UUID, plan.created[1].NewUUID)
+}
+
+func TestPlanRestoreInvalidContent(t *testing.T) {
+	_, err := planRestore([]BackupItem{{UUID: "abc", Type: common.SNItemTypeNote, Content: "{"}}, nil, RestoreConflictSkip, nil)
+	require.Error(t, err)
+}
+
+func TestPlanRestoreMalformedComponent(t *testing.T) {
+	// valid JSON that doesn't match a component, which the parser panics on
+	_, err := planRestore([]BackupItem{{UUID: "abc", Type: common.SNItemTypeComponent, Content: `{"name":5}`}}, nil, RestoreConflictSkip, nil)
+	require.ErrorContains(t, err, "cannot be parsed")
+}
+
+func writeTestBackup(t *testing.T, path string, manifest BackupManifest, password string, entries map[string][]BackupItem) {
+	t.Helper()
+
+	var gcm cipher.AEAD
+
+	if manifest.Encrypted {
+		kdf := legacyBackupKDF()
+		if manifest.KDF != nil {
+			kdf = *manifest.KDF
+		}
+
+		var err error
+		gcm, err = newBackupCipher(password, kdf)
+		require.NoError(t, err)
+	}
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+
+	zw := zip.NewWriter(f)
+
+	for name, backupItems := range entries {
+		data, err := json.Marshal(backupItems)
+		require.NoError(t, err)
+		require.NoError(t, writeZipEntry(zw, name, data, gcm))
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	// version 1 archives encrypted the manifest along with everything else
+	manifestCipher := gcm
+	if manifest.Version != BackupFormatVersion1 {
+		manifestCipher = nil
+	}
+
+	require.NoError(t, writeZipEntry(zw, backupManifestFile, manifestData, manifestCipher))
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+}
+
+func readTestBackupNotes(t *testing.T, path, password string) ([]BackupItem, error) {
+	t.Helper()
+
+	zr, err := zip.OpenReader(path)
+	require.NoError(t, err)
+
+	defer zr.Close()
+
+	_, gcm, err := readBackupManifest(&zr.Reader, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return readBackupItems(&zr.Reader, "notes.json", gcm)
+}
+
+func TestBackupKDFSaltIsRandom(t *testing.T) {
+	first, err := NewBackupKDF("pbkdf2")
+	require.NoError(t, err)
+
+	second, err := NewBackupKDF("pbkdf2")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first.Salt, second.Salt)
+
+	firstKey, err := first.deriveKey("password123")
+	require.NoError(t, err)
+
+	secondKey, err := second.deriveKey("password123")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, firstKey, secondKey)
+
+	_, err = NewBackupKDF("scrypt")
+	require.Error(t, err)
+}
+
+func TestBackupKDFRejectsExcessiveParameters(t *testing.T) {
+	pbkdf2KDF, err := NewBackupKDF(BackupKDFPBKDF2)
+	require.NoError(t, err)
+
+	argon2KDF, err := NewBackupKDF(BackupKDFArgon2id)
+	require.NoError(t, err)
+
+	// the manifest is unencrypted, so these could come from a crafted backup
+	excessive := map[string]BackupKDF{
+		"pbkdf2 iterations": pbkdf2KDF,
+		"key length":        pbkdf2KDF,
+		"argon2id time":     argon2KDF,
+		"argon2id memory":   argon2KDF,
+		"argon2id threads":  argon2KDF,
+	}
+
+	for name, kdf := range excessive {
+		switch name {
+		case "pbkdf2 iterations":
+			kdf.Iterations = maxPBKDF2Iterations + 1
+		case "key length":
+			kdf.KeyLength = 1 << 30
+		case "argon2id time":
+			kdf.Iterations = maxArgon2Time + 1
+		case "argon2id memory":
+			kdf.Memory = maxArgon2Memory + 1
+		case "argon2id threads":
+			kdf.Threads = maxArgon2Threads + 1
+		}
+
+		_, err = kdf.deriveKey("password123")
+		require.ErrorContains(t, err, "the maximum", name)
+	}
+
+	// the defaults are within the bounds
+	_, err = argon2KDF.deriveKey("password123")
+	require.NoError(t, err)
+}
+
+func TestReadVersion1Backup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v1.zip")
+	notes := []BackupItem{{UUID: "note-1", Type: common.SNItemTypeNote, Content: `{"title":"one"}`}}
+
+	writeTestBackup(t, path, BackupManifest{
+		Timestamp: "2024-01-01T00:00:00Z",
+		Encrypted: true,
+		Version:   BackupFormatVersion1,
+	}, "password123", map[string][]BackupItem{"notes.json": notes, "tags.json": nil})
+
+	manifest, err := GetBackupInfo(path, "")
+	require.ErrorIs(t, err, ErrBackupPasswordRequired)
+	assert.True(t, manifest.Encrypted)
+
+	manifest, err = GetBackupInfo(path, "password123")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-01T00:00:00Z", manifest.Timestamp)
+
+	restored, err := readTestBackupNotes(t, path, "password123")
+	require.NoError(t, err)
+	assert.Equal(t, notes, restored)
+}
+
+func TestReadVersion2Backup(t *testing.T) {
+	for _, algorithm := range []string{BackupKDFPBKDF2, BackupKDFArgon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			kdf, err := NewBackupKDF(algorithm)
+			require.NoError(t, err)
+
+			path := filepath.Join(t.TempDir(), "v2.zip")
+			notes := []BackupItem{{UUID: "note-1", Type: common.SNItemTypeNote, Content: `{"title":"one"}`}}
+
+			writeTestBackup(t, path, BackupManifest{
+				Timestamp: "2024-01-01T00:00:00Z",
+				Encrypted: true,
+				Version:   BackupFormatVersion2,
+				KDF:       &kdf,
+			}, "password123", map[string][]BackupItem{"notes.json": notes})
+
+			// header is readable without the password
+			manifest, err := GetBackupInfo(path, "")
+			require.NoError(t, err)
+			require.NotNil(t, manifest.KDF)
+			assert.Equal(t, algorithm, manifest.KDF.Algorithm)
+
+			restored, err := readTestBackupNotes(t, path, "password123")
+			require.NoError(t, err)
+			assert.Equal(t, notes, restored)
+
+			_, err = readTestBackupNotes(t, path, "wrong-password")
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRekeyBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "v1.zip")
+	notes := []BackupItem{{UUID: "note-1", Type: common.SNItemTypeNote, Content: `{"title":"one"}`}}
+
+	writeTestBackup(t, path, BackupManifest{
+		Timestamp: "2024-01-01T00:00:00Z",
+		Encrypted: true,
+		Version:   BackupFormatVersion1,
+	}, "old-password", map[string][]BackupItem{"notes.json": notes})
+
+	_, err := (&RekeyConfig{InputFile: path, OldPassword: "wrong-password", NewPassword: "new-password"}).Run()
+	require.Error(t, err)
+
+	manifest, err := (&RekeyConfig{
+		InputFile:   path,
+		OldPassword: "old-password",
+		NewPassword: "new-password",
+		KDF:         BackupKDFPBKDF2,
+	}).Run()
+	require.NoError(t, err)
+	assert.Equal(t, BackupFormatVersion2, manifest.Version)
+	assert.Equal(t, "2024-01-01T00:00:00Z", manifest.Timestamp)
+
+	_, err = readTestBackupNotes(t, path, "old-password")
+	require.Error(t, err)
+
+	restored, err := readTestBackupNotes(t, path, "new-password")
+	require.NoError(t, err)
+	assert.Equal(t, notes, restored)
+}
+
+func TestModifiedSince(t *testing.T) {
+	assert.True(t, modifiedSince("2024-01-02T03:04:05.000Z", ""))
+	assert.True(t, modifiedSince("2024-01-02T03:04:05.000Z", "2024-01-02T03:04:05Z"))
+	assert.False(t, modifiedSince("2024-01-02T03:04:05.000Z", "2024-01-02T05:00:00+01:00"))
+	assert.True(t, modifiedSince("2024-01-02T03:04:05.000Z", "2024-01-02T03:00:00+00:00"))
+	assert.True(t, modifiedSince("invalid", "2024-01-02T03:00:00Z"))
+}
+
+func TestFindTombstones(t *testing.T) {
+	parent := []BackupItemRef{{UUID: "a", Type: common.SNItemTypeNote}, {UUID: "b", Type: common.SNItemTypeTag}}
+	current := []BackupItemRef{{UUID: "a", Type: common.SNItemTypeNote}, {UUID: "c", Type: common.SNItemTypeNote}}
+
+	assert.Equal(t, []BackupItemRef{{UUID: "b", Type: common.SNItemTypeTag}}, findTombstones(parent, current, []string{"notes", "tags"}))
+
+	// items of types that weren't backed up can't be known to be deleted
+	assert.Empty(t, findTombstones(parent, current, []string{"notes"}))
+}
+
+func writeTestChain(t *testing.T, dir string) (string, string, string) {
+	t.Helper()
+
+	full := filepath.Join(dir, "full.zip")
+	writeTestBackup(t, full, BackupManifest{
+		ID:        "full",
+		Timestamp: "2024-01-01T00:00:00Z",
+		Version:   BackupFormatVersion2,
+	}, "", map[string][]BackupItem{
+		"notes.json": {
+			{UUID: "note-1", Type: common.SNItemTypeNote, Content: `{"title":"one"}`},
+			{UUID: "note-2", Type: common.SNItemTypeNote, Content: `{"title":"two"}`},
+		},
+		"tags.json": nil,
+	})
+
+	fullHash, err := hashFile(full)
+	require.NoError(t, err)
+
+	first := filepath.Join(dir, "inc-1.zip")
+	writeTestBackup(t, first, BackupManifest{
+		ID:          "inc-1",
+		Timestamp:   "2024-01-02T00:00:00Z",
+		Incremental: true,
+		Version:     BackupFormatVersion2,
+		Parent:      &BackupParent{ID: "full", File: "full.zip", SHA256: fullHash, Timestamp: "2024-01-01T00:00:00Z"},
+	}, "", map[string][]BackupItem{
+		"notes.json":   {{UUID: "note-1", Type: common.SNItemTypeNote, Content: `{"title":"one edited"}`}},
+		"tags.json":    {{UUID: "tag-1", Type: common.SNItemTypeTag, Content: `{"title":"work"}`}},
+		"deleted.json": {{UUID: "note-2", Type: common.SNItemTypeNote}},
+	})
+
+	firstHash, err := hashFile(first)
+	require.NoError(t, err)
+
+	second := filepath.Join(dir, "inc-2.zip")
+	writeTestBackup(t, second, BackupManifest{
+		ID:          "inc-2",
+		Timestamp:   "2024-01-03T00:00:00Z",
+		Incremental: true,
+		Version:     BackupFormatVersion2,
+		Parent:      &BackupParent{ID: "inc-1", File: "inc-1.zip", SHA256: firstHash, Timestamp: "2024-01-02T00:00:00Z"},
+	}, "", map[string][]BackupItem{
+		"notes.json":   {{UUID: "note-3", Type: common.SNItemTypeNote, Content: `{"title":"three"}`}},
+		"tags.json":    nil,
+		"deleted.json": {{UUID: "tag-1", Type: common.SNItemTypeTag}},
+	})
+
+	return full, first, second
+}
+
+func TestResolveBackupChain(t *testing.T) {
+	dir := t.TempDir()
+	full, first, second := writeTestChain(t, dir)
+
+	chain, err := ResolveBackupChain(dir, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, chain, 3)
+	assert.Equal(t, []string{full, first, second}, []string{chain[0].Path, chain[1].Path, chain[2].Path})
+
+	chain, err = ResolveBackupChain(dir, time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, chain, 2)
+	assert.Equal(t, first, chain[1].Path)
+
+	_, err = ResolveBackupChain(dir, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.Error(t, err)
+
+	latest, err := FindLatestBackup(dir, second)
+	require.NoError(t, err)
+	assert.Equal(t, first, latest)
+
+	// a missing parent breaks the chain
+	require.NoError(t, os.Remove(first))
+
+	_, err = ResolveBackupChain(dir, time.Time{})
+	require.Error(t, err)
+}
+
+func TestReplayBackupChain(t *testing.T) {
+	dir := t.TempDir()
+	writeTestChain(t, dir)
+
+	chain, err := ResolveBackupChain(dir, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	replayed, err := replayBackupChain(chain, "", backupItemTypes)
+	require.NoError(t, err)
+	require.Len(t, replayed, 2)
+	assert.Equal(t, "tag-1", replayed[0].UUID)
+	assert.Equal(t, "note-1", replayed[1].UUID)
+	assert.JSONEq(t, `{"title":"one edited"}`, replayed[1].Content)
+
+	chain, err = ResolveBackupChain(dir, time.Time{})
+	require.NoError(t, err)
+
+	replayed, err = replayBackupChain(chain, "", backupItemTypes)
+	require.NoError(t, err)
+
+	var uuids []string
+	for _, bi := range replayed {
+		uuids = append(uuids, bi.UUID)
+	}
+
+	assert.Equal(t, []string{"note-1", "note-3"}, uuids)
+}
+
+func TestRekeyBackupChain(t *testing.T) {
+	dir := t.TempDir()
+	full, first, _ := writeTestChain(t, dir)
+
+	// re-encrypting the base and middle of the chain changes their hashes, but not their IDs
+	for _, path := range []string{full, first} {
+		_, err := (&RekeyConfig{InputFile: path, NewPassword: "new-password", KDF: BackupKDFPBKDF2}).Run()
+		require.NoError(t, err)
+	}
+
+	chain, err := ResolveBackupChain(dir, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, chain, 3)
+
+	replayed, err := replayBackupChain(chain, "new-password", backupItemTypes)
+	require.NoError(t, err)
+
+	var uuids []string
+	for _, bi := range replayed {
+		uuids = append(uuids, bi.UUID)
+	}
+
+	assert.Equal(t, []string{"note-1", "note-3"}, uuids)
+
+	// rotation keeps the rekeyed parents of the latest incremental
+	result, err := (&RotateConfig{Dir: dir, KeepDaily: 1, DryRun: true}).Run()
+	require.NoError(t, err)
+	assert.Empty(t, result.Pruned)
+	assert.Empty(t, result.Warnings)
+}
+
+func TestResolveBackupChainModifiedParent(t *testing.T) {
+	dir := t.TempDir()
+	_, first, _ := writeTestChain(t, dir)
+
+	// the same ID with different content, without being re-encrypted, is a modified parent
+	writeTestBackup(t, first, BackupManifest{
+		ID:          "inc-1",
+		Timestamp:   "2024-01-02T00:00:00Z",
+		Incremental: true,
+		Version:     BackupFormatVersion2,
+	}, "", map[string][]BackupItem{"notes.json": nil})
+
+	_, err := ResolveBackupChain(dir, time.Time{})
+	require.ErrorContains(t, err, "missing or has been modified")
+}
+
+func TestParseBackupTypes(t *testing.T) {
+	types, err := parseBackupTypes(nil)
+	require.NoError(t, err)
+	assert.Len(t, types, len(backupItemTypes))
+
+	types, err = parseBackupTypes([]string{"Notes", "preferences", "tags"})
+	require.NoError(t, err)
+	require.Len(t, types, 3)
+	// returned in restore order
+	assert.Equal(t, []string{"tags", "notes", "preferences"}, []string{types[0].Name, types[1].Name, types[2].Name})
+
+	_, err = parseBackupTypes([]string{"keys"})
+	require.Error(t, err)
+}
+
+func TestPlanRestoreUnsupportedType(t *testing.T) {
+	plan, err := planRestore([]BackupItem{{UUID: "key-1", Type: common.SNItemTypeItemsKey, Content: "{}"}}, nil, RestoreConflictSkip, nil)
+	require.NoError(t, err)
+
+	assert.Empty(t, plan.toSave)
+	require.Len(t, plan.skipped, 1)
+	assert.Equal(t, "key-1", plan.skipped[0].UUID)
+}
+
+func TestPlanRestoreSingletonType(t *testing.T) {
+	backup := []BackupItem{{
+		UUID:    "prefs-backup",
+		Type:    common.SNItemTypeUserPreferences,
+		Content: `{"appData":{}}`,
+	}}
+
+	existing, err := items.ParseItem(items.DecryptedItem{
+		UUID:        "prefs-current",
+		ContentType: common.SNItemTypeUserPreferences,
+		Content:     `{"appData":{}}`,
+		UpdatedAt:   "2025-05-05T05:05:05.000Z",
+	})
+	require.NoError(t, err)
+
+	plan, err := planRestore(backup, items.Items{existing}, RestoreConflictCopy, nil)
+	require.NoError(t, err)
+	assert.Empty(t, plan.toSave)
+	require.Len(t, plan.skipped, 1)
+
+	plan, err = planRestore(backup, items.Items{existing}, RestoreConflictOverwrite, nil)
+	require.NoError(t, err)
+	require.Len(t, plan.toSave, 1)
+	assert.Equal(t, "prefs-current", plan.toSave[0].GetUUID())
+	assert.Equal(t, RestoreActionOverwritten, plan.updated[0].Action)
+}
+
+func writeChecksummedTestBackup(t *testing.T, path, password string, notes []BackupItem, mutate func(*BackupManifest)) {
+	t.Helper()
+
+	manifest := BackupManifest{
+		Timestamp:  "2024-01-01T00:00:00Z",
+		ItemCounts: map[string]int{"notes": len(notes)},
+		Encrypted:  password != "",
+		Version:    BackupFormatVersion2,
+	}
+
+	var gcm cipher.AEAD
+
+	if password != "" {
+		kdf, err := NewBackupKDF(BackupKDFPBKDF2)
+		require.NoError(t, err)
+
+		gcm, err = newBackupCipher(password, kdf)
+		require.NoError(t, err)
+
+		manifest.KDF = &kdf
+	}
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+
+	zw := zip.NewWriter(f)
+
+	for x := range notes {
+		if notes[x].SHA256 == "" {
+			notes[x].SHA256 = backupItemChecksum(notes[x])
+		}
+	}
+
+	data, err := json.Marshal(notes)
+	require.NoError(t, err)
+	require.NoError(t, writeBackupEntry(zw, &manifest, "notes.json", data, gcm))
+
+	if mutate != nil {
+		mutate(&manifest)
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, writeZipEntry(zw, backupManifestFile, manifestData, nil))
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+}
+
+func TestVerifyBackup(t *testing.T) {
+	dir := t.TempDir()
+	notes := func() []BackupItem {
+		return []BackupItem{{UUID: "note-1", Type: common.SNItemTypeNote, Content: `{"title":"one","text":"text"}`}}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		path := filepath.Join(dir, "valid.zip")
+		writeChecksummedTestBackup(t, path, "password123", notes(), nil)
+
+		result, err := (&VerifyConfig{InputFile: path, Password: "password123"}).Run()
+		require.NoError(t, err)
+		assert.True(t, result.OK(), result.Problems)
+		assert.True(t, result.DigestValid)
+		assert.True(t, result.ItemsVerified)
+		assert.Equal(t, 1, result.ItemsChecked)
+
+		// entry checksums can be checked without the password
+		result, err = (&VerifyConfig{InputFile: path}).Run()
+		require.NoError(t, err)
+		assert.True(t, result.OK())
+		assert.False(t, result.ItemsVerified)
+	})
+
+	t.Run("undecryptable", func(t *testing.T) {
+		path := filepath.Join(dir, "undecryptable.zip")
+		writeChecksummedTestBackup(t, path, "password123", notes(), nil)
+
+		result, err := (&VerifyConfig{InputFile: path, Password: "wrong-password"}).Run()
+		require.NoError(t, err)
+		require.Len(t, result.Problems, 1)
+		assert.Equal(t, VerifyProblemUndecryptable, result.Problems[0].Kind)
+	})
+
+	t.Run("corrupted entry", func(t *testing.T) {
+		path := filepath.Join(dir, "corrupted.zip")
+		writeChecksummedTestBackup(t, path, "", notes(), func(m *BackupManifest) {
+			m.Entries["notes.json"] = "0000"
+		})
+
+		result, err := (&VerifyConfig{InputFile: path}).Run()
+		require.NoError(t, err)
+		assert.False(t, result.OK())
+		assert.False(t, result.DigestValid)
+		assert.Equal(t, VerifyProblemCorrupted, result.Problems[0].Kind)
+		assert.Equal(t, "notes.json", result.Problems[0].Entry)
+	})
+
+	t.Run("missing entry", func(t *testing.T) {
+		path := filepath.Join(dir, "missing.zip")
+		writeChecksummedTestBackup(t, path, "", notes(), func(m *BackupManifest) {
+			m.Entries["tags.json"] = "0000"
+			m.Digest = archiveDigest(m.Entries)
+		})
+
+		result, err := (&VerifyConfig{InputFile: path}).Run()
+		require.NoError(t, err)
+		require.NotEmpty(t, result.Problems)
+		assert.Equal(t, VerifyProblemMissing, result.Problems[0].Kind)
+		assert.Equal(t, "tags.json", result.Problems[0].Entry)
+	})
+
+	t.Run("corrupted item", func(t *testing.T) {
+		path := filepath.Join(dir, "item.zip")
+		tampered := notes()
+		tampered[0].SHA256 = backupItemChecksum(tampered[0])
+		tampered[0].Content = `{"title":"changed"}`
+
+		writeChecksummedTestBackup(t, path, "", tampered, nil)
+
+		result, err := (&VerifyConfig{InputFile: path}).Run()
+		require.NoError(t, err)
+		require.Len(t, result.Problems, 1)
+		assert.Equal(t, "note-1", result.Problems[0].UUID)
+		assert.Equal(t, VerifyProblemCorrupted, result.Problems[0].Kind)
+	})
+}
+
+func writeTestRotationBackups(t *testing.T, dir string) {
+	t.Helper()
+
+	var parent *BackupParent
+
+	for _, b := range []struct {
+		name        string
+		timestamp   string
+		incremental bool
+	}{
+		{"full-jan.zip", "2024-01-01T00:00:00Z", false},
+		{"inc-jan15.zip", "2024-01-15T00:00:00Z", true},
+		{"full-feb.zip", "2024-02-01T00:00:00Z", false},
+		{"inc-feb2.zip", "2024-02-02T00:00:00Z", true},
+		{"inc-feb3.zip", "2024-02-03T00:00:00Z", true},
+	} {
+		manifest := BackupManifest{Timestamp: b.timestamp, Incremental: b.incremental, Version: BackupFormatVersion2}
+		if b.incremental {
+			manifest.Parent = parent
+		}
+
+		path := filepath.Join(dir, b.name)
+		writeTestBackup(t, path, manifest, "", map[string][]BackupItem{"notes.json": nil})
+
+		hash, err := hashFile(path)
+		require.NoError(t, err)
+
+		parent = &BackupParent{File: b.name, SHA256: hash, Timestamp: b.timestamp}
+	}
+}
+
+func rotatedNames(entries []RotateEntry) []string {
+	var names []string
+	for _, entry := range entries {
+		names = append(names, filepath.Base(entry.Path))
+	}
+
+	return names
+}
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	writeTestRotationBackups(t, dir)
+
+	_, err := (&RotateConfig{Dir: dir}).Run()
+	require.Error(t, err)
+
+	// the latest incremental keeps its whole chain
+	result, err := (&RotateConfig{Dir: dir, KeepDaily: 1, DryRun: true}).Run()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"inc-feb3.zip", "inc-feb2.zip", "full-feb.zip"}, rotatedNames(result.Kept))
+	assert.Equal(t, []string{"inc-jan15.zip", "full-jan.zip"}, rotatedNames(result.Pruned))
+	assert.FileExists(t, filepath.Join(dir, "full-jan.zip"))
+
+	// january's latest backup is an incremental, so its full backup is kept too
+	result, err = (&RotateConfig{Dir: dir, KeepMonthly: 2, DryRun: true}).Run()
+	require.NoError(t, err)
+	assert.Empty(t, result.Pruned)
+	assert.Len(t, result.Kept, 5)
+
+	result, err = (&RotateConfig{Dir: dir, KeepDaily: 1}).Run()
+	require.NoError(t, err)
+	assert.Len(t, result.Pruned, 2)
+	assert.NoFileExists(t, filepath.Join(dir, "full-jan.zip"))
+	assert.NoFileExists(t, filepath.Join(dir, "inc-jan15.zip"))
+
+	// what remains is still restorable
+	chain, err := ResolveBackupChain(dir, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, chain, 3)
+}
+
+func TestRetainBackupDependenciesCycle(t *testing.T) {
+	// two incrementals that each name the other as their parent
+	entries := []BackupChainEntry{
+		{Path: "a.zip", SHA256: "aaa", Manifest: BackupManifest{ID: "a", Incremental: true, Parent: &BackupParent{ID: "b", File: "b.zip", SHA256: "bbb"}}},
+		{Path: "b.zip", SHA256: "bbb", Manifest: BackupManifest{ID: "b", Incremental: true, Parent: &BackupParent{ID: "a", File: "a.zip", SHA256: "aaa"}}},
+	}
+	reasons := map[string][]string{"a.zip": {"daily"}}
+
+	warnings := retainBackupDependencies(entries, reasons)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "cycle")
+	assert.Equal(t, []string{"parent of a.zip"}, reasons["b.zip"])
+}
+
+func TestDiffBackupItems(t *testing.T) {
+	from := []BackupItem{
+		{UUID: "note-1", Type: common.SNItemTypeNote, Content: `{"title":"one","text":"a\nb\nc\n"}`},
+		{UUID: "note-2", Type: common.SNItemTypeNote, Content: `{"title":"two","text":"same"}`},
+		{UUID: "tag-1", Type: common.SNItemTypeTag, Content: `{"title":"work","references":[]}`},
+	}
+	to := []BackupItem{
+		{UUID: "note-1", Type: common.SNItemTypeNote, Content: `{"text":"a\nB\nc\n","title":"one"}`},
+		{UUID: "note-2", Type: common.SNItemTypeNote, Content: `{"text":"same","title":"two"}`, UpdatedAt: "2025-01-01T00:00:00.000Z"},
+		{UUID: "note-3", Type: common.SNItemTypeNote, Content: `{"title":"three"}`},
+	}
+
+	var result BackupDiff
+	diffBackupItems(from, to, &result)
+
+	require.Len(t, result.Added, 1)
+	assert.Equal(t, "three", result.Added[0].Title)
+	require.Len(t, result.Removed, 1)
+	assert.Equal(t, "tag-1", result.Removed[0].UUID)
+
+	// key order and timestamps alone are not modifications
+	require.Len(t, result.Modified, 1)
+	assert.Equal(t, "note-1", result.Modified[0].UUID)
+	assert.Equal(t, []string{"text"}, result.Modified[0].Fields)
+	assert.Contains(t, result.Modified[0].Diff, "-b\n+B\n")
+}
+
+func TestDiffBackupsWithIncremental(t *testing.T) {
+	dir := t.TempDir()
+	full, _, second := writeTestChain(t, dir)
+
+	result, err := (&DiffConfig{FileA: full, FileB: second}).Run()
+	require.NoError(t, err)
+
+	// the incremental is compared as the state after replaying its chain
+	assert.Equal(t, []string{"note-3"}, []string{result.Added[0].UUID})
+	require.Len(t, result.Removed, 1)
+	assert.Equal(t, "note-2", result.Removed[0].UUID)
+	require.Len(t, result.Modified, 1)
+	assert.Equal(t, []string{"title"}, result.Modified[0].Fields)
+
+	_, err = (&DiffConfig{FileA: full, Live: true}).Run()
+	require.Error(t, err)
+}
+
+func selectionTestItems() []BackupItem {
+	return []BackupItem{
+		{UUID: "parent", Type: common.SNItemTypeTag, Content: `{"title":"projects","references":[{"uuid":"ghost","content_type":"Note"}]}`},
+		{UUID: "tag-work", Type: common.SNItemTypeTag, Content: `{"title":"work","parentId":"parent","references":[{"uuid":"note-1","content_type":"Note"},{"uuid":"note-2","content_type":"Note"}]}`},
+		{UUID: "tag-home", Type: common.SNItemTypeTag, Content: `{"title":"home","references":[{"uuid":"note-3","content_type":"Note"}]}`},
+		{UUID: "note-1", Type: common.SNItemTypeNote, Content: `{"title":"Plan","text":"a"}`, UpdatedAt: "2024-01-01T00:00:00.000Z"},
+		{UUID: "note-2", Type: common.SNItemTypeNote, Content: `{"title":"Budget","text":"b"}`, UpdatedAt: "2024-03-01T00:00:00.000Z"},
+		{UUID: "note-3", Type: common.SNItemTypeNote, Content: `{"title":"Garden","text":"c"}`, UpdatedAt: "2024-01-01T00:00:00.000Z"},
+	}
+}
+
+func backupItemUUIDs(backupItems []BackupItem) []string {
+	var uuids []string
+	for _, bi := range backupItems {
+		uuids = append(uuids, bi.UUID)
+	}
+
+	return uuids
+}
+
+func TestSelectBackupItems(t *testing.T) {
+	all := selectionTestItems()
+
+	selected, dependencies := selectBackupItems(all, RestoreFilter{})
+	assert.Len(t, selected, len(all))
+	assert.Empty(t, dependencies)
+
+	// referencing tags and their parents are brought along
+	selected, dependencies = selectBackupItems(all, RestoreFilter{Titles: []string{"plan"}})
+	assert.Equal(t, []string{"parent", "tag-work", "note-1"}, backupItemUUIDs(selected))
+	assert.Equal(t, map[string]bool{"parent": true, "tag-work": true}, dependencies)
+
+	selected, _ = selectBackupItems(all, RestoreFilter{UUIDs: []string{"note-3"}})
+	assert.Equal(t, []string{"tag-home", "note-3"}, backupItemUUIDs(selected))
+
+	selected, _ = selectBackupItems(all, RestoreFilter{
+		Tags:          []string{"Work"},
+		UpdatedBefore: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.Equal(t, []string{"parent", "tag-work", "note-1"}, backupItemUUIDs(selected))
+
+	selected, _ = selectBackupItems(all, RestoreFilter{UUIDs: []string{"missing"}})
+	assert.Empty(t, selected)
+}
+
+func TestPlanRestoreSelectedNote(t *testing.T) {
+	selected, dependencies := selectBackupItems(selectionTestItems(), RestoreFilter{UUIDs: []string{"note-1"}})
+
+	// the note was edited and its tag still exists in the account
+	current, err := items.NewNote("Plan", "edited", nil)
+	require.NoError(t, err)
+	current.UUID = "note-1"
+
+	workTag, err := items.NewTag("work", nil)
+	require.NoError(t, err)
+	workTag.UUID = "tag-work"
+
+	plan, err := planRestore(selected, items.Items{&current, &workTag}, RestoreConflictCopy, dependencies)
+	require.NoError(t, err)
+
+	// the existing tag is linked to the copy rather than copied itself
+	require.Len(t, plan.conflicted, 1)
+	assert.Equal(t, "note-1", plan.conflicted[0].UUID)
+	require.Len(t, plan.updated, 1)
+	assert.Equal(t, RestoreActionRelinked, plan.updated[0].Action)
+
+	copied := plan.created[len(plan.created)-1].NewUUID
+	assert.NotEqual(t, "note-1", copied)
+	assert.True(t, referenceExists(workTag, copied))
+
+	// the missing parent tag is created, dropping references to items that won't exist
+	var parent *items.Tag
+
+	for _, item := range plan.toSave {
+		if item.GetUUID() == "parent" {
+			parent = item.(*items.Tag)
+		}
+	}
+
+	require.NotNil(t, parent)
+	assert.Empty(t, parent.Content.References())
+}
+
+func TestWriteBackupFileKeepsExistingOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "backup.zip")
+	require.NoError(t, os.WriteFile(output, []byte("previous"), 0o600))
+
+	// a backup that fails part way leaves the previous one as it was
+	err := writeBackupFile(output, func(w io.Writer) error {
+		_, _ = w.Write([]byte("partial"))
+
+		return errors.New("sync failed")
+	})
+	require.ErrorContains(t, err, "sync failed")
+
+	got, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", string(got))
+
+	require.NoError(t, writeBackupFile(output, func(w io.Writer) error {
+		_, err := w.Write([]byte("complete"))
+
+		return err
+	}))
+
+	got, err = os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "complete", string(got))
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func testBackupCipher(t testing.TB) cipher.AEAD {
+	t.Helper()
+
+	kdf, err := NewBackupKDF(BackupKDFPBKDF2)
+	require.NoError(t, err)
+
+	gcm, err := newBackupCipher("password123", kdf)
+	require.NoError(t, err)
+
+	return gcm
+}
+
+func TestBackupStream(t *testing.T) {
+	gcm := testBackupCipher(t)
+
+	seal := func(t *testing.T, name string, plaintext []byte) []byte {
+		t.Helper()
+
+		var sealed bytes.Buffer
+
+		w, err := newBackupStreamWriter(&sealed, gcm, name)
+		require.NoError(t, err)
+
+		_, err = w.Write(plaintext)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		return sealed.Bytes()
+	}
+
+	open := func(name string, sealed []byte) ([]byte, error) {
+		r, err := newBackupStreamReader(bytes.NewReader(sealed), gcm, name)
+		if err != nil {
+			return nil, err
+		}
+
+		return io.ReadAll(r)
+	}
+
+	for _, size := range []int{0, 10, backupFrameSize, 3*backupFrameSize + 5} {
+		plaintext := bytes.Repeat([]byte("a"), size)
+
+		opened, err := open("notes/0001.json.enc", seal(t, "notes/0001.json.enc", plaintext))
+		require.NoError(t, err, size)
+		assert.Equal(t, plaintext, opened, size)
+	}
+
+	plaintext := bytes.Repeat([]byte("b"), 2*backupFrameSize+1)
+	sealed := seal(t, "notes/0001.json.enc", plaintext)
+
+	t.Run("truncated", func(t *testing.T) {
+		// drop the final frame, leaving a stream that ends on a frame boundary
+		firstTwo := backupNoncePrefixSize + 2*(4+backupFrameSize+gcm.Overhead())
+
+		_, err := open("notes/0001.json.enc", sealed[:firstTwo])
+		require.Error(t, err)
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		modified := bytes.Clone(sealed)
+		modified[len(modified)/2] ^= 0xff
+
+		_, err := open("notes/0001.json.enc", modified)
+		require.Error(t, err)
+	})
+
+	t.Run("renamed", func(t *testing.T) {
+		_, err := open("notes/0002.json.enc", sealed)
+		require.Error(t, err)
+	})
+}
+
+func writeChunkedTestBackup(t *testing.T, path, password string, notes []BackupItem, chunkSize int) {
+	t.Helper()
+
+	bt, _ := backupTypeByName("notes")
+	manifest := BackupManifest{
+		Timestamp:  "2024-01-01T00:00:00Z",
+		ItemCounts: map[string]int{"notes": len(notes)},
+		Encrypted:  password != "",
+		Version:    BackupFormatVersion3,
+	}
+
+	var gcm cipher.AEAD
+
+	if password != "" {
+		kdf, err := NewBackupKDF(BackupKDFPBKDF2)
+		require.NoError(t, err)
+
+		gcm, err = newBackupCipher(password, kdf)
+		require.NoError(t, err)
+
+		manifest.KDF = &kdf
+	}
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+
+	zw := zip.NewWriter(f)
+	chunks := newBackupChunkWriter(zw, &manifest, gcm, bt, chunkSize)
+
+	for _, bi := range notes {
+		bi.SHA256 = backupItemChecksum(bi)
+		require.NoError(t, chunks.Add(bi))
+	}
+
+	require.NoError(t, chunks.Close())
+
+	manifestData, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, writeZipEntry(zw, backupManifestFile, manifestData, nil))
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+}
+
+func TestChunkedBackup(t *testing.T) {
+	dir := t.TempDir()
+	notesType, _ := backupTypeByName("notes")
+
+	var notes []BackupItem
+	for _, uuid := range []string{"note-1", "note-2", "note-3", "note-4", "note-5"} {
+		notes = append(notes, BackupItem{UUID: uuid, Type: common.SNItemTypeNote, Content: `{"title":"` + uuid + `"}`})
+	}
+
+	readNotes := func(t *testing.T, path, password string) []string {
+		t.Helper()
+
+		zr, err := zip.OpenReader(path)
+		require.NoError(t, err)
+		defer zr.Close()
+
+		_, gcm, err := readBackupManifest(&zr.Reader, password)
+		require.NoError(t, err)
+
+		backupItems, err := readArchiveItems(&zr.Reader, gcm, []backupItemType{notesType})
+		require.NoError(t, err)
+
+		return backupItemUUIDs(backupItems)
+	}
+
+	t.Run("unencrypted", func(t *testing.T) {
+		path := filepath.Join(dir, "plain.zip")
+		writeChunkedTestBackup(t, path, "", notes, 2)
+
+		zr, err := zip.OpenReader(path)
+		require.NoError(t, err)
+
+		var names []string
+		for _, file := range chunkEntries(&zr.Reader, "notes") {
+			names = append(names, file.Name)
+		}
+
+		require.NoError(t, zr.Close())
+		assert.Equal(t, []string{"notes/0001.json", "notes/0002.json", "notes/0003.json"}, names)
+		assert.Equal(t, backupItemUUIDs(notes), readNotes(t, path, ""))
+	})
+
+	t.Run("verify and rekey", func(t *testing.T) {
+		path := filepath.Join(dir, "encrypted.zip")
+		writeChunkedTestBackup(t, path, "password123", notes, 2)
+
+		result, err := (&VerifyConfig{InputFile: path, Password: "password123"}).Run()
+		require.NoError(t, err)
+		assert.True(t, result.OK(), result.Problems)
+		assert.Equal(t, len(notes), result.ItemsChecked)
+
+		result, err = (&VerifyConfig{InputFile: path, Password: "wrong-password"}).Run()
+		require.NoError(t, err)
+		require.NotEmpty(t, result.Problems)
+		assert.Equal(t, VerifyProblemUndecryptable, result.Problems[0].Kind)
+
+		rekeyed, err := (&RekeyConfig{InputFile: path, OldPassword: "password123", NewPassword: "new-password"}).Run()
+		require.NoError(t, err)
+		assert.Equal(t, BackupFormatVersion3, rekeyed.Version)
+
+		assert.Equal(t, backupItemUUIDs(notes), readNotes(t, path, "new-password"))
+
+		result, err = (&VerifyConfig{InputFile: path, Password: "new-password"}).Run()
+		require.NoError(t, err)
+		assert.True(t, result.OK(), result.Problems)
+	})
+}
+
+func BenchmarkBackupWriteArchive(b *testing.B) {
+	notes := genNotes(5000, 5)
+	types, err := parseBackupTypes([]string{"notes"})
+	require.NoError(b, err)
+
+	gcm := testBackupCipher(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		manifest := BackupManifest{ItemCounts: make(map[string]int), Version: BackupFormatVersion3, Encrypted: true}
+
+		if err := (&BackupConfig{}).writeArchive(io.Discard, &manifest, gcm, types, notes, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package sncli
+
+import (
+	"archive/zip"
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// backupItemType describes how items of a content type are stored in a backup
+type backupItemType struct {
+	// Name is used with --types and as the key in the manifest item counts
+	Name        string
+	ContentType string
+	File        string
+	// Singleton types have at most one item per account, so an existing item
+	// of the type is a conflict regardless of its UUID
+	Singleton bool
+}
+
+// backupItemTypes lists the content types that can be backed up, in restore order.
+// Key material (items keys, key system keys), shared vault records and stored
+// credentials are deliberately excluded as they are tied to the account's keys.
+var backupItemTypes = []backupItemType{
+	{Name: "tags", ContentType: common.SNItemTypeTag, File: "tags.json"},
+	{Name: "notes", ContentType: common.SNItemTypeNote, File: "notes.json"},
+	{Name: "smartviews", ContentType: common.SNItemTypeSmartTag, File: "smartviews.json"},
+	{Name: "files", ContentType: common.SNItemTypeFile, File: "files.json"},
+	{Name: "filesafe", ContentType: common.SNItemTypeFileSafeFileMetaData, File: "filesafe.json"},
+	{Name: "components", ContentType: common.SNItemTypeComponent, File: "components.json"},
+	{Name: "themes", ContentType: common.SNItemTypeTheme, File: "themes.json"},
+	{Name: "extensions", ContentType: common.SNItemTypeExtension, File: "extensions.json"},
+	{Name: "extensionrepos", ContentType: common.SNItemTypeExtensionRepo, File: "extensionrepos.json"},
+	{Name: "privileges", ContentType: common.SNItemTypePrivileges, File: "privileges.json"},
+	{Name: "preferences", ContentType: common.SNItemTypeUserPreferences, File: "preferences.json", Singleton: true},
+}
+
+// BackupTypeNames returns the names accepted by --types, in restore order
+func BackupTypeNames() []string {
+	names := make([]string, 0, len(backupItemTypes))
+	for _, bt := range backupItemTypes {
+		names = append(names, bt.Name)
+	}
+
+	return names
+}
+
+// parseBackupTypes returns the backup types matching the given names, or all types if none are given
+func parseBackupTypes(names []string) ([]backupItemType, error) {
+	if len(names) == 0 {
+		return backupItemTypes, nil
+	}
+
+	selected := make(map[string]bool, len(names))
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		if _, ok := backupTypeByName(name); !ok {
+			return nil, fmt.Errorf("invalid item type: %s (use %s)", name, strings.Join(BackupTypeNames(), ", "))
+		}
+
+		selected[name] = true
+	}
+
+	var types []backupItemType
+
+	for _, bt := range backupItemTypes {
+		if selected[bt.Name] {
+			types = append(types, bt)
+		}
+	}
+
+	return types, nil
+}
+
+// backupTypeByName returns the backup type with the given name
+func backupTypeByName(name string) (backupItemType, bool) {
+	for _, bt := range backupItemTypes {
+		if bt.Name == name {
+			return bt, true
+		}
+	}
+
+	return backupItemType{}, false
+}
+
+// backupTypeByContentType returns the backup type for a content type
+func backupTypeByContentType(contentType string) (backupItemType, bool) {
+	for _, bt := range backupItemTypes {
+		if bt.ContentType == contentType {
+			return bt, true
+		}
+	}
+
+	return backupItemType{}, false
+}
+
+// syncAllItems syncs and returns every item in the account
+func syncAllItems(session *cache.Session) (items.Items, error) {
+	so, err := Sync(cache.SyncInput{
+		Session: session,
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = so.DB.Close()
+	}()
+
+	var allPersistedItems cache.Items
+	if err = so.DB.All(&allPersistedItems); err != nil {
+		return nil, fmt.Errorf("getting items from db: %w", err)
+	}
+
+	return allPersistedItems.ToItems(session)
+}
+
+// newBackupItem converts an item into its backup form, with a checksum of the result
+func newBackupItem(item items.Item) (BackupItem, error) {
+	contentData, err := json.Marshal(item.GetContent())
+	if err != nil {
+		return BackupItem{}, fmt.Errorf("failed to marshal %s content: %w", item.GetContentType(), err)
+	}
+
+	bi := BackupItem{
+		UUID:      item.GetUUID(),
+		Type:      item.GetContentType(),
+		Content:   string(contentData),
+		CreatedAt: item.GetCreatedAt(),
+		UpdatedAt: item.GetUpdatedAt(),
+	}
+	bi.SHA256 = backupItemChecksum(bi)
+
+	return bi, nil
+}
+
+// backupItemsOfType writes the items of a single content type to the archive in chunks
+func (b *BackupConfig) backupItemsOfType(zipWriter *zip.Writer, manifest *BackupManifest, gcm cipher.AEAD, index *[]BackupItemRef, bt backupItemType, sourceItems items.Items) error {
+	chunks := newBackupChunkWriter(zipWriter, manifest, gcm, bt, backupChunkItems)
+	count := 0
+
+	for _, item := range sourceItems {
+		if item.GetContentType() != bt.ContentType {
+			continue
+		}
+
+		*index = append(*index, BackupItemRef{UUID: item.GetUUID(), Type: bt.ContentType})
+
+		// Skip if incremental and not modified since last backup
+		if b.Incremental && !modifiedSince(item.GetUpdatedAt(), b.LastBackupTime) {
+			continue
+		}
+
+		bi, err := newBackupItem(item)
+		if err != nil {
+			return err
+		}
+
+		if err := chunks.Add(bi); err != nil {
+			return err
+		}
+
+		count++
+	}
+
+	if err := chunks.Close(); err != nil {
+		return err
+	}
+
+	manifest.ItemCounts[bt.Name] = count
+
+	return nil
+}
+
+// readArchiveItems reads the items of the given types from an archive, in restore order.
+// Types missing from the archive, such as those not backed up by older versions, are skipped.
+func readArchiveItems(zipReader *zip.Reader, gcm cipher.AEAD, types []backupItemType) ([]BackupItem, error) {
+	var backupItems []BackupItem
+
+	for _, bt := range types {
+		err := forEachArchiveItem(zipReader, gcm, bt, func(bi BackupItem) error {
+			backupItems = append(backupItems, bi)
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", bt.Name, err)
+		}
+	}
+
+	return backupItems, nil
+}
+
+// countBackupItems returns the number of items of each backup type
+func countBackupItems(backupItems []BackupItem) map[string]int {
+	counts := make(map[string]int)
+
+	for _, bi := range backupItems {
+		if bt, ok := backupTypeByContentType(bi.Type); ok {
+			counts[bt.Name]++
+		}
+	}
+
+	return counts
+}
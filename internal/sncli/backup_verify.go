@@ -0,0 +1,340 @@
+package sncli
+
+import (
+	"archive/zip"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// VerifyProblemKind classifies a problem found when verifying a backup
+type VerifyProblemKind string
+
+const (
+	VerifyProblemMissing       VerifyProblemKind = "missing"
+	VerifyProblemCorrupted     VerifyProblemKind = "corrupted"
+	VerifyProblemUndecryptable VerifyProblemKind = "undecryptable"
+	VerifyProblemUnexpected    VerifyProblemKind = "unexpected"
+)
+
+// VerifyProblem describes a problem with an archive entry or an item within it
+type VerifyProblem struct {
+	Entry  string            `json:"entry"`
+	UUID   string            `json:"uuid,omitempty"`
+	Kind   VerifyProblemKind `json:"kind"`
+	Detail string            `json:"detail"`
+}
+
+// VerifyConfig holds configuration for verifying a backup
+type VerifyConfig struct {
+	InputFile string
+	Password  string
+}
+
+// VerifyResult contains the outcome of verifying a backup
+type VerifyResult struct {
+	Manifest       BackupManifest  `json:"manifest"`
+	HasChecksums   bool            `json:"has_checksums"`
+	DigestValid    bool            `json:"digest_valid"`
+	ItemsVerified  bool            `json:"items_verified"`
+	EntriesChecked int             `json:"entries_checked"`
+	ItemsChecked   int             `json:"items_checked"`
+	Problems       []VerifyProblem `json:"problems"`
+}
+
+// OK reports whether the backup passed verification
+func (v VerifyResult) OK() bool {
+	return len(v.Problems) == 0
+}
+
+// backupItemChecksum returns the SHA-256 of the fields of an item that are restored
+func backupItemChecksum(bi BackupItem) string {
+	h := sha256.New()
+
+	for _, field := range []string{bi.UUID, bi.Type, bi.Content, bi.CreatedAt, bi.UpdatedAt} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// archiveDigest combines the checksums of every entry into a single digest for the archive
+func archiveDigest(entries map[string]string) string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	h := sha256.New()
+
+	for _, name := range names {
+		fmt.Fprintf(h, "%s:%s\n", name, entries[name])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeBackupEntry writes an entry to the archive and records the checksum of the
+// bytes as stored, so the archive can be checked without the password
+func writeBackupEntry(zipWriter *zip.Writer, manifest *BackupManifest, filename string, data []byte, gcm cipher.AEAD) error {
+	if gcm != nil {
+		var err error
+
+		data, err = encryptBackupData(data, gcm)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeZipEntry(zipWriter, filename, data, nil); err != nil {
+		return err
+	}
+
+	if manifest.Entries == nil {
+		manifest.Entries = make(map[string]string)
+	}
+
+	sum := sha256.Sum256(data)
+	manifest.Entries[filename] = hex.EncodeToString(sum[:])
+	manifest.Digest = archiveDigest(manifest.Entries)
+
+	return nil
+}
+
+// Run checks the archive against the checksums recorded when it was created.
+// Item level checks need the password for encrypted archives and are skipped without it.
+func (v *VerifyConfig) Run() (VerifyResult, error) {
+	var result VerifyResult
+
+	zipReader, err := zip.OpenReader(v.InputFile)
+	if err != nil {
+		return result, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer zipReader.Close()
+
+	manifest, gcm, err := readBackupManifest(&zipReader.Reader, v.Password)
+	result.Manifest = manifest
+
+	switch {
+	case errors.Is(err, ErrBackupPasswordRequired):
+		if manifest.Version == BackupFormatVersion1 {
+			return result, err
+		}
+	case err != nil:
+		return result, err
+	}
+
+	result.HasChecksums = len(manifest.Entries) > 0
+
+	actual := verifyArchiveEntries(&zipReader.Reader, &result)
+
+	if result.HasChecksums {
+		result.DigestValid = manifest.Digest == archiveDigest(manifest.Entries) &&
+			manifest.Digest == archiveDigest(actual)
+
+		if !result.DigestValid {
+			result.Problems = append(result.Problems, VerifyProblem{
+				Entry:  backupManifestFile,
+				Kind:   VerifyProblemCorrupted,
+				Detail: "archive digest does not match",
+			})
+		}
+	}
+
+	if manifest.Encrypted && gcm == nil {
+		return result, nil
+	}
+
+	result.ItemsVerified = true
+
+	for _, bt := range backupItemTypes {
+		verifyArchiveItems(&zipReader.Reader, bt, gcm, &result)
+	}
+
+	return result, nil
+}
+
+// verifyArchiveEntries compares the stored bytes of each entry with the recorded checksums
+// and returns the checksums of the entries that could be read
+func verifyArchiveEntries(zipReader *zip.Reader, result *VerifyResult) map[string]string {
+	actual := make(map[string]string)
+
+	for _, file := range zipReader.File {
+		if file.Name == backupManifestFile {
+			continue
+		}
+
+		result.EntriesChecked++
+
+		sum, err := hashZipFile(file)
+		if err != nil {
+			result.Problems = append(result.Problems, VerifyProblem{
+				Entry:  file.Name,
+				Kind:   VerifyProblemCorrupted,
+				Detail: err.Error(),
+			})
+
+			continue
+		}
+
+		actual[file.Name] = sum
+
+		if !result.HasChecksums {
+			continue
+		}
+
+		expected, ok := result.Manifest.Entries[file.Name]
+
+		switch {
+		case !ok:
+			result.Problems = append(result.Problems, VerifyProblem{
+				Entry:  file.Name,
+				Kind:   VerifyProblemUnexpected,
+				Detail: "entry is not listed in the manifest",
+			})
+		case expected != sum:
+			result.Problems = append(result.Problems, VerifyProblem{
+				Entry:  file.Name,
+				Kind:   VerifyProblemCorrupted,
+				Detail: "checksum does not match manifest",
+			})
+		}
+	}
+
+	for name := range result.Manifest.Entries {
+		if !zipHasEntry(zipReader, name) {
+			result.Problems = append(result.Problems, VerifyProblem{
+				Entry:  name,
+				Kind:   VerifyProblemMissing,
+				Detail: "entry listed in the manifest is not in the archive",
+			})
+		}
+	}
+
+	return actual
+}
+
+// verifyArchiveItems checks the item list of a type, stored in a single entry or in chunks,
+// against the manifest count and each item's checksum
+func verifyArchiveItems(zipReader *zip.Reader, bt backupItemType, gcm cipher.AEAD, result *VerifyResult) {
+	found := 0
+	entry := bt.File
+
+	if zipHasEntry(zipReader, bt.File) {
+		data, err := readZipEntry(zipReader, bt.File, gcm)
+		if err != nil {
+			result.Problems = append(result.Problems, VerifyProblem{Entry: bt.File, Kind: unreadableKind(gcm), Detail: err.Error()})
+
+			return
+		}
+
+		var backupItems []BackupItem
+		if err := json.Unmarshal(data, &backupItems); err != nil {
+			result.Problems = append(result.Problems, VerifyProblem{
+				Entry:  bt.File,
+				Kind:   VerifyProblemCorrupted,
+				Detail: fmt.Sprintf("invalid item list: %s", err),
+			})
+
+			return
+		}
+
+		for _, bi := range backupItems {
+			verifyBackupItem(bt.File, bi, result)
+		}
+
+		found = len(backupItems)
+	} else {
+		chunks := chunkEntries(zipReader, bt.Name)
+		if len(chunks) == 0 {
+			return
+		}
+
+		entry = bt.Name + "/"
+
+		for _, chunk := range chunks {
+			err := decodeBackupChunk(chunk, gcm, func(bi BackupItem) error {
+				verifyBackupItem(chunk.Name, bi, result)
+				found++
+
+				return nil
+			})
+			if err != nil {
+				kind := VerifyProblemCorrupted
+				if isEncryptedChunk(chunk.Name) {
+					kind = unreadableKind(gcm)
+				}
+
+				result.Problems = append(result.Problems, VerifyProblem{Entry: chunk.Name, Kind: kind, Detail: err.Error()})
+
+				return
+			}
+		}
+	}
+
+	if expected, ok := result.Manifest.ItemCounts[bt.Name]; ok && expected != found {
+		result.Problems = append(result.Problems, VerifyProblem{
+			Entry:  entry,
+			Kind:   VerifyProblemMissing,
+			Detail: fmt.Sprintf("manifest records %d items but %d were found", expected, found),
+		})
+	}
+}
+
+// unreadableKind is the problem reported for an entry that can't be read
+func unreadableKind(gcm cipher.AEAD) VerifyProblemKind {
+	if gcm != nil {
+		return VerifyProblemUndecryptable
+	}
+
+	return VerifyProblemCorrupted
+}
+
+// verifyBackupItem checks an item's checksum and that it parses
+func verifyBackupItem(entry string, bi BackupItem, result *VerifyResult) {
+	result.ItemsChecked++
+
+	if bi.SHA256 != "" && bi.SHA256 != backupItemChecksum(bi) {
+		result.Problems = append(result.Problems, VerifyProblem{
+			Entry:  entry,
+			UUID:   bi.UUID,
+			Kind:   VerifyProblemCorrupted,
+			Detail: "item checksum does not match",
+		})
+
+		return
+	}
+
+	if _, err := parseBackupItem(bi); err != nil {
+		result.Problems = append(result.Problems, VerifyProblem{
+			Entry:  entry,
+			UUID:   bi.UUID,
+			Kind:   VerifyProblemCorrupted,
+			Detail: err.Error(),
+		})
+	}
+}
+
+// hashZipFile returns the SHA-256 of an entry's stored bytes. Reading the entry also checks its CRC.
+func hashZipFile(file *zip.File) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
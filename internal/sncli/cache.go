@@ -4,10 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/asdine/storm/v3"
 	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/jonhadfield/gosn-v2/session"
+	bolt "go.etcd.io/bbolt"
 )
 
+// ErrNoCache is returned when reading offline and no local cache has been created
+var ErrNoCache = errors.New("no local cache found: run the command without --offline to sync first")
+
 func Resync(s *cache.Session, cacheDBDir, appName string) error {
 	var err error
 
@@ -28,6 +37,10 @@ func Resync(s *cache.Session, cacheDBDir, appName string) error {
 		return err
 	}
 
+	if DaemonRunning(s.CacheDBPath) {
+		return errors.New("stop the daemon before resyncing, as it holds the cache open")
+	}
+
 	fmt.Printf("deleting cache db at %s\n", s.CacheDBPath)
 	if s.CacheDBPath != "" {
 		err = os.Remove(s.CacheDBPath)
@@ -42,3 +55,139 @@ func Resync(s *cache.Session, cacheDBDir, appName string) error {
 
 	return err
 }
+
+// LoadCachedItems decrypts the items in the local cache without syncing, using the items keys
+// stored in the cache
+func LoadCachedItems(s *cache.Session) (items.Items, error) {
+	allPersistedItems, err := readCachedItems(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = loadCachedItemsKeys(s, allPersistedItems); err != nil {
+		return nil, err
+	}
+
+	return allPersistedItems.ToItems(s)
+}
+
+// readCachedItems returns the encrypted items in the local cache. The cache is opened
+// read-only so it can be read while another command syncs.
+func readCachedItems(s *cache.Session) (cache.Items, error) {
+	if s.CacheDBPath == "" {
+		return nil, ErrNoCache
+	}
+
+	if _, err := os.Stat(s.CacheDBPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w (expected at %s)", ErrNoCache, s.CacheDBPath)
+		}
+
+		return nil, err
+	}
+
+	// a running daemon holds the cache open, so borrow it while reading
+	giveBack, err := borrowCacheFromDaemon(s.CacheDBPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer giveBack()
+
+	db, err := storm.Open(s.CacheDBPath, storm.BoltOptions(0o600, &bolt.Options{ReadOnly: true, Timeout: time.Second}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache at %s: %w", s.CacheDBPath, err)
+	}
+
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var allPersistedItems cache.Items
+	if err = db.All(&allPersistedItems); err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return nil, fmt.Errorf("getting items from db: %w", err)
+	}
+
+	if len(allPersistedItems) == 0 {
+		return nil, fmt.Errorf("%w (cache at %s is empty)", ErrNoCache, s.CacheDBPath)
+	}
+
+	return allPersistedItems, nil
+}
+
+// loadCachedItemsKeys decrypts the items keys in the cache and adds them to the session,
+// choosing the default key the same way a sync does
+func loadCachedItemsKeys(s *cache.Session, cachedItems cache.Items) error {
+	var eiks items.EncryptedItems
+
+	for _, ci := range cachedItems {
+		if ci.ContentType != common.SNItemTypeItemsKey || ci.Deleted {
+			continue
+		}
+
+		eiks = append(eiks, items.EncryptedItem{
+			UUID:               ci.UUID,
+			Content:            ci.Content,
+			ContentType:        ci.ContentType,
+			ItemsKeyID:         ci.ItemsKeyID,
+			EncItemKey:         ci.EncItemKey,
+			CreatedAt:          ci.CreatedAt,
+			UpdatedAt:          ci.UpdatedAt,
+			CreatedAtTimestamp: ci.CreatedAtTimestamp,
+			UpdatedAtTimestamp: ci.UpdatedAtTimestamp,
+		})
+	}
+
+	if len(eiks) == 0 {
+		return fmt.Errorf("%w (cache at %s has no items keys)", ErrNoCache, s.CacheDBPath)
+	}
+
+	iks, err := items.DecryptAndParseItemKeys(s.MasterKey, eiks)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt cached items keys: %w", err)
+	}
+
+	keys := make(map[string]session.SessionItemsKey, len(s.ItemsKeys)+len(iks))
+	for _, k := range s.ItemsKeys {
+		keys[k.UUID] = k
+	}
+
+	for _, ik := range iks {
+		if existing, ok := keys[ik.UUID]; ok && existing.UpdatedAtTimestamp > ik.UpdatedAtTimestamp {
+			continue
+		}
+
+		keys[ik.UUID] = session.SessionItemsKey{
+			UUID:               ik.UUID,
+			ItemsKey:           ik.ItemsKey,
+			Default:            ik.Default,
+			CreatedAtTimestamp: ik.CreatedAtTimestamp,
+			UpdatedAtTimestamp: ik.UpdatedAtTimestamp,
+		}
+	}
+
+	s.ItemsKeys = s.ItemsKeys[:0]
+
+	var defaultKey, latestKey session.SessionItemsKey
+
+	for _, k := range keys {
+		s.ItemsKeys = append(s.ItemsKeys, k)
+
+		if k.CreatedAtTimestamp > latestKey.CreatedAtTimestamp {
+			latestKey = k
+		}
+
+		if k.Default {
+			defaultKey = k
+		}
+	}
+
+	// prefer the key marked as default, falling back to the most recent
+	if defaultKey.UUID == "" {
+		defaultKey = latestKey
+	}
+
+	s.DefaultItemsKey = defaultKey
+
+	return nil
+}
@@ -0,0 +1,734 @@
+package sncli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// DefaultDaemonInterval is how often the daemon syncs in the background
+	DefaultDaemonInterval = 5 * time.Minute
+	// DefaultDaemonMaxAge is how old the daemon's last sync can be before a command syncs again
+	DefaultDaemonMaxAge = 30 * time.Second
+
+	// daemonDisableEnv stops commands using the daemon when set
+	daemonDisableEnv = "SN_NO_DAEMON"
+
+	daemonDialTimeout = time.Second
+	// daemonOpenTimeout is how long to wait for the cache to be unlocked
+	daemonOpenTimeout = 5 * time.Second
+	// daemonMaxMessage is the largest request or response accepted
+	daemonMaxMessage = 1 << 20
+	// daemonLeaseWait is how long a request waits for the cache before the daemon reports it busy
+	daemonLeaseWait = 30 * time.Second
+	// daemonCallTimeout is how long a command waits for a response, long enough for a wait and a sync
+	daemonCallTimeout = 2 * time.Minute
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	// rpcCacheBusy is returned when the cache stays in use for longer than the daemon waits
+	rpcCacheBusy = -32000
+)
+
+// Daemon holds the session and cache open, syncing on an interval and when asked, and serves a
+// JSON-RPC 2.0 API on a Unix socket next to the cache. Commands borrow the cache from the daemon
+// with acquire, holding it until they call release or disconnect, so only one uses it at a time and
+// the daemon only syncs when the cache is stale or has changes to push.
+//
+// Requests and responses are JSON objects, one per line. The methods are:
+//
+//	status                  the daemon's state
+//	sync    {force}         sync if the cache is stale or has changes, or always with force
+//	acquire {sync}          close the daemon's copy of the cache for the caller to open, syncing first if asked
+//	release {push}          take the cache back, syncing if push and there are changes
+//	stop                    shut the daemon down
+type Daemon struct {
+	Session  *cache.Session
+	Interval time.Duration
+	MaxAge   time.Duration
+
+	// syncFn syncs the cache, returning it open. It is replaced in tests.
+	syncFn func(si cache.SyncInput) (cache.SyncOutput, error)
+	// leaseWait is how long requests wait for the cache, daemonLeaseWait unless set in tests
+	leaseWait time.Duration
+
+	// lease is held by whoever is using the cache: the daemon while syncing, or a command
+	lease    chan struct{}
+	db       *storm.DB
+	lastSync atomic.Int64
+	lastErr  atomic.Value
+	leased   atomic.Bool
+	stop     context.CancelFunc
+}
+
+// DaemonStatus describes a running daemon
+type DaemonStatus struct {
+	PID         int       `json:"pid"`
+	CacheDBPath string    `json:"cache_db_path"`
+	LastSync    time.Time `json:"last_sync"`
+	LastError   string    `json:"last_error,omitempty"`
+	Leased      bool      `json:"leased"`
+	Interval    string    `json:"interval"`
+}
+
+type daemonSyncParams struct {
+	Force bool `json:"force"`
+}
+
+type daemonAcquireParams struct {
+	Sync bool `json:"sync"`
+}
+
+type daemonReleaseParams struct {
+	Push bool `json:"push"`
+}
+
+type daemonSyncResult struct {
+	LastSync time.Time `json:"last_sync"`
+	Synced   bool      `json:"synced"`
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      any             `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      any             `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError is an error returned by the daemon
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("daemon: %s", e.Message)
+}
+
+// DaemonSocketPath returns the location of the socket for the daemon serving a cache
+func DaemonSocketPath(cacheDBPath string) string {
+	return strings.TrimSuffix(cacheDBPath, filepath.Ext(cacheDBPath)) + ".sock"
+}
+
+// Run syncs, then serves requests until the context is cancelled or the stop method is called
+func (d *Daemon) Run(ctx context.Context) error {
+	if d.Session == nil || d.Session.CacheDBPath == "" {
+		return errors.New("cache path is not set")
+	}
+
+	if d.Interval <= 0 {
+		d.Interval = DefaultDaemonInterval
+	}
+
+	if d.MaxAge <= 0 {
+		d.MaxAge = DefaultDaemonMaxAge
+	}
+
+	if d.syncFn == nil {
+		d.syncFn = cache.Sync
+	}
+
+	if d.leaseWait <= 0 {
+		d.leaseWait = daemonLeaseWait
+	}
+
+	socketPath := DaemonSocketPath(d.Session.CacheDBPath)
+
+	if conn, err := net.DialTimeout("unix", socketPath, daemonDialTimeout); err == nil {
+		_ = conn.Close()
+
+		return fmt.Errorf("daemon is already running on %s", socketPath)
+	}
+
+	// a socket left by a daemon that didn't stop cleanly
+	_ = os.Remove(socketPath)
+
+	d.lease = make(chan struct{}, 1)
+
+	if err := d.sync(); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		d.closeDB()
+
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+
+	if err = os.Chmod(socketPath, 0o600); err != nil {
+		_ = listener.Close()
+		d.closeDB()
+
+		return err
+	}
+
+	ctx, d.stop = context.WithCancel(ctx)
+
+	go d.accept(listener)
+
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = listener.Close()
+
+			// wait for any command using the cache to finish
+			d.lease <- struct{}{}
+			d.closeDB()
+			_ = os.Remove(socketPath)
+
+			return nil
+		case <-ticker.C:
+			// skip this sync if a command is using the cache
+			select {
+			case d.lease <- struct{}{}:
+				_ = d.sync()
+				<-d.lease
+			default:
+			}
+		}
+	}
+}
+
+func (d *Daemon) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go d.serve(conn)
+	}
+}
+
+// serve handles the requests on a connection. A lease held by the connection is released when it closes.
+func (d *Daemon) serve(conn net.Conn) {
+	holding := false
+
+	defer func() {
+		if holding {
+			_, _ = d.release(true)
+		}
+
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), daemonMaxMessage)
+
+	enc := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req rpcRequest
+
+		resp := rpcResponse{JSONRPC: "2.0"}
+
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = &RPCError{Code: rpcParseError, Message: err.Error()}
+		} else {
+			resp.ID = req.ID
+			resp.Result, resp.Error = d.handle(req, &holding)
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (d *Daemon) handle(req rpcRequest, holding *bool) (json.RawMessage, *RPCError) {
+	var result any
+
+	switch req.Method {
+	case "status":
+		result = d.status()
+	case "sync":
+		var params daemonSyncParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		if *holding {
+			return nil, &RPCError{Code: rpcInvalidParams, Message: "release the cache before syncing"}
+		}
+
+		if !d.takeLease() {
+			return nil, errCacheBusy
+		}
+
+		synced, err := d.syncIfNeeded(params.Force)
+		<-d.lease
+
+		if err != nil {
+			return nil, &RPCError{Code: rpcInternalError, Message: err.Error()}
+		}
+
+		result = daemonSyncResult{LastSync: d.lastSyncTime(), Synced: synced}
+	case "acquire":
+		var params daemonAcquireParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		if *holding {
+			return nil, &RPCError{Code: rpcInvalidParams, Message: "cache is already acquired"}
+		}
+
+		if !d.takeLease() {
+			return nil, errCacheBusy
+		}
+
+		synced := false
+
+		if params.Sync {
+			var err error
+			if synced, err = d.syncIfNeeded(false); err != nil {
+				<-d.lease
+
+				return nil, &RPCError{Code: rpcInternalError, Message: err.Error()}
+			}
+		}
+
+		d.closeDB()
+		d.leased.Store(true)
+		*holding = true
+
+		result = daemonSyncResult{LastSync: d.lastSyncTime(), Synced: synced}
+	case "release":
+		var params daemonReleaseParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		if !*holding {
+			return nil, &RPCError{Code: rpcInvalidParams, Message: "cache is not acquired"}
+		}
+
+		*holding = false
+
+		synced, err := d.release(params.Push)
+		if err != nil {
+			return nil, &RPCError{Code: rpcInternalError, Message: err.Error()}
+		}
+
+		result = daemonSyncResult{LastSync: d.lastSyncTime(), Synced: synced}
+	case "stop":
+		d.stop()
+
+		result = true
+	default:
+		return nil, &RPCError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, &RPCError{Code: rpcInternalError, Message: err.Error()}
+	}
+
+	return data, nil
+}
+
+// errCacheBusy is returned to a request that waited too long for another command to give the cache back
+var errCacheBusy = &RPCError{Code: rpcCacheBusy, Message: "cache is busy"}
+
+// takeLease waits for the cache to be free, reporting false if it isn't within the wait
+func (d *Daemon) takeLease() bool {
+	timer := time.NewTimer(d.leaseWait)
+	defer timer.Stop()
+
+	select {
+	case d.lease <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func decodeParams(params json.RawMessage, v any) *RPCError {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+
+	if err := json.Unmarshal(params, v); err != nil {
+		return &RPCError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// release takes the cache back from a command, pushing its changes if asked
+func (d *Daemon) release(push bool) (bool, error) {
+	defer func() {
+		d.leased.Store(false)
+		<-d.lease
+	}()
+
+	if err := d.openDB(); err != nil {
+		return false, err
+	}
+
+	if !push || !d.dirty() {
+		return false, nil
+	}
+
+	return true, d.sync()
+}
+
+// syncIfNeeded syncs if forced, the last sync is older than MaxAge, or the cache has changes to push
+func (d *Daemon) syncIfNeeded(force bool) (bool, error) {
+	if !force && time.Since(d.lastSyncTime()) < d.MaxAge {
+		if err := d.openDB(); err != nil {
+			return false, err
+		}
+
+		if !d.dirty() {
+			return false, nil
+		}
+	}
+
+	return true, d.sync()
+}
+
+// sync syncs the cache, leaving it open
+func (d *Daemon) sync() error {
+	d.closeDB()
+
+	so, err := d.syncFn(cache.SyncInput{Session: d.Session})
+	if err != nil {
+		d.lastErr.Store(err.Error())
+
+		return err
+	}
+
+	d.db = so.DB
+	d.lastSync.Store(time.Now().UnixNano())
+	d.lastErr.Store("")
+
+	refreshSearchIndex(d.Session, d.db)
+
+	return nil
+}
+
+// dirty reports whether the cache has changes that haven't been synced
+func (d *Daemon) dirty() bool {
+	var dirty cache.Items
+
+	return d.db.Find("Dirty", true, &dirty) == nil && len(dirty) > 0
+}
+
+func (d *Daemon) openDB() error {
+	if d.db != nil {
+		return nil
+	}
+
+	db, err := storm.Open(d.Session.CacheDBPath, storm.BoltOptions(0o600, &bolt.Options{Timeout: daemonOpenTimeout}))
+	if err != nil {
+		return fmt.Errorf("failed to open cache at %s: %w", d.Session.CacheDBPath, err)
+	}
+
+	d.db = db
+
+	return nil
+}
+
+func (d *Daemon) closeDB() {
+	if d.db != nil {
+		_ = d.db.Close()
+		d.db = nil
+	}
+}
+
+func (d *Daemon) lastSyncTime() time.Time {
+	if ns := d.lastSync.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+
+	return time.Time{}
+}
+
+func (d *Daemon) status() DaemonStatus {
+	lastErr, _ := d.lastErr.Load().(string)
+
+	return DaemonStatus{
+		PID:         os.Getpid(),
+		CacheDBPath: d.Session.CacheDBPath,
+		LastSync:    d.lastSyncTime(),
+		LastError:   lastErr,
+		Leased:      d.leased.Load(),
+		Interval:    d.Interval.String(),
+	}
+}
+
+// DaemonClient is a connection to a running daemon
+type DaemonClient struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	id      int
+}
+
+// DialDaemon connects to the daemon serving the cache, returning an error if none is running
+func DialDaemon(cacheDBPath string) (*DaemonClient, error) {
+	conn, err := net.DialTimeout("unix", DaemonSocketPath(cacheDBPath), daemonDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), daemonMaxMessage)
+
+	return &DaemonClient{conn: conn, scanner: scanner}, nil
+}
+
+// Call sends a request and decodes the result into result, if not nil. It fails if the daemon
+// doesn't respond within daemonCallTimeout.
+func (c *DaemonClient) Call(method string, params, result any) error {
+	c.id++
+
+	if err := c.conn.SetDeadline(time.Now().Add(daemonCallTimeout)); err != nil {
+		return fmt.Errorf("failed to send request to daemon: %w", err)
+	}
+
+	req := map[string]any{"jsonrpc": "2.0", "id": c.id, "method": method}
+	if params != nil {
+		req["params"] = params
+	}
+
+	if err := json.NewEncoder(c.conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request to daemon: %w", err)
+	}
+
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read response from daemon: %w", err)
+		}
+
+		return errors.New("daemon closed the connection")
+	}
+
+	var resp rpcResponse
+	if err := json.Unmarshal(c.scanner.Bytes(), &resp); err != nil {
+		return fmt.Errorf("failed to decode response from daemon: %w", err)
+	}
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Status returns the daemon's state
+func (c *DaemonClient) Status() (DaemonStatus, error) {
+	var status DaemonStatus
+
+	err := c.Call("status", nil, &status)
+
+	return status, err
+}
+
+// Close closes the connection, releasing the cache if it was acquired
+func (c *DaemonClient) Close() error {
+	return c.conn.Close()
+}
+
+// daemonLease is the cache borrowed from the daemon by this process, held until the next sync
+// so commands can use the cache between syncs as they do without a daemon. The channel guards it.
+// Long-running callers give it back with releaseDaemonLease once they've read what they need, as
+// other commands only wait daemonLeaseWait for it before being told the cache is busy.
+var daemonLease = make(chan *leasedCache, 1)
+
+type leasedCache struct {
+	client *DaemonClient
+	db     *storm.DB
+}
+
+func init() {
+	daemonLease <- nil
+}
+
+// syncWithDaemon syncs through the daemon for the cache, if one is running, reporting whether it was used.
+// The cache is borrowed from the daemon and opened here, so the daemon only syncs if it needs to.
+func syncWithDaemon(si cache.SyncInput) (cache.SyncOutput, bool, error) {
+	if si.Session == nil || si.Session.CacheDBPath == "" || os.Getenv(daemonDisableEnv) != "" {
+		return cache.SyncOutput{}, false, nil
+	}
+
+	lease := <-daemonLease
+
+	defer func() {
+		daemonLease <- lease
+	}()
+
+	released := false
+
+	if lease != nil {
+		// the command has finished with the cache, so push its changes
+		_ = lease.db.Close()
+		err := lease.client.Call("release", daemonReleaseParams{Push: true}, nil)
+		_ = lease.client.Close()
+		lease = nil
+
+		if err != nil {
+			return cache.SyncOutput{}, true, err
+		}
+
+		released = true
+	}
+
+	client, err := DialDaemon(si.Session.CacheDBPath)
+	if err != nil {
+		// no daemon is running, or it stopped since the cache was borrowed, so sync directly
+		return cache.SyncOutput{}, false, nil
+	}
+
+	if si.Close {
+		defer func() {
+			_ = client.Close()
+		}()
+
+		if released {
+			return cache.SyncOutput{}, true, nil
+		}
+
+		return cache.SyncOutput{}, true, client.Call("sync", daemonSyncParams{}, nil)
+	}
+
+	if err = client.Call("acquire", daemonAcquireParams{Sync: true}, nil); err != nil {
+		_ = client.Close()
+
+		return cache.SyncOutput{}, true, err
+	}
+
+	db, err := openLeasedCache(si.Session)
+	if err != nil {
+		_ = client.Close()
+
+		return cache.SyncOutput{}, true, err
+	}
+
+	lease = &leasedCache{client: client, db: db}
+	si.Session.CacheDB = db
+
+	return cache.SyncOutput{DB: db}, true, nil
+}
+
+// openLeasedCache opens the cache borrowed from the daemon and loads its items keys into the session, as a sync would
+func openLeasedCache(s *cache.Session) (*storm.DB, error) {
+	db, err := storm.Open(s.CacheDBPath, storm.BoltOptions(0o600, &bolt.Options{Timeout: daemonOpenTimeout}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache at %s: %w", s.CacheDBPath, err)
+	}
+
+	var itemsKeys cache.Items
+	if err = db.Find("ContentType", common.SNItemTypeItemsKey, &itemsKeys); err != nil && !errors.Is(err, storm.ErrNotFound) {
+		_ = db.Close()
+
+		return nil, fmt.Errorf("failed to read items keys from cache: %w", err)
+	}
+
+	if err = loadCachedItemsKeys(s, itemsKeys); err != nil {
+		_ = db.Close()
+
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// releaseDaemonLease returns a borrowed cache to the daemon once the caller has closed it,
+// for callers that run for a while between syncs, such as the TUI
+func releaseDaemonLease(push bool) error {
+	lease := <-daemonLease
+
+	defer func() {
+		daemonLease <- nil
+	}()
+
+	if lease == nil {
+		return nil
+	}
+
+	_ = lease.db.Close()
+
+	defer func() {
+		_ = lease.client.Close()
+	}()
+
+	return lease.client.Call("release", daemonReleaseParams{Push: push}, nil)
+}
+
+// borrowCacheFromDaemon borrows the cache without syncing so it can be read, if a daemon is running
+// and this process isn't already holding it. The returned function gives it back.
+func borrowCacheFromDaemon(cacheDBPath string) (func(), error) {
+	if os.Getenv(daemonDisableEnv) != "" {
+		return func() {}, nil
+	}
+
+	lease := <-daemonLease
+	daemonLease <- lease
+
+	if lease != nil {
+		return func() {}, nil
+	}
+
+	client, err := DialDaemon(cacheDBPath)
+	if err != nil {
+		return func() {}, nil
+	}
+
+	if err = client.Call("acquire", daemonAcquireParams{}, nil); err != nil {
+		_ = client.Close()
+
+		return nil, err
+	}
+
+	return func() {
+		_ = client.Call("release", daemonReleaseParams{}, nil)
+		_ = client.Close()
+	}, nil
+}
+
+// DaemonRunning reports whether a daemon is serving the cache
+func DaemonRunning(cacheDBPath string) bool {
+	client, err := DialDaemon(cacheDBPath)
+	if err != nil {
+		return false
+	}
+
+	_ = client.Close()
+
+	return true
+}
@@ -0,0 +1,271 @@
+package sncli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/jonhadfield/gosn-v2/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDaemon starts a daemon whose syncs mark the cached items clean rather than push them
+func testDaemon(t *testing.T) (*Daemon, *int) {
+	t.Helper()
+
+	// socket paths are limited in length, so avoid the long test directory names
+	dir, err := os.MkdirTemp("", "sn-daemon")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	syncs := new(int)
+
+	d := &Daemon{
+		Session:   &cache.Session{CacheDBPath: filepath.Join(dir, "sn-cli-test.db")},
+		MaxAge:    time.Hour,
+		leaseWait: time.Second,
+		syncFn: func(si cache.SyncInput) (cache.SyncOutput, error) {
+			db, err := storm.Open(si.Session.CacheDBPath)
+			if err != nil {
+				return cache.SyncOutput{}, err
+			}
+
+			var dirty cache.Items
+			_ = db.Find("Dirty", true, &dirty)
+
+			for _, item := range dirty {
+				if err = db.UpdateField(&cache.Item{UUID: item.UUID}, "Dirty", false); err != nil {
+					return cache.SyncOutput{}, err
+				}
+			}
+
+			*syncs++
+
+			return cache.SyncOutput{DB: db}, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- d.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	require.Eventually(t, func() bool {
+		return DaemonRunning(d.Session.CacheDBPath)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return d, syncs
+}
+
+// testDaemonSession returns a session able to read the daemon's cache, after storing an items
+// key encrypted with its master key there, as a sync would
+func testDaemonSession(t *testing.T, d *Daemon) *cache.Session {
+	t.Helper()
+
+	s := &session.Session{Debug: true, MasterKey: "9dbd97421d3981c433979fc8d86559734331f711372c4ad7a0a6830fff75af68"}
+
+	ik, err := items.CreateItemsKey()
+	require.NoError(t, err)
+
+	eik, err := items.EncryptItemsKey(session.SessionItemsKey{
+		UUID:               ik.UUID,
+		ItemsKey:           ik.Content.ItemsKey,
+		Version:            ik.Content.Version,
+		Default:            true,
+		CreatedAt:          ik.CreatedAt,
+		CreatedAtTimestamp: ik.CreatedAtTimestamp,
+	}, s, true)
+	require.NoError(t, err)
+
+	client, err := DialDaemon(d.Session.CacheDBPath)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	require.NoError(t, client.Call("acquire", nil, nil))
+
+	db, err := storm.Open(d.Session.CacheDBPath)
+	require.NoError(t, err)
+
+	for _, item := range cache.ToCacheItems(items.EncryptedItems{eik}, true) {
+		require.NoError(t, db.Save(&item))
+	}
+
+	require.NoError(t, db.Close())
+	require.NoError(t, client.Call("release", nil, nil))
+
+	return &cache.Session{Session: s, CacheDBPath: d.Session.CacheDBPath}
+}
+
+func TestDaemonSocketPath(t *testing.T) {
+	assert.Equal(t, "/tmp/sn-cli-abc.sock", DaemonSocketPath("/tmp/sn-cli-abc.db"))
+}
+
+func TestDaemonStatusAndSync(t *testing.T) {
+	d, syncs := testDaemon(t)
+
+	client, err := DialDaemon(d.Session.CacheDBPath)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	status, err := client.Status()
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), status.PID)
+	assert.False(t, status.LastSync.IsZero())
+	assert.Equal(t, 1, *syncs)
+
+	// the cache is fresh and clean, so there's nothing to do unless forced
+	var result daemonSyncResult
+	require.NoError(t, client.Call("sync", daemonSyncParams{}, &result))
+	assert.False(t, result.Synced)
+
+	require.NoError(t, client.Call("sync", daemonSyncParams{Force: true}, &result))
+	assert.True(t, result.Synced)
+	assert.Equal(t, 2, *syncs)
+
+	var rpcErr *RPCError
+	require.ErrorAs(t, client.Call("unknown", nil, nil), &rpcErr)
+	assert.Equal(t, rpcMethodNotFound, rpcErr.Code)
+
+	// a second daemon for the same cache isn't started
+	require.ErrorContains(t, (&Daemon{Session: d.Session}).Run(context.Background()), "already running")
+}
+
+func TestDaemonAcquireRelease(t *testing.T) {
+	d, syncs := testDaemon(t)
+
+	client, err := DialDaemon(d.Session.CacheDBPath)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	require.NoError(t, client.Call("acquire", daemonAcquireParams{Sync: true}, nil))
+
+	status, err := client.Status()
+	require.NoError(t, err)
+	assert.True(t, status.Leased)
+
+	// the daemon has closed the cache so it can be opened here
+	db, err := storm.Open(d.Session.CacheDBPath)
+	require.NoError(t, err)
+	require.NoError(t, db.Save(&cache.Item{UUID: "note-1", Dirty: true}))
+	require.NoError(t, db.Close())
+
+	var result daemonSyncResult
+	require.NoError(t, client.Call("release", daemonReleaseParams{Push: true}, &result))
+	assert.True(t, result.Synced, "changes weren't pushed")
+	assert.Equal(t, 2, *syncs)
+
+	require.ErrorContains(t, client.Call("release", nil, nil), "not acquired")
+}
+
+func TestDaemonReclaimsCacheOnDisconnect(t *testing.T) {
+	d, syncs := testDaemon(t)
+
+	client, err := DialDaemon(d.Session.CacheDBPath)
+	require.NoError(t, err)
+	require.NoError(t, client.Call("acquire", nil, nil))
+
+	db, err := storm.Open(d.Session.CacheDBPath)
+	require.NoError(t, err)
+	require.NoError(t, db.Save(&cache.Item{UUID: "note-1", Dirty: true}))
+	require.NoError(t, db.Close())
+
+	// as when a command exits without releasing the cache
+	require.NoError(t, client.Close())
+
+	other, err := DialDaemon(d.Session.CacheDBPath)
+	require.NoError(t, err)
+
+	defer other.Close()
+
+	// waits for the cache to be reclaimed
+	var result daemonSyncResult
+	require.NoError(t, other.Call("sync", nil, &result))
+
+	status, err := other.Status()
+	require.NoError(t, err)
+	assert.False(t, status.Leased)
+	assert.Equal(t, 2, *syncs, "changes left by the command weren't pushed")
+}
+
+func TestDaemonReportsBusyCache(t *testing.T) {
+	d, _ := testDaemon(t)
+
+	holder, err := DialDaemon(d.Session.CacheDBPath)
+	require.NoError(t, err)
+
+	defer holder.Close()
+
+	require.NoError(t, holder.Call("acquire", nil, nil))
+
+	other, err := DialDaemon(d.Session.CacheDBPath)
+	require.NoError(t, err)
+
+	defer other.Close()
+
+	// a command holding the cache doesn't leave others waiting forever
+	var rpcErr *RPCError
+	require.ErrorAs(t, other.Call("acquire", nil, nil), &rpcErr)
+	assert.Equal(t, rpcCacheBusy, rpcErr.Code)
+	require.ErrorAs(t, other.Call("sync", nil, nil), &rpcErr)
+	assert.Equal(t, rpcCacheBusy, rpcErr.Code)
+
+	require.NoError(t, holder.Call("release", nil, nil))
+	require.NoError(t, other.Call("acquire", nil, nil))
+	require.NoError(t, other.Call("release", nil, nil))
+}
+
+func TestDaemonRemovesStaleSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sn-daemon")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	cacheDBPath := filepath.Join(dir, "sn-cli-test.db")
+	require.NoError(t, os.WriteFile(DaemonSocketPath(cacheDBPath), nil, 0o600))
+	assert.False(t, DaemonRunning(cacheDBPath))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Daemon{
+		Session: &cache.Session{CacheDBPath: cacheDBPath},
+		syncFn: func(si cache.SyncInput) (cache.SyncOutput, error) {
+			db, err := storm.Open(si.Session.CacheDBPath)
+
+			return cache.SyncOutput{DB: db}, err
+		},
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- d.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return DaemonRunning(cacheDBPath)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	_, err = os.Stat(DaemonSocketPath(cacheDBPath))
+	assert.True(t, os.IsNotExist(err), "socket wasn't removed on shutdown")
+}
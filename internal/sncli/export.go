@@ -11,14 +11,6 @@ type ExportConfig struct {
 	UseStdOut bool
 }
 
-type ImportConfig struct {
-	Session   *cache.Session
-	File      string
-	Format    string
-	UseStdOut bool
-	Debug     bool
-}
-
 //
 // // Run will retrieve all items from SN directly, re-encrypt them with a new ItemsKey and write them to a file.
 // func (i ExportConfig) Run() error {
@@ -42,51 +34,3 @@ type ImportConfig struct {
 //
 // 	return i.Session.Export(i.File)
 // }
-
-// func (i *ImportConfig) Run() (imported int, err error) {
-// 	// populate DB
-// 	gii := cache.SyncInput{
-// 		Session: i.Session,
-// 	}
-//
-// 	gio, err := Sync(gii, true)
-// 	if err != nil {
-// 		return imported, err
-// 	}
-//
-// 	var syncTokens []cache.SyncToken
-// 	if err = gio.DB.All(&syncTokens); err != nil {
-// 		return imported, err
-// 	}
-// 	syncToken := ""
-// 	if len(syncTokens) > 0 {
-// 		syncToken = syncTokens[0].SyncToken
-// 	}
-// 	if err = gio.DB.Close(); err != nil {
-// 		return imported, err
-// 	}
-//
-// 	// request all items from SN
-// 	var iItemsKey items.ItemsKey
-// 	var iItems items.EncryptedItems
-//
-// 	iItems, iItemsKey, err = i.Session.Session.Import(i.File, syncToken, "")
-// 	if err != nil {
-// 		return 0, err
-// 	}
-//
-// 	if iItemsKey.ItemsKey == "" {
-// 		panic(fmt.Sprintf("iItemsKey.ItemsKey is empty for: '%s'", iItemsKey.UUID))
-// 	}
-//
-// 	// push item and close db
-// 	pii := cache.SyncInput{
-// 		Session: i.Session,
-// 		Close:   true,
-// 	}
-//
-// 	_, err = Sync(pii, true)
-// 	imported = len(iItems)
-//
-// 	return imported, err
-// }
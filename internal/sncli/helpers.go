@@ -175,6 +175,55 @@ func ItemRefsToJSON(irs []items.ItemReference) []ItemReferenceJSON {
 	return iRefs
 }
 
+// NoteToJSON returns the note in the JSON form output by get note
+func NoteToJSON(note *items.Note) NoteJSON {
+	appData := note.Content.GetAppData()
+
+	return NoteJSON{
+		UUID:        note.UUID,
+		ContentType: note.ContentType,
+		Content: NoteContentJSON{
+			Title:          note.Content.GetTitle(),
+			Text:           note.Content.GetText(),
+			ItemReferences: ItemRefsToJSON(note.Content.References()),
+			AppData: AppDataContentJSON{
+				OrgStandardNotesSN: OrgStandardNotesSNDetailJSON{
+					ClientUpdatedAt:    appData.OrgStandardNotesSN.ClientUpdatedAt,
+					Pinned:             appData.OrgStandardNotesSN.Pinned,
+					PrefersPlainEditor: appData.OrgStandardNotesSN.PrefersPlainEditor,
+				},
+				OrgStandardNotesSNComponents: appData.OrgStandardNotesSNComponents,
+			},
+			EditorIdentifier: note.Content.EditorIdentifier,
+			PreviewPlain:     note.Content.PreviewPlain,
+			PreviewHtml:      note.Content.PreviewHtml,
+			Spellcheck:       note.Content.Spellcheck,
+			Trashed:          note.Content.Trashed,
+		},
+		UpdatedAt: note.UpdatedAt,
+		CreatedAt: note.CreatedAt,
+	}
+}
+
+// TagToJSON returns the tag in the JSON form output by get tag
+func TagToJSON(tag *items.Tag) TagJSON {
+	return TagJSON{
+		UUID:        tag.UUID,
+		ContentType: tag.ContentType,
+		Content: TagContentJSON{
+			Title:          tag.Content.GetTitle(),
+			ItemReferences: ItemRefsToJSON(tag.Content.References()),
+			AppData: AppDataContentJSON{
+				OrgStandardNotesSN: OrgStandardNotesSNDetailJSON{
+					ClientUpdatedAt: tag.Content.GetAppData().OrgStandardNotesSN.ClientUpdatedAt,
+				},
+			},
+		},
+		UpdatedAt: tag.UpdatedAt,
+		CreatedAt: tag.CreatedAt,
+	}
+}
+
 func CommaSplit(i string) []string {
 	// split i
 	o := strings.Split(i, ",")
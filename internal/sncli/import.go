@@ -0,0 +1,432 @@
+package sncli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// ImportStateFile records the note created for each imported note, so importing again is safe. It's kept
+// in the directory imported, or next to the file imported with the file's name added.
+const ImportStateFile = ".sn-import.json"
+
+// ImportConfig holds configuration for import operations.
+type ImportConfig struct {
+	Session *cache.Session
+	// Format names the importer: obsidian, markdown, backup or enex
+	Format string
+	// Path is the directory or file to import
+	Path string
+	// FolderTags tags notes imported from directories with their folders
+	FolderTags bool
+	DryRun     bool
+	Debug      bool
+}
+
+// Importer interface defines operations for different import sources.
+type Importer interface {
+	Name() string
+	Validate() error
+	Read() ([]ImportedNote, error)
+}
+
+// ImportedNote is a note read from another application, ready to be added
+type ImportedNote struct {
+	// Source identifies the note in what it was imported from, such as its path, so it can be
+	// matched with the note created for it when imported again
+	Source string `json:"source"`
+	Title  string `json:"title"`
+	Text   string `json:"text"`
+	// Tags are tag paths, with nested tags separated by /, such as projects/work
+	Tags []string `json:"tags,omitempty"`
+	// Links are the sources or titles of other notes it links to, which become note references
+	Links []string `json:"links,omitempty"`
+	// Aliases are other titles links can use to refer to the note
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// ImportResult lists the notes, by source, and the tags changed by an import
+type ImportResult struct {
+	Created   []string
+	Updated   []string
+	Unchanged int
+	// TagsCreated are the paths of new tags
+	TagsCreated []string
+	// Links is how many links became note references
+	Links int
+}
+
+// importState maps each source to the note created for it, and is kept between imports
+type importState struct {
+	Notes map[string]importEntry `json:"notes"`
+}
+
+// importEntry records the note created for a source and a hash of what was imported, to skip it
+// when it hasn't changed
+type importEntry struct {
+	UUID string `json:"uuid"`
+	Hash string `json:"hash"`
+}
+
+// importPlan is the work found by comparing the imported notes with the library and the state
+type importPlan struct {
+	lib   *Library
+	state importState
+	// notes holds the created and updated notes, by source
+	notes map[string]*items.Note
+	// dirtyTags holds the UUIDs of tags created or changed
+	dirtyTags map[string]bool
+	result    ImportResult
+}
+
+// Run reads the notes with the importer for the format and adds them, creating notes for new ones and
+// updating those imported before that have changed.
+func (i *ImportConfig) Run() (ImportResult, error) {
+	if i.Session == nil {
+		return ImportResult{}, fmt.Errorf("session is required")
+	}
+
+	importer, err := getImporter(i)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	if err = importer.Validate(); err != nil {
+		return ImportResult{}, fmt.Errorf("%s import: %w", importer.Name(), err)
+	}
+
+	notes, err := importer.Read()
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("%s import: %w", importer.Name(), err)
+	}
+
+	return importNotes(i.Session, importStatePath(i.Path), notes, i.DryRun)
+}
+
+// getImporter returns the appropriate importer based on the format.
+func getImporter(i *ImportConfig) (Importer, error) {
+	switch i.Format {
+	case "obsidian", "obs":
+		return NewMarkdownImporter(i.Path, true, i.FolderTags), nil
+	case "markdown", "md":
+		return NewMarkdownImporter(i.Path, false, i.FolderTags), nil
+	case "backup":
+		return NewBackupImporter(i.Path), nil
+	case "enex", "evernote":
+		return NewENEXImporter(i.Path), nil
+	default:
+		return nil, fmt.Errorf("unsupported import format: %s", i.Format)
+	}
+}
+
+// importStatePath returns where the state is kept for the directory or file
+func importStatePath(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, ImportStateFile)
+	}
+
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+ImportStateFile)
+}
+
+// importNotes adds the notes, or updates those imported before that have since changed, recording
+// the notes created in the state file. With dry run, the result is what would be done.
+func importNotes(s *cache.Session, statePath string, imported []ImportedNote, dryRun bool) (ImportResult, error) {
+	state, err := loadImportState(statePath)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	lib, err := SyncLibrary(s, nil)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	p, err := planImport(lib, state, imported)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	if dryRun {
+		return p.result, nil
+	}
+
+	if changed := p.changed(); len(changed) > 0 {
+		if _, err = SyncLibrary(s, changed); err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	data, err := json.MarshalIndent(p.state, "", "  ")
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	return p.result, os.WriteFile(statePath, data, 0o600)
+}
+
+func loadImportState(path string) (importState, error) {
+	state := importState{Notes: make(map[string]importEntry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if err = json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if state.Notes == nil {
+		state.Notes = make(map[string]importEntry)
+	}
+
+	return state, nil
+}
+
+// planImport works out the notes and tags to create or change without saving them
+func planImport(lib *Library, state importState, imported []ImportedNote) (*importPlan, error) {
+	p := &importPlan{
+		lib:       lib,
+		state:     importState{Notes: make(map[string]importEntry, len(state.Notes))},
+		notes:     make(map[string]*items.Note),
+		dirtyTags: make(map[string]bool),
+	}
+
+	// sources missing this time are kept, so they aren't added twice if they come back
+	maps.Copy(p.state.Notes, state.Notes)
+
+	// UUIDs of every imported note, changed or not, for resolving links
+	uuids := make(map[string]string, len(imported))
+
+	for _, in := range imported {
+		if strings.TrimSpace(in.Title) == "" {
+			in.Title = in.Source
+		}
+
+		hash := importHash(in)
+		entry, known := state.Notes[in.Source]
+		existing := lib.Note(entry.UUID)
+
+		switch {
+		case known && existing != nil && entry.Hash == hash:
+			p.result.Unchanged++
+			p.state.Notes[in.Source] = entry
+			uuids[in.Source] = entry.UUID
+
+			continue
+		case known && existing != nil:
+			p.notes[in.Source] = lib.EditNote(existing, in.Title, in.Text)[0].(*items.Note)
+			p.result.Updated = append(p.result.Updated, in.Source)
+		default:
+			note, err := items.NewNote(in.Title, in.Text, nil)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", in.Source, err)
+			}
+
+			p.notes[in.Source] = &note
+			p.result.Created = append(p.result.Created, in.Source)
+		}
+
+		note := p.notes[in.Source]
+		uuids[in.Source] = note.UUID
+		p.state.Notes[in.Source] = importEntry{UUID: note.UUID, Hash: hash}
+
+		for _, path := range in.Tags {
+			idx, err := p.tagPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", in.Source, err)
+			}
+
+			if !tagReferences(p.lib.Tags[idx], note.UUID) {
+				tag := p.editableTag(idx)
+				tag.Content.SetReferences(append(tag.Content.References(), items.ItemReference{
+					UUID:        note.UUID,
+					ContentType: common.SNItemTypeNote,
+				}))
+			}
+		}
+	}
+
+	resolve := importLinkResolver(imported, uuids)
+
+	for _, in := range imported {
+		note := p.notes[in.Source]
+		if note == nil {
+			continue
+		}
+
+		for _, link := range in.Links {
+			target, ok := resolve(link)
+			if !ok || target == note.UUID || slices.ContainsFunc(note.Content.References(), func(ref items.ItemReference) bool {
+				return ref.UUID == target
+			}) {
+				continue
+			}
+
+			note.Content.SetReferences(append(note.Content.References(), items.ItemReference{
+				UUID:        target,
+				ContentType: common.SNItemTypeNote,
+			}))
+			p.result.Links++
+		}
+	}
+
+	sort.Strings(p.result.Created)
+	sort.Strings(p.result.Updated)
+	sort.Strings(p.result.TagsCreated)
+
+	return p, nil
+}
+
+// changed returns the notes and tags to save
+func (p *importPlan) changed() items.Items {
+	var changed items.Items
+
+	for _, note := range p.notes {
+		changed = append(changed, note)
+	}
+
+	for _, tag := range p.lib.Tags {
+		if p.dirtyTags[tag.UUID] {
+			changed = append(changed, tag)
+		}
+	}
+
+	return changed
+}
+
+// tagPath returns the index in the library of the tag at the end of the path, creating the tags
+// along it that don't exist with each nested under the one before
+func (p *importPlan) tagPath(path string) (int, error) {
+	idx := -1
+
+	var walked []string
+
+	for _, title := range strings.Split(path, "/") {
+		title = strings.TrimSpace(title)
+		if title == "" {
+			continue
+		}
+
+		walked = append(walked, title)
+
+		parentUUID := ""
+		if idx >= 0 {
+			parentUUID = p.lib.Tags[idx].UUID
+		}
+
+		if idx = slices.IndexFunc(p.lib.Tags, func(tag *items.Tag) bool {
+			return strings.EqualFold(tag.Content.GetTitle(), title) && tagParent(tag) == parentUUID
+		}); idx >= 0 {
+			continue
+		}
+
+		var refs items.ItemReferences
+		if parentUUID != "" {
+			refs = items.ItemReferences{{UUID: parentUUID, ContentType: common.SNItemTypeTag, ReferenceType: tagParentReferenceType}}
+		}
+
+		tag, err := items.NewTag(title, refs)
+		if err != nil {
+			return -1, err
+		}
+
+		p.lib.Tags = append(p.lib.Tags, &tag)
+		p.dirtyTags[tag.UUID] = true
+		p.result.TagsCreated = append(p.result.TagsCreated, strings.Join(walked, "/"))
+		idx = len(p.lib.Tags) - 1
+	}
+
+	if idx < 0 {
+		return -1, fmt.Errorf("invalid tag %q", path)
+	}
+
+	return idx, nil
+}
+
+// editableTag replaces the library's tag with a copy, once, so it can be changed and saved
+func (p *importPlan) editableTag(idx int) *items.Tag {
+	tag := p.lib.Tags[idx]
+	if p.dirtyTags[tag.UUID] {
+		return tag
+	}
+
+	edited := *tag
+	edited.Content.SetReferences(slices.Clone(tag.Content.References()))
+	edited.Content.SetUpdateTime(time.Now().UTC())
+	p.lib.Tags[idx] = &edited
+	p.dirtyTags[tag.UUID] = true
+
+	return &edited
+}
+
+// importLinkResolver returns a function that finds the UUID of the note a link refers to, by source
+// or title, without the .md extension, and then by alias, matched case-insensitively
+func importLinkResolver(imported []ImportedNote, uuids map[string]string) func(string) (string, bool) {
+	targets := make(map[string]string)
+
+	add := func(key, uuid string) {
+		key = strings.ToLower(strings.TrimSuffix(key, ".md"))
+		if _, taken := targets[key]; !taken && key != "" {
+			targets[key] = uuid
+		}
+	}
+
+	for _, in := range imported {
+		add(in.Source, uuids[in.Source])
+	}
+
+	for _, in := range imported {
+		add(in.Title, uuids[in.Source])
+
+		// links to files in vaults usually give only the name
+		if i := strings.LastIndex(in.Source, "/"); i >= 0 {
+			add(in.Source[i+1:], uuids[in.Source])
+		}
+	}
+
+	for _, in := range imported {
+		for _, alias := range in.Aliases {
+			add(alias, uuids[in.Source])
+		}
+	}
+
+	return func(link string) (string, bool) {
+		uuid, ok := targets[strings.ToLower(strings.TrimSuffix(link, ".md"))]
+
+		return uuid, ok
+	}
+}
+
+func importHash(in ImportedNote) string {
+	h := sha256.New()
+
+	for _, field := range [][]string{{in.Title, in.Text}, in.Tags, in.Links} {
+		for _, value := range field {
+			h.Write([]byte(value))
+			h.Write([]byte{0})
+		}
+
+		h.Write([]byte{1})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,183 @@
+package sncli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jonhadfield/gosn-v2/common"
+)
+
+// BackupImporter implements the Importer interface for the decrypted backups made by the Standard Notes
+// apps, saved as .txt or .json. Notes are imported with their tags, nested as they were, and links to
+// other notes in the backup.
+type BackupImporter struct {
+	file string
+}
+
+// snBackup is the decrypted backup format
+type snBackup struct {
+	Version string         `json:"version"`
+	Items   []snBackupItem `json:"items"`
+	// encrypted backups have key parameters
+	KeyParams json.RawMessage `json:"keyParams"`
+}
+
+type snBackupItem struct {
+	UUID        string          `json:"uuid"`
+	ContentType string          `json:"content_type"`
+	Content     json.RawMessage `json:"content"`
+	Deleted     bool            `json:"deleted"`
+}
+
+type snBackupContent struct {
+	Title      string                  `json:"title"`
+	Text       string                  `json:"text"`
+	Trashed    bool                    `json:"trashed"`
+	References []snBackupItemReference `json:"references"`
+}
+
+type snBackupItemReference struct {
+	UUID          string `json:"uuid"`
+	ContentType   string `json:"content_type"`
+	ReferenceType string `json:"reference_type"`
+}
+
+// NewBackupImporter creates a new backup importer.
+func NewBackupImporter(file string) *BackupImporter {
+	return &BackupImporter{file: file}
+}
+
+// Name returns the importer name.
+func (b *BackupImporter) Name() string {
+	return "backup"
+}
+
+// Validate checks the backup file exists.
+func (b *BackupImporter) Validate() error {
+	if b.file == "" {
+		return fmt.Errorf("backup file is required")
+	}
+
+	info, err := os.Stat(b.file)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", b.file)
+	}
+
+	return nil
+}
+
+// Read returns the notes in the backup, other than deleted and trashed ones, in backup order with their
+// UUIDs as sources.
+func (b *BackupImporter) Read() ([]ImportedNote, error) {
+	data, err := os.ReadFile(b.file)
+	if err != nil {
+		return nil, err
+	}
+
+	var backup snBackup
+	if err = json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("not a Standard Notes backup: %w", err)
+	}
+
+	if len(backup.KeyParams) > 0 {
+		return nil, errors.New("the backup is encrypted, so export a decrypted backup instead")
+	}
+
+	type tagInfo struct {
+		title, parent string
+		notes         []string
+	}
+
+	var notes []ImportedNote
+
+	tags := make(map[string]*tagInfo)
+
+	for _, item := range backup.Items {
+		if item.Deleted || (item.ContentType != common.SNItemTypeNote && item.ContentType != common.SNItemTypeTag) {
+			continue
+		}
+
+		var content snBackupContent
+		if err = json.Unmarshal(item.Content, &content); err != nil {
+			// encrypted items have their content as a string
+			return nil, fmt.Errorf("item %s can't be read, so the backup may be encrypted: %w", item.UUID, err)
+		}
+
+		if item.ContentType == common.SNItemTypeTag {
+			tag := &tagInfo{title: content.Title}
+
+			for _, ref := range content.References {
+				switch {
+				case ref.ContentType == common.SNItemTypeNote:
+					tag.notes = append(tag.notes, ref.UUID)
+				case ref.ContentType == common.SNItemTypeTag && ref.ReferenceType == tagParentReferenceType:
+					tag.parent = ref.UUID
+				}
+			}
+
+			tags[item.UUID] = tag
+
+			continue
+		}
+
+		if content.Trashed {
+			continue
+		}
+
+		note := ImportedNote{Source: item.UUID, Title: content.Title, Text: content.Text}
+
+		for _, ref := range content.References {
+			if ref.ContentType == common.SNItemTypeNote {
+				note.Links = append(note.Links, ref.UUID)
+			}
+		}
+
+		notes = append(notes, note)
+	}
+
+	// tag paths follow parents to the top, stopping at any loop
+	tagPath := func(uuid string) string {
+		var titles []string
+
+		for visited := make(map[string]bool); tags[uuid] != nil && !visited[uuid]; uuid = tags[uuid].parent {
+			visited[uuid] = true
+			// slashes in titles would otherwise nest the tag further
+			titles = append(titles, strings.ReplaceAll(tags[uuid].title, "/", "-"))
+		}
+
+		slices.Reverse(titles)
+
+		return strings.Join(titles, "/")
+	}
+
+	bySource := make(map[string]int, len(notes))
+	for i, note := range notes {
+		bySource[note.Source] = i
+	}
+
+	// tag in backup order so tags are applied in the same order each time
+	for _, item := range backup.Items {
+		tag := tags[item.UUID]
+		if tag == nil {
+			continue
+		}
+
+		path := tagPath(item.UUID)
+
+		for _, uuid := range tag.notes {
+			if i, ok := bySource[uuid]; ok && path != "" && !slices.Contains(notes[i].Tags, path) {
+				notes[i].Tags = append(notes[i].Tags, path)
+			}
+		}
+	}
+
+	return notes, nil
+}
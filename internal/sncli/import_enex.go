@@ -0,0 +1,462 @@
+package sncli
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ENEXImporter implements the Importer interface for Evernote's .enex exports. Each note's ENML is
+// converted to Markdown, and it's tagged with its Evernote tags and the notebook, named after the file.
+type ENEXImporter struct {
+	file string
+}
+
+// enexNote is a note in an ENEX file
+type enexNote struct {
+	Title   string   `xml:"title"`
+	Content string   `xml:"content"`
+	Created string   `xml:"created"`
+	Tags    []string `xml:"tag"`
+}
+
+var (
+	enmlSpace     = regexp.MustCompile(`[ \t\r\n]+`)
+	enmlBlankRuns = regexp.MustCompile(`\n{3,}`)
+	// ordered list items start with a number, such as 1.
+	enmlOrderedItem = regexp.MustCompile(`^[0-9]+\. `)
+)
+
+// NewENEXImporter creates a new ENEX importer.
+func NewENEXImporter(file string) *ENEXImporter {
+	return &ENEXImporter{file: file}
+}
+
+// Name returns the importer name.
+func (e *ENEXImporter) Name() string {
+	return "enex"
+}
+
+// Validate checks the ENEX file exists.
+func (e *ENEXImporter) Validate() error {
+	if e.file == "" {
+		return fmt.Errorf("enex file is required")
+	}
+
+	info, err := os.Stat(e.file)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", e.file)
+	}
+
+	return nil
+}
+
+// Read returns the notes in the file, in file order. Notes have no IDs in ENEX, so the source is
+// the notebook, title and creation time.
+func (e *ENEXImporter) Read() ([]ImportedNote, error) {
+	f, err := os.Open(e.file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	notebook := strings.TrimSuffix(filepath.Base(e.file), filepath.Ext(e.file))
+
+	var notes []ImportedNote
+
+	// ENEX files can be large, so notes are decoded one at a time
+	dec := xml.NewDecoder(f)
+	dec.Strict = false
+
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("not an ENEX file: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+
+		var en enexNote
+		if err = dec.DecodeElement(&en, &start); err != nil {
+			return nil, fmt.Errorf("note %d: %w", len(notes)+1, err)
+		}
+
+		text, err := enmlToMarkdown(en.Content)
+		if err != nil {
+			return nil, fmt.Errorf("note %q: %w", en.Title, err)
+		}
+
+		note := ImportedNote{
+			Source: notebook + "/" + en.Title + "/" + en.Created,
+			Title:  strings.TrimSpace(en.Title),
+			Text:   text,
+			Tags:   []string{strings.ReplaceAll(notebook, "/", "-")},
+		}
+
+		for _, tag := range en.Tags {
+			if tag = strings.ReplaceAll(strings.TrimSpace(tag), "/", "-"); tag != "" {
+				note.Tags = append(note.Tags, tag)
+			}
+		}
+
+		notes = append(notes, note)
+	}
+
+	return notes, nil
+}
+
+// enmlWriter converts ENML, Evernote's XHTML, to Markdown
+type enmlWriter struct {
+	b strings.Builder
+	// lists holds the item number of each open list, or -1 for unordered lists
+	lists []int
+	pre   bool
+}
+
+// enmlToMarkdown converts the note content to Markdown
+func enmlToMarkdown(enml string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(enml))
+	if err != nil {
+		return "", err
+	}
+
+	w := &enmlWriter{}
+	w.children(doc)
+
+	lines := strings.Split(w.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+
+	text := enmlBlankRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+
+	return strings.Trim(text, "\n") + "\n", nil
+}
+
+func (w *enmlWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+func (w *enmlWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+
+		return
+	}
+
+	switch n.Data {
+	case "head", "style", "script", "title":
+	case "div":
+		// Evernote puts each line in a div, including the text of list items, which would break the item
+		if len(w.lists) > 0 {
+			w.children(n)
+
+			return
+		}
+
+		// lines after a checklist would otherwise continue its last item
+		if w.afterListItem() && !startsWithTodo(n) {
+			w.block()
+		} else {
+			w.newline()
+		}
+
+		w.children(n)
+		w.newline()
+	case "p":
+		w.block()
+		w.children(n)
+		w.block()
+	case "br":
+		w.b.WriteString("\n")
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(n.Data[1:])
+
+		w.block()
+		w.b.WriteString(strings.Repeat("#", level) + " ")
+		w.children(n)
+		w.block()
+	case "b", "strong":
+		w.wrap(n, "**")
+	case "i", "em":
+		w.wrap(n, "_")
+	case "s", "strike", "del":
+		w.wrap(n, "~~")
+	case "code":
+		if w.pre {
+			w.children(n)
+
+			return
+		}
+
+		w.wrap(n, "`")
+	case "pre":
+		w.block()
+		w.b.WriteString("```\n")
+		w.pre = true
+		w.children(n)
+		w.pre = false
+		w.newline()
+		w.b.WriteString("```")
+		w.block()
+	case "a":
+		href := enmlAttr(n, "href")
+
+		inner := &enmlWriter{}
+		inner.children(n)
+		label := strings.TrimSpace(inner.b.String())
+
+		switch {
+		case href == "":
+			w.b.WriteString(label)
+		case label == "" || label == href:
+			w.b.WriteString("<" + href + ">")
+		default:
+			w.b.WriteString("[" + label + "](" + href + ")")
+		}
+	case "img":
+		w.b.WriteString("![" + enmlAttr(n, "alt") + "](" + enmlAttr(n, "src") + ")")
+	case "en-media":
+		// attachments aren't imported, but where they were is kept
+		w.b.WriteString("_[attachment: " + enmlAttr(n, "type") + "]_")
+		// written as <en-media/>, which HTML doesn't close, so what follows is parsed as inside it
+		w.children(n)
+	case "en-todo":
+		box := "[ ] "
+		if enmlAttr(n, "checked") == "true" {
+			box = "[x] "
+		}
+
+		if w.atLineStart() {
+			box = "- " + box
+		}
+
+		w.b.WriteString(box)
+		w.children(n)
+	case "ul", "ol":
+		if len(w.lists) == 0 {
+			w.block()
+		}
+
+		number := -1
+		if n.Data == "ol" {
+			number = 1
+		}
+
+		w.lists = append(w.lists, number)
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+
+		if len(w.lists) == 0 {
+			w.block()
+		}
+	case "li":
+		w.newline()
+
+		marker := "- "
+
+		// items outside a list are taken as unordered
+		if depth := len(w.lists); depth > 0 {
+			w.b.WriteString(strings.Repeat("  ", depth-1))
+
+			if number := w.lists[depth-1]; number > 0 {
+				marker = strconv.Itoa(number) + ". "
+				w.lists[depth-1]++
+			}
+		}
+
+		w.b.WriteString(marker)
+		w.children(n)
+	case "hr":
+		w.block()
+		w.b.WriteString("---")
+		w.block()
+	case "blockquote":
+		inner := &enmlWriter{}
+		inner.children(n)
+
+		w.block()
+
+		for _, line := range strings.Split(strings.Trim(inner.b.String(), "\n"), "\n") {
+			w.b.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+		}
+
+		w.block()
+	case "table":
+		w.block()
+		w.table(n)
+		w.block()
+	default:
+		// en-note, span, font and others only hold content
+		w.children(n)
+	}
+}
+
+// table writes the rows, with the first as the header
+func (w *enmlWriter) table(n *html.Node) {
+	var rows [][]string
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+
+			if c.Data != "tr" {
+				walk(c)
+
+				continue
+			}
+
+			var cells []string
+
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+					inner := &enmlWriter{}
+					inner.children(cell)
+					cells = append(cells, strings.ReplaceAll(strings.TrimSpace(enmlSpace.ReplaceAllString(inner.b.String(), " ")), "|", `\|`))
+				}
+			}
+
+			rows = append(rows, cells)
+		}
+	}
+
+	walk(n)
+
+	for i, cells := range rows {
+		w.b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+
+		if i == 0 {
+			w.b.WriteString(strings.Repeat("| --- ", len(cells)) + "|\n")
+		}
+	}
+}
+
+func (w *enmlWriter) wrap(n *html.Node, marker string) {
+	inner := &enmlWriter{lists: w.lists}
+	inner.children(n)
+
+	text := inner.b.String()
+	if strings.TrimSpace(text) == "" {
+		w.b.WriteString(text)
+
+		return
+	}
+
+	// markers must touch the text, so spaces go outside them
+	trimmed := strings.TrimSpace(text)
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+
+	w.b.WriteString(lead + marker + trimmed + marker + trail)
+}
+
+func (w *enmlWriter) text(s string) {
+	if w.pre {
+		w.b.WriteString(s)
+
+		return
+	}
+
+	s = enmlSpace.ReplaceAllString(s, " ")
+	if w.atLineStart() {
+		s = strings.TrimLeft(s, " ")
+	}
+
+	w.b.WriteString(s)
+}
+
+func (w *enmlWriter) atLineStart() bool {
+	out := w.b.String()
+
+	return out == "" || strings.HasSuffix(out, "\n")
+}
+
+// newline ends the current line, if it has anything on it
+func (w *enmlWriter) newline() {
+	if !w.atLineStart() {
+		w.b.WriteString("\n")
+	}
+}
+
+// block ends the current paragraph, leaving a blank line after it
+func (w *enmlWriter) block() {
+	out := w.b.String()
+
+	switch {
+	case out == "", strings.HasSuffix(out, "\n\n"):
+	case strings.HasSuffix(out, "\n"):
+		w.b.WriteString("\n")
+	default:
+		w.b.WriteString("\n\n")
+	}
+}
+
+// afterListItem reports whether the last line written is a list item
+func (w *enmlWriter) afterListItem() bool {
+	out := w.b.String()
+	if !strings.HasSuffix(out, "\n") || strings.HasSuffix(out, "\n\n") {
+		return false
+	}
+
+	out = strings.TrimSuffix(out, "\n")
+	line := strings.TrimSpace(out[strings.LastIndex(out, "\n")+1:])
+
+	return strings.HasPrefix(line, "- ") || enmlOrderedItem.MatchString(line)
+}
+
+// startsWithTodo reports whether the first content in the element is a checkbox
+func startsWithTodo(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode && strings.TrimSpace(c.Data) == "":
+			continue
+		case c.Type == html.ElementNode && c.Data == "en-todo":
+			return true
+		}
+
+		return false
+	}
+
+	return false
+}
+
+func enmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+
+	return ""
+}
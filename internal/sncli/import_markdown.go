@@ -0,0 +1,261 @@
+package sncli
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// wikilinks are [[target]], [[target|alias]] or [[target#heading]], and embeds start with !
+	wikilinkPattern = regexp.MustCompile(`!?\[\[([^\[\]|#]*)(?:#[^\[\]|]*)?(?:\|[^\[\]]*)?\]\]`)
+	// markdown links to other notes, such as [text](other%20note.md)
+	markdownLinkPattern = regexp.MustCompile(`\[[^\]]*\]\(([^)\s]+\.md)(?:#[^)]*)?\)`)
+	// inline tags follow a space or start a line, and can be nested with /
+	inlineTagPattern  = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_\-/]+)`)
+	inlineCodePattern = regexp.MustCompile("`[^`\n]*`")
+	digitsPattern     = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// MarkdownImporter implements the Importer interface for a directory of Markdown files, or an
+// Obsidian vault. Tags are read from frontmatter and inline #tags, folders become nested tags,
+// and links to other files become note references.
+type MarkdownImporter struct {
+	dir   string
+	vault bool
+	// folderTags tags each note with its folder, nested as the folders are
+	folderTags bool
+}
+
+// markdownFrontmatter holds the frontmatter fields used, where tags and aliases can be a list or a string
+type markdownFrontmatter struct {
+	Title   string      `yaml:"title"`
+	Tags    interface{} `yaml:"tags"`
+	Tag     interface{} `yaml:"tag"`
+	Aliases interface{} `yaml:"aliases"`
+}
+
+// NewMarkdownImporter creates a new Markdown importer. A vault also has links resolved using frontmatter aliases.
+func NewMarkdownImporter(dir string, vault, folderTags bool) *MarkdownImporter {
+	return &MarkdownImporter{
+		dir:        dir,
+		vault:      vault,
+		folderTags: folderTags,
+	}
+}
+
+// Name returns the importer name.
+func (i *MarkdownImporter) Name() string {
+	if i.vault {
+		return "obsidian"
+	}
+
+	return "markdown"
+}
+
+// Validate checks the directory exists.
+func (i *MarkdownImporter) Validate() error {
+	info, err := os.Stat(i.dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", i.dir)
+	}
+
+	return nil
+}
+
+// Read returns the notes in the directory, in path order, with their paths as sources.
+func (i *MarkdownImporter) Read() ([]ImportedNote, error) {
+	var notes []ImportedNote
+
+	err := filepath.WalkDir(i.dir, func(full string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			// hidden folders include Obsidian's .obsidian and .trash
+			if full != i.dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !strings.EqualFold(filepath.Ext(full), ".md") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(i.dir, full)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(full)
+		if err != nil {
+			return err
+		}
+
+		note, err := i.parse(filepath.ToSlash(rel), string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+
+		notes = append(notes, note)
+
+		return nil
+	})
+
+	sort.Slice(notes, func(x, y int) bool {
+		return notes[x].Source < notes[y].Source
+	})
+
+	return notes, err
+}
+
+// parse reads the note in the file at the path, relative to the directory
+func (i *MarkdownImporter) parse(rel, content string) (ImportedNote, error) {
+	var fm markdownFrontmatter
+
+	header, body := splitFrontmatter(content)
+	if header != "" {
+		if err := yaml.Unmarshal([]byte(header), &fm); err != nil {
+			return ImportedNote{}, fmt.Errorf("invalid frontmatter: %w", err)
+		}
+	}
+
+	note := ImportedNote{
+		Source: rel,
+		Title:  strings.TrimSpace(fm.Title),
+		Text:   body,
+	}
+
+	if note.Title == "" {
+		note.Title = strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	}
+
+	tags := append(frontmatterList(fm.Tags), frontmatterList(fm.Tag)...)
+	tags = append(tags, inlineTags(body)...)
+
+	if dir := path.Dir(rel); i.folderTags && dir != "." {
+		tags = append(tags, dir)
+	}
+
+	for _, tag := range tags {
+		tag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "#"), "/")
+		if tag != "" && !slices.ContainsFunc(note.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			note.Tags = append(note.Tags, tag)
+		}
+	}
+
+	if i.vault {
+		note.Aliases = frontmatterList(fm.Aliases)
+	}
+
+	note.Links = markdownLinks(rel, body)
+
+	return note, nil
+}
+
+// frontmatterList returns the values of a frontmatter field given as a list, or as a string
+// separated by commas or spaces
+func frontmatterList(v interface{}) []string {
+	var values []string
+
+	switch v := v.(type) {
+	case string:
+		values = strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	case []interface{}:
+		for _, value := range v {
+			if value != nil {
+				values = append(values, strings.TrimSpace(fmt.Sprint(value)))
+			}
+		}
+	}
+
+	return slices.DeleteFunc(values, func(value string) bool {
+		return value == ""
+	})
+}
+
+// inlineTags returns the #tags in the text outside code. Tags of only digits aren't tags, as in Obsidian.
+func inlineTags(text string) []string {
+	var tags []string
+
+	for _, line := range withoutCode(text) {
+		for _, match := range inlineTagPattern.FindAllStringSubmatch(line, -1) {
+			tag := strings.Trim(match[1], "/")
+			if tag != "" && !digitsPattern.MatchString(tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
+
+// markdownLinks returns the targets of the wikilinks, by name, and of the Markdown links to other
+// Markdown files, by path relative to the directory
+func markdownLinks(rel, text string) []string {
+	var links []string
+
+	add := func(link string) {
+		if link = strings.TrimSpace(link); link != "" && !slices.Contains(links, link) {
+			links = append(links, link)
+		}
+	}
+
+	for _, line := range withoutCode(text) {
+		for _, match := range wikilinkPattern.FindAllStringSubmatch(line, -1) {
+			if !strings.HasPrefix(match[0], "!") {
+				add(match[1])
+			}
+		}
+
+		for _, match := range markdownLinkPattern.FindAllStringSubmatch(line, -1) {
+			target, err := url.PathUnescape(match[1])
+			if err != nil || strings.Contains(target, "://") {
+				continue
+			}
+
+			add(path.Clean(path.Join(path.Dir(rel), target)))
+		}
+	}
+
+	return links
+}
+
+// withoutCode returns the lines of the text outside fenced code blocks, with inline code removed
+func withoutCode(text string) []string {
+	var lines []string
+
+	fenced := false
+
+	for _, line := range strings.Split(text, "\n") {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+
+			continue
+		}
+
+		if !fenced {
+			lines = append(lines, inlineCodePattern.ReplaceAllString(line, ""))
+		}
+	}
+
+	return lines
+}
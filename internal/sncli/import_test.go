@@ -0,0 +1,119 @@
+package sncli
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// TestImportersGolden compares the notes read by each importer with testdata/import/<name>.golden.json.
+// Run with -update to rewrite them.
+func TestImportersGolden(t *testing.T) {
+	dir := filepath.Join("testdata", "import")
+
+	for _, tc := range []struct {
+		name     string
+		importer Importer
+	}{
+		{"obsidian", NewMarkdownImporter(filepath.Join(dir, "vault"), true, true)},
+		{"markdown", NewMarkdownImporter(filepath.Join(dir, "vault"), false, false)},
+		{"backup", NewBackupImporter(filepath.Join(dir, "backup.txt"))},
+		{"enex", NewENEXImporter(filepath.Join(dir, "Recipes.enex"))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.importer.Validate())
+
+			notes, err := tc.importer.Read()
+			require.NoError(t, err)
+
+			got, err := json.MarshalIndent(notes, "", "  ")
+			require.NoError(t, err)
+
+			golden := filepath.Join(dir, tc.name+".golden.json")
+
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(golden, append(got, '\n'), 0o644))
+			}
+
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(want), string(got))
+		})
+	}
+}
+
+func TestImporterErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	encrypted := filepath.Join(dir, "encrypted.txt")
+	require.NoError(t, os.WriteFile(encrypted, []byte(`{"keyParams": {"version": "004"}, "items": []}`), 0o644))
+
+	_, err := NewBackupImporter(encrypted).Read()
+	require.ErrorContains(t, err, "encrypted")
+
+	require.Error(t, NewBackupImporter(dir).Validate())
+	require.Error(t, NewENEXImporter(filepath.Join(dir, "missing.enex")).Validate())
+	require.Error(t, NewMarkdownImporter(encrypted, false, false).Validate())
+
+	_, err = getImporter(&ImportConfig{Format: "onenote"})
+	require.ErrorContains(t, err, "unsupported import format")
+
+	assert.Equal(t, filepath.Join(dir, ImportStateFile), importStatePath(dir))
+	assert.Equal(t, filepath.Join(dir, ".encrypted.txt"+ImportStateFile), importStatePath(encrypted))
+}
+
+func TestPlanImport(t *testing.T) {
+	lib := testLibrary(t)
+
+	imported := []ImportedNote{
+		{Source: "Launch.md", Title: "Launch", Text: "see [[ideas]]", Tags: []string{"work/projects", "area/ops"}, Links: []string{"ideas", "Missing"}},
+		{Source: "notes/Ideas.md", Title: "Ideas", Tags: []string{"Home"}},
+	}
+
+	p, err := planImport(lib, importState{}, imported)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Launch.md", "notes/Ideas.md"}, p.result.Created)
+	// existing tags are reused, matching nested tags by parent
+	assert.Equal(t, []string{"area", "area/ops"}, p.result.TagsCreated)
+	assert.Equal(t, 1, p.result.Links)
+
+	launch, ideas := p.notes["Launch.md"], p.notes["notes/Ideas.md"]
+	assert.Equal(t, items.ItemReferences{{UUID: ideas.UUID, ContentType: "Note"}}, launch.Content.References())
+
+	lib.Apply(p.changed())
+	assert.Equal(t, []string{"ops", "projects"}, lib.NoteTags(launch.UUID))
+	assert.Equal(t, []string{"Home"}, lib.NoteTags(ideas.UUID))
+
+	var entries []string
+
+	for _, entry := range lib.TagTree() {
+		entries = append(entries, entry.Tag.Content.GetTitle())
+	}
+
+	assert.Equal(t, []string{"area", "ops", "Home", "work", "projects"}, entries)
+
+	// importing again changes only what changed
+	imported[1].Text = "more ideas"
+
+	again, err := planImport(lib, p.state, imported)
+	require.NoError(t, err)
+
+	assert.Empty(t, again.result.Created)
+	assert.Equal(t, []string{"notes/Ideas.md"}, again.result.Updated)
+	assert.Equal(t, 1, again.result.Unchanged)
+	assert.Empty(t, again.result.TagsCreated)
+	assert.Equal(t, ideas.UUID, again.notes["notes/Ideas.md"].UUID)
+
+	changed := again.changed()
+	require.Len(t, changed, 1)
+	assert.Equal(t, "more ideas", changed[0].(*items.Note).Content.GetText())
+}
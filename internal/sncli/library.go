@@ -0,0 +1,441 @@
+package sncli
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// tagParentReferenceType is the reference from a nested tag to its parent
+const tagParentReferenceType = "TagToParentTag"
+
+// Library holds the decrypted notes and tags for interactive use, such as the TUI. Changes are made
+// to copies of notes and tags, which are returned so they can be saved with SyncLibrary.
+type Library struct {
+	Notes []*items.Note
+	Tags  []*items.Tag
+}
+
+// TagTreeEntry is a tag with its depth in the tag hierarchy
+type TagTreeEntry struct {
+	Tag   *items.Tag
+	Depth int
+}
+
+// LoadLibrary reads the notes and tags in the local cache without syncing
+func LoadLibrary(s *cache.Session) (*Library, error) {
+	cachedItems, err := LoadCachedItems(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLibrary(cachedItems), nil
+}
+
+// SyncLibrary saves the changed items to the cache, syncs, and returns the notes and tags in the cache.
+// No progress is shown so it can run in the background.
+func SyncLibrary(s *cache.Session, changed items.Items) (*Library, error) {
+	so, err := sync(cache.SyncInput{Session: s})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(changed) > 0 {
+		if err = cache.SaveItems(s, so.DB, changed, true); err != nil {
+			return nil, err
+		}
+
+		// sync again to push the changes
+		if so, err = sync(cache.SyncInput{Session: s}); err != nil {
+			return nil, err
+		}
+	}
+
+	refreshSearchIndex(s, so.DB)
+
+	var cachedItems cache.Items
+	if err = so.DB.All(&cachedItems); err != nil {
+		_ = so.DB.Close()
+
+		return nil, err
+	}
+
+	if err = so.DB.Close(); err != nil {
+		return nil, err
+	}
+
+	// give the cache back to the daemon, if one is running, rather than hold it between syncs
+	if err = releaseDaemonLease(false); err != nil {
+		return nil, err
+	}
+
+	decrypted, err := cachedItems.ToItems(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLibrary(decrypted), nil
+}
+
+func newLibrary(all items.Items) *Library {
+	lib := &Library{}
+
+	for _, item := range all {
+		if item.IsDeleted() {
+			continue
+		}
+
+		switch item.GetContentType() {
+		case common.SNItemTypeNote:
+			if note, ok := item.(*items.Note); ok {
+				lib.Notes = append(lib.Notes, note)
+			}
+		case common.SNItemTypeTag:
+			if tag, ok := item.(*items.Tag); ok {
+				lib.Tags = append(lib.Tags, tag)
+			}
+		}
+	}
+
+	lib.sort()
+
+	return lib
+}
+
+// sort orders notes pinned first then by most recently updated, and tags by title
+func (lib *Library) sort() {
+	sort.SliceStable(lib.Notes, func(x, y int) bool {
+		px, py := NotePinned(lib.Notes[x]), NotePinned(lib.Notes[y])
+		if px != py {
+			return px
+		}
+
+		return lib.Notes[x].UpdatedAtTimestamp > lib.Notes[y].UpdatedAtTimestamp
+	})
+
+	sort.SliceStable(lib.Tags, func(x, y int) bool {
+		return strings.ToLower(lib.Tags[x].Content.GetTitle()) < strings.ToLower(lib.Tags[y].Content.GetTitle())
+	})
+}
+
+// Apply replaces the notes and tags with the changed copies, adding new ones and dropping deleted ones
+func (lib *Library) Apply(changed items.Items) {
+	byUUID := make(map[string]items.Item, len(changed))
+	for _, item := range changed {
+		byUUID[item.GetUUID()] = item
+	}
+
+	notes := lib.Notes[:0:0]
+
+	for _, note := range lib.Notes {
+		if item, ok := byUUID[note.UUID]; ok {
+			delete(byUUID, note.UUID)
+
+			if item.IsDeleted() {
+				continue
+			}
+
+			note = item.(*items.Note)
+		}
+
+		notes = append(notes, note)
+	}
+
+	tags := lib.Tags[:0:0]
+
+	for _, tag := range lib.Tags {
+		if item, ok := byUUID[tag.UUID]; ok {
+			delete(byUUID, tag.UUID)
+
+			if item.IsDeleted() {
+				continue
+			}
+
+			tag = item.(*items.Tag)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	// the rest are new
+	for _, item := range changed {
+		if _, ok := byUUID[item.GetUUID()]; !ok || item.IsDeleted() {
+			continue
+		}
+
+		switch v := item.(type) {
+		case *items.Note:
+			notes = append(notes, v)
+		case *items.Tag:
+			tags = append(tags, v)
+		}
+	}
+
+	lib.Notes, lib.Tags = notes, tags
+	lib.sort()
+}
+
+// Note returns the note with the UUID
+func (lib *Library) Note(uuid string) *items.Note {
+	for _, note := range lib.Notes {
+		if note.UUID == uuid {
+			return note
+		}
+	}
+
+	return nil
+}
+
+// TagTree returns the tags in hierarchy order, each followed by its children
+func (lib *Library) TagTree() []TagTreeEntry {
+	known := make(map[string]bool, len(lib.Tags))
+	for _, tag := range lib.Tags {
+		known[tag.UUID] = true
+	}
+
+	children := make(map[string][]*items.Tag)
+
+	for _, tag := range lib.Tags {
+		parent := tagParent(tag)
+		if !known[parent] {
+			parent = ""
+		}
+
+		children[parent] = append(children[parent], tag)
+	}
+
+	var tree []TagTreeEntry
+
+	visited := make(map[string]bool)
+
+	var walk func(parent string, depth int)
+	walk = func(parent string, depth int) {
+		for _, tag := range children[parent] {
+			// tags referencing each other as parents would otherwise loop forever
+			if visited[tag.UUID] {
+				continue
+			}
+
+			visited[tag.UUID] = true
+			tree = append(tree, TagTreeEntry{Tag: tag, Depth: depth})
+			walk(tag.UUID, depth+1)
+		}
+	}
+
+	walk("", 0)
+
+	return tree
+}
+
+// NoteTags returns the titles of the tags referencing the note, in title order
+func (lib *Library) NoteTags(uuid string) []string {
+	var titles []string
+
+	for _, tag := range lib.Tags {
+		if tagReferences(tag, uuid) {
+			titles = append(titles, tag.Content.GetTitle())
+		}
+	}
+
+	return titles
+}
+
+// TaggedNotes returns the notes referenced by the tag or any of its descendants
+func (lib *Library) TaggedNotes(tagUUID string) map[string]bool {
+	include := map[string]bool{tagUUID: true}
+
+	// children can appear before their parents, so repeat until no more are found
+	for found := true; found; {
+		found = false
+
+		for _, tag := range lib.Tags {
+			if !include[tag.UUID] && include[tagParent(tag)] {
+				include[tag.UUID] = true
+				found = true
+			}
+		}
+	}
+
+	notes := make(map[string]bool)
+
+	for _, tag := range lib.Tags {
+		if !include[tag.UUID] {
+			continue
+		}
+
+		for _, ref := range tag.Content.References() {
+			if ref.ContentType == common.SNItemTypeNote {
+				notes[ref.UUID] = true
+			}
+		}
+	}
+
+	return notes
+}
+
+// EditNote returns a copy of the note with a new title and text
+func (lib *Library) EditNote(note *items.Note, title, text string) items.Items {
+	edited := *note
+	edited.Content.SetTitle(title)
+	edited.Content.SetText(text)
+	edited.Content.SetUpdateTime(time.Now().UTC())
+
+	return items.Items{&edited}
+}
+
+// PinNote returns a copy of the note, pinned or unpinned
+func (lib *Library) PinNote(note *items.Note, pinned bool) items.Items {
+	edited := *note
+	appData := edited.Content.GetAppData()
+	appData.OrgStandardNotesSN.Pinned = pinned
+	edited.Content.SetAppData(appData)
+	edited.Content.SetUpdateTime(time.Now().UTC())
+
+	return items.Items{&edited}
+}
+
+// TrashNote returns a copy of the note, moved to or restored from the trash
+func (lib *Library) TrashNote(note *items.Note, trashed bool) items.Items {
+	edited := *note
+	edited.Content.SetTrashed(trashed)
+	edited.Content.SetUpdateTime(time.Now().UTC())
+
+	return items.Items{&edited}
+}
+
+// DeleteNote returns a copy of the note marked deleted, as the delete command does
+func (lib *Library) DeleteNote(note *items.Note) items.Items {
+	edited := *note
+	edited.Content.SetText("")
+	edited.SetDeleted(true)
+
+	return items.Items{&edited}
+}
+
+// TagNote returns copies of the tags with the titles, matched case-insensitively, updated to
+// reference the note and any new tags needed. Titles are expected to be trimmed, as CommaSplit does. Tags already referencing the note are left out.
+func (lib *Library) TagNote(note *items.Note, titles []string) (items.Items, error) {
+	if len(titles) == 0 {
+		return nil, errors.New("no tags given")
+	}
+
+	var changed items.Items
+
+	for _, title := range titles {
+
+		var existing *items.Tag
+
+		for _, tag := range lib.Tags {
+			if strings.EqualFold(tag.Content.GetTitle(), title) {
+				existing = tag
+
+				break
+			}
+		}
+
+		ref := items.ItemReference{UUID: note.UUID, ContentType: common.SNItemTypeNote}
+
+		if existing == nil {
+			tag, err := items.NewTag(title, items.ItemReferences{ref})
+			if err != nil {
+				return nil, err
+			}
+
+			changed = append(changed, &tag)
+
+			continue
+		}
+
+		if tagReferences(existing, note.UUID) {
+			continue
+		}
+
+		tag := *existing
+		refs := append(items.ItemReferences{}, tag.Content.References()...)
+		tag.Content.SetReferences(append(refs, ref))
+		tag.Content.SetUpdateTime(time.Now().UTC())
+		changed = append(changed, &tag)
+	}
+
+	return changed, nil
+}
+
+// tag returns the tag with the title, matched case-insensitively
+func (lib *Library) tag(title string) *items.Tag {
+	for _, tag := range lib.Tags {
+		if strings.EqualFold(tag.Content.GetTitle(), title) {
+			return tag
+		}
+	}
+
+	return nil
+}
+
+// tagByUUID returns the tag with the UUID
+func (lib *Library) tagByUUID(uuid string) *items.Tag {
+	for _, tag := range lib.Tags {
+		if tag.UUID == uuid {
+			return tag
+		}
+	}
+
+	return nil
+}
+
+// UntagNote returns copies of the tags referencing the note, other than those with the titles
+// to keep, with the reference to the note removed
+func (lib *Library) UntagNote(note *items.Note, keep []string) items.Items {
+	var changed items.Items
+
+	for _, existing := range lib.Tags {
+		if !tagReferences(existing, note.UUID) || StringInSlice(existing.Content.GetTitle(), keep, true) {
+			continue
+		}
+
+		tag := *existing
+		refs := slices.DeleteFunc(slices.Clone(tag.Content.References()), func(ref items.ItemReference) bool {
+			return ref.UUID == note.UUID && ref.ContentType == common.SNItemTypeNote
+		})
+		tag.Content.SetReferences(refs)
+		tag.Content.SetUpdateTime(time.Now().UTC())
+		changed = append(changed, &tag)
+	}
+
+	return changed
+}
+
+// NotePinned reports whether the note is pinned
+func NotePinned(note *items.Note) bool {
+	return note.Content.GetAppData().OrgStandardNotesSN.Pinned
+}
+
+// NoteTrashed reports whether the note is in the trash
+func NoteTrashed(note *items.Note) bool {
+	return note.Content.Trashed != nil && *note.Content.Trashed
+}
+
+func tagParent(tag *items.Tag) string {
+	for _, ref := range tag.Content.References() {
+		if ref.ContentType == common.SNItemTypeTag && ref.ReferenceType == tagParentReferenceType {
+			return ref.UUID
+		}
+	}
+
+	return tag.Content.GetParentId()
+}
+
+func tagReferences(tag *items.Tag, uuid string) bool {
+	for _, ref := range tag.Content.References() {
+		if ref.UUID == uuid {
+			return true
+		}
+	}
+
+	return false
+}
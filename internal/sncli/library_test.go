@@ -0,0 +1,120 @@
+package sncli
+
+import (
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLibrary(t *testing.T) *Library {
+	t.Helper()
+
+	var all items.Items
+
+	for _, title := range []string{"Standup", "Groceries", "Design doc"} {
+		note, err := items.NewNote(title, title+" text", nil)
+		require.NoError(t, err)
+
+		note.UUID = "note-" + title
+		all = append(all, &note)
+	}
+
+	work, err := items.NewTag("work", items.ItemReferences{{UUID: "note-Standup", ContentType: common.SNItemTypeNote}})
+	require.NoError(t, err)
+
+	work.UUID = "tag-work"
+
+	projects, err := items.NewTag("projects", items.ItemReferences{
+		{UUID: "note-Design doc", ContentType: common.SNItemTypeNote},
+		{UUID: "tag-work", ContentType: common.SNItemTypeTag, ReferenceType: tagParentReferenceType},
+	})
+	require.NoError(t, err)
+
+	projects.UUID = "tag-projects"
+
+	home, err := items.NewTag("Home", nil)
+	require.NoError(t, err)
+
+	home.UUID = "tag-home"
+
+	return newLibrary(append(all, &projects, &work, &home))
+}
+
+func TestLibraryTagTree(t *testing.T) {
+	lib := testLibrary(t)
+
+	var titles []string
+
+	var depths []int
+
+	for _, entry := range lib.TagTree() {
+		titles = append(titles, entry.Tag.Content.GetTitle())
+		depths = append(depths, entry.Depth)
+	}
+
+	assert.Equal(t, []string{"Home", "work", "projects"}, titles)
+	assert.Equal(t, []int{0, 0, 1}, depths)
+
+	// notes tagged with a child tag are included with the parent's
+	assert.Equal(t, map[string]bool{"note-Standup": true, "note-Design doc": true}, lib.TaggedNotes("tag-work"))
+	assert.Equal(t, map[string]bool{"note-Design doc": true}, lib.TaggedNotes("tag-projects"))
+	assert.Equal(t, []string{"work"}, lib.NoteTags("note-Standup"))
+}
+
+func TestLibraryChanges(t *testing.T) {
+	lib := testLibrary(t)
+	groceries := lib.Note("note-Groceries")
+
+	changed := lib.PinNote(groceries, true)
+	require.Len(t, changed, 1)
+	// the library's copy isn't changed until applied
+	assert.False(t, NotePinned(groceries))
+
+	lib.Apply(changed)
+	assert.True(t, NotePinned(lib.Note("note-Groceries")))
+	// pinned notes come first
+	assert.Equal(t, "note-Groceries", lib.Notes[0].UUID)
+
+	lib.Apply(lib.TrashNote(lib.Note("note-Groceries"), true))
+	assert.True(t, NoteTrashed(lib.Note("note-Groceries")))
+
+	lib.Apply(lib.EditNote(lib.Note("note-Standup"), "Standup notes", "new text"))
+	assert.Equal(t, "Standup notes", lib.Note("note-Standup").Content.GetTitle())
+
+	lib.Apply(lib.DeleteNote(lib.Note("note-Standup")))
+	assert.Nil(t, lib.Note("note-Standup"))
+	assert.Len(t, lib.Notes, 2)
+}
+
+func TestLibraryTagNote(t *testing.T) {
+	lib := testLibrary(t)
+	note := lib.Note("note-Groceries")
+
+	changed, err := lib.TagNote(note, []string{"home", "errands"})
+	require.NoError(t, err)
+	require.Len(t, changed, 2)
+
+	// existing tags are matched case-insensitively
+	home := changed[0].(*items.Tag)
+	assert.Equal(t, "tag-home", home.UUID)
+	assert.True(t, tagReferences(home, note.UUID))
+	assert.False(t, tagReferences(lib.Tags[0], note.UUID), "library tag changed before apply")
+
+	errands := changed[1].(*items.Tag)
+	assert.Equal(t, "errands", errands.Content.GetTitle())
+	assert.True(t, tagReferences(errands, note.UUID))
+
+	lib.Apply(changed)
+	assert.Equal(t, []string{"errands", "Home"}, lib.NoteTags(note.UUID))
+
+	// tags already referencing the note aren't changed
+	changed, err = lib.TagNote(note, []string{"Home"})
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	_, err = lib.TagNote(note, nil)
+	require.Error(t, err)
+}
@@ -153,6 +153,7 @@ type TagItemsConfig struct {
 	FindTitle  string
 	FindText   string
 	FindTag    string
+	FindUUIDs  []string
 	NewTags    []string
 	Replace    bool
 	IgnoreCase bool
@@ -183,6 +184,8 @@ type GetTagConfig struct {
 	Session *cache.Session
 	Filters items.ItemFilters
 	Output  string
+	// Offline reads from the local cache without syncing
+	Offline bool
 	Debug   bool
 }
 
@@ -201,7 +204,9 @@ type GetNoteConfig struct {
 	TagUUIDs   []string
 	PageSize   int
 	BatchSize  int
-	Debug      bool
+	// Offline reads from the local cache without syncing
+	Offline bool
+	Debug   bool
 }
 
 type DeleteTagConfig struct {
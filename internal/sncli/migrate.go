@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/jonhadfield/gosn-v2/cache"
@@ -11,6 +14,9 @@ import (
 	"github.com/jonhadfield/gosn-v2/items"
 )
 
+// invalidFilenameChars are the characters not allowed in file names on some systems
+var invalidFilenameChars = regexp.MustCompile(`[<>:"/\\|?*]`)
+
 // MigrateConfig holds configuration for migration operations.
 type MigrateConfig struct {
 	Session      *cache.Session
@@ -22,6 +28,8 @@ type MigrateConfig struct {
 	TagFilter    []string
 	DryRun       bool
 	Debug        bool
+	// LinkStyle is how links between notes are written, as wikilinks if not given
+	LinkStyle LinkStyle
 }
 
 // MigrationResult contains the results of a migration operation.
@@ -33,6 +41,10 @@ type MigrationResult struct {
 	OutputPath    string
 	Warnings      []string
 	Errors        []string
+	// MOCStyle is the style the MOCs were generated with, chosen for the notes with the reason
+	// given when the auto style was asked for
+	MOCStyle       MOCStyle
+	MOCStyleReason string
 }
 
 // MOCStyle represents different MOC organization styles.
@@ -72,6 +84,8 @@ type MOCConfig struct {
 	IncludeStats   bool
 	IncludeRecent  bool
 	RecentCount    int
+	// StyleReason says why the style was chosen, when it was chosen automatically
+	StyleReason string
 }
 
 // LinkStyle defines how links are formatted.
@@ -128,6 +142,12 @@ func (m *MigrateConfig) Validate() error {
 		return fmt.Errorf("invalid MOC style: %s", m.MOCStyle)
 	}
 
+	switch m.LinkStyle {
+	case "", LinkStyleWikilink, LinkStyleMarkdown, LinkStyleRelative:
+	default:
+		return fmt.Errorf("invalid link style: %s", m.LinkStyle)
+	}
+
 	if m.MOCDepth < 1 || m.MOCDepth > 10 {
 		return fmt.Errorf("MOC depth must be between 1 and 10")
 	}
@@ -186,6 +206,14 @@ func (m *MigrateConfig) Run() (*MigrationResult, error) {
 		return nil, fmt.Errorf("converting items: %w", err)
 	}
 
+	// Keep the tags, which the filter drops, so providers can tag the notes
+	var tagItems items.Items
+	for _, item := range allItems {
+		if item.GetContentType() == common.SNItemTypeTag && !item.IsDeleted() {
+			tagItems = append(tagItems, item)
+		}
+	}
+
 	// Filter for notes only
 	filters := items.ItemFilters{
 		MatchAny: false,
@@ -206,13 +234,16 @@ func (m *MigrateConfig) Run() (*MigrationResult, error) {
 
 	// Apply tag filter if specified
 	if len(m.TagFilter) > 0 {
-		allItems = filterByTags(allItems, m.TagFilter)
+		allItems = filterByTags(append(allItems, tagItems...), m.TagFilter)
 	}
 
-	if len(allItems) == 0 {
+	noteCount := len(allItems)
+	if noteCount == 0 {
 		return nil, fmt.Errorf("no notes found to export")
 	}
 
+	allItems = append(allItems, tagItems...)
+
 	// Get provider
 	provider, err := getProvider(m.Provider, m.OutputDir)
 	if err != nil {
@@ -231,11 +262,16 @@ func (m *MigrateConfig) Run() (*MigrationResult, error) {
 		}
 	}
 
+	linkStyle := m.LinkStyle
+	if linkStyle == "" {
+		linkStyle = LinkStyleWikilink
+	}
+
 	// Export notes
 	exportConfig := MigrationExportConfig{
 		OutputDir:    m.OutputDir,
 		PreserveUUID: true,
-		LinkStyle:    LinkStyleWikilink,
+		LinkStyle:    linkStyle,
 		TagStyle:     TagStyleFrontmatter,
 		DryRun:       m.DryRun,
 		Debug:        m.Debug,
@@ -245,7 +281,7 @@ func (m *MigrateConfig) Run() (*MigrationResult, error) {
 		return nil, fmt.Errorf("export failed: %w", err)
 	}
 
-	result.NotesExported = len(allItems)
+	result.NotesExported = noteCount
 
 	// Count unique tags
 	tagSet := make(map[string]bool)
@@ -270,6 +306,12 @@ func (m *MigrateConfig) Run() (*MigrationResult, error) {
 			RecentCount:    5,
 		}
 
+		if mocConfig.Style == MOCStyleAuto {
+			mocConfig.Style, mocConfig.StyleReason = NewMOCBuilder(allItems, mocConfig).ChooseStyle()
+		}
+
+		result.MOCStyle, result.MOCStyleReason = mocConfig.Style, mocConfig.StyleReason
+
 		mocs, err := provider.GenerateMOCs(allItems, mocConfig)
 		if err != nil {
 			result.Warnings = append(result.Warnings, fmt.Sprintf("MOC generation failed: %v", err))
@@ -297,6 +339,12 @@ func getProvider(name string, outputDir string) (Provider, error) {
 	switch name {
 	case "obsidian", "obs":
 		return NewObsidianExporter(outputDir), nil
+	case "logseq":
+		return NewLogseqExporter(outputDir), nil
+	case "joplin":
+		return NewJoplinExporter(outputDir), nil
+	case "zettel", "zettelkasten":
+		return NewZettelExporter(outputDir), nil
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", name)
 	}
@@ -317,13 +365,8 @@ func filterByTags(allItems items.Items, tagFilter []string) items.Items {
 		}
 
 		tags := extractNoteTags(note, allItems)
-		for _, tag := range tags {
-			for _, filterTag := range tagFilter {
-				if tag == filterTag {
-					filtered = append(filtered, item)
-					break
-				}
-			}
+		if slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(tagFilter, tag) }) {
+			filtered = append(filtered, item)
 		}
 	}
 
@@ -340,6 +383,11 @@ func extractNoteTags(note *items.Note, allItems items.Items) []string {
 		if item.GetContentType() == common.SNItemTypeTag {
 			tag := item.(*items.Tag)
 			tagMap[tag.UUID] = tag.Content.GetTitle()
+
+			// tags usually reference their notes, rather than notes their tags
+			if tagReferences(tag, note.UUID) && !slices.Contains(tags, tag.Content.GetTitle()) {
+				tags = append(tags, tag.Content.GetTitle())
+			}
 		}
 	}
 
@@ -347,7 +395,7 @@ func extractNoteTags(note *items.Note, allItems items.Items) []string {
 	refs := note.Content.References()
 	for _, ref := range refs {
 		if ref.ContentType == common.SNItemTypeTag {
-			if tagTitle, exists := tagMap[ref.UUID]; exists {
+			if tagTitle, exists := tagMap[ref.UUID]; exists && !slices.Contains(tags, tagTitle) {
 				tags = append(tags, tagTitle)
 			}
 		}
@@ -355,3 +403,35 @@ func extractNoteTags(note *items.Note, allItems items.Items) []string {
 
 	return tags
 }
+
+// itemTimes returns when the item was created and last updated. Items not yet synced have no
+// update time, so their creation time is used.
+func itemTimes(item items.Item) (time.Time, time.Time) {
+	created := time.UnixMicro(item.GetCreatedAtTimestamp()).UTC()
+	if item.GetCreatedAtTimestamp() == 0 {
+		created = time.Now().UTC()
+	}
+
+	updated := created
+	if item.GetUpdatedAtTimestamp() > 0 {
+		updated = time.UnixMicro(item.GetUpdatedAtTimestamp()).UTC()
+	}
+
+	return created, updated
+}
+
+// rewriteWikilinks replaces the target of each [[wikilink]] in the content with the link returned
+// for it, leaving links it returns nothing for unchanged
+func rewriteWikilinks(content string, link func(target string) string) string {
+	return wikilinkPattern.ReplaceAllStringFunc(content, func(match string) string {
+		if strings.HasPrefix(match, "!") {
+			return match
+		}
+
+		if replaced := link(wikilinkPattern.FindStringSubmatch(match)[1]); replaced != "" {
+			return replaced
+		}
+
+		return match
+	})
+}
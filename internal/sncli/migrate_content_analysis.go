@@ -74,18 +74,23 @@ func (ca *ContentAnalyzer) extractNoteTexts() map[string]string {
 			continue
 		}
 
-		// Combine title and text with extra weight on title
-		title := note.Content.GetTitle()
-		text := note.Content.GetText()
-
-		// Title words appear 3x for emphasis
-		combined := title + " " + title + " " + title + " " + text
-		texts[note.UUID] = strings.ToLower(combined)
+		texts[note.UUID] = noteAnalysisText(note)
 	}
 
 	return texts
 }
 
+// noteAnalysisText combines a note's title and text with extra weight on the title.
+func noteAnalysisText(note *items.Note) string {
+	title := note.Content.GetTitle()
+	text := note.Content.GetText()
+
+	// Title words appear 3x for emphasis
+	combined := title + " " + title + " " + title + " " + text
+
+	return strings.ToLower(combined)
+}
+
 // calculateKeywordDF calculates document frequency for keywords.
 func (ca *ContentAnalyzer) calculateKeywordDF(noteTexts map[string]string) map[string]int {
 	df := make(map[string]int)
@@ -147,24 +152,13 @@ func (ca *ContentAnalyzer) calculateTFIDF(noteTexts map[string]string, df map[st
 	numDocs := float64(len(noteTexts))
 
 	for uuid, text := range noteTexts {
-		words := ca.extractWords(text)
-		tf := make(map[string]int)
-
-		// Calculate term frequency
-		for _, word := range words {
-			if !ca.stopWords[word] && len(word) > 2 {
-				tf[word]++
-			}
-		}
-
 		// Calculate TF-IDF
 		scores[uuid] = make(map[string]float64)
-		for word, freq := range tf {
+		for word, termFreq := range ca.termFrequencies(text) {
 			if df[word] < ca.minKeywordFreq {
 				continue
 			}
 
-			termFreq := float64(freq) / float64(len(words))
 			inverseDocFreq := math.Log(numDocs / float64(df[word]))
 			scores[uuid][word] = termFreq * inverseDocFreq
 		}
@@ -173,6 +167,24 @@ func (ca *ContentAnalyzer) calculateTFIDF(noteTexts map[string]string, df map[st
 	return scores
 }
 
+// termFrequencies calculates the frequency of each keyword relative to the length of the text.
+func (ca *ContentAnalyzer) termFrequencies(text string) map[string]float64 {
+	words := ca.extractWords(text)
+	tf := make(map[string]float64)
+
+	for _, word := range words {
+		if !ca.stopWords[word] && len(word) > 2 {
+			tf[word]++
+		}
+	}
+
+	for word := range tf {
+		tf[word] /= float64(len(words))
+	}
+
+	return tf
+}
+
 // calculatePhraseTFIDF calculates TF-IDF scores for phrases.
 func (ca *ContentAnalyzer) calculatePhraseTFIDF(noteTexts map[string]string, df map[string]int) map[string]map[string]float64 {
 	scores := make(map[string]map[string]float64)
@@ -341,7 +353,7 @@ func (ca *ContentAnalyzer) getTopTerms(scores map[string]float64, n int) []strin
 func (ca *ContentAnalyzer) extractWords(text string) []string {
 	// Remove markdown syntax
 	text = regexp.MustCompile(`\[([^\]]+)\]\([^\)]+\)`).ReplaceAllString(text, "$1")
-	text = regexp.MustCompile("[ *_~`]").ReplaceAllString(text, "")
+	text = regexp.MustCompile("[*_~`]").ReplaceAllString(text, "")
 
 	// Split on non-letter characters
 	words := strings.FieldsFunc(text, func(r rune) bool {
@@ -0,0 +1,264 @@
+package sncli
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// Joplin item types, given as type_ in each item's metadata
+const (
+	joplinTypeNote    = 1
+	joplinTypeFolder  = 2
+	joplinTypeTag     = 5
+	joplinTypeNoteTag = 6
+)
+
+// joplinNotebook is the notebook the notes are exported to
+const joplinNotebook = "Standard Notes"
+
+// joplinTimeLayout is how Joplin writes times in its metadata
+const joplinTimeLayout = "2006-01-02T15:04:05.000Z"
+
+// joplinSource is the application recorded as the source of the notes
+const joplinSource = "sn-cli"
+
+// JoplinExporter implements the Provider interface for Joplin. Notes are written as a RAW export,
+// imported with File > Import > RAW - Joplin Export Directory, into a notebook with their tags.
+type JoplinExporter struct {
+	outputDir string
+	folderID  string
+	ids       map[string]string // lower-case note title to Joplin ID, for links in MOCs
+}
+
+// joplinProperty is a metadata field, kept in the order Joplin writes them
+type joplinProperty struct {
+	key   string
+	value string
+}
+
+// NewJoplinExporter creates a new Joplin exporter.
+func NewJoplinExporter(outputDir string) *JoplinExporter {
+	return &JoplinExporter{
+		outputDir: outputDir,
+		folderID:  joplinDerivedID("folder", joplinNotebook),
+		ids:       make(map[string]string),
+	}
+}
+
+// Name returns the provider name.
+func (j *JoplinExporter) Name() string {
+	return "joplin"
+}
+
+// Validate checks if the exporter configuration is valid.
+func (j *JoplinExporter) Validate() error {
+	if j.outputDir == "" {
+		return fmt.Errorf("output directory is required")
+	}
+
+	return nil
+}
+
+// Export exports notes to a Joplin RAW export directory, with an item for the notebook, each note,
+// each tag and each note's tagging.
+func (j *JoplinExporter) Export(notes items.Items, config MigrationExportConfig) error {
+	if !config.DryRun {
+		// Joplin reads attachments from resources, which is empty as there are none
+		if err := os.MkdirAll(filepath.Join(config.OutputDir, "resources"), 0755); err != nil {
+			return fmt.Errorf("failed to create resources directory: %w", err)
+		}
+	}
+
+	now := time.Now().UTC()
+
+	folder := append([]joplinProperty{{"id", j.folderID}, {"parent_id", ""}}, joplinTimes(now, joplinTypeFolder)...)
+	if err := j.write(config, j.folderID, joplinSerialize(joplinNotebook, "", folder)); err != nil {
+		return fmt.Errorf("failed to write notebook: %w", err)
+	}
+
+	// tags are flat in Joplin, so tags with the same title become one
+	tagIDs := make(map[string]string)
+
+	for _, item := range notes {
+		note, ok := item.(*items.Note)
+		if !ok {
+			continue
+		}
+
+		id := joplinID(note.UUID)
+		if _, taken := j.ids[strings.ToLower(note.Content.GetTitle())]; !taken {
+			j.ids[strings.ToLower(note.Content.GetTitle())] = id
+		}
+
+		// the first line is always read as the title
+		title := note.Content.GetTitle()
+		if strings.TrimSpace(title) == "" {
+			title = "untitled"
+		}
+
+		created, updated := itemTimes(note)
+
+		// the source URL is the only free text field Joplin shows, so it keeps where the note came from
+		source := ""
+		if config.PreserveUUID {
+			source = "standardnotes:" + note.UUID
+		}
+
+		if err := j.write(config, id, joplinSerialize(title, note.Content.GetText(), j.noteProperties(id, source, created, updated))); err != nil {
+			return fmt.Errorf("failed to write note %s: %w", note.Content.GetTitle(), err)
+		}
+
+		for _, title := range extractNoteTags(note, notes) {
+			tagID, exists := tagIDs[strings.ToLower(title)]
+			if !exists {
+				tagID = joplinDerivedID("tag", strings.ToLower(title))
+				tagIDs[strings.ToLower(title)] = tagID
+
+				tag := append([]joplinProperty{{"id", tagID}, {"parent_id", ""}}, joplinTimes(now, joplinTypeTag)...)
+				if err := j.write(config, tagID, joplinSerialize(title, "", tag)); err != nil {
+					return fmt.Errorf("failed to write tag %s: %w", title, err)
+				}
+			}
+
+			noteTagID := joplinDerivedID("note_tag", id, tagID)
+			noteTag := append([]joplinProperty{{"id", noteTagID}, {"note_id", id}, {"tag_id", tagID}}, joplinTimes(now, joplinTypeNoteTag)...)
+
+			if err := j.write(config, noteTagID, joplinSerialize("", "", noteTag)); err != nil {
+				return fmt.Errorf("failed to tag note %s: %w", note.Content.GetTitle(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GenerateMOCs generates Maps of Content as notes in the notebook, with links to the notes they list.
+func (j *JoplinExporter) GenerateMOCs(notes items.Items, config MOCConfig) ([]MOCFile, error) {
+	mocs, err := NewMOCBuilder(notes, config).Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	// MOCs link to each other as well as to notes
+	mocIDs := make([]string, len(mocs))
+	for i, moc := range mocs {
+		mocIDs[i] = joplinDerivedID("moc", moc.Filename)
+		j.ids[strings.ToLower(moc.Title)] = mocIDs[i]
+	}
+
+	now := time.Now().UTC()
+
+	for i, moc := range mocs {
+		_, body := splitFrontmatter(moc.Content)
+
+		// Joplin doesn't have wikilinks, so they become links to the notes by ID
+		body = rewriteWikilinks(body, func(target string) string {
+			if id, ok := j.ids[strings.ToLower(target)]; ok {
+				return fmt.Sprintf("[%s](:/%s)", target, id)
+			}
+
+			return target
+		})
+
+		mocs[i].Filename = mocIDs[i] + ".md"
+		mocs[i].Content = joplinSerialize(moc.Title, strings.TrimSpace(body), j.noteProperties(mocIDs[i], "", now, now))
+	}
+
+	return mocs, nil
+}
+
+func (j *JoplinExporter) write(config MigrationExportConfig, id, content string) error {
+	if config.DryRun {
+		return nil
+	}
+
+	return os.WriteFile(filepath.Join(config.OutputDir, id+".md"), []byte(content), 0644)
+}
+
+// noteProperties returns the metadata of a Markdown note in the notebook
+func (j *JoplinExporter) noteProperties(id, sourceURL string, created, updated time.Time) []joplinProperty {
+	return []joplinProperty{
+		{"id", id},
+		{"parent_id", j.folderID},
+		{"created_time", created.Format(joplinTimeLayout)},
+		{"updated_time", updated.Format(joplinTimeLayout)},
+		{"is_conflict", "0"},
+		{"author", ""},
+		{"source_url", sourceURL},
+		{"is_todo", "0"},
+		{"todo_due", "0"},
+		{"todo_completed", "0"},
+		{"source", joplinSource},
+		{"source_application", joplinSource},
+		{"application_data", ""},
+		{"order", "0"},
+		{"user_created_time", created.Format(joplinTimeLayout)},
+		{"user_updated_time", updated.Format(joplinTimeLayout)},
+		{"encryption_cipher_text", ""},
+		{"encryption_applied", "0"},
+		{"markup_language", "1"},
+		{"is_shared", "0"},
+		{"type_", fmt.Sprint(joplinTypeNote)},
+	}
+}
+
+// joplinTimes returns the metadata after the IDs of notebooks, tags and note tags, made at the time
+func joplinTimes(at time.Time, itemType int) []joplinProperty {
+	return []joplinProperty{
+		{"created_time", at.Format(joplinTimeLayout)},
+		{"updated_time", at.Format(joplinTimeLayout)},
+		{"user_created_time", at.Format(joplinTimeLayout)},
+		{"user_updated_time", at.Format(joplinTimeLayout)},
+		{"encryption_cipher_text", ""},
+		{"encryption_applied", "0"},
+		{"is_shared", "0"},
+		{"type_", fmt.Sprint(itemType)},
+	}
+}
+
+// joplinSerialize returns an item as Joplin writes it: the title, the body and the metadata,
+// separated by blank lines, leaving out those without one
+func joplinSerialize(title, body string, props []joplinProperty) string {
+	var parts []string
+
+	if title != "" {
+		parts = append(parts, strings.Join(strings.Fields(title), " "))
+	}
+
+	if body != "" {
+		parts = append(parts, body)
+	}
+
+	lines := make([]string, len(props))
+
+	for i, prop := range props {
+		value := strings.ReplaceAll(prop.value, "\r", `\r`)
+		lines[i] = prop.key + ": " + strings.ReplaceAll(value, "\n", `\n`)
+	}
+
+	return strings.Join(append(parts, strings.Join(lines, "\n")), "\n\n")
+}
+
+// joplinID returns the Joplin ID for a Standard Notes UUID, which is the UUID without dashes
+func joplinID(uuid string) string {
+	id := strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+	if len(id) != 32 || strings.Trim(id, "0123456789abcdef") != "" {
+		return joplinDerivedID(uuid)
+	}
+
+	return id
+}
+
+// joplinDerivedID returns an ID for an item with no UUID, the same each time for the same parts
+func joplinDerivedID(parts ...string) string {
+	sum := md5.Sum([]byte(strings.Join(parts, "\x00")))
+
+	return hex.EncodeToString(sum[:])
+}
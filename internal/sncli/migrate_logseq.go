@@ -0,0 +1,399 @@
+package sncli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+var (
+	logseqListItem = regexp.MustCompile(`^([ \t]*)([-*+]|[0-9]+[.)])[ \t]+(.*)$`)
+	logseqOrdinal  = regexp.MustCompile(`([0-9])(st|nd|rd|th)\b`)
+	logseqFence    = regexp.MustCompile("^[ \t]*(```|~~~)")
+	// the layouts of note titles that are taken as dates, for journals
+	logseqDateLayouts = []string{
+		"2006-01-02", "2006_01_02", "2006/01/02", "2006.01.02",
+		"January 2, 2006", "Jan 2, 2006", "Monday, January 2, 2006", "2 January 2006", "2 Jan 2006",
+	}
+)
+
+// logseqJournalTitle is the layout of journal page names in a new Logseq graph, without the ordinal
+const logseqJournalTitle = "Jan 2, 2006"
+
+// LogseqExporter implements the Provider interface for Logseq. Notes become outliner pages in
+// pages/ with their tags as properties, and notes titled with a date become journals.
+type LogseqExporter struct {
+	outputDir string
+	pages     map[string]bool // lower-case page names used
+}
+
+// logseqJournal collects the notes titled with the same date
+type logseqJournal struct {
+	tags   []string
+	blocks []string
+}
+
+// NewLogseqExporter creates a new Logseq exporter.
+func NewLogseqExporter(outputDir string) *LogseqExporter {
+	return &LogseqExporter{
+		outputDir: outputDir,
+		pages:     make(map[string]bool),
+	}
+}
+
+// Name returns the provider name.
+func (l *LogseqExporter) Name() string {
+	return "logseq"
+}
+
+// Validate checks if the exporter configuration is valid.
+func (l *LogseqExporter) Validate() error {
+	if l.outputDir == "" {
+		return fmt.Errorf("output directory is required")
+	}
+
+	return nil
+}
+
+// Export exports notes to a Logseq graph.
+func (l *LogseqExporter) Export(notes items.Items, config MigrationExportConfig) error {
+	if !config.DryRun {
+		for _, dir := range []string{"pages", "journals"} {
+			if err := os.MkdirAll(filepath.Join(config.OutputDir, dir), 0755); err != nil {
+				return fmt.Errorf("failed to create %s directory: %w", dir, err)
+			}
+		}
+	}
+
+	journals := make(map[string]*logseqJournal)
+
+	for _, item := range notes {
+		note, ok := item.(*items.Note)
+		if !ok {
+			continue
+		}
+
+		tags := extractNoteTags(note, notes)
+
+		blocks := logseqBlocks(note.Content.GetText())
+		if config.TagStyle == TagStyleInline || config.TagStyle == TagStyleBoth {
+			blocks += logseqInlineTags(tags)
+		}
+
+		// journals are one file a day, so notes for the same day are combined
+		if day, ok := logseqJournalDate(note.Content.GetTitle()); ok {
+			key := day.Format("2006_01_02")
+			if journals[key] == nil {
+				journals[key] = &logseqJournal{}
+			}
+
+			journals[key].tags = appendMissing(journals[key].tags, tags...)
+			journals[key].blocks = append(journals[key].blocks, blocks)
+
+			continue
+		}
+
+		name := l.uniquePageName(note.Content.GetTitle())
+
+		var props []string
+		if len(tags) > 0 && (config.TagStyle == TagStyleFrontmatter || config.TagStyle == TagStyleBoth) {
+			props = append(props, "tags:: "+logseqPropertyList(tags))
+		}
+
+		if config.PreserveUUID {
+			props = append(props, "uuid:: "+note.UUID)
+		}
+
+		if err := l.write(config, filepath.Join("pages", logseqFilename(name)+".md"), logseqPage(name, props, blocks)); err != nil {
+			return fmt.Errorf("failed to write note %s: %w", name, err)
+		}
+	}
+
+	days := make([]string, 0, len(journals))
+	for day := range journals {
+		days = append(days, day)
+	}
+
+	sort.Strings(days)
+
+	for _, day := range days {
+		journal := journals[day]
+
+		var props []string
+		if len(journal.tags) > 0 && (config.TagStyle == TagStyleFrontmatter || config.TagStyle == TagStyleBoth) {
+			props = append(props, "tags:: "+logseqPropertyList(journal.tags))
+		}
+
+		if err := l.write(config, filepath.Join("journals", day+".md"), logseqPage("", props, strings.Join(journal.blocks, ""))); err != nil {
+			return fmt.Errorf("failed to write journal %s: %w", day, err)
+		}
+	}
+
+	return nil
+}
+
+// GenerateMOCs generates Maps of Content as Logseq pages, linking journals by their page names.
+func (l *LogseqExporter) GenerateMOCs(notes items.Items, config MOCConfig) ([]MOCFile, error) {
+	mocs, err := NewMOCBuilder(notes, config).Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, moc := range mocs {
+		_, body := splitFrontmatter(moc.Content)
+
+		body = rewriteWikilinks(body, func(target string) string {
+			if day, ok := logseqJournalDate(target); ok {
+				return "[[" + logseqJournalPageName(day) + "]]"
+			}
+
+			return ""
+		})
+
+		mocs[i].Filename = filepath.Join("pages", logseqFilename(moc.Title)+".md")
+		mocs[i].Content = logseqPage(moc.Title, []string{"tags:: " + logseqPropertyList(moc.Tags)}, logseqBlocks(body))
+	}
+
+	return mocs, nil
+}
+
+func (l *LogseqExporter) write(config MigrationExportConfig, name, content string) error {
+	if config.DryRun {
+		return nil
+	}
+
+	return os.WriteFile(filepath.Join(config.OutputDir, name), []byte(content), 0644)
+}
+
+// uniquePageName returns the title, numbered if a page already has it, as Logseq matches page
+// names regardless of case
+func (l *LogseqExporter) uniquePageName(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		title = "untitled"
+	}
+
+	name := title
+	for counter := 2; l.pages[strings.ToLower(name)]; counter++ {
+		name = fmt.Sprintf("%s (%d)", title, counter)
+	}
+
+	l.pages[strings.ToLower(name)] = true
+
+	return name
+}
+
+// logseqPage returns the page with the title and other properties first, then its blocks
+func logseqPage(title string, props []string, blocks string) string {
+	var sb strings.Builder
+
+	if title != "" {
+		sb.WriteString("title:: " + title + "\n")
+	}
+
+	for _, prop := range props {
+		sb.WriteString(prop + "\n")
+	}
+
+	if sb.Len() > 0 && blocks != "" {
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(blocks)
+
+	return sb.String()
+}
+
+// logseqBlocks converts Markdown to outliner blocks. Paragraphs and headings become blocks, list
+// items become blocks nested as they were, and fenced code stays whole within a block.
+func logseqBlocks(text string) string {
+	var sb strings.Builder
+
+	var (
+		// continuation is the indent of lines continuing the current block, or empty between blocks
+		continuation string
+		fence        string
+		// levels holds the indent widths of the open list items
+		levels []int
+	)
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			sb.WriteString(continuation + line + "\n")
+
+			// the block ends with the code, so what follows starts another
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+				continuation = ""
+			}
+
+			continue
+		}
+
+		if match := logseqFence.FindStringSubmatch(line); match != nil {
+			fence = match[1]
+
+			if continuation == "" {
+				sb.WriteString("- " + trimmed + "\n")
+				continuation = "  "
+			} else {
+				sb.WriteString(continuation + trimmed + "\n")
+			}
+
+			continue
+		}
+
+		if trimmed == "" {
+			continuation = ""
+
+			continue
+		}
+
+		if match := logseqListItem.FindStringSubmatch(line); match != nil && !strings.HasPrefix(trimmed, "---") {
+			width := len(strings.ReplaceAll(match[1], "\t", "    "))
+
+			for len(levels) > 0 && levels[len(levels)-1] > width {
+				levels = levels[:len(levels)-1]
+			}
+
+			if len(levels) == 0 || levels[len(levels)-1] < width {
+				levels = append(levels, width)
+			}
+
+			indent := strings.Repeat("\t", len(levels)-1)
+
+			content := match[3]
+			if match[2] != "-" && match[2] != "*" && match[2] != "+" {
+				content = match[2] + " " + content
+			}
+
+			sb.WriteString(indent + "- " + logseqTask(content) + "\n")
+			continuation = indent + "  "
+
+			continue
+		}
+
+		levels = nil
+
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			// headings are blocks of their own
+			sb.WriteString("- " + trimmed + "\n")
+			continuation = ""
+		case continuation != "":
+			sb.WriteString(continuation + trimmed + "\n")
+		default:
+			sb.WriteString("- " + trimmed + "\n")
+			continuation = "  "
+		}
+	}
+
+	return sb.String()
+}
+
+// logseqTask converts a Markdown checkbox to a Logseq task marker
+func logseqTask(content string) string {
+	switch {
+	case strings.HasPrefix(content, "[ ] "):
+		return "TODO " + content[4:]
+	case strings.HasPrefix(content, "[x] "), strings.HasPrefix(content, "[X] "):
+		return "DONE " + content[4:]
+	}
+
+	return content
+}
+
+// logseqPropertyList returns the values for a property, with those containing commas as page references
+func logseqPropertyList(values []string) string {
+	list := make([]string, len(values))
+
+	for i, value := range values {
+		if strings.Contains(value, ",") {
+			value = "[[" + value + "]]"
+		}
+
+		list[i] = value
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// logseqInlineTags returns a block of the tags
+func logseqInlineTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	refs := make([]string, len(tags))
+
+	for i, tag := range tags {
+		refs[i] = "#" + tag
+		if strings.ContainsAny(tag, " ,#") {
+			refs[i] = "#[[" + tag + "]]"
+		}
+	}
+
+	return "- " + strings.Join(refs, " ") + "\n"
+}
+
+// logseqJournalDate returns the date a note's title is, if it is one
+func logseqJournalDate(title string) (time.Time, bool) {
+	title = logseqOrdinal.ReplaceAllString(strings.TrimSpace(title), "$1")
+
+	for _, layout := range logseqDateLayouts {
+		if day, err := time.Parse(layout, title); err == nil {
+			return day, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// logseqJournalPageName returns the name Logseq gives the journal for the day, such as Jan 5th, 2026
+func logseqJournalPageName(day time.Time) string {
+	suffix := "th"
+
+	switch d := day.Day(); {
+	case d == 1 || d == 21 || d == 31:
+		suffix = "st"
+	case d == 2 || d == 22:
+		suffix = "nd"
+	case d == 3 || d == 23:
+		suffix = "rd"
+	}
+
+	name := day.Format(logseqJournalTitle)
+
+	return strings.Replace(name, ",", suffix+",", 1)
+}
+
+// logseqFilename returns the file name for a page, with namespaces separated by ___ as Logseq does
+func logseqFilename(name string) string {
+	name = strings.ReplaceAll(name, "/", "___")
+	name = invalidFilenameChars.ReplaceAllString(name, "-")
+
+	if len(name) > 200 {
+		name = name[:200]
+	}
+
+	return name
+}
+
+// appendMissing appends the values not already in the slice
+func appendMissing(slice []string, values ...string) []string {
+	for _, value := range values {
+		if !StringInSlice(value, slice, true) {
+			slice = append(slice, value)
+		}
+	}
+
+	return slice
+}
@@ -2,8 +2,10 @@ package sncli
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/jonhadfield/gosn-v2/common"
@@ -15,16 +17,68 @@ type MOCBuilder struct {
 	notes     items.Items
 	tags      map[string]items.Items // tag name to notes
 	tagCounts map[string]int
+	tagNodes  map[string]*mocTagNode // tag UUID to its place in the tag tree
+	noteTags  map[string][]string    // note UUID to tag UUIDs
 	config    MOCConfig
+	now       time.Time
 }
 
+// mocTagNode is a tag with its parent and children among the tags, and the notes tagged with it
+type mocTagNode struct {
+	tag      *items.Tag
+	parent   string
+	children []string
+	notes    []*items.Note
+}
+
+// PARA categories, in the order they are listed
+const (
+	paraProjects  = "Projects"
+	paraAreas     = "Areas"
+	paraResources = "Resources"
+	paraArchives  = "Archives"
+)
+
+var (
+	paraCategories = []string{paraProjects, paraAreas, paraResources, paraArchives}
+	// paraTagNames are the tag titles, in lower case, taken as a PARA category
+	paraTagNames = map[string]string{
+		"project": paraProjects, "projects": paraProjects,
+		"area": paraAreas, "areas": paraAreas,
+		"resource": paraResources, "resources": paraResources, "reference": paraResources,
+		"archive": paraArchives, "archives": paraArchives, "archived": paraArchives,
+	}
+	paraDescriptions = map[string]string{
+		paraProjects:  "Active work with a goal and an end",
+		paraAreas:     "Ongoing responsibilities to maintain",
+		paraResources: "Topics and reference material of interest",
+		paraArchives:  "Inactive items from the other categories",
+	}
+	paraIcons = map[string]string{
+		paraProjects:  "🚀",
+		paraAreas:     "🧭",
+		paraResources: "📚",
+		paraArchives:  "🗄️",
+	}
+)
+
+const (
+	// paraActiveDays is how recently a note with open tasks was updated to be taken as a project
+	paraActiveDays = 30
+	// paraStaleDays is how long since a note without a PARA tag was updated for it to be archived
+	paraStaleDays = 365
+)
+
 // NewMOCBuilder creates a new MOC builder.
 func NewMOCBuilder(notes items.Items, config MOCConfig) *MOCBuilder {
 	mb := &MOCBuilder{
 		notes:     notes,
 		tags:      make(map[string]items.Items),
 		tagCounts: make(map[string]int),
+		tagNodes:  make(map[string]*mocTagNode),
+		noteTags:  make(map[string][]string),
 		config:    config,
+		now:       time.Now().UTC(),
 	}
 
 	mb.buildTagIndex()
@@ -32,35 +86,68 @@ func NewMOCBuilder(notes items.Items, config MOCConfig) *MOCBuilder {
 	return mb
 }
 
-// buildTagIndex groups notes by their tags.
+// buildTagIndex groups notes by their tags, and builds the tag tree from the tags' parents.
 func (mb *MOCBuilder) buildTagIndex() {
-	// Build tag map from all items
-	tagMap := make(map[string]string) // UUID to title
+	notes := make(map[string]*items.Note)
+
 	for _, item := range mb.notes {
-		if item.GetContentType() == common.SNItemTypeTag {
-			tag := item.(*items.Tag)
-			tagMap[tag.UUID] = tag.Content.GetTitle()
+		switch v := item.(type) {
+		case *items.Note:
+			notes[v.UUID] = v
+		case *items.Tag:
+			mb.tagNodes[v.UUID] = &mocTagNode{tag: v}
 		}
 	}
 
-	// Group notes by tag
-	for _, item := range mb.notes {
-		if item.GetContentType() != common.SNItemTypeNote {
-			continue
+	tagged := func(tagUUID string, note *items.Note) {
+		node := mb.tagNodes[tagUUID]
+		if node == nil || slices.Contains(mb.noteTags[note.UUID], tagUUID) {
+			return
 		}
 
-		note := item.(*items.Note)
-		refs := note.Content.References()
+		// tags with the same title in different places share a name
+		title := node.tag.Content.GetTitle()
+		if !slices.ContainsFunc(mb.noteTags[note.UUID], func(uuid string) bool {
+			return mb.tagNodes[uuid].tag.Content.GetTitle() == title
+		}) {
+			mb.tags[title] = append(mb.tags[title], note)
+			mb.tagCounts[title]++
+		}
 
-		for _, ref := range refs {
-			if ref.ContentType == common.SNItemTypeTag {
-				if tagTitle, exists := tagMap[ref.UUID]; exists {
-					mb.tags[tagTitle] = append(mb.tags[tagTitle], item)
-					mb.tagCounts[tagTitle]++
+		node.notes = append(node.notes, note)
+		mb.noteTags[note.UUID] = append(mb.noteTags[note.UUID], tagUUID)
+	}
+
+	// tags usually reference their notes, and notes can reference their tags
+	for _, item := range mb.notes {
+		switch v := item.(type) {
+		case *items.Tag:
+			for _, ref := range v.Content.References() {
+				if note := notes[ref.UUID]; note != nil {
+					tagged(v.UUID, note)
+				}
+			}
+		case *items.Note:
+			for _, ref := range v.Content.References() {
+				if ref.ContentType == common.SNItemTypeTag {
+					tagged(ref.UUID, v)
 				}
 			}
 		}
 	}
+
+	for uuid, node := range mb.tagNodes {
+		if parent := mb.tagNodes[tagParent(node.tag)]; parent != nil && parent != node {
+			node.parent = tagParent(node.tag)
+			parent.children = append(parent.children, uuid)
+		}
+	}
+
+	for _, node := range mb.tagNodes {
+		sort.Slice(node.children, func(i, j int) bool {
+			return mb.tagNodes[node.children[i]].tag.Content.GetTitle() < mb.tagNodes[node.children[j]].tag.Content.GetTitle()
+		})
+	}
 }
 
 // Generate generates MOC files based on the configured style.
@@ -74,6 +161,10 @@ func (mb *MOCBuilder) Generate() ([]MOCFile, error) {
 		return mb.generatePARAMOCs()
 	case MOCStyleTopicBased:
 		return mb.generateTopicMOCs()
+	case MOCStyleAuto:
+		mb.config.Style, mb.config.StyleReason = mb.ChooseStyle()
+
+		return mb.Generate()
 	default:
 		return mb.generateFlatMOCs()
 	}
@@ -109,34 +200,566 @@ func (mb *MOCBuilder) generateFlatMOCs() ([]MOCFile, error) {
 	return mocs, nil
 }
 
-// generateHierarchicalMOCs generates a hierarchical MOC structure.
+// generateHierarchicalMOCs generates a MOC for each tag down to the maximum depth, following the
+// tags' parents. Notes tagged below that depth, or with tags with too few notes for a MOC, are
+// listed in the MOC of the closest tag above that has one.
 func (mb *MOCBuilder) generateHierarchicalMOCs() ([]MOCFile, error) {
-	// For now, use flat MOCs - can be enhanced later
-	return mb.generateFlatMOCs()
+	maxDepth := max(mb.config.MaxDepth, 1)
+
+	hasMOC := func(uuid string, depth int) bool {
+		return depth < maxDepth && len(mb.subtreeNotes(uuid)) >= max(mb.config.MinNotesPerMOC, 1)
+	}
+
+	var (
+		mocs []MOCFile
+		home strings.Builder
+	)
+
+	var walk func(uuid, up string, path []string, depth int)
+	walk = func(uuid, up string, path []string, depth int) {
+		node := mb.tagNodes[uuid]
+		path = append(slices.Clone(path), node.tag.Content.GetTitle())
+		title := mocTitle(path)
+		icon := mb.getIconForTag(node.tag.Content.GetTitle())
+
+		home.WriteString(fmt.Sprintf("%s- %s [[%s]] (%d notes)\n", strings.Repeat("  ", depth), icon, title, len(mb.subtreeNotes(uuid))))
+
+		var sb strings.Builder
+
+		sb.WriteString(fmt.Sprintf("⬆️ [[%s]]\n\n", up))
+
+		var subtopics, folded []string
+
+		for _, child := range node.children {
+			switch {
+			case hasMOC(child, depth+1):
+				subtopics = append(subtopics, child)
+			case len(mb.subtreeNotes(child)) > 0:
+				folded = append(folded, child)
+			}
+		}
+
+		if len(subtopics) > 0 {
+			sb.WriteString("## 📂 Subtopics\n\n")
+
+			for _, child := range subtopics {
+				childTitle := mb.tagNodes[child].tag.Content.GetTitle()
+				sb.WriteString(fmt.Sprintf("- %s [[%s]] (%d notes)\n", mb.getIconForTag(childTitle), mocTitle(append(slices.Clone(path), childTitle)), len(mb.subtreeNotes(child))))
+			}
+
+			sb.WriteString("\n")
+		}
+
+		if len(node.notes) > 0 {
+			sb.WriteString("## Notes\n\n")
+			writeNoteLinks(&sb, node.notes)
+			sb.WriteString("\n")
+		}
+
+		for _, child := range folded {
+			sb.WriteString(fmt.Sprintf("### %s\n\n", toTitleCase(mb.tagNodes[child].tag.Content.GetTitle())))
+			writeNoteLinks(&sb, mb.subtreeNotes(child))
+			sb.WriteString("\n")
+		}
+
+		tag := strings.Join(path, "/")
+		sb.WriteString(fmt.Sprintf("---\n**Tagged Notes**: #%s (%d notes)\n", strings.ReplaceAll(tag, " ", "-"), len(mb.subtreeNotes(uuid))))
+
+		mocs = append(mocs, newMOCFile(title, []string{"moc", tag}, depth+1, icon+" "+strings.TrimSuffix(title, " MOC"), sb.String()))
+
+		for _, child := range subtopics {
+			walk(child, title, path, depth+1)
+		}
+	}
+
+	var roots []string
+
+	for uuid, node := range mb.tagNodes {
+		if node.parent == "" && hasMOC(uuid, 0) {
+			roots = append(roots, uuid)
+		}
+	}
+
+	sort.Slice(roots, func(i, j int) bool {
+		return mb.tagNodes[roots[i]].tag.Content.GetTitle() < mb.tagNodes[roots[j]].tag.Content.GetTitle()
+	})
+
+	if len(roots) > 0 {
+		home.WriteString("## 📂 Tags\n\n")
+	}
+
+	for _, root := range roots {
+		walk(root, "Home", nil, 0)
+	}
+
+	if len(roots) > 0 {
+		home.WriteString("\n")
+	}
+
+	return append([]MOCFile{mb.homeMOC(home.String())}, mocs...), nil
 }
 
-// generatePARAMOCs generates MOCs using the PARA method.
+// generatePARAMOCs generates a MOC for each PARA category with notes: Projects, Areas, Resources
+// and Archives, grouping the notes in each by tag.
 func (mb *MOCBuilder) generatePARAMOCs() ([]MOCFile, error) {
-	// For now, use flat MOCs - can be enhanced later
-	return mb.generateFlatMOCs()
+	groups := make(map[string]map[string][]*items.Note) // category to group to notes
+
+	for _, item := range mb.notes {
+		note, ok := item.(*items.Note)
+		if !ok {
+			continue
+		}
+
+		category, group := mb.paraCategory(note)
+		if groups[category] == nil {
+			groups[category] = make(map[string][]*items.Note)
+		}
+
+		groups[category][group] = append(groups[category][group], note)
+	}
+
+	var (
+		mocs []MOCFile
+		home strings.Builder
+	)
+
+	home.WriteString("## 🗂️ PARA\n\n")
+
+	for i, category := range paraCategories {
+		if len(groups[category]) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(groups[category]))
+		count := 0
+
+		for name, notes := range groups[category] {
+			names = append(names, name)
+			count += len(notes)
+		}
+
+		// notes without a group come last
+		sort.Slice(names, func(i, j int) bool {
+			if names[i] == "" || names[j] == "" {
+				return names[j] == ""
+			}
+
+			return strings.ToLower(names[i]) < strings.ToLower(names[j])
+		})
+
+		var sb strings.Builder
+
+		sb.WriteString(fmt.Sprintf("*%s*\n\n", paraDescriptions[category]))
+
+		for _, name := range names {
+			switch {
+			case name != "":
+				sb.WriteString(fmt.Sprintf("## %s\n\n", toTitleCase(name)))
+			case len(names) > 1:
+				sb.WriteString("## Other\n\n")
+			}
+
+			writeNoteLinks(&sb, groups[category][name])
+			sb.WriteString("\n")
+		}
+
+		sb.WriteString(fmt.Sprintf("---\n**%s**: %d notes\n", category, count))
+
+		title := category + " MOC"
+		home.WriteString(fmt.Sprintf("- %s [[%s]] (%d notes) - %s\n", paraIcons[category], title, count, paraDescriptions[category]))
+
+		mocs = append(mocs, newMOCFile(title, []string{"moc", "para", strings.ToLower(category)}, i+1, paraIcons[category]+" "+category, sb.String()))
+	}
+
+	home.WriteString("\n")
+
+	return append([]MOCFile{mb.homeMOC(home.String())}, mocs...), nil
 }
 
-// generateTopicMOCs generates topic-based MOCs.
+// generateTopicMOCs generates a MOC for each topic found in the notes' content, listing each note
+// under the most relevant topic it's part of, and linking topics that share notes.
 func (mb *MOCBuilder) generateTopicMOCs() ([]MOCFile, error) {
-	// For now, use flat MOCs - can be enhanced later
-	return mb.generateFlatMOCs()
+	themes := NewContentAnalyzer(mb.notes).AnalyzeContent()
+
+	// ties are broken by name so the topics are the same each time
+	sort.SliceStable(themes, func(i, j int) bool {
+		if themes[i].Relevance == themes[j].Relevance {
+			return themes[i].Name < themes[j].Name
+		}
+
+		return themes[i].Relevance > themes[j].Relevance
+	})
+
+	notes := make(map[string]*items.Note)
+
+	for _, item := range mb.notes {
+		if note, ok := item.(*items.Note); ok {
+			notes[note.UUID] = note
+		}
+	}
+
+	// topics left with too few notes are dropped, and their notes go to the next most relevant
+	active := make([]bool, len(themes))
+	for i := range active {
+		active[i] = true
+	}
+
+	var (
+		clusters [][]*items.Note
+		assigned map[string]bool
+	)
+
+	for dropped := true; dropped; {
+		clusters = make([][]*items.Note, len(themes))
+		assigned = make(map[string]bool)
+
+		for i, theme := range themes {
+			if !active[i] {
+				continue
+			}
+
+			for _, uuid := range theme.RelatedNotes {
+				if note := notes[uuid]; note != nil && !assigned[uuid] {
+					assigned[uuid] = true
+					clusters[i] = append(clusters[i], note)
+				}
+			}
+		}
+
+		dropped = false
+
+		for i := range themes {
+			if active[i] && len(clusters[i]) < max(mb.config.MinNotesPerMOC, 1) {
+				active[i] = false
+				dropped = true
+			}
+		}
+	}
+
+	var (
+		mocs []MOCFile
+		home strings.Builder
+	)
+
+	for i, theme := range themes {
+		if !active[i] {
+			continue
+		}
+
+		var sb strings.Builder
+
+		sb.WriteString(fmt.Sprintf("*Topic found by content analysis (%d notes)*\n\n", len(clusters[i])))
+
+		if len(theme.Phrases) > 0 {
+			sb.WriteString("## 🔑 Key Phrases\n\n")
+
+			for _, phrase := range theme.Phrases[:min(len(theme.Phrases), 5)] {
+				sb.WriteString(fmt.Sprintf("- `%s`\n", phrase))
+			}
+
+			sb.WriteString("\n")
+		}
+
+		sb.WriteString("## 📄 Notes\n\n")
+		writeNoteLinks(&sb, clusters[i])
+		sb.WriteString("\n")
+
+		if related := mb.relatedThemes(themes, active, i); len(related) > 0 {
+			sb.WriteString("## 🔗 Related Topics\n\n")
+
+			for _, line := range related {
+				sb.WriteString(line)
+			}
+
+			sb.WriteString("\n")
+		}
+
+		title := theme.Name + " MOC"
+		home.WriteString(fmt.Sprintf("- 📝 [[%s]] (%d notes)\n", title, len(clusters[i])))
+
+		mocs = append(mocs, newMOCFile(title, []string{"moc", "topic", strings.ToLower(theme.Name)}, 2, "🎯 "+theme.Name, sb.String()))
+	}
+
+	var other []*items.Note
+
+	for _, item := range mb.notes {
+		if note, ok := item.(*items.Note); ok && !assigned[note.UUID] {
+			other = append(other, note)
+		}
+	}
+
+	if len(other) > 0 {
+		var sb strings.Builder
+
+		sb.WriteString("*Notes without a topic shared with enough other notes*\n\n")
+		writeNoteLinks(&sb, other)
+
+		home.WriteString(fmt.Sprintf("- 📄 [[Other Notes MOC]] (%d notes)\n", len(other)))
+
+		mocs = append(mocs, newMOCFile("Other Notes MOC", []string{"moc", "topic"}, 3, "📄 Other Notes", sb.String()))
+	}
+
+	sections := ""
+	if home.Len() > 0 {
+		sections = "## 🎯 Topics\n\n" + home.String() + "\n"
+	}
+
+	return append([]MOCFile{mb.homeMOC(sections)}, mocs...), nil
 }
 
-// createHomeMOC creates the main Home MOC file.
-func (mb *MOCBuilder) createHomeMOC(topLevelTags []string, themes []ContentTheme) MOCFile {
+// relatedThemes returns links to the other active themes sharing notes with the theme, most shared first
+func (mb *MOCBuilder) relatedThemes(themes []ContentTheme, active []bool, i int) []string {
+	type relatedTheme struct {
+		name   string
+		shared int
+	}
+
+	var related []relatedTheme
+
+	for j, other := range themes {
+		if j == i || !active[j] {
+			continue
+		}
+
+		shared := 0
+
+		for _, uuid := range themes[i].RelatedNotes {
+			if slices.Contains(other.RelatedNotes, uuid) {
+				shared++
+			}
+		}
+
+		if shared > 0 {
+			related = append(related, relatedTheme{other.Name, shared})
+		}
+	}
+
+	sort.SliceStable(related, func(x, y int) bool {
+		return related[x].shared > related[y].shared
+	})
+
+	var lines []string
+
+	for _, r := range related[:min(len(related), 5)] {
+		lines = append(lines, fmt.Sprintf("- [[%s MOC]] (%d shared notes)\n", r.name, r.shared))
+	}
+
+	return lines
+}
+
+// ChooseStyle picks the MOC style that suits how the notes are organized, and gives the reason:
+// PARA when the top-level tags are PARA categories, hierarchical when tags are nested, topic when
+// few notes are tagged and their content has topics, and otherwise flat.
+func (mb *MOCBuilder) ChooseStyle() (MOCStyle, string) {
+	noteCount, tagged := 0, 0
+
+	for _, item := range mb.notes {
+		if note, ok := item.(*items.Note); ok {
+			noteCount++
+
+			if len(mb.noteTags[note.UUID]) > 0 {
+				tagged++
+			}
+		}
+	}
+
+	if noteCount == 0 {
+		return MOCStyleFlat, "there are no notes to organize"
+	}
+
+	var paraTags []string
+
+	categories := make(map[string]bool)
+	nested := 0
+
+	for uuid, node := range mb.tagNodes {
+		if len(mb.subtreeNotes(uuid)) == 0 {
+			continue
+		}
+
+		if node.parent != "" {
+			nested++
+
+			continue
+		}
+
+		if category, ok := paraTagNames[strings.ToLower(node.tag.Content.GetTitle())]; ok {
+			paraTags = append(paraTags, node.tag.Content.GetTitle())
+			categories[category] = true
+		}
+	}
+
+	sort.Strings(paraTags)
+
+	switch {
+	case len(categories) >= 2:
+		return MOCStylePARA, fmt.Sprintf("the top-level tags %s follow the PARA method", strings.Join(paraTags, ", "))
+	case nested > 0:
+		return MOCStyleHierarchical, fmt.Sprintf("%d tags are nested under other tags", nested)
+	case tagged*2 < noteCount && len(NewContentAnalyzer(mb.notes).AnalyzeContent()) > 0:
+		return MOCStyleTopicBased, fmt.Sprintf("only %d of %d notes are tagged, so their content is used instead", tagged, noteCount)
+	default:
+		return MOCStyleFlat, fmt.Sprintf("%d of %d notes are tagged and the tags aren't nested", tagged, noteCount)
+	}
+}
+
+// paraCategory returns the PARA category for the note, and the group within it. The category is
+// Archives for archived notes, then that of the first PARA tag above one of its tags, grouped by
+// the tag below it. Otherwise, notes not updated for a year are archived, recently updated notes
+// with open tasks are projects, other tagged notes are areas, grouped by their first tag, and the
+// rest are resources.
+func (mb *MOCBuilder) paraCategory(note *items.Note) (string, string) {
+	found := make(map[string]string) // category to group
+
+	firstTag := ""
+
+	for _, uuid := range mb.noteTags[note.UUID] {
+		path := mb.tagPath(uuid)
+		if firstTag == "" {
+			firstTag = path[len(path)-1]
+		}
+
+		for i, title := range path {
+			category, ok := paraTagNames[strings.ToLower(title)]
+			if !ok {
+				continue
+			}
+
+			group := ""
+			if i+1 < len(path) {
+				group = path[i+1]
+			}
+
+			if found[category] == "" {
+				found[category] = group
+			}
+
+			break
+		}
+	}
+
+	if group, ok := found[paraArchives]; ok || note.Archived {
+		if !ok {
+			group = firstTag
+		}
+
+		return paraArchives, group
+	}
+
+	for _, category := range []string{paraProjects, paraAreas, paraResources} {
+		if group, ok := found[category]; ok {
+			return category, group
+		}
+	}
+
+	_, updated := itemTimes(note)
+	age := mb.now.Sub(updated)
+
+	switch {
+	case age > paraStaleDays*24*time.Hour:
+		return paraArchives, firstTag
+	case age <= paraActiveDays*24*time.Hour && strings.Contains(note.Content.GetText(), "- [ ]"):
+		return paraProjects, firstTag
+	case firstTag != "":
+		return paraAreas, firstTag
+	default:
+		return paraResources, ""
+	}
+}
+
+// tagPath returns the titles of the tag and the tags above it, from the top
+func (mb *MOCBuilder) tagPath(uuid string) []string {
+	var titles []string
+
+	for visited := make(map[string]bool); mb.tagNodes[uuid] != nil && !visited[uuid]; uuid = mb.tagNodes[uuid].parent {
+		visited[uuid] = true
+		titles = append(titles, mb.tagNodes[uuid].tag.Content.GetTitle())
+	}
+
+	slices.Reverse(titles)
+
+	return titles
+}
+
+// subtreeNotes returns the notes tagged with the tag or any tag below it, once each
+func (mb *MOCBuilder) subtreeNotes(uuid string) []*items.Note {
+	var notes []*items.Note
+
+	visited := make(map[string]bool)
+	seen := make(map[string]bool)
+
+	var walk func(string)
+	walk = func(uuid string) {
+		if visited[uuid] {
+			return
+		}
+
+		visited[uuid] = true
+
+		for _, note := range mb.tagNodes[uuid].notes {
+			if !seen[note.UUID] {
+				seen[note.UUID] = true
+				notes = append(notes, note)
+			}
+		}
+
+		for _, child := range mb.tagNodes[uuid].children {
+			walk(child)
+		}
+	}
+
+	walk(uuid)
+
+	return notes
+}
+
+// newMOCFile creates a MOC with frontmatter, a heading and the content given
+func newMOCFile(title string, tags []string, order int, heading, content string) MOCFile {
 	var sb strings.Builder
 
 	sb.WriteString("---\n")
-	sb.WriteString("title: Home\n")
-	sb.WriteString("tags: [moc, index]\n")
+	sb.WriteString(fmt.Sprintf("title: %s\n", title))
+	sb.WriteString(fmt.Sprintf("tags: [%s]\n", strings.Join(tags, ", ")))
 	sb.WriteString("---\n\n")
-	sb.WriteString("# 🏠 Home\n\n")
-	sb.WriteString("Welcome to your knowledge base!\n\n")
+	sb.WriteString(fmt.Sprintf("# %s\n\n", heading))
+	sb.WriteString(content)
+
+	return MOCFile{
+		Filename: title + ".md",
+		Title:    title,
+		Content:  sb.String(),
+		Tags:     tags,
+		Order:    order,
+	}
+}
+
+// mocTitle returns the title of the MOC for a tag, from the titles of the tags down to it
+func mocTitle(path []string) string {
+	parts := make([]string, len(path))
+
+	for i, title := range path {
+		parts[i] = toTitleCase(invalidFilenameChars.ReplaceAllString(title, "-"))
+	}
+
+	return strings.Join(parts, " - ") + " MOC"
+}
+
+// writeNoteLinks writes a link to each note, in title order
+func writeNoteLinks(sb *strings.Builder, notes []*items.Note) {
+	sorted := slices.Clone(notes)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].Content.GetTitle()) < strings.ToLower(sorted[j].Content.GetTitle())
+	})
+
+	for _, note := range sorted {
+		sb.WriteString(fmt.Sprintf("- [[%s]]\n", note.Content.GetTitle()))
+	}
+}
+
+// createHomeMOC creates the main Home MOC file.
+func (mb *MOCBuilder) createHomeMOC(topLevelTags []string, themes []ContentTheme) MOCFile {
+	var sb strings.Builder
 
 	// Tag-based MOCs
 	if len(topLevelTags) > 0 {
@@ -162,6 +785,26 @@ func (mb *MOCBuilder) createHomeMOC(topLevelTags []string, themes []ContentTheme
 		sb.WriteString("\n")
 	}
 
+	return mb.homeMOC(sb.String())
+}
+
+// homeMOC creates the Home MOC with the sections given, followed by the stats and recently updated notes.
+func (mb *MOCBuilder) homeMOC(sections string) MOCFile {
+	var sb strings.Builder
+
+	sb.WriteString("---\n")
+	sb.WriteString("title: Home\n")
+	sb.WriteString("tags: [moc, index]\n")
+	sb.WriteString("---\n\n")
+	sb.WriteString("# 🏠 Home\n\n")
+	sb.WriteString("Welcome to your knowledge base!\n\n")
+
+	if mb.config.StyleReason != "" {
+		sb.WriteString(fmt.Sprintf("*Organized with %s MOCs, as %s.*\n\n", mb.config.Style, mb.config.StyleReason))
+	}
+
+	sb.WriteString(sections)
+
 	if mb.config.IncludeStats {
 		sb.WriteString("\n## 📊 Quick Stats\n\n")
 		noteCount := 0
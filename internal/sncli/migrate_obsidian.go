@@ -2,27 +2,46 @@ package sncli
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/jonhadfield/gosn-v2/common"
 	"github.com/jonhadfield/gosn-v2/items"
 )
 
+var (
+	// noteLinkPattern matches [[wikilinks]], with their heading and alias, and Markdown links
+	noteLinkPattern = regexp.MustCompile(`(!?)(?:\[\[([^\[\]|#]*)(#[^\[\]|]*)?(?:\|([^\[\]]*))?\]\]|\[([^\[\]]*)\]\(([^()\s]+)\))`)
+	uuidPattern     = regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+)
+
 // ObsidianExporter implements the Provider interface for Obsidian.
 type ObsidianExporter struct {
 	outputDir string
 	noteMap   map[string]*items.Note // UUID to Note mapping
-	titleMap  map[string]string      // Title to filename mapping
+	titleMap  map[string]string      // Title to UUID of the first note with it
+	filenames map[string]string      // UUID to filename mapping
+	used      map[string]bool        // lower-case filenames given
+	links     map[string][]string    // UUID to the UUIDs of the notes it links to
+	// referenced holds the notes each note references without linking to them in its text
+	referenced map[string][]string
 }
 
 // NewObsidianExporter creates a new Obsidian exporter.
 func NewObsidianExporter(outputDir string) *ObsidianExporter {
 	return &ObsidianExporter{
-		outputDir: outputDir,
-		noteMap:   make(map[string]*items.Note),
-		titleMap:  make(map[string]string),
+		outputDir:  outputDir,
+		noteMap:    make(map[string]*items.Note),
+		titleMap:   make(map[string]string),
+		filenames:  make(map[string]string),
+		used:       make(map[string]bool),
+		links:      make(map[string][]string),
+		referenced: make(map[string][]string),
 	}
 }
 
@@ -41,12 +60,40 @@ func (o *ObsidianExporter) Validate() error {
 
 // Export exports notes to Obsidian format.
 func (o *ObsidianExporter) Export(notes items.Items, config MigrationExportConfig) error {
-	// Build note and title maps
+	// Build note and title maps, giving each note its filename first so links to it can be resolved
 	for _, item := range notes {
 		if note, ok := item.(*items.Note); ok {
 			o.noteMap[note.UUID] = note
-			filename := o.sanitizeFilename(note.Content.GetTitle())
-			o.titleMap[note.Content.GetTitle()] = filename
+			filename := o.ensureUniqueFilename(o.sanitizeFilename(note.Content.GetTitle()))
+			o.filenames[note.UUID] = filename
+
+			if _, exists := o.titleMap[note.Content.GetTitle()]; !exists {
+				o.titleMap[note.Content.GetTitle()] = note.UUID
+			}
+		}
+	}
+
+	// Find the notes each note links to, in its text or by reference, for the backlinks
+	for _, item := range notes {
+		note, ok := item.(*items.Note)
+		if !ok {
+			continue
+		}
+
+		_, linked := o.convertLinks(note.Content.GetText(), config.LinkStyle)
+
+		for _, ref := range note.Content.References() {
+			if ref.ContentType != common.SNItemTypeNote || o.noteMap[ref.UUID] == nil || slices.Contains(linked, ref.UUID) {
+				continue
+			}
+
+			o.referenced[note.UUID] = appendMissing(o.referenced[note.UUID], ref.UUID)
+		}
+
+		for _, target := range append(linked, o.referenced[note.UUID]...) {
+			if target != note.UUID && !slices.Contains(o.links[note.UUID], target) {
+				o.links[note.UUID] = append(o.links[note.UUID], target)
+			}
 		}
 	}
 
@@ -59,13 +106,7 @@ func (o *ObsidianExporter) Export(notes items.Items, config MigrationExportConfi
 
 		// Convert note to markdown
 		markdown := o.convertToMarkdown(note, notes, config)
-
-		// Get filename
-		filename := o.sanitizeFilename(note.Content.GetTitle())
-		if filename == "" {
-			filename = fmt.Sprintf("untitled-%s", note.UUID[:8])
-		}
-		filename = o.ensureUniqueFilename(filename)
+		filename := o.filenames[note.UUID]
 
 		// Write file
 		if !config.DryRun {
@@ -82,7 +123,24 @@ func (o *ObsidianExporter) Export(notes items.Items, config MigrationExportConfi
 // GenerateMOCs generates Maps of Content for the exported notes.
 func (o *ObsidianExporter) GenerateMOCs(notes items.Items, config MOCConfig) ([]MOCFile, error) {
 	builder := NewMOCBuilder(notes, config)
-	return builder.Generate()
+
+	mocs, err := builder.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	// MOCs link to notes by title, which differs from the filename for some
+	for i, moc := range mocs {
+		mocs[i].Content = rewriteWikilinks(moc.Content, func(target string) string {
+			if uuid, ok := o.titleMap[target]; ok && o.filenames[uuid] != target {
+				return "[[" + o.filenames[uuid] + "|" + target + "]]"
+			}
+
+			return ""
+		})
+	}
+
+	return mocs, nil
 }
 
 // convertToMarkdown converts a Standard Notes note to Obsidian markdown format.
@@ -125,7 +183,7 @@ func (o *ObsidianExporter) convertToMarkdown(note *items.Note, allNotes items.It
 
 	// Add content
 	content := note.Content.GetText()
-	content = o.convertLinks(content)
+	content, _ = o.convertLinks(content, config.LinkStyle)
 	sb.WriteString(content)
 
 	// Add inline tags if configured
@@ -139,14 +197,164 @@ func (o *ObsidianExporter) convertToMarkdown(note *items.Note, allNotes items.It
 		}
 	}
 
+	// Add the notes referenced but not linked to, then those linking here
+	o.writeLinkSection(&sb, "Links", o.referenced[note.UUID], config.LinkStyle)
+	o.writeLinkSection(&sb, "Backlinks", o.backlinks(note.UUID), config.LinkStyle)
+
 	return sb.String()
 }
 
-// convertLinks converts any links in content to Obsidian wikilinks.
-func (o *ObsidianExporter) convertLinks(content string) string {
-	// This is a basic implementation - could be enhanced to detect
-	// Standard Notes references and convert them to wikilinks
-	return content
+// convertLinks converts links to other notes, by [[uuid]], [[title]] or a Markdown link containing the
+// note's UUID, to links to their exported files in the link style. It returns the content and the
+// UUIDs of the notes linked to. Links in code and those to anything else are left as they are.
+func (o *ObsidianExporter) convertLinks(content string, style LinkStyle) (string, []string) {
+	var linked []string
+
+	convert := func(text string) string {
+		return noteLinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+			parts := noteLinkPattern.FindStringSubmatch(match)
+			embed, label, heading := parts[1] != "", parts[4], ""
+
+			var uuid string
+
+			switch {
+			case strings.HasPrefix(match, parts[1]+"[["):
+				heading = strings.TrimPrefix(parts[3], "#")
+				uuid = o.resolveLink(strings.TrimSpace(parts[2]))
+			case embed:
+				// images are left alone
+				return match
+			default:
+				label = parts[5]
+
+				for _, candidate := range uuidPattern.FindAllString(parts[6], -1) {
+					if o.noteMap[strings.ToLower(candidate)] != nil {
+						uuid = strings.ToLower(candidate)
+
+						break
+					}
+				}
+			}
+
+			if uuid == "" {
+				return match
+			}
+
+			if !slices.Contains(linked, uuid) {
+				linked = append(linked, uuid)
+			}
+
+			if label == "" {
+				label = o.noteMap[uuid].Content.GetTitle()
+			}
+
+			link := o.formatLink(o.filenames[uuid], heading, label, style)
+			if embed {
+				link = "!" + link
+			}
+
+			return link
+		})
+	}
+
+	lines := strings.Split(content, "\n")
+	fenced := false
+
+	for i, line := range lines {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+
+			continue
+		}
+
+		if fenced {
+			continue
+		}
+
+		// inline code is kept as it is, converting the text around it
+		var sb strings.Builder
+
+		last := 0
+		for _, span := range inlineCodePattern.FindAllStringIndex(line, -1) {
+			sb.WriteString(convert(line[last:span[0]]))
+			sb.WriteString(line[span[0]:span[1]])
+			last = span[1]
+		}
+
+		sb.WriteString(convert(line[last:]))
+		lines[i] = sb.String()
+	}
+
+	return strings.Join(lines, "\n"), linked
+}
+
+// resolveLink returns the UUID of the note a wikilink's target refers to, by UUID or title
+func (o *ObsidianExporter) resolveLink(target string) string {
+	if o.noteMap[strings.ToLower(target)] != nil {
+		return strings.ToLower(target)
+	}
+
+	return o.titleMap[target]
+}
+
+// formatLink returns a link to the exported note, and the heading in it if given, in the link style.
+// Notes are all written to the same directory, so relative links are to ./ and Markdown links have
+// only the filename, as Obsidian writes them.
+func (o *ObsidianExporter) formatLink(filename, heading, label string, style LinkStyle) string {
+	switch style {
+	case LinkStyleMarkdown, LinkStyleRelative:
+		target := url.PathEscape(filename) + ".md"
+		if style == LinkStyleRelative {
+			target = "./" + target
+		}
+
+		if heading != "" {
+			target += "#" + url.PathEscape(heading)
+		}
+
+		return "[" + label + "](" + target + ")"
+	default:
+		link := filename
+		if heading != "" {
+			link += "#" + heading
+		}
+
+		if label != filename && label != link {
+			link += "|" + label
+		}
+
+		return "[[" + link + "]]"
+	}
+}
+
+// backlinks returns the UUIDs of the notes linking to the note, ordered by filename
+func (o *ObsidianExporter) backlinks(uuid string) []string {
+	var sources []string
+
+	for source, targets := range o.links {
+		if slices.Contains(targets, uuid) {
+			sources = append(sources, source)
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return o.filenames[sources[i]] < o.filenames[sources[j]]
+	})
+
+	return sources
+}
+
+// writeLinkSection writes a section with the heading listing links to the notes, if there are any
+func (o *ObsidianExporter) writeLinkSection(sb *strings.Builder, heading string, uuids []string, style LinkStyle) {
+	if len(uuids) == 0 {
+		return
+	}
+
+	sb.WriteString(fmt.Sprintf("\n\n## %s\n\n", heading))
+
+	for _, uuid := range uuids {
+		sb.WriteString("- " + o.formatLink(o.filenames[uuid], "", o.noteMap[uuid].Content.GetTitle(), style) + "\n")
+	}
 }
 
 // sanitizeFilename creates a valid filename from a note title.
@@ -176,11 +384,12 @@ func (o *ObsidianExporter) sanitizeFilename(title string) string {
 	return filename
 }
 
-// ensureUniqueFilename ensures the filename is unique by appending numbers if needed.
+// ensureUniqueFilename ensures the filename is unique by appending numbers if needed. Filenames
+// differing only in case are taken as the same, as they are on macOS and Windows.
 func (o *ObsidianExporter) ensureUniqueFilename(filename string) string {
 	// Check if already used
-	if _, exists := o.titleMap[filename]; !exists {
-		o.titleMap[filename] = filename
+	if !o.used[strings.ToLower(filename)] {
+		o.used[strings.ToLower(filename)] = true
 		return filename
 	}
 
@@ -188,8 +397,8 @@ func (o *ObsidianExporter) ensureUniqueFilename(filename string) string {
 	counter := 1
 	for {
 		uniqueName := fmt.Sprintf("%s-%d", filename, counter)
-		if _, exists := o.titleMap[uniqueName]; !exists {
-			o.titleMap[uniqueName] = uniqueName
+		if !o.used[strings.ToLower(uniqueName)] {
+			o.used[strings.ToLower(uniqueName)] = true
 			return uniqueName
 		}
 		counter++
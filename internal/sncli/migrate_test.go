@@ -1,8 +1,14 @@
 package sncli
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
 	"github.com/jonhadfield/gosn-v2/items"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,7 +31,7 @@ func TestMigrateConfig_Validate(t *testing.T) {
 		{
 			name: "missing provider",
 			config: MigrateConfig{
-				Session:   &struct{}{}, // dummy session
+				Session:   &cache.Session{}, // dummy session
 				OutputDir: "/tmp/test",
 			},
 			wantErr: true,
@@ -33,7 +39,7 @@ func TestMigrateConfig_Validate(t *testing.T) {
 		{
 			name: "missing output dir",
 			config: MigrateConfig{
-				Session:  &struct{}{},
+				Session:  &cache.Session{},
 				Provider: "obsidian",
 			},
 			wantErr: true,
@@ -41,7 +47,7 @@ func TestMigrateConfig_Validate(t *testing.T) {
 		{
 			name: "invalid MOC style",
 			config: MigrateConfig{
-				Session:      &struct{}{},
+				Session:      &cache.Session{},
 				Provider:     "obsidian",
 				OutputDir:    "/tmp/test",
 				GenerateMOCs: true,
@@ -52,7 +58,7 @@ func TestMigrateConfig_Validate(t *testing.T) {
 		{
 			name: "invalid MOC depth",
 			config: MigrateConfig{
-				Session:      &struct{}{},
+				Session:      &cache.Session{},
 				Provider:     "obsidian",
 				OutputDir:    "/tmp/test",
 				GenerateMOCs: true,
@@ -61,6 +67,17 @@ func TestMigrateConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid link style",
+			config: MigrateConfig{
+				Session:   &cache.Session{},
+				Provider:  "obsidian",
+				OutputDir: "/tmp/test",
+				MOCDepth:  2,
+				LinkStyle: "invalid",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -124,8 +141,8 @@ func TestObsidianExporter_SanitizeFilename(t *testing.T) {
 
 func TestExtractNoteTags(t *testing.T) {
 	// Create test notes and tags
-	tag1, _ := items.NewTag("work")
-	tag2, _ := items.NewTag("personal")
+	tag1, _ := items.NewTag("work", nil)
+	tag2, _ := items.NewTag("personal", nil)
 
 	note, _ := items.NewNote("Test Note", "Test content", nil)
 	note.Content.UpsertReferences(items.ItemReferences{
@@ -144,9 +161,9 @@ func TestExtractNoteTags(t *testing.T) {
 
 func TestMOCBuilder_IdentifyTopLevelTags(t *testing.T) {
 	// Create test data
-	tag1, _ := items.NewTag("work")
-	tag2, _ := items.NewTag("personal")
-	tag3, _ := items.NewTag("rarely-used")
+	tag1, _ := items.NewTag("work", nil)
+	tag2, _ := items.NewTag("personal", nil)
+	tag3, _ := items.NewTag("rarely-used", nil)
 
 	// Create 10 notes with work tag, 5 with personal, 1 with rarely-used
 	var allItems items.Items
@@ -216,7 +233,7 @@ func TestEscapeYAMLString(t *testing.T) {
 
 func TestMOCBuilder_Generate(t *testing.T) {
 	// Create minimal test data
-	tag1, _ := items.NewTag("work")
+	tag1, _ := items.NewTag("work", nil)
 
 	var allItems items.Items
 	allItems = append(allItems, &tag1)
@@ -251,3 +268,544 @@ func TestMOCBuilder_Generate(t *testing.T) {
 	assert.Equal(t, "Home", mocs[0].Title)
 	assert.Contains(t, mocs[0].Content, "# 🏠 Home")
 }
+
+// testMigrationItems returns the notes and tags of the test library, with a note titled as a
+// date, created a minute apart from 9am on 5 January 2026
+func testMigrationItems(t *testing.T) items.Items {
+	t.Helper()
+
+	lib := testLibrary(t)
+
+	journal, err := items.NewNote("2026-01-05", "- [ ] call Sam\n- [x] book room", nil)
+	require.NoError(t, err)
+
+	journal.UUID = "note-journal"
+	lib.Notes = append(lib.Notes, &journal)
+
+	var all items.Items
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	for i, note := range lib.Notes {
+		note.CreatedAtTimestamp = start.Add(time.Duration(i) * time.Minute).UnixMicro()
+		all = append(all, note)
+	}
+
+	// tagged with work by the note itself, as well as by the tag
+	lib.Notes[0].Content.SetReferences(items.ItemReferences{{UUID: "tag-work", ContentType: common.SNItemTypeTag}})
+
+	for _, tag := range lib.Tags {
+		all = append(all, tag)
+	}
+
+	return all
+}
+
+func testExportConfig(t *testing.T) MigrationExportConfig {
+	t.Helper()
+
+	return MigrationExportConfig{
+		OutputDir:    t.TempDir(),
+		PreserveUUID: true,
+		LinkStyle:    LinkStyleWikilink,
+		TagStyle:     TagStyleFrontmatter,
+	}
+}
+
+func TestGetProvider(t *testing.T) {
+	for name, want := range map[string]string{
+		"obsidian":     "obsidian",
+		"obs":          "obsidian",
+		"logseq":       "logseq",
+		"joplin":       "joplin",
+		"zettel":       "zettel",
+		"zettelkasten": "zettel",
+	} {
+		provider, err := getProvider(name, "/tmp/test")
+		require.NoError(t, err)
+		assert.Equal(t, want, provider.Name())
+	}
+
+	_, err := getProvider("notion", "/tmp/test")
+	assert.ErrorContains(t, err, "unsupported provider")
+}
+
+func TestExtractNoteTagsReferencedByTags(t *testing.T) {
+	all := testMigrationItems(t)
+
+	tags := make(map[string][]string)
+
+	for _, item := range all {
+		if note, ok := item.(*items.Note); ok {
+			tags[note.Content.GetTitle()] = extractNoteTags(note, all)
+		}
+	}
+
+	assert.Equal(t, []string{"work"}, tags["Standup"])
+	assert.Equal(t, []string{"projects"}, tags["Design doc"])
+	assert.Empty(t, tags["Groceries"])
+
+	filtered := filterByTags(all, []string{"work", "projects"})
+	require.Len(t, filtered, 2)
+}
+
+func TestLogseqBlocks(t *testing.T) {
+	text := "# Plan\nFirst paragraph\ncontinues here.\n\n- one\n  - nested\n- [ ] task\n1. first\n\n```go\nfmt.Println()\n\n```\n| a | b |\n| - | - |"
+
+	want := "- # Plan\n" +
+		"- First paragraph\n  continues here.\n" +
+		"- one\n\t- nested\n- TODO task\n- 1. first\n" +
+		"- ```go\n  fmt.Println()\n  \n  ```\n" +
+		"- | a | b |\n  | - | - |\n"
+
+	assert.Equal(t, want, logseqBlocks(text))
+}
+
+func TestLogseqJournalDate(t *testing.T) {
+	for _, title := range []string{"2026-01-05", "2026_01_05", "Jan 5th, 2026", "January 5, 2026", "Monday, January 5, 2026"} {
+		day, ok := logseqJournalDate(title)
+		require.True(t, ok, title)
+		assert.Equal(t, "Jan 5th, 2026", logseqJournalPageName(day))
+	}
+
+	_, ok := logseqJournalDate("Standup")
+	assert.False(t, ok)
+
+	for day, want := range map[int]string{1: "Mar 1st, 2026", 2: "Mar 2nd, 2026", 3: "Mar 3rd, 2026", 11: "Mar 11th, 2026", 22: "Mar 22nd, 2026"} {
+		assert.Equal(t, want, logseqJournalPageName(time.Date(2026, 3, day, 0, 0, 0, 0, time.UTC)))
+	}
+}
+
+func TestLogseqExporter_Export(t *testing.T) {
+	all := testMigrationItems(t)
+	config := testExportConfig(t)
+
+	exporter := NewLogseqExporter(config.OutputDir)
+	require.NoError(t, exporter.Export(all, config))
+
+	page, err := os.ReadFile(filepath.Join(config.OutputDir, "pages", "Standup.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "title:: Standup\ntags:: work\nuuid:: note-Standup\n\n- Standup text\n", string(page))
+
+	journal, err := os.ReadFile(filepath.Join(config.OutputDir, "journals", "2026_01_05.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "- TODO call Sam\n- DONE book room\n", string(journal))
+
+	assert.NoFileExists(t, filepath.Join(config.OutputDir, "pages", "2026-01-05.md"))
+
+	mocs, err := exporter.GenerateMOCs(all, MOCConfig{Style: MOCStyleFlat, MinNotesPerMOC: 1, IncludeRecent: true, RecentCount: 5})
+	require.NoError(t, err)
+	require.NotEmpty(t, mocs)
+
+	assert.Equal(t, filepath.Join("pages", "Home.md"), mocs[0].Filename)
+	assert.True(t, strings.HasPrefix(mocs[0].Content, "title:: Home\ntags:: moc, index\n\n- # 🏠 Home\n"))
+	assert.Contains(t, mocs[0].Content, "- [[Jan 5th, 2026]]\n")
+}
+
+func TestJoplinExporter_Export(t *testing.T) {
+	all := testMigrationItems(t)
+	config := testExportConfig(t)
+
+	exporter := NewJoplinExporter(config.OutputDir)
+	require.NoError(t, exporter.Export(all, config))
+
+	entries, err := os.ReadDir(config.OutputDir)
+	require.NoError(t, err)
+
+	// the resources folder, the notebook, four notes, two tags and two note tags
+	assert.Len(t, entries, 10)
+
+	noteID := joplinID("note-Standup")
+	assert.Len(t, noteID, 32)
+
+	note, err := os.ReadFile(filepath.Join(config.OutputDir, noteID+".md"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(note), "Standup\n\nStandup text\n\nid: "+noteID+"\nparent_id: "+exporter.folderID+"\ncreated_time: 2026-01-05T09:0"))
+	assert.Contains(t, string(note), "\nsource_url: standardnotes:note-Standup\n")
+	assert.True(t, strings.HasSuffix(string(note), "\ntype_: 1"))
+
+	tagID := joplinDerivedID("tag", "work")
+	tag, err := os.ReadFile(filepath.Join(config.OutputDir, tagID+".md"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(tag), "work\n\nid: "+tagID+"\n"))
+	assert.True(t, strings.HasSuffix(string(tag), "\ntype_: 5"))
+
+	noteTag, err := os.ReadFile(filepath.Join(config.OutputDir, joplinDerivedID("note_tag", noteID, tagID)+".md"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(noteTag), "id: "+joplinDerivedID("note_tag", noteID, tagID)+"\nnote_id: "+noteID+"\ntag_id: "+tagID+"\n"))
+
+	assert.Equal(t, "4e1a0b3f6e4a4e0a9c8a2d3b5e6f7a8b", joplinID("4E1A0B3F-6E4A-4E0A-9C8A-2D3B5E6F7A8B"))
+
+	mocs, err := exporter.GenerateMOCs(all, MOCConfig{Style: MOCStyleFlat, MinNotesPerMOC: 1, IncludeRecent: true, RecentCount: 5})
+	require.NoError(t, err)
+	require.NotEmpty(t, mocs)
+
+	assert.True(t, strings.HasPrefix(mocs[0].Content, "Home\n\n# 🏠 Home\n"))
+	assert.Contains(t, mocs[0].Content, "- [Standup](:/"+noteID+")\n")
+	assert.Equal(t, ".md", filepath.Ext(mocs[0].Filename))
+}
+
+func TestZettelExporter_Export(t *testing.T) {
+	all := testMigrationItems(t)
+	config := testExportConfig(t)
+
+	// created at the same time as Standup, so given the next second
+	clash, err := items.NewNote("Standup", "again", nil)
+	require.NoError(t, err)
+
+	clash.CreatedAtTimestamp = all[0].GetCreatedAtTimestamp()
+	all = append(all, &clash)
+
+	exporter := NewZettelExporter(config.OutputDir)
+	require.NoError(t, exporter.Export(all, config))
+
+	first := all[0].(*items.Note)
+	id := time.UnixMicro(first.CreatedAtTimestamp).UTC().Format(zettelIDLayout)
+
+	note, err := os.ReadFile(filepath.Join(config.OutputDir, id+" "+first.Content.GetTitle()+".md"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(note), "---\nid: \""+id+"\"\ntitle: \""+first.Content.GetTitle()+"\"\n"))
+
+	clashID := time.UnixMicro(first.CreatedAtTimestamp).UTC().Add(time.Second).Format(zettelIDLayout)
+	assert.FileExists(t, filepath.Join(config.OutputDir, clashID+" Standup.md"))
+
+	mocs, err := exporter.GenerateMOCs(all, MOCConfig{Style: MOCStyleFlat, MinNotesPerMOC: 1, IncludeRecent: true, RecentCount: 10})
+	require.NoError(t, err)
+	assert.Contains(t, mocs[0].Content, "- [["+id+"]] "+first.Content.GetTitle()+"\n")
+}
+
+// testLinkedNotes returns notes linking to each other by UUID in their text, by a Markdown link with
+// the UUID and by an item reference, with one titled with characters not allowed in filenames
+func testLinkedNotes(t *testing.T) items.Items {
+	t.Helper()
+
+	var notes []*items.Note
+
+	for _, title := range []string{"Design: Draft", "Meeting", "Ideas"} {
+		note, err := items.NewNote(title, "notes on "+title, nil)
+		require.NoError(t, err)
+
+		notes = append(notes, &note)
+	}
+
+	text := "See [[" + notes[0].UUID + "]] and [[Meeting#Actions|the meeting]].\n" +
+		"Also [minutes](https://app.standardnotes.com/?uuid=" + notes[1].UUID + ").\n" +
+		"`[[" + notes[0].UUID + "]]` stays.\n```\n[[Meeting]]\n```\n[[Nowhere]]"
+
+	plan, err := items.NewNote("Plan", text, items.ItemReferences{
+		{UUID: notes[2].UUID, ContentType: common.SNItemTypeNote},
+		{UUID: notes[1].UUID, ContentType: common.SNItemTypeNote},
+	})
+	require.NoError(t, err)
+
+	return items.Items{&plan, notes[0], notes[1], notes[2]}
+}
+
+func TestObsidianExporter_Links(t *testing.T) {
+	all := testLinkedNotes(t)
+	design := all[1].(*items.Note)
+
+	tests := []struct {
+		style     LinkStyle
+		plan      []string
+		backlinks string
+	}{
+		{
+			style: LinkStyleWikilink,
+			plan: []string{
+				"See [[Design- Draft|Design: Draft]] and [[Meeting#Actions|the meeting]].\n",
+				"Also [[Meeting|minutes]].\n",
+				"`[[" + design.UUID + "]]` stays.\n```\n[[Meeting]]\n```\n[[Nowhere]]",
+				"\n\n## Links\n\n- [[Ideas]]\n",
+			},
+			backlinks: "## Backlinks\n\n- [[Plan]]\n",
+		},
+		{
+			style: LinkStyleMarkdown,
+			plan: []string{
+				"See [Design: Draft](Design-%20Draft.md) and [the meeting](Meeting.md#Actions).\n",
+				"Also [minutes](Meeting.md).\n",
+				"\n\n## Links\n\n- [Ideas](Ideas.md)\n",
+			},
+			backlinks: "## Backlinks\n\n- [Plan](Plan.md)\n",
+		},
+		{
+			style: LinkStyleRelative,
+			plan: []string{
+				"See [Design: Draft](./Design-%20Draft.md) and [the meeting](./Meeting.md#Actions).\n",
+				"\n\n## Links\n\n- [Ideas](./Ideas.md)\n",
+			},
+			backlinks: "## Backlinks\n\n- [Plan](./Plan.md)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.style), func(t *testing.T) {
+			config := testExportConfig(t)
+			config.LinkStyle = tt.style
+
+			require.NoError(t, NewObsidianExporter(config.OutputDir).Export(all, config))
+
+			plan, err := os.ReadFile(filepath.Join(config.OutputDir, "Plan.md"))
+			require.NoError(t, err)
+
+			for _, want := range tt.plan {
+				assert.Contains(t, string(plan), want)
+			}
+
+			// the meeting is linked in the text, so isn't listed again
+			assert.NotContains(t, string(plan), "- [[Meeting]]")
+			assert.NotContains(t, string(plan), "## Backlinks")
+
+			// referenced and linked notes all get backlinks, under their own filenames
+			for _, name := range []string{"Design- Draft", "Meeting", "Ideas"} {
+				note, err := os.ReadFile(filepath.Join(config.OutputDir, name+".md"))
+				require.NoError(t, err)
+				assert.True(t, strings.HasSuffix(string(note), tt.backlinks), name)
+			}
+		})
+	}
+}
+
+func TestObsidianExporter_GenerateMOCsLinkFilenames(t *testing.T) {
+	all := testLinkedNotes(t)
+	tag := testMOCTag(t, "work", nil)
+
+	for _, item := range all {
+		tag.Content.SetReferences(append(tag.Content.References(), items.ItemReference{UUID: item.GetUUID(), ContentType: common.SNItemTypeNote}))
+	}
+
+	all = append(all, tag)
+	config := testExportConfig(t)
+	exporter := NewObsidianExporter(config.OutputDir)
+
+	require.NoError(t, exporter.Export(all, config))
+
+	mocs, err := exporter.GenerateMOCs(all, MOCConfig{Style: MOCStyleFlat, MinNotesPerMOC: 1})
+	require.NoError(t, err)
+
+	work := mocByTitle(mocs, "Work MOC")
+	require.NotNil(t, work)
+	assert.Contains(t, work.Content, "[[Design- Draft|Design: Draft]]")
+	assert.Contains(t, work.Content, "[[Meeting]]")
+}
+
+// testMOCNote returns a note tagged with the tags, updated the given number of days before now
+func testMOCNote(t *testing.T, title, text string, daysAgo int, tags ...*items.Tag) *items.Note {
+	t.Helper()
+
+	note, err := items.NewNote(title, text, nil)
+	require.NoError(t, err)
+
+	note.UpdatedAtTimestamp = time.Now().AddDate(0, 0, -daysAgo).UnixMicro()
+
+	for _, tag := range tags {
+		tag.Content.SetReferences(append(tag.Content.References(), items.ItemReference{UUID: note.UUID, ContentType: common.SNItemTypeNote}))
+	}
+
+	return &note
+}
+
+// testMOCTag returns a tag, nested under the parent if given
+func testMOCTag(t *testing.T, title string, parent *items.Tag) *items.Tag {
+	t.Helper()
+
+	var refs items.ItemReferences
+	if parent != nil {
+		refs = items.ItemReferences{{UUID: parent.UUID, ContentType: common.SNItemTypeTag, ReferenceType: tagParentReferenceType}}
+	}
+
+	tag, err := items.NewTag(title, refs)
+	require.NoError(t, err)
+
+	return &tag
+}
+
+func mocByTitle(mocs []MOCFile, title string) *MOCFile {
+	for i := range mocs {
+		if mocs[i].Title == title {
+			return &mocs[i]
+		}
+	}
+
+	return nil
+}
+
+func TestMOCBuilder_Hierarchical(t *testing.T) {
+	work := testMOCTag(t, "work", nil)
+	projects := testMOCTag(t, "projects", work)
+	launch := testMOCTag(t, "launch", projects)
+	home := testMOCTag(t, "home", nil)
+
+	all := items.Items{
+		testMOCNote(t, "Standup", "", 1, work),
+		testMOCNote(t, "Design doc", "", 1, projects),
+		testMOCNote(t, "Roadmap", "", 1, projects),
+		testMOCNote(t, "Press release", "", 1, launch),
+		testMOCNote(t, "Groceries", "", 1, home),
+		work, projects, launch, home,
+	}
+
+	mocs, err := NewMOCBuilder(all, MOCConfig{Style: MOCStyleHierarchical, MaxDepth: 2, MinNotesPerMOC: 2}).Generate()
+	require.NoError(t, err)
+
+	var titles []string
+	for _, moc := range mocs {
+		titles = append(titles, moc.Title)
+	}
+
+	// home has too few notes, and launch is deeper than the maximum depth
+	assert.Equal(t, []string{"Home", "Work MOC", "Work - Projects MOC"}, titles)
+
+	assert.Contains(t, mocs[0].Content, "## 📂 Tags\n\n- 💼 [[Work MOC]] (4 notes)\n  - 🚀 [[Work - Projects MOC]] (3 notes)\n")
+
+	assert.Contains(t, mocs[1].Content, "⬆️ [[Home]]\n\n## 📂 Subtopics\n\n- 🚀 [[Work - Projects MOC]] (3 notes)\n\n## Notes\n\n- [[Standup]]\n")
+
+	assert.Contains(t, mocs[2].Content, "⬆️ [[Work MOC]]\n")
+	assert.Contains(t, mocs[2].Content, "## Notes\n\n- [[Design doc]]\n- [[Roadmap]]\n\n### Launch\n\n- [[Press release]]\n")
+	assert.Contains(t, mocs[2].Content, "**Tagged Notes**: #work/projects (3 notes)")
+	assert.Equal(t, "Work - Projects MOC.md", mocs[2].Filename)
+
+	shallow, err := NewMOCBuilder(all, MOCConfig{Style: MOCStyleHierarchical, MaxDepth: 1, MinNotesPerMOC: 2}).Generate()
+	require.NoError(t, err)
+	require.Len(t, shallow, 2)
+	assert.Contains(t, shallow[1].Content, "### Projects\n\n- [[Design doc]]\n- [[Press release]]\n- [[Roadmap]]\n")
+}
+
+func TestMOCBuilder_PARA(t *testing.T) {
+	projects := testMOCTag(t, "Projects", nil)
+	website := testMOCTag(t, "website", projects)
+	areas := testMOCTag(t, "areas", nil)
+	archive := testMOCTag(t, "archive", nil)
+	health := testMOCTag(t, "health", nil)
+
+	archived := testMOCNote(t, "Old plan", "", 1, health)
+	archived.Archived = true
+
+	all := items.Items{
+		testMOCNote(t, "Redesign", "", 200, website),
+		testMOCNote(t, "Budget", "", 500, areas),
+		testMOCNote(t, "2024 taxes", "", 1, archive),
+		archived,
+		testMOCNote(t, "Gym plan", "- [ ] book classes", 2, health),
+		testMOCNote(t, "Diet", "", 10, health),
+		testMOCNote(t, "Old recipe", "", 400),
+		testMOCNote(t, "Poems", "", 10),
+		projects, website, areas, archive, health,
+	}
+
+	builder := NewMOCBuilder(all, MOCConfig{Style: MOCStylePARA, MinNotesPerMOC: 1})
+
+	mocs, err := builder.Generate()
+	require.NoError(t, err)
+	require.Len(t, mocs, 5)
+
+	assert.Contains(t, mocs[0].Content, "## 🗂️ PARA\n\n- 🚀 [[Projects MOC]] (2 notes)")
+	assert.Contains(t, mocs[0].Content, "- 🗄️ [[Archives MOC]] (3 notes)")
+
+	// PARA tags decide before recency, grouped by the tag below them
+	assert.Equal(t, "Projects MOC", mocs[1].Title)
+	assert.Contains(t, mocs[1].Content, "## Health\n\n- [[Gym plan]]\n\n## Website\n\n- [[Redesign]]\n")
+
+	assert.Contains(t, mocByTitle(mocs, "Areas MOC").Content, "## Health\n\n- [[Diet]]\n\n## Other\n\n- [[Budget]]\n")
+	assert.Contains(t, mocByTitle(mocs, "Resources MOC").Content, "- [[Poems]]\n")
+	assert.Contains(t, mocByTitle(mocs, "Archives MOC").Content, "## Health\n\n- [[Old plan]]\n\n## Other\n\n- [[2024 taxes]]\n- [[Old recipe]]\n")
+}
+
+// testTopicNotes returns untagged notes on two topics, and one on neither
+func testTopicNotes(t *testing.T) items.Items {
+	t.Helper()
+
+	var all items.Items
+
+	for _, title := range []string{
+		"Kubernetes upgrade", "Kubernetes rollout", "Kubernetes monitoring",
+		"Sourdough starter", "Sourdough flour", "Sourdough oven",
+		"Holiday",
+	} {
+		all = append(all, testMOCNote(t, title, strings.ToLower(strings.Fields(title)[0]), 1))
+	}
+
+	return all
+}
+
+func TestMOCBuilder_Topic(t *testing.T) {
+	mocs, err := NewMOCBuilder(testTopicNotes(t), MOCConfig{Style: MOCStyleTopicBased, MinNotesPerMOC: 2}).Generate()
+	require.NoError(t, err)
+
+	assert.Contains(t, mocs[0].Content, "## 🎯 Topics\n\n- 📝 [[Kubernetes MOC]] (3 notes)\n- 📝 [[Sourdough MOC]] (3 notes)\n- 📄 [[Other Notes MOC]] (1 notes)\n")
+
+	kubernetes := mocByTitle(mocs, "Kubernetes MOC")
+	require.NotNil(t, kubernetes)
+	assert.Contains(t, kubernetes.Content, "## 📄 Notes\n\n- [[Kubernetes monitoring]]\n- [[Kubernetes rollout]]\n- [[Kubernetes upgrade]]\n")
+
+	// each note is listed under one topic only
+	listed := make(map[string]int)
+
+	for _, moc := range mocs[1:] {
+		for _, line := range strings.Split(moc.Content, "\n") {
+			if strings.HasPrefix(line, "- [[") && !strings.Contains(line, "MOC]]") {
+				listed[line]++
+			}
+		}
+	}
+
+	assert.Len(t, listed, 7)
+
+	for line, count := range listed {
+		assert.Equal(t, 1, count, line)
+	}
+
+	assert.Contains(t, mocByTitle(mocs, "Other Notes MOC").Content, "- [[Holiday]]\n")
+}
+
+func TestMOCBuilder_ChooseStyle(t *testing.T) {
+	projects := testMOCTag(t, "projects", nil)
+	areas := testMOCTag(t, "areas", nil)
+	work := testMOCTag(t, "work", nil)
+	meetings := testMOCTag(t, "meetings", work)
+
+	para := items.Items{testMOCNote(t, "A", "", 1, projects), testMOCNote(t, "B", "", 1, areas), projects, areas}
+
+	style, reason := NewMOCBuilder(para, MOCConfig{}).ChooseStyle()
+	assert.Equal(t, MOCStylePARA, style)
+	assert.Equal(t, "the top-level tags areas, projects follow the PARA method", reason)
+
+	nested := items.Items{testMOCNote(t, "A", "", 1, meetings), work, meetings}
+
+	style, reason = NewMOCBuilder(nested, MOCConfig{}).ChooseStyle()
+	assert.Equal(t, MOCStyleHierarchical, style)
+	assert.Equal(t, "1 tags are nested under other tags", reason)
+
+	flat := items.Items{testMOCNote(t, "A", "", 1, work), work}
+
+	style, _ = NewMOCBuilder(flat, MOCConfig{}).ChooseStyle()
+	assert.Equal(t, MOCStyleFlat, style)
+
+	style, reason = NewMOCBuilder(testTopicNotes(t), MOCConfig{}).ChooseStyle()
+	assert.Equal(t, MOCStyleTopicBased, style)
+	assert.Equal(t, "only 0 of 7 notes are tagged, so their content is used instead", reason)
+
+	mocs, err := NewMOCBuilder(para, MOCConfig{Style: MOCStyleAuto, MinNotesPerMOC: 1}).Generate()
+	require.NoError(t, err)
+	assert.Contains(t, mocs[0].Content, "*Organized with para MOCs, as the top-level tags areas, projects follow the PARA method.*")
+	assert.NotNil(t, mocByTitle(mocs, "Projects MOC"))
+}
+
+func TestContentAnalyzer_ExtractWords(t *testing.T) {
+	ca := NewContentAnalyzer(nil)
+
+	// markdown emphasis and link targets are dropped, but the spaces between words are kept; stripping
+	// spaces along with the emphasis characters turned each line into a single word
+	assert.Equal(t, []string{"kubernetes", "cluster", "upgrade", "runbook"},
+		ca.extractWords("**Kubernetes** cluster _upgrade_ [runbook](https://example.com/runbook)"))
+
+	// so notes that share a word, but not a whole line, share a keyword
+	df := ca.calculateKeywordDF(map[string]string{
+		"a": "Kubernetes cluster upgrade",
+		"b": "Kubernetes node drain",
+	})
+	assert.Equal(t, 2, df["kubernetes"])
+	assert.Equal(t, 1, df["cluster"])
+	assert.Zero(t, df["kubernetesclusterupgrade"])
+}
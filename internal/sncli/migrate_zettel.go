@@ -0,0 +1,158 @@
+package sncli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// zettelIDLayout is the timestamp each note's ID is made from
+const zettelIDLayout = "20060102150405"
+
+// ZettelExporter implements the Provider interface for a plain Zettelkasten. Each note is named
+// with a timestamp ID from when it was created, followed by its title, and notes link by ID.
+type ZettelExporter struct {
+	outputDir string
+	ids       map[string]string // note title to ID
+	used      map[string]bool   // IDs given
+}
+
+// NewZettelExporter creates a new Zettelkasten exporter.
+func NewZettelExporter(outputDir string) *ZettelExporter {
+	return &ZettelExporter{
+		outputDir: outputDir,
+		ids:       make(map[string]string),
+		used:      make(map[string]bool),
+	}
+}
+
+// Name returns the provider name.
+func (z *ZettelExporter) Name() string {
+	return "zettel"
+}
+
+// Validate checks if the exporter configuration is valid.
+func (z *ZettelExporter) Validate() error {
+	if z.outputDir == "" {
+		return fmt.Errorf("output directory is required")
+	}
+
+	return nil
+}
+
+// Export exports notes as Zettelkasten notes.
+func (z *ZettelExporter) Export(notes items.Items, config MigrationExportConfig) error {
+	for _, item := range notes {
+		note, ok := item.(*items.Note)
+		if !ok {
+			continue
+		}
+
+		created, updated := itemTimes(note)
+		id := z.uniqueID(created)
+
+		if _, taken := z.ids[strings.ToLower(note.Content.GetTitle())]; !taken {
+			z.ids[strings.ToLower(note.Content.GetTitle())] = id
+		}
+
+		tags := extractNoteTags(note, notes)
+
+		var sb strings.Builder
+
+		sb.WriteString("---\n")
+		sb.WriteString(fmt.Sprintf("id: \"%s\"\n", id))
+		sb.WriteString(fmt.Sprintf("title: \"%s\"\n", escapeYAMLString(note.Content.GetTitle())))
+
+		if len(tags) > 0 && (config.TagStyle == TagStyleFrontmatter || config.TagStyle == TagStyleBoth) {
+			quoted := make([]string, len(tags))
+			for i, tag := range tags {
+				quoted[i] = fmt.Sprintf("\"%s\"", escapeYAMLString(tag))
+			}
+
+			sb.WriteString(fmt.Sprintf("tags: [%s]\n", strings.Join(quoted, ", ")))
+		}
+
+		sb.WriteString(fmt.Sprintf("created: %s\n", created.Format(time.RFC3339)))
+		sb.WriteString(fmt.Sprintf("updated: %s\n", updated.Format(time.RFC3339)))
+
+		if config.PreserveUUID {
+			sb.WriteString(fmt.Sprintf("uuid: %s\n", note.UUID))
+		}
+
+		sb.WriteString("---\n\n")
+		sb.WriteString(fmt.Sprintf("# %s\n\n", note.Content.GetTitle()))
+		sb.WriteString(note.Content.GetText())
+
+		if len(tags) > 0 && (config.TagStyle == TagStyleInline || config.TagStyle == TagStyleBoth) {
+			sb.WriteString("\n\n")
+
+			for _, tag := range tags {
+				sb.WriteString(fmt.Sprintf("#%s ", strings.ReplaceAll(tag, " ", "-")))
+			}
+		}
+
+		filename := zettelFilename(id, note.Content.GetTitle())
+
+		if !config.DryRun {
+			if err := os.WriteFile(filepath.Join(config.OutputDir, filename), []byte(sb.String()), 0644); err != nil {
+				return fmt.Errorf("failed to write note %s: %w", filename, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GenerateMOCs generates Maps of Content as structure notes, linking to notes by ID.
+func (z *ZettelExporter) GenerateMOCs(notes items.Items, config MOCConfig) ([]MOCFile, error) {
+	mocs, err := NewMOCBuilder(notes, config).Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, moc := range mocs {
+		mocs[i].Content = rewriteWikilinks(moc.Content, func(target string) string {
+			if id, ok := z.ids[strings.ToLower(target)]; ok {
+				return fmt.Sprintf("[[%s]] %s", id, target)
+			}
+
+			return ""
+		})
+	}
+
+	return mocs, nil
+}
+
+// uniqueID returns the ID for a note created at the time, a second later for each note already
+// given it, so notes created together keep the order they were created in
+func (z *ZettelExporter) uniqueID(created time.Time) string {
+	id := created.Format(zettelIDLayout)
+
+	for z.used[id] {
+		created = created.Add(time.Second)
+		id = created.Format(zettelIDLayout)
+	}
+
+	z.used[id] = true
+
+	return id
+}
+
+// zettelFilename returns the file name for a note, its ID followed by its title
+func zettelFilename(id, title string) string {
+	title = strings.Join(strings.Fields(invalidFilenameChars.ReplaceAllString(title, "-")), " ")
+
+	if len(title) > 200 {
+		title = title[:200]
+	}
+
+	if title == "" {
+		return id + ".md"
+	}
+
+	return id + " " + title + ".md"
+}
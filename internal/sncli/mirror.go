@@ -0,0 +1,653 @@
+package sncli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/items"
+	"gopkg.in/yaml.v2"
+)
+
+// MirrorStateFile records what each mirrored note looked like when last synced, relative to the mirror directory
+const MirrorStateFile = ".sn-mirror.json"
+
+const mirrorConflictMarker = ".conflict-"
+
+// MirrorConfig keeps a directory of Markdown files, one per note, in two-way sync with the account.
+// Each file has YAML frontmatter with the note's title, UUID and tags.
+type MirrorConfig struct {
+	Session *cache.Session
+	Dir     string
+	// TagFolders places each note in a folder named after its first tag, following nested tags,
+	// and tags notes moved into a folder with the folder's name
+	TagFolders bool
+	// DryRun reports what would change without writing files or syncing changes
+	DryRun bool
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// MirrorResult lists the paths, relative to the mirror directory, changed by a mirror
+type MirrorResult struct {
+	// Pushed are local files created or edited and sent to the account
+	Pushed []string
+	// Pulled are files written from notes created or edited in the account
+	Pulled []string
+	// Trashed are files deleted locally whose notes were moved to the trash
+	Trashed []string
+	// Removed are files deleted because their notes were deleted or trashed in the account
+	Removed []string
+	// Conflicts are copies of local files that were edited on both sides and replaced by the account's version
+	Conflicts []string
+}
+
+// mirrorState is saved to MirrorStateFile
+type mirrorState struct {
+	Notes map[string]mirrorEntry `json:"notes"`
+}
+
+// mirrorEntry is a note as last synced. Hash is of the file as written, so comparing it with the file
+// shows local edits and comparing it with the note rendered now shows remote ones.
+type mirrorEntry struct {
+	Path    string `json:"path"`
+	Hash    string `json:"hash"`
+	ModTime int64  `json:"mod_time"`
+	Size    int64  `json:"size"`
+}
+
+// mirrorFile is a Markdown file found in the mirror directory
+type mirrorFile struct {
+	path    string
+	data    []byte
+	hash    string
+	modTime int64
+	size    int64
+	// unchanged is set when the file matches the state, so it wasn't read
+	unchanged bool
+}
+
+// mirrorFrontmatter is the YAML at the top of each file
+type mirrorFrontmatter struct {
+	Title string   `yaml:"title"`
+	UUID  string   `yaml:"uuid,omitempty"`
+	Tags  []string `yaml:"tags,omitempty"`
+}
+
+// mirrorPlan is the work found by comparing the files, the notes and the state
+type mirrorPlan struct {
+	lib     *Library
+	state   mirrorState
+	changed items.Items
+	// write holds the files to write, by path, once changes are pushed
+	write map[string][]byte
+	// remove holds the files to delete
+	remove []string
+	// seen holds the notes matched with files
+	seen   map[string]bool
+	result MirrorResult
+}
+
+// Run pulls the account's notes, compares them and the files with the state saved by the last run,
+// and pushes local changes. Where a note and its file have both changed, the account's version is
+// written and the local one kept in a conflict file alongside it.
+func (m *MirrorConfig) Run() (MirrorResult, error) {
+	if m.now == nil {
+		m.now = time.Now
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return MirrorResult{}, fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+
+	lib, err := SyncLibrary(m.Session, nil)
+	if err != nil {
+		return MirrorResult{}, err
+	}
+
+	state, err := m.loadState()
+	if err != nil {
+		return MirrorResult{}, err
+	}
+
+	plan, err := m.plan(lib, state)
+	if err != nil {
+		return MirrorResult{}, err
+	}
+
+	if m.DryRun {
+		return plan.result, nil
+	}
+
+	if len(plan.changed) > 0 {
+		if _, err = SyncLibrary(m.Session, plan.changed); err != nil {
+			return MirrorResult{}, err
+		}
+	}
+
+	return plan.result, m.apply(plan)
+}
+
+// plan works out the changes needed on each side without making them
+func (m *MirrorConfig) plan(lib *Library, state mirrorState) (*mirrorPlan, error) {
+	files, err := m.scan(state)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &mirrorPlan{
+		lib:   lib,
+		state: mirrorState{Notes: make(map[string]mirrorEntry)},
+		write: make(map[string][]byte),
+		seen:  make(map[string]bool),
+	}
+
+	notes := make(map[string]*items.Note)
+
+	for _, note := range lib.Notes {
+		if !NoteTrashed(note) {
+			notes[note.UUID] = note
+		}
+	}
+
+	byPath := make(map[string]string, len(state.Notes))
+	for uuid, entry := range state.Notes {
+		byPath[entry.Path] = uuid
+	}
+
+	// paths taken by files that are kept, so renamed notes don't overwrite them. They're compared
+	// in lower case, as paths that differ only in case are the same file on macOS and Windows.
+	taken := make(map[string]bool, len(files))
+	for _, f := range files {
+		taken[strings.ToLower(f.path)] = true
+	}
+
+	for _, f := range files {
+		uuid, known := byPath[f.path]
+
+		var fm mirrorFrontmatter
+
+		var body string
+
+		if !f.unchanged {
+			fm, body = parseMirrorFile(f.data, f.path)
+			if fm.UUID != "" {
+				uuid = fm.UUID
+				_, known = state.Notes[uuid]
+			}
+		}
+
+		// a file copied from another keeps its UUID, so only the first is matched with the note
+		if uuid != "" && p.seen[uuid] {
+			uuid, known = "", false
+			fm.UUID = ""
+		}
+
+		entry := state.Notes[uuid]
+		note := notes[uuid]
+
+		switch {
+		case uuid == "" || (note == nil && !known):
+			// new locally, or copied from another account
+			if err = m.create(p, f, fm, body); err != nil {
+				return nil, err
+			}
+
+			continue
+		case note == nil:
+			// deleted or trashed in the account
+			if f.unchanged || f.hash == entry.Hash {
+				p.remove = append(p.remove, f.path)
+				p.result.Removed = append(p.result.Removed, f.path)
+
+				continue
+			}
+
+			// edited locally since, so keep the edits as a new note
+			fm.UUID = ""
+			if err = m.create(p, f, fm, body); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		p.seen[uuid] = true
+
+		remote := m.render(lib, note)
+		remoteHash := mirrorHash(remote)
+		// with tag folders, moving a file is a change as it tags the note
+		moved := m.TagFolders && f.path != entry.Path
+		localChanged := !f.unchanged && (f.hash != entry.Hash || moved)
+		remoteChanged := remoteHash != entry.Hash
+
+		if !known {
+			// first seen, such as a file exported with its UUID, so only the title and text can be compared
+			localChanged = fm.Title != note.Content.GetTitle() || body != note.Content.GetText()
+			remoteChanged = true
+		}
+
+		switch {
+		case !localChanged && !remoteChanged:
+			p.state.Notes[uuid] = mirrorEntry{Path: f.path, Hash: remoteHash, ModTime: f.modTime, Size: f.size}
+		case localChanged && !remoteChanged:
+			if err = m.push(p, note, f, fm, body); err != nil {
+				return nil, err
+			}
+		case localChanged && f.hash != remoteHash:
+			conflict := m.conflictPath(f.path)
+			p.write[conflict] = f.data
+			p.result.Conflicts = append(p.result.Conflicts, conflict)
+
+			fallthrough
+		default:
+			m.pull(p, note, f.path, remote, taken)
+		}
+	}
+
+	// files deleted locally, and notes new in the account
+	for _, note := range lib.Notes {
+		if p.seen[note.UUID] || NoteTrashed(note) {
+			continue
+		}
+
+		p.seen[note.UUID] = true
+
+		remote := m.render(lib, note)
+
+		if entry, ok := state.Notes[note.UUID]; ok && mirrorHash(remote) == entry.Hash {
+			p.changed = append(p.changed, lib.TrashNote(note, true)...)
+			p.result.Trashed = append(p.result.Trashed, entry.Path)
+
+			continue
+		}
+
+		m.pull(p, note, "", remote, taken)
+	}
+
+	for _, list := range [][]string{p.result.Pushed, p.result.Pulled, p.result.Trashed, p.result.Removed, p.result.Conflicts} {
+		sort.Strings(list)
+	}
+
+	return p, nil
+}
+
+// create adds a note for a file without one
+func (m *MirrorConfig) create(p *mirrorPlan, f mirrorFile, fm mirrorFrontmatter, body string) error {
+	note, err := items.NewNote(fm.Title, body, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+
+	changed := items.Items{&note}
+
+	if titles := m.fileTags(f.path, fm); len(titles) > 0 {
+		tags, err := p.lib.TagNote(&note, titles)
+		if err != nil {
+			return err
+		}
+
+		changed = append(changed, tags...)
+	}
+
+	p.changed = append(p.changed, changed...)
+	p.lib.Apply(changed)
+	p.seen[note.UUID] = true
+
+	// rewrite the file with the new UUID
+	data := m.render(p.lib, p.lib.Note(note.UUID))
+	p.write[f.path] = data
+	p.state.Notes[note.UUID] = mirrorEntry{Path: f.path, Hash: mirrorHash(data)}
+	p.result.Pushed = append(p.result.Pushed, f.path)
+
+	return nil
+}
+
+// push updates the note and its tags from the edited file
+func (m *MirrorConfig) push(p *mirrorPlan, note *items.Note, f mirrorFile, fm mirrorFrontmatter, body string) error {
+	changed := p.lib.EditNote(note, fm.Title, body)
+	edited := changed[0].(*items.Note)
+
+	want := m.fileTags(f.path, fm)
+
+	var add []string
+
+	for _, title := range want {
+		if !StringInSlice(title, p.lib.NoteTags(note.UUID), true) {
+			add = append(add, title)
+		}
+	}
+
+	if len(add) > 0 {
+		tags, err := p.lib.TagNote(edited, add)
+		if err != nil {
+			return err
+		}
+
+		changed = append(changed, tags...)
+	}
+
+	changed = append(changed, p.lib.UntagNote(edited, want)...)
+
+	p.changed = append(p.changed, changed...)
+	p.lib.Apply(changed)
+
+	// rewrite the file in case the tags were tidied, such as by case
+	data := m.render(p.lib, p.lib.Note(note.UUID))
+	if !bytes.Equal(data, f.data) {
+		p.write[f.path] = data
+	}
+
+	p.state.Notes[note.UUID] = mirrorEntry{Path: f.path, Hash: mirrorHash(data)}
+	p.result.Pushed = append(p.result.Pushed, f.path)
+
+	return nil
+}
+
+// pull writes the note's file, moving it if the title or tags now give it another path
+func (m *MirrorConfig) pull(p *mirrorPlan, note *items.Note, current string, data []byte, taken map[string]bool) {
+	path := m.notePath(p.lib, note)
+
+	if path != current {
+		// the note's own file is free, so a change of case alone doesn't get a new name
+		if current != "" {
+			p.remove = append(p.remove, current)
+			delete(taken, strings.ToLower(current))
+		}
+
+		path = uniqueMirrorPath(path, note.UUID, taken)
+		taken[strings.ToLower(path)] = true
+	}
+
+	p.write[path] = data
+	p.state.Notes[note.UUID] = mirrorEntry{Path: path, Hash: mirrorHash(data)}
+	p.result.Pulled = append(p.result.Pulled, path)
+}
+
+// apply writes and removes the planned files and saves the state
+func (m *MirrorConfig) apply(p *mirrorPlan) error {
+	for _, path := range p.remove {
+		if _, ok := p.write[path]; ok {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(m.Dir, path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	for path, data := range p.write {
+		full := filepath.Join(m.Dir, path)
+
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(full, data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	// record the files as written so unchanged ones aren't read next time
+	for uuid, entry := range p.state.Notes {
+		info, err := os.Stat(filepath.Join(m.Dir, entry.Path))
+		if err != nil {
+			continue
+		}
+
+		entry.ModTime = info.ModTime().UnixNano()
+		entry.Size = info.Size()
+		p.state.Notes[uuid] = entry
+	}
+
+	data, err := json.MarshalIndent(p.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(m.Dir, MirrorStateFile), data, 0o600)
+}
+
+func (m *MirrorConfig) loadState() (mirrorState, error) {
+	state := mirrorState{Notes: make(map[string]mirrorEntry)}
+
+	data, err := os.ReadFile(filepath.Join(m.Dir, MirrorStateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if err = json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to read %s: %w", MirrorStateFile, err)
+	}
+
+	if state.Notes == nil {
+		state.Notes = make(map[string]mirrorEntry)
+	}
+
+	return state, nil
+}
+
+// scan returns the Markdown files in the mirror directory, reading only those that differ
+// in size or modification time from the state
+func (m *MirrorConfig) scan(state mirrorState) ([]mirrorFile, error) {
+	known := make(map[string]mirrorEntry, len(state.Notes))
+	for _, entry := range state.Notes {
+		known[entry.Path] = entry
+	}
+
+	var files []mirrorFile
+
+	err := filepath.WalkDir(m.Dir, func(full string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if full != m.Dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !strings.EqualFold(filepath.Ext(full), ".md") || strings.Contains(d.Name(), mirrorConflictMarker) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(m.Dir, full)
+		if err != nil {
+			return err
+		}
+
+		f := mirrorFile{path: filepath.ToSlash(rel), modTime: info.ModTime().UnixNano(), size: info.Size()}
+
+		if entry, ok := known[f.path]; ok && entry.ModTime == f.modTime && entry.Size == f.size {
+			f.unchanged = true
+			f.hash = entry.Hash
+		} else {
+			if f.data, err = os.ReadFile(full); err != nil {
+				return err
+			}
+
+			f.hash = mirrorHash(f.data)
+		}
+
+		files = append(files, f)
+
+		return nil
+	})
+
+	return files, err
+}
+
+// render returns the file for the note
+func (m *MirrorConfig) render(lib *Library, note *items.Note) []byte {
+	fm := mirrorFrontmatter{
+		Title: note.Content.GetTitle(),
+		UUID:  note.UUID,
+		Tags:  lib.NoteTags(note.UUID),
+	}
+
+	// marshalling a struct of strings can't fail
+	header, _ := yaml.Marshal(fm)
+
+	var buf bytes.Buffer
+
+	buf.WriteString("---\n")
+	buf.Write(header)
+	buf.WriteString("---\n\n")
+	buf.WriteString(note.Content.GetText())
+
+	return buf.Bytes()
+}
+
+// notePath returns where the note's file belongs, relative to the mirror directory
+func (m *MirrorConfig) notePath(lib *Library, note *items.Note) string {
+	name := sanitizeFilename(note.Content.GetTitle())
+	if name == "" {
+		name = note.UUID
+	}
+
+	name += ".md"
+
+	if !m.TagFolders {
+		return name
+	}
+
+	tags := lib.NoteTags(note.UUID)
+	if len(tags) == 0 {
+		return name
+	}
+
+	folders := []string{name}
+
+	// follow the first tag's parents up to the top of the hierarchy
+	tag := lib.tag(tags[0])
+
+	for visited := make(map[string]bool); tag != nil && !visited[tag.UUID]; tag = lib.tagByUUID(tagParent(tag)) {
+		visited[tag.UUID] = true
+		folders = append(folders, sanitizeFilename(tag.Content.GetTitle()))
+	}
+
+	slices.Reverse(folders)
+
+	return strings.Join(folders, "/")
+}
+
+// fileTags returns the tags in the file's frontmatter and, with tag folders, the tag of its folder
+func (m *MirrorConfig) fileTags(path string, fm mirrorFrontmatter) []string {
+	tags := slices.Clone(fm.Tags)
+
+	if dir := filepath.Base(filepath.Dir(filepath.FromSlash(path))); m.TagFolders && dir != "." {
+		if !StringInSlice(dir, tags, true) {
+			tags = append(tags, dir)
+		}
+	}
+
+	return tags
+}
+
+func (m *MirrorConfig) conflictPath(path string) string {
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + mirrorConflictMarker + m.now().UTC().Format("20060102-150405") + ext
+}
+
+// parseMirrorFile splits the file into its frontmatter and body, defaulting the title to the file name
+func parseMirrorFile(data []byte, path string) (mirrorFrontmatter, string) {
+	var fm mirrorFrontmatter
+
+	header, body := splitFrontmatter(string(data))
+	if header != "" {
+		// files with frontmatter that isn't YAML are taken as they are
+		if err := yaml.Unmarshal([]byte(header), &fm); err != nil {
+			fm, body = mirrorFrontmatter{}, string(data)
+		}
+	}
+
+	fm.Title = strings.TrimSpace(fm.Title)
+	if fm.Title == "" {
+		fm.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	for i := range fm.Tags {
+		fm.Tags[i] = strings.TrimSpace(fm.Tags[i])
+	}
+
+	fm.Tags = slices.DeleteFunc(fm.Tags, func(tag string) bool {
+		return tag == ""
+	})
+
+	return fm, body
+}
+
+// splitFrontmatter returns the YAML between the leading --- lines, if there are any, and the text after
+// them, less the blank line that separates them
+func splitFrontmatter(text string) (string, string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	if !strings.HasPrefix(text, "---\n") {
+		return "", text
+	}
+
+	end := strings.Index(text[4:], "\n---")
+	if end < 0 {
+		return "", text
+	}
+
+	header := text[4 : 4+end+1]
+	rest := text[4+end+4:]
+
+	if !strings.HasPrefix(rest, "\n") && rest != "" {
+		// --- followed by more on the same line isn't the end
+		return "", text
+	}
+
+	rest = strings.TrimPrefix(rest, "\n")
+	rest = strings.TrimPrefix(rest, "\n")
+
+	return header, rest
+}
+
+// uniqueMirrorPath returns the path, or if it's taken, the path with part of the UUID added.
+// Taken paths are keyed in lower case.
+func uniqueMirrorPath(path, uuid string, taken map[string]bool) string {
+	if !taken[strings.ToLower(path)] {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	short := uuid
+	if len(short) > 8 {
+		short = short[:8]
+	}
+
+	return fmt.Sprintf("%s (%s)%s", strings.TrimSuffix(path, ext), short, ext)
+}
+
+func mirrorHash(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
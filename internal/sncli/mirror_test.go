@@ -0,0 +1,173 @@
+package sncli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mirrorRound runs a mirror against the library, applying the changes to it as a sync would
+func mirrorRound(t *testing.T, m *MirrorConfig, lib *Library) MirrorResult {
+	t.Helper()
+
+	state, err := m.loadState()
+	require.NoError(t, err)
+
+	p, err := m.plan(lib, state)
+	require.NoError(t, err)
+	require.NoError(t, m.apply(p))
+
+	lib.Apply(p.changed)
+
+	return p.result
+}
+
+func readMirrorFile(t *testing.T, m *MirrorConfig, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(m.Dir, path))
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func writeMirrorFile(t *testing.T, m *MirrorConfig, path, content string) {
+	t.Helper()
+
+	full := filepath.Join(m.Dir, path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(full), 0o755))
+	require.NoError(t, os.WriteFile(full, []byte(content), 0o644))
+}
+
+func TestMirror(t *testing.T) {
+	lib := testLibrary(t)
+	m := &MirrorConfig{
+		Dir: t.TempDir(),
+		now: func() time.Time {
+			return time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+		},
+	}
+
+	writeMirrorFile(t, m, "Ideas.md", "---\ntags: [home, Later]\n---\n\nrewrite the docs\n")
+
+	result := mirrorRound(t, m, lib)
+	assert.Equal(t, []string{"Ideas.md"}, result.Pushed)
+	assert.Equal(t, []string{"Design doc.md", "Groceries.md", "Standup.md"}, result.Pulled)
+	assert.Equal(t, "---\ntitle: Standup\nuuid: note-Standup\ntags:\n- work\n---\n\nStandup text", readMirrorFile(t, m, "Standup.md"))
+
+	// the new note is tagged, using the existing tag's title, and its file gets the UUID
+	var ideas *items.Note
+
+	for _, note := range lib.Notes {
+		if note.Content.GetTitle() == "Ideas" {
+			ideas = note
+		}
+	}
+
+	require.NotNil(t, ideas)
+	assert.Equal(t, "rewrite the docs\n", ideas.Content.GetText())
+	assert.Equal(t, []string{"Home", "Later"}, lib.NoteTags(ideas.UUID))
+	assert.Contains(t, readMirrorFile(t, m, "Ideas.md"), "uuid: "+ideas.UUID+"\n")
+
+	// nothing changes when run again
+	assert.Equal(t, MirrorResult{}, mirrorRound(t, m, lib))
+
+	// edit locally, retag, edit remotely and delete a file
+	writeMirrorFile(t, m, "Standup.md", "---\ntitle: Standup\nuuid: note-Standup\ntags: [projects]\n---\n\nStandup text, edited\n")
+	lib.Apply(lib.EditNote(lib.Note("note-Groceries"), "Shopping", "milk"))
+	require.NoError(t, os.Remove(filepath.Join(m.Dir, "Ideas.md")))
+
+	result = mirrorRound(t, m, lib)
+	assert.Equal(t, []string{"Standup.md"}, result.Pushed)
+	assert.Equal(t, []string{"Shopping.md"}, result.Pulled)
+	assert.Equal(t, []string{"Ideas.md"}, result.Trashed)
+
+	assert.Equal(t, "Standup text, edited\n", lib.Note("note-Standup").Content.GetText())
+	assert.Equal(t, []string{"projects"}, lib.NoteTags("note-Standup"))
+	assert.True(t, NoteTrashed(lib.Note(ideas.UUID)))
+	assert.NoFileExists(t, filepath.Join(m.Dir, "Groceries.md"))
+	assert.Contains(t, readMirrorFile(t, m, "Shopping.md"), "\nmilk")
+
+	// edited on both sides
+	writeMirrorFile(t, m, "Shopping.md", "---\ntitle: Shopping\nuuid: note-Groceries\n---\n\nmilk, eggs")
+	lib.Apply(lib.EditNote(lib.Note("note-Groceries"), "Shopping", "milk, bread"))
+
+	result = mirrorRound(t, m, lib)
+	assert.Equal(t, []string{"Shopping.conflict-20261017-090000.md"}, result.Conflicts)
+	assert.Contains(t, readMirrorFile(t, m, "Shopping.md"), "milk, bread")
+	assert.Contains(t, readMirrorFile(t, m, "Shopping.conflict-20261017-090000.md"), "milk, eggs")
+	assert.Equal(t, "milk, bread", lib.Note("note-Groceries").Content.GetText())
+
+	// deleted in the account
+	lib.Apply(lib.DeleteNote(lib.Note("note-Design doc")))
+
+	result = mirrorRound(t, m, lib)
+	assert.Equal(t, []string{"Design doc.md"}, result.Removed)
+	assert.NoFileExists(t, filepath.Join(m.Dir, "Design doc.md"))
+}
+
+func TestMirrorPathsIgnoreCase(t *testing.T) {
+	lib := testLibrary(t)
+	m := &MirrorConfig{Dir: t.TempDir()}
+
+	mirrorRound(t, m, lib)
+
+	// on macOS and Windows standup.md is the same file as Standup.md, so it isn't overwritten
+	lib.Apply(lib.EditNote(lib.Note("note-Groceries"), "standup", "milk"))
+
+	result := mirrorRound(t, m, lib)
+	assert.Equal(t, []string{"standup (note-Gro).md"}, result.Pulled)
+	assert.Contains(t, readMirrorFile(t, m, "Standup.md"), "Standup text")
+
+	// a note whose title only changes case keeps its name
+	lib.Apply(lib.EditNote(lib.Note("note-Standup"), "STANDUP", "Standup text"))
+
+	result = mirrorRound(t, m, lib)
+	assert.Equal(t, []string{"STANDUP.md"}, result.Pulled)
+	assert.NoFileExists(t, filepath.Join(m.Dir, "Standup.md"))
+}
+
+func TestMirrorTagFolders(t *testing.T) {
+	lib := testLibrary(t)
+	m := &MirrorConfig{Dir: t.TempDir(), TagFolders: true}
+
+	mirrorRound(t, m, lib)
+
+	// nested tags become nested folders
+	assert.FileExists(t, filepath.Join(m.Dir, "work", "Standup.md"))
+	assert.FileExists(t, filepath.Join(m.Dir, "work", "projects", "Design doc.md"))
+	assert.FileExists(t, filepath.Join(m.Dir, "Groceries.md"))
+
+	// a note moved into a folder is given the folder's tag
+	require.NoError(t, os.Mkdir(filepath.Join(m.Dir, "Home"), 0o755))
+	require.NoError(t, os.Rename(filepath.Join(m.Dir, "Groceries.md"), filepath.Join(m.Dir, "Home", "Groceries.md")))
+
+	result := mirrorRound(t, m, lib)
+	assert.Equal(t, []string{"Home/Groceries.md"}, result.Pushed)
+	assert.Equal(t, []string{"Home"}, lib.NoteTags("note-Groceries"))
+}
+
+func TestSplitFrontmatter(t *testing.T) {
+	for _, tc := range []struct {
+		text, header, body string
+	}{
+		{"---\ntitle: a\n---\n\nbody", "title: a\n", "body"},
+		{"---\r\ntitle: a\r\n---\r\nbody\r\n", "title: a\n", "body\n"},
+		{"---\ntitle: a\n---", "title: a\n", ""},
+		{"no frontmatter\n---\n", "", "no frontmatter\n---\n"},
+		{"---\nunterminated", "", "---\nunterminated"},
+	} {
+		header, body := splitFrontmatter(tc.text)
+		assert.Equal(t, tc.header, header, tc.text)
+		assert.Equal(t, tc.body, body, tc.text)
+	}
+
+	fm, body := parseMirrorFile([]byte("---\ntags: [ a , '' ]\n---\ntext"), "notes/Title.md")
+	assert.Equal(t, mirrorFrontmatter{Title: "Title", Tags: []string{"a"}}, fm)
+	assert.Equal(t, "text", body)
+}
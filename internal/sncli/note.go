@@ -14,6 +14,13 @@ import (
 )
 
 func (i *AddNoteInput) Run() error {
+	_, err := i.add()
+
+	return err
+}
+
+// add adds the note, returning its UUID
+func (i *AddNoteInput) add() (string, error) {
 	// get DB
 	var syncToken string
 
@@ -28,7 +35,7 @@ func (i *AddNoteInput) Run() error {
 
 	newNoteUUID, err := addNote(ani)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if len(ani.tagTitles) > 0 {
@@ -39,11 +46,11 @@ func (i *AddNoteInput) Run() error {
 			newTags:        i.Tags,
 			replace:        i.Replace,
 		}); err != nil {
-			return err
+			return "", err
 		}
 	}
 
-	return nil
+	return newNoteUUID, nil
 }
 
 type addNoteInput struct {
@@ -129,6 +136,7 @@ func addNote(i addNoteInput) (string, error) {
 		case 1:
 			noteToAdd = gi.Notes()[0]
 			noteToAdd.Content.SetText(i.noteText)
+			noteUUID = noteToAdd.UUID
 		default:
 			return "", errors.New("multiple notes found with that title")
 		}
@@ -208,6 +216,17 @@ func (i *DeleteNoteConfig) Run() (int, error) {
 }
 
 func (i *GetNoteConfig) Run() (items.Items, error) {
+	if i.Offline {
+		items, err := LoadCachedItems(i.Session)
+		if err != nil {
+			return nil, err
+		}
+
+		items.Filter(i.Filters)
+
+		return items, nil
+	}
+
 	var so cache.SyncOutput
 	var err error
 	so, err = Sync(cache.SyncInput{
@@ -2,6 +2,8 @@ package sncli
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -380,6 +382,35 @@ func TestGetNote(t *testing.T) {
 
 	require.EqualValues(t, 1, len(output))
 	t.Logf("Successfully retrieved note via GetNoteConfig")
+
+	// reading offline must load the items keys from the cache rather than rely on the session
+	offlineSession := *testSession
+	gs := *testSession.Session
+	gs.ItemsKeys = nil
+	gs.DefaultItemsKey = session.SessionItemsKey{}
+	offlineSession.Session = &gs
+
+	getNoteConfig.Session = &offlineSession
+	getNoteConfig.Offline = true
+
+	output, err = getNoteConfig.Run()
+	require.NoError(t, err)
+	require.Len(t, output, 1)
+	require.Equal(t, note.UUID, output[0].GetUUID())
+}
+
+func TestGetNoteOfflineWithoutCache(t *testing.T) {
+	s := cache.Session{CacheDBPath: filepath.Join(t.TempDir(), "missing.db")}
+
+	_, err := (&GetNoteConfig{Session: &s, Offline: true}).Run()
+	require.ErrorIs(t, err, ErrNoCache)
+
+	// the missing cache must not be created
+	_, statErr := os.Stat(s.CacheDBPath)
+	require.True(t, os.IsNotExist(statErr))
+
+	_, err = (&GetTagConfig{Session: &cache.Session{}, Offline: true}).Run()
+	require.ErrorIs(t, err, ErrNoCache)
 }
 
 //func TestCreateOneHundredNotes(t *testing.T) {
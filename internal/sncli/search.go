@@ -0,0 +1,215 @@
+package sncli
+
+import (
+	"fmt"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// SearchConfig holds configuration for a ranked search of notes using the search index
+type SearchConfig struct {
+	Session *cache.Session
+	// Query is parsed with ParseSearchQuery
+	Query string
+	// Tags limits results to notes with any of these tag titles
+	Tags         []string
+	IncludeTrash bool
+	Limit        int
+	// Offline searches the local cache without syncing
+	Offline bool
+	// Scan returns every note matching the query's fields and operators, ignoring its free text,
+	// so the caller can match the text itself
+	Scan  bool
+	Debug bool
+}
+
+// SearchMatch is a note matching a search
+type SearchMatch struct {
+	Note *items.Note
+	SearchHit
+}
+
+// Run brings the search index up to date with the cache, creating it on first use, and
+// returns the matching notes in order of relevance. Only the notes that need checking against
+// the query are decrypted.
+func (i *SearchConfig) Run() ([]SearchMatch, error) {
+	query, err := ParseSearchQuery(i.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	cachedItems, err := i.cachedItems()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := updatedSearchIndex(i.Session, cachedItems)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagged map[string]bool
+	if len(i.Tags) > 0 {
+		tagged = idx.TaggedNotes(i.Tags)
+	}
+
+	candidates := idx.allHits()
+	if !i.Scan && len(searchTerms(query.Text)) > 0 {
+		candidates = idx.Search(query.Text)
+	}
+
+	// the limit can only be applied once notes have been checked against the query
+	evaluated := i.Scan || query.Evaluated()
+
+	var hits []SearchHit
+
+	for _, hit := range candidates {
+		if doc, _ := idx.doc(hit.UUID); doc.Trashed && !i.IncludeTrash && !query.Trash {
+			continue
+		}
+
+		if tagged != nil && !tagged[hit.UUID] {
+			continue
+		}
+
+		hits = append(hits, hit)
+
+		if !evaluated && i.Limit > 0 && len(hits) == i.Limit {
+			break
+		}
+	}
+
+	matches, err := decryptSearchHits(i.Session, cachedItems, hits)
+	if err != nil || !evaluated {
+		return matches, err
+	}
+
+	return filterSearchMatches(matches, query, idx.noteTags(), i.Limit), nil
+}
+
+// updatedSearchIndex loads the search index and brings it up to date with the cache
+func updatedSearchIndex(s *cache.Session, cachedItems cache.Items) (*SearchIndex, error) {
+	idx, err := LoadSearchIndex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := idx.Update(s, cachedItems)
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		if err := idx.Save(); err != nil {
+			return nil, err
+		}
+	}
+
+	return idx, nil
+}
+
+// filterSearchMatches returns the matches for notes matching the query, up to the limit
+func filterSearchMatches(matches []SearchMatch, query *SearchQuery, noteTags map[string][]string, limit int) []SearchMatch {
+	notes := make(items.Items, 0, len(matches))
+	for _, m := range matches {
+		notes = append(notes, m.Note)
+	}
+
+	matched := make(map[string]bool)
+	for _, item := range query.FilterNotes(notes, noteTags) {
+		matched[item.GetUUID()] = true
+	}
+
+	filtered := matches[:0]
+
+	for _, m := range matches {
+		if !matched[m.Note.UUID] {
+			continue
+		}
+
+		filtered = append(filtered, m)
+
+		if limit > 0 && len(filtered) == limit {
+			break
+		}
+	}
+
+	return filtered
+}
+
+// cachedItems syncs, unless offline, and returns the encrypted items in the cache
+func (i *SearchConfig) cachedItems() (cache.Items, error) {
+	if i.Offline {
+		cachedItems, err := readCachedItems(i.Session)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = loadCachedItemsKeys(i.Session, cachedItems); err != nil {
+			return nil, err
+		}
+
+		return cachedItems, nil
+	}
+
+	// the index is updated here rather than by Sync so it is only loaded once
+	so, err := syncWithProgress(cache.SyncInput{Session: i.Session}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = so.DB.Close()
+	}()
+
+	var cachedItems cache.Items
+	if err = so.DB.All(&cachedItems); err != nil {
+		return nil, fmt.Errorf("getting items from db: %w", err)
+	}
+
+	return cachedItems, nil
+}
+
+// decryptSearchHits decrypts the notes for the hits, keeping their order
+func decryptSearchHits(s *cache.Session, cachedItems cache.Items, hits []SearchHit) ([]SearchMatch, error) {
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	wanted := make(map[string]bool, len(hits))
+	for _, hit := range hits {
+		wanted[hit.UUID] = true
+	}
+
+	var selected cache.Items
+
+	for _, ci := range cachedItems {
+		if wanted[ci.UUID] && !ci.Deleted {
+			selected = append(selected, ci)
+		}
+	}
+
+	decrypted, err := selected.ToItems(s)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make(map[string]*items.Note, len(decrypted))
+
+	for _, item := range decrypted {
+		if note, ok := item.(*items.Note); ok {
+			notes[note.UUID] = note
+		}
+	}
+
+	matches := make([]SearchMatch, 0, len(hits))
+
+	for _, hit := range hits {
+		if note, ok := notes[hit.UUID]; ok {
+			matches = append(matches, SearchMatch{Note: note, SearchHit: hit})
+		}
+	}
+
+	return matches, nil
+}
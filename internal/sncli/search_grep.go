@@ -0,0 +1,61 @@
+package sncli
+
+import (
+	"regexp"
+	"strings"
+)
+
+// GrepLine is a line of a note's text that matches a regular expression, or is context around a match
+type GrepLine struct {
+	// Number is the line's position in the text, starting at 1
+	Number int
+	Text   string
+	// Matches holds the start and end offsets of each match in the line, empty for context lines
+	Matches [][]int
+}
+
+// GrepText returns the lines of text matching re, with up to before and after lines of context, as
+// groups of adjacent lines. Groups are separated by at least one line that wasn't returned.
+func GrepText(text string, re *regexp.Regexp, before, after int) [][]GrepLine {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var groups [][]GrepLine
+
+	var group []GrepLine
+
+	// last is the index of the last line added to group
+	last := -1
+
+	for x, line := range lines {
+		matches := re.FindAllStringIndex(line, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		start := max(x-before, last+1)
+
+		if len(group) > 0 && start > last+1 {
+			groups = append(groups, group)
+			group = nil
+		}
+
+		for y := start; y < x; y++ {
+			group = append(group, GrepLine{Number: y + 1, Text: lines[y]})
+		}
+
+		group = append(group, GrepLine{Number: x + 1, Text: line, Matches: matches})
+		last = x
+
+		// trailing context stops at the next match, which adds its own line
+		for y := x + 1; y <= x+after && y < len(lines) && !re.MatchString(lines[y]); y++ {
+			group = append(group, GrepLine{Number: y + 1, Text: lines[y]})
+			last = y
+		}
+	}
+
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+
+	return groups
+}
@@ -0,0 +1,724 @@
+package sncli
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/asdine/storm/v3"
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// searchIndexVersion is increased whenever tokenising or the stored format changes, forcing a rebuild
+const searchIndexVersion = 1
+
+const (
+	// BM25 term frequency saturation and document length normalisation
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// searchTitleWeight counts each term in a title as this many occurrences
+	searchTitleWeight = 3
+)
+
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "was": true, "with": true,
+}
+
+// SearchIndex is an inverted index of the notes in the local cache. It is stored encrypted
+// alongside the cache and brought up to date from the cache after each sync.
+// Notes and terms are numbered so the index stays compact and quick to load.
+type SearchIndex struct {
+	Version int
+	// Terms holds each term by its ID
+	Terms []string
+	// Postings holds the notes containing each term by term ID, as pairs of note ID and weighted
+	// term frequency ordered by note ID. Pairs are stored flat as it's much quicker to load.
+	Postings [][]int32
+	// Docs holds the indexed notes by ID. Removed notes leave an empty slot until compacted.
+	Docs []SearchIndexDoc
+	// Tags holds the notes referenced by each tag, so results can be filtered by tag
+	Tags        map[string]SearchIndexTag
+	TotalLength int
+
+	termIDs map[string]int32
+	docIDs  map[string]int32
+	path    string
+	key     []byte
+}
+
+// SearchIndexDoc records an indexed note
+type SearchIndexDoc struct {
+	UUID       string
+	Title      string
+	UpdatedAt  int64
+	Trashed    bool
+	Length     int
+	TitleTerms []int32
+
+	// terms holds the IDs of the terms in the note, so it can be removed. It is rebuilt from the postings on load.
+	terms []int32
+}
+
+// SearchIndexTag records the notes a tag references
+type SearchIndexTag struct {
+	Title     string
+	UpdatedAt int64
+	Notes     []string
+}
+
+// SearchHit is a note matching a query, with its BM25 score
+type SearchHit struct {
+	UUID    string
+	Title   string
+	Score   float64
+	InTitle bool
+	InBody  bool
+}
+
+func newSearchIndex(path string, key []byte) *SearchIndex {
+	return &SearchIndex{
+		Version: searchIndexVersion,
+		Tags:    make(map[string]SearchIndexTag),
+		termIDs: make(map[string]int32),
+		docIDs:  make(map[string]int32),
+		path:    path,
+		key:     key,
+	}
+}
+
+// buildLookups recreates the maps from UUIDs and terms to IDs and the terms of each note, which aren't stored
+func (idx *SearchIndex) buildLookups() {
+	idx.termIDs = make(map[string]int32, len(idx.Terms))
+	for id, term := range idx.Terms {
+		idx.termIDs[term] = int32(id)
+	}
+
+	idx.docIDs = make(map[string]int32, len(idx.Docs))
+	for id := range idx.Docs {
+		idx.Docs[id].terms = idx.Docs[id].terms[:0]
+
+		if idx.Docs[id].UUID != "" {
+			idx.docIDs[idx.Docs[id].UUID] = int32(id)
+		}
+	}
+
+	for termID, postings := range idx.Postings {
+		for x := 0; x < len(postings); x += 2 {
+			doc := &idx.Docs[postings[x]]
+			doc.terms = append(doc.terms, int32(termID))
+		}
+	}
+
+	if idx.Tags == nil {
+		idx.Tags = make(map[string]SearchIndexTag)
+	}
+}
+
+// Len returns the number of indexed notes
+func (idx *SearchIndex) Len() int {
+	return len(idx.docIDs)
+}
+
+// doc returns the indexed note with the UUID
+func (idx *SearchIndex) doc(uuid string) (*SearchIndexDoc, bool) {
+	id, ok := idx.docIDs[uuid]
+	if !ok {
+		return nil, false
+	}
+
+	return &idx.Docs[id], true
+}
+
+// searchIndexPath returns the location of the index for a cache
+func searchIndexPath(cacheDBPath string) string {
+	return strings.TrimSuffix(cacheDBPath, filepath.Ext(cacheDBPath)) + ".idx"
+}
+
+// searchIndexKey derives the key used to encrypt the index from the account's master key
+func searchIndexKey(s *cache.Session) ([]byte, error) {
+	if s.Session == nil || s.MasterKey == "" {
+		return nil, errors.New("session has no master key to encrypt the search index with")
+	}
+
+	key := sha256.Sum256([]byte("sn-cli search index\x00" + s.MasterKey))
+
+	return key[:], nil
+}
+
+// LoadSearchIndex reads the index for the session's cache. An empty index is returned if none
+// exists yet, or if it can't be read, for example after a password change, so it is rebuilt.
+func LoadSearchIndex(s *cache.Session) (*SearchIndex, error) {
+	if s.CacheDBPath == "" {
+		return nil, errors.New("cache path is not set")
+	}
+
+	key, err := searchIndexKey(s)
+	if err != nil {
+		return nil, err
+	}
+
+	path := searchIndexPath(s.CacheDBPath)
+
+	var idx SearchIndex
+	if err := readEncryptedFile(path, key, &idx); err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errEncryptedFileUnreadable) {
+			return newSearchIndex(path, key), nil
+		}
+
+		return nil, fmt.Errorf("failed to read search index: %w", err)
+	}
+
+	if idx.Version != searchIndexVersion {
+		return newSearchIndex(path, key), nil
+	}
+
+	idx.path = path
+	idx.key = key
+	idx.buildLookups()
+
+	return &idx, nil
+}
+
+// errEncryptedFileUnreadable is returned when a file written by writeEncryptedFile can't be
+// decrypted or decoded, such as after a password change, so its contents should be rebuilt
+var errEncryptedFileUnreadable = errors.New("encrypted file cannot be read")
+
+// writeEncryptedFile gob encodes v and seals it with AES-GCM, writing it to a temporary file
+// that then replaces the previous copy atomically
+func writeEncryptedFile(path string, key []byte, v any) error {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return fmt.Errorf("failed to encode: %w", err)
+	}
+
+	gcm, err := newEncryptedFileCipher(key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, gcm.Seal(nonce, nonce, buf.Bytes(), nil), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// readEncryptedFile decrypts and decodes a file written by writeEncryptedFile into v
+func readEncryptedFile(path string, key []byte, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newEncryptedFileCipher(key)
+	if err != nil {
+		return err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return fmt.Errorf("%w: truncated", errEncryptedFileUnreadable)
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errEncryptedFileUnreadable, err)
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %w", errEncryptedFileUnreadable, err)
+	}
+
+	return nil
+}
+
+func newEncryptedFileCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Save writes the index, gob encoded and encrypted, replacing the previous copy atomically
+func (idx *SearchIndex) Save() error {
+	idx.compact()
+
+	if err := writeEncryptedFile(idx.path, idx.key, idx); err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+
+	return nil
+}
+
+// Update brings the index up to date with the cache, decrypting only the notes and tags that
+// have changed since they were indexed. It reports whether the index changed.
+func (idx *SearchIndex) Update(s *cache.Session, cachedItems cache.Items) (bool, error) {
+	live := make(map[string]bool)
+
+	var stale cache.Items
+
+	for _, ci := range cachedItems {
+		if ci.Deleted {
+			continue
+		}
+
+		switch ci.ContentType {
+		case common.SNItemTypeNote:
+			live[ci.UUID] = true
+
+			if doc, ok := idx.doc(ci.UUID); !ok || doc.UpdatedAt != ci.UpdatedAtTimestamp {
+				stale = append(stale, ci)
+			}
+		case common.SNItemTypeTag:
+			live[ci.UUID] = true
+
+			if tag, ok := idx.Tags[ci.UUID]; !ok || tag.UpdatedAt != ci.UpdatedAtTimestamp {
+				stale = append(stale, ci)
+			}
+		}
+	}
+
+	changed := false
+
+	for uuid := range idx.docIDs {
+		if !live[uuid] {
+			idx.removeDoc(uuid)
+
+			changed = true
+		}
+	}
+
+	for uuid := range idx.Tags {
+		if !live[uuid] {
+			delete(idx.Tags, uuid)
+
+			changed = true
+		}
+	}
+
+	if len(stale) == 0 {
+		return changed, nil
+	}
+
+	if len(s.ItemsKeys) == 0 {
+		if err := loadCachedItemsKeys(s, cachedItems); err != nil {
+			return changed, err
+		}
+	}
+
+	decrypted, err := stale.ToItems(s)
+	if err != nil {
+		return changed, fmt.Errorf("failed to decrypt items to index: %w", err)
+	}
+
+	byUUID := make(map[string]items.Item, len(decrypted))
+	for _, item := range decrypted {
+		byUUID[item.GetUUID()] = item
+	}
+
+	for _, ci := range stale {
+		item := byUUID[ci.UUID]
+
+		switch ci.ContentType {
+		case common.SNItemTypeNote:
+			idx.removeDoc(ci.UUID)
+
+			// notes that can't be decrypted are recorded empty so they aren't retried until they change
+			doc := SearchIndexDoc{UUID: ci.UUID, UpdatedAt: ci.UpdatedAtTimestamp}
+
+			var title, text string
+
+			if note, ok := item.(*items.Note); ok {
+				title, text = note.Content.GetTitle(), note.Content.GetText()
+				doc.Trashed = note.Content.Trashed != nil && *note.Content.Trashed
+			}
+
+			idx.addDoc(doc, title, text)
+		case common.SNItemTypeTag:
+			tag := SearchIndexTag{UpdatedAt: ci.UpdatedAtTimestamp}
+
+			if t, ok := item.(*items.Tag); ok {
+				tag.Title = t.Content.GetTitle()
+
+				for _, ref := range t.Content.References() {
+					if ref.ContentType == common.SNItemTypeNote {
+						tag.Notes = append(tag.Notes, ref.UUID)
+					}
+				}
+			}
+
+			idx.Tags[ci.UUID] = tag
+		}
+	}
+
+	return true, nil
+}
+
+// addDoc indexes a note's title and text
+func (idx *SearchIndex) addDoc(doc SearchIndexDoc, title, text string) {
+	id := int32(len(idx.Docs))
+	doc.Title = title
+
+	frequencies := make(map[int32]int32)
+
+	for _, term := range searchTerms(title) {
+		termID := idx.termID(term)
+		doc.TitleTerms = append(doc.TitleTerms, termID)
+		frequencies[termID] += searchTitleWeight
+	}
+
+	for _, term := range searchTerms(text) {
+		frequencies[idx.termID(term)]++
+	}
+
+	for termID, tf := range frequencies {
+		// notes are only ever appended, so postings stay ordered by note ID
+		idx.Postings[termID] = append(idx.Postings[termID], id, tf)
+		doc.terms = append(doc.terms, termID)
+		doc.Length += int(tf)
+	}
+
+	idx.Docs = append(idx.Docs, doc)
+	idx.docIDs[doc.UUID] = id
+	idx.TotalLength += doc.Length
+}
+
+// termID returns the ID of a term, adding it to the index if new
+func (idx *SearchIndex) termID(term string) int32 {
+	if id, ok := idx.termIDs[term]; ok {
+		return id
+	}
+
+	id := int32(len(idx.Terms))
+	idx.Terms = append(idx.Terms, term)
+	idx.Postings = append(idx.Postings, nil)
+	idx.termIDs[term] = id
+
+	return id
+}
+
+func (idx *SearchIndex) removeDoc(uuid string) {
+	id, ok := idx.docIDs[uuid]
+	if !ok {
+		return
+	}
+
+	doc := &idx.Docs[id]
+
+	for _, termID := range doc.terms {
+		if x, ok := idx.findPosting(termID, id); ok {
+			postings := idx.Postings[termID]
+			idx.Postings[termID] = append(postings[:x], postings[x+2:]...)
+		}
+	}
+
+	idx.TotalLength -= doc.Length
+	idx.Docs[id] = SearchIndexDoc{}
+	delete(idx.docIDs, uuid)
+}
+
+// compact renumbers notes and terms to drop the slots left by removed notes and unused terms,
+// once they make up half the index
+func (idx *SearchIndex) compact() {
+	if len(idx.Docs) < 2*idx.Len()+1000 {
+		return
+	}
+
+	docMap := make([]int32, len(idx.Docs))
+
+	var docs []SearchIndexDoc
+
+	for id, doc := range idx.Docs {
+		docMap[id] = int32(len(docs))
+
+		if doc.UUID != "" {
+			docs = append(docs, doc)
+		}
+	}
+
+	termMap := make([]int32, len(idx.Terms))
+
+	var (
+		terms    []string
+		postings [][]int32
+	)
+
+	for id, list := range idx.Postings {
+		termMap[id] = int32(len(terms))
+
+		if len(list) == 0 {
+			continue
+		}
+
+		for x := 0; x < len(list); x += 2 {
+			list[x] = docMap[list[x]]
+		}
+
+		terms = append(terms, idx.Terms[id])
+		postings = append(postings, list)
+	}
+
+	for x := range docs {
+		for y := range docs[x].TitleTerms {
+			docs[x].TitleTerms[y] = termMap[docs[x].TitleTerms[y]]
+		}
+	}
+
+	idx.Docs = docs
+	idx.Terms = terms
+	idx.Postings = postings
+	idx.buildLookups()
+}
+
+// Search returns the notes containing every term in the query, highest BM25 score first
+func (idx *SearchIndex) Search(query string) []SearchHit {
+	terms := uniqueTerms(searchTerms(query))
+	if len(terms) == 0 || idx.Len() == 0 {
+		return nil
+	}
+
+	n := float64(idx.Len())
+	avgLength := float64(idx.TotalLength) / n
+
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	termIDs := make([]int32, 0, len(terms))
+	scores := make(map[int32]float64)
+
+	for x, term := range terms {
+		termID, ok := idx.termIDs[term]
+		if !ok || len(idx.Postings[termID]) == 0 {
+			return nil
+		}
+
+		termIDs = append(termIDs, termID)
+		postings := idx.Postings[termID]
+
+		df := float64(len(postings) / 2)
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		matched := make(map[int32]float64, len(postings)/2)
+
+		for p := 0; p < len(postings); p += 2 {
+			id := postings[p]
+
+			// only keep notes that contained every earlier term
+			score, ok := scores[id]
+			if !ok && x > 0 {
+				continue
+			}
+
+			length := float64(idx.Docs[id].Length)
+			f := float64(postings[p+1])
+			matched[id] = score + idf*f*(bm25K1+1)/(f+bm25K1*(1-bm25B+bm25B*length/avgLength))
+		}
+
+		scores = matched
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+
+	for id, score := range scores {
+		hits = append(hits, idx.newHit(id, score, termIDs))
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+
+		return hits[i].UUID < hits[j].UUID
+	})
+
+	return hits
+}
+
+// allHits returns every indexed note, most recently updated first, for queries without free text
+func (idx *SearchIndex) allHits() []SearchHit {
+	ids := make([]int32, 0, idx.Len())
+
+	for id := range idx.Docs {
+		if idx.Docs[id].UUID != "" {
+			ids = append(ids, int32(id))
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := &idx.Docs[ids[i]], &idx.Docs[ids[j]]
+		if a.UpdatedAt != b.UpdatedAt {
+			return a.UpdatedAt > b.UpdatedAt
+		}
+
+		return a.UUID < b.UUID
+	})
+
+	hits := make([]SearchHit, len(ids))
+	for x, id := range ids {
+		hits[x] = SearchHit{UUID: idx.Docs[id].UUID, Title: idx.Docs[id].Title}
+	}
+
+	return hits
+}
+
+// newHit records whether the query terms were found in the title, the text or both
+func (idx *SearchIndex) newHit(id int32, score float64, termIDs []int32) SearchHit {
+	doc := &idx.Docs[id]
+	hit := SearchHit{UUID: doc.UUID, Title: doc.Title, Score: score, InTitle: true}
+
+	for _, termID := range termIDs {
+		var inTitle int32
+
+		for _, titleTerm := range doc.TitleTerms {
+			if titleTerm == termID {
+				inTitle++
+			}
+		}
+
+		if inTitle == 0 {
+			hit.InTitle = false
+		}
+
+		if idx.termFrequency(termID, id) > inTitle*searchTitleWeight {
+			hit.InBody = true
+		}
+	}
+
+	return hit
+}
+
+// termFrequency returns the weighted number of times a term occurs in a note
+func (idx *SearchIndex) termFrequency(termID, id int32) int32 {
+	if x, ok := idx.findPosting(termID, id); ok {
+		return idx.Postings[termID][x+1]
+	}
+
+	return 0
+}
+
+// findPosting returns the offset of a note's entry in a term's postings
+func (idx *SearchIndex) findPosting(termID, id int32) (int, bool) {
+	postings := idx.Postings[termID]
+
+	x := sort.Search(len(postings)/2, func(i int) bool {
+		return postings[2*i] >= id
+	})
+
+	return 2 * x, 2*x < len(postings) && postings[2*x] == id
+}
+
+// TaggedNotes returns the UUIDs of notes referenced by tags with any of the titles, ignoring case
+func (idx *SearchIndex) TaggedNotes(titles []string) map[string]bool {
+	tagged := make(map[string]bool)
+
+	for _, tag := range idx.Tags {
+		if !StringInSlice(tag.Title, titles, true) {
+			continue
+		}
+
+		for _, uuid := range tag.Notes {
+			tagged[uuid] = true
+		}
+	}
+
+	return tagged
+}
+
+// noteTags returns the titles of the tags referencing each note, by note UUID
+func (idx *SearchIndex) noteTags() map[string][]string {
+	noteTags := make(map[string][]string)
+
+	for _, tag := range idx.Tags {
+		for _, uuid := range tag.Notes {
+			noteTags[uuid] = append(noteTags[uuid], tag.Title)
+		}
+	}
+
+	return noteTags
+}
+
+// searchTerms splits text into lower case, stemmed terms, dropping common words
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := words[:0]
+
+	for _, word := range words {
+		if searchStopWords[word] {
+			continue
+		}
+
+		terms = append(terms, stem(word))
+	}
+
+	return terms
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+
+	var unique []string
+
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+
+	return unique
+}
+
+// refreshSearchIndex updates an existing search index after a sync. Indexes are only
+// created by searching, so accounts that never search don't pay for indexing.
+// Failures are ignored as the index is brought up to date again before each search.
+func refreshSearchIndex(s *cache.Session, db *storm.DB) {
+	if s.CacheDBPath == "" {
+		return
+	}
+
+	if _, err := os.Stat(searchIndexPath(s.CacheDBPath)); err != nil {
+		return
+	}
+
+	var cachedItems cache.Items
+	if err := db.All(&cachedItems); err != nil {
+		return
+	}
+
+	idx, err := LoadSearchIndex(s)
+	if err != nil {
+		return
+	}
+
+	if changed, err := idx.Update(s, cachedItems); err == nil && changed {
+		_ = idx.Save()
+	}
+}
@@ -0,0 +1,720 @@
+package sncli
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// searchQueryFields are the qualifiers a search query term can start with, e.g. title:standup
+var searchQueryFields = []string{"title", "text", "tag", "uuid", "pinned", "trash", "updated", "created"}
+
+// QueryError reports where a search query couldn't be parsed
+type QueryError struct {
+	Query string
+	// Pos is the byte offset of the problem in the query
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos+1, e.Msg)
+}
+
+// SearchQuery is a parsed search query, such as:
+//
+//	title:"standup" AND tag:work -tag:archive updated:>2026-01-01 pinned:true "exact phrase"
+//
+// Terms are combined with AND unless joined by OR, can be negated with - or NOT and grouped
+// with parentheses. Field terms at the top level are compiled to item filters where possible
+// and the rest of the query is evaluated against each note.
+type SearchQuery struct {
+	// Filters holds the terms that can be applied with items.Filter
+	Filters []items.Filter
+	// Text holds the words and phrases every note must contain, used to find and rank notes
+	Text string
+	// Trash is true if the query refers to trash, so trashed notes shouldn't be excluded by default
+	Trash bool
+
+	root     queryNode
+	residual queryNode
+}
+
+// ParseSearchQuery parses a query into filters, free text and terms to evaluate against each note
+func ParseSearchQuery(query string) (*SearchQuery, error) {
+	tokens, err := lexSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{query: query, tokens: tokens}
+
+	var root queryNode
+
+	if len(tokens) > 0 {
+		if root, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+
+		if tok := p.peek(); tok.kind != tokEOF {
+			return nil, p.errorf(tok.pos, "unexpected %s", tok)
+		}
+	}
+
+	q := &SearchQuery{root: root}
+	q.compile(root)
+
+	return q, nil
+}
+
+// compile moves the top level terms that items.Filter or the search index can handle out of the tree
+func (q *SearchQuery) compile(root queryNode) {
+	conjuncts := []queryNode{root}
+	if and, ok := root.(*andNode); ok {
+		conjuncts = and.nodes
+	}
+
+	var text []string
+
+	var residual []queryNode
+
+	for _, node := range conjuncts {
+		switch n := node.(type) {
+		case nil:
+			continue
+		case *termNode:
+			// left to the index, which matches stemmed terms in the same way
+			text = append(text, n.word)
+
+			continue
+		case *phraseNode:
+			// the index finds notes with the phrase's words, which are then checked for the phrase
+			text = append(text, n.phrase)
+		case *fieldNode:
+			if filter, ok := n.filter(); ok {
+				q.Filters = append(q.Filters, filter)
+
+				continue
+			}
+		}
+
+		residual = append(residual, node)
+	}
+
+	q.Text = strings.Join(text, " ")
+	q.Trash = refersToTrash(root)
+
+	switch len(residual) {
+	case 0:
+	case 1:
+		q.residual = residual[0]
+	default:
+		q.residual = &andNode{nodes: residual}
+	}
+}
+
+// Evaluated reports whether notes need to be checked with FilterNotes, beyond matching Text
+func (q *SearchQuery) Evaluated() bool {
+	return len(q.Filters) > 0 || q.residual != nil
+}
+
+// FilterNotes returns the notes matching the query's filters and the terms that are evaluated against
+// each note. Text isn't matched, as it's left to the search index or a scan. noteTags holds the titles
+// of the tags referencing each note by UUID.
+func (q *SearchQuery) FilterNotes(notes items.Items, noteTags map[string][]string) items.Items {
+	// applied one at a time as Filter only fails a note with an empty title on the last filter
+	for _, filter := range q.Filters {
+		notes.Filter(items.ItemFilters{Filters: []items.Filter{filter}})
+	}
+
+	if q.residual == nil {
+		return notes
+	}
+
+	var matched items.Items
+
+	for _, item := range notes {
+		note, ok := item.(*items.Note)
+		if !ok {
+			continue
+		}
+
+		if q.residual.match(&queryNote{note: note, tags: noteTags[note.UUID]}) {
+			matched = append(matched, note)
+		}
+	}
+
+	return matched
+}
+
+func refersToTrash(node queryNode) bool {
+	switch n := node.(type) {
+	case *andNode:
+		for _, child := range n.nodes {
+			if refersToTrash(child) {
+				return true
+			}
+		}
+	case *orNode:
+		for _, child := range n.nodes {
+			if refersToTrash(child) {
+				return true
+			}
+		}
+	case *notNode:
+		return refersToTrash(n.node)
+	case *fieldNode:
+		return n.field == "trash"
+	}
+
+	return false
+}
+
+type queryTokenKind int
+
+const (
+	tokEOF queryTokenKind = iota
+	tokWord
+	tokPhrase
+	tokField
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	pos  int
+	// text is the word, the phrase without quotes or a field's value
+	text  string
+	field string
+	// valuePos is the offset of a field's value
+	valuePos int
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokPhrase:
+		return strconv.Quote(t.text)
+	case tokField:
+		return t.field + ":" + t.text
+	case tokAnd:
+		return "AND"
+	case tokOr:
+		return "OR"
+	case tokNot:
+		return "NOT"
+	case tokLParen:
+		return `"("`
+	case tokRParen:
+		return `")"`
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+// lexSearchQuery splits a query into tokens
+func lexSearchQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: tokLParen, pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: tokRParen, pos: i})
+			i++
+		case c == '"':
+			phrase, end, err := lexPhrase(query, i)
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, queryToken{kind: tokPhrase, pos: i, text: phrase})
+			i = end
+		case c == '-':
+			if i+1 == len(query) || strings.ContainsRune(" \t\n)", rune(query[i+1])) {
+				return nil, &QueryError{Query: query, Pos: i, Msg: "expected a term after -"}
+			}
+
+			tokens = append(tokens, queryToken{kind: tokNot, pos: i})
+			i++
+		default:
+			end := i
+			for end < len(query) && !strings.ContainsRune(" \t\n()\"", rune(query[end])) {
+				end++
+			}
+
+			token, next, err := lexWord(query, i, end)
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, token)
+			i = next
+		}
+	}
+
+	return tokens, nil
+}
+
+// lexPhrase reads the quoted phrase starting at start, returning it and the offset after the closing quote
+func lexPhrase(query string, start int) (string, int, error) {
+	end := strings.IndexByte(query[start+1:], '"')
+	if end == -1 {
+		return "", 0, &QueryError{Query: query, Pos: start, Msg: "missing closing quote"}
+	}
+
+	return query[start+1 : start+1+end], start + end + 2, nil
+}
+
+// lexWord reads the word between start and end, which is an operator, a field term or a plain word
+func lexWord(query string, start, end int) (queryToken, int, error) {
+	word := query[start:end]
+
+	switch word {
+	case "AND":
+		return queryToken{kind: tokAnd, pos: start}, end, nil
+	case "OR":
+		return queryToken{kind: tokOr, pos: start}, end, nil
+	case "NOT":
+		return queryToken{kind: tokNot, pos: start}, end, nil
+	}
+
+	name, value, found := strings.Cut(word, ":")
+	if !found || !StringInSlice(name, searchQueryFields, true) {
+		return queryToken{kind: tokWord, pos: start, text: word}, end, nil
+	}
+
+	token := queryToken{kind: tokField, pos: start, field: strings.ToLower(name), text: value, valuePos: start + len(name) + 1}
+
+	// a quoted value, e.g. title:"standup notes" or updated:>"2026-01-01"
+	if end < len(query) && query[end] == '"' {
+		phrase, next, err := lexPhrase(query, end)
+		if err != nil {
+			return queryToken{}, 0, err
+		}
+
+		token.text += phrase
+
+		return token, next, nil
+	}
+
+	if value == "" {
+		return queryToken{}, 0, &QueryError{Query: query, Pos: token.valuePos, Msg: fmt.Sprintf("missing value for %s:", token.field)}
+	}
+
+	return token, end, nil
+}
+
+type queryParser struct {
+	query  string
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) peek() queryToken {
+	if p.next < len(p.tokens) {
+		return p.tokens[p.next]
+	}
+
+	return queryToken{kind: tokEOF, pos: len(p.query)}
+}
+
+func (p *queryParser) advance() queryToken {
+	tok := p.peek()
+	if p.next < len(p.tokens) {
+		p.next++
+	}
+
+	return tok
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...any) error {
+	return &QueryError{Query: p.query, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseOr parses terms joined by OR
+func (p *queryParser) parseOr() (queryNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []queryNode{node}
+
+	for p.peek().kind == tokOr {
+		p.advance()
+
+		if node, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return &orNode{nodes: nodes}, nil
+}
+
+// parseAnd parses terms joined by AND or only by spaces
+func (p *queryParser) parseAnd() (queryNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []queryNode{node}
+
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.advance()
+		case tokWord, tokPhrase, tokField, tokNot, tokLParen:
+		default:
+			if len(nodes) == 1 {
+				return nodes[0], nil
+			}
+
+			return &andNode{nodes: nodes}, nil
+		}
+
+		if node, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+	}
+}
+
+// parseUnary parses a term, which may be negated
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek().kind != tokNot {
+		return p.parsePrimary()
+	}
+
+	p.advance()
+
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &notNode{node: node}, nil
+}
+
+// parsePrimary parses a word, phrase, field term or parenthesised group
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.advance()
+
+	switch tok.kind {
+	case tokWord:
+		return &termNode{word: tok.text, terms: uniqueTerms(searchTerms(tok.text))}, nil
+	case tokPhrase:
+		return &phraseNode{phrase: tok.text, lower: strings.ToLower(strings.Join(strings.Fields(tok.text), " "))}, nil
+	case tokField:
+		return p.parseField(tok)
+	case tokLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.advance(); closing.kind != tokRParen {
+			return nil, p.errorf(closing.pos, `expected ")" to close "(" at position %d`, tok.pos+1)
+		}
+
+		return node, nil
+	default:
+		return nil, p.errorf(tok.pos, "expected a term but found %s", tok)
+	}
+}
+
+// parseField checks a field term's value, which for dates may start with a comparison
+func (p *queryParser) parseField(tok queryToken) (queryNode, error) {
+	node := &fieldNode{field: tok.field, value: tok.text}
+
+	switch tok.field {
+	case "pinned", "trash":
+		b, err := strconv.ParseBool(tok.text)
+		if err != nil {
+			return nil, p.errorf(tok.valuePos, "%s: expects true or false", tok.field)
+		}
+
+		node.flag = b
+	case "updated", "created":
+		value := tok.text
+
+		for _, op := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(value, op) {
+				node.op = op
+				value = value[len(op):]
+
+				break
+			}
+		}
+
+		from, to, err := parseQueryTime(value, time.Now())
+		if err != nil {
+			return nil, p.errorf(tok.valuePos+len(node.op), "%s: expects a date such as 2026-01-31, a time such as 2026-01-31T09:00:00Z or a period such as 7.days.ago", tok.field)
+		}
+
+		node.date, node.from, node.to = value, from, to
+	default:
+		node.lower = strings.ToLower(tok.text)
+	}
+
+	return node, nil
+}
+
+// queryTimeAgo matches the relative times used by smart views, such as 7.days.ago
+var queryTimeAgo = regexp.MustCompile(`^(\d+)\.(minute|hour|day|week|month|year)s?\.ago$`)
+
+// parseQueryTime parses a date, returning the start of the day and the next day, or a time or period
+// before now, returning it and the following nanosecond
+func parseQueryTime(value string, now time.Time) (time.Time, time.Time, error) {
+	if day, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return day, day.AddDate(0, 0, 1), nil
+	}
+
+	if m := queryTimeAgo.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.Atoi(m[1])
+
+		var t time.Time
+
+		switch m[2] {
+		case "minute":
+			t = now.Add(-time.Duration(n) * time.Minute)
+		case "hour":
+			t = now.Add(-time.Duration(n) * time.Hour)
+		case "day":
+			t = now.AddDate(0, 0, -n)
+		case "week":
+			t = now.AddDate(0, 0, -7*n)
+		case "month":
+			t = now.AddDate(0, -n, 0)
+		case "year":
+			t = now.AddDate(-n, 0, 0)
+		}
+
+		return t, t.Add(time.Nanosecond), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return t, t.Add(time.Nanosecond), nil
+}
+
+// queryNote is a note being evaluated against a query, with its text lower cased and split into terms on demand
+type queryNote struct {
+	note  *items.Note
+	tags  []string
+	title string
+	text  string
+	terms map[string]bool
+}
+
+func (n *queryNote) lowerTitle() string {
+	if n.title == "" {
+		n.title = strings.ToLower(n.note.Content.GetTitle())
+	}
+
+	return n.title
+}
+
+func (n *queryNote) lowerText() string {
+	if n.text == "" {
+		n.text = strings.ToLower(n.note.Content.GetText())
+	}
+
+	return n.text
+}
+
+func (n *queryNote) hasTerm(term string) bool {
+	if n.terms == nil {
+		n.terms = make(map[string]bool)
+
+		for _, t := range searchTerms(n.note.Content.GetTitle() + " " + n.note.Content.GetText()) {
+			n.terms[t] = true
+		}
+	}
+
+	return n.terms[term]
+}
+
+type queryNode interface {
+	match(n *queryNote) bool
+}
+
+type andNode struct {
+	nodes []queryNode
+}
+
+func (a *andNode) match(n *queryNote) bool {
+	for _, node := range a.nodes {
+		if !node.match(n) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type orNode struct {
+	nodes []queryNode
+}
+
+func (o *orNode) match(n *queryNote) bool {
+	for _, node := range o.nodes {
+		if node.match(n) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type notNode struct {
+	node queryNode
+}
+
+func (o *notNode) match(n *queryNote) bool {
+	return !o.node.match(n)
+}
+
+// termNode matches notes containing a word, stemmed as it is in the search index
+type termNode struct {
+	word  string
+	terms []string
+}
+
+func (t *termNode) match(n *queryNote) bool {
+	for _, term := range t.terms {
+		if !n.hasTerm(term) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// phraseNode matches notes whose title or text contain a phrase, ignoring case
+type phraseNode struct {
+	phrase string
+	lower  string
+}
+
+func (p *phraseNode) match(n *queryNote) bool {
+	if strings.Contains(n.lowerTitle(), p.lower) {
+		return true
+	}
+
+	return strings.Contains(strings.Join(strings.Fields(n.lowerText()), " "), p.lower)
+}
+
+// fieldNode matches notes on a field such as title, tag or updated
+type fieldNode struct {
+	field string
+	value string
+	lower string
+	flag  bool
+	op    string
+	// date is the value given for updated and created, without the comparison
+	date string
+	// from and to bound the time given for updated and created, with to excluded
+	from time.Time
+	to   time.Time
+}
+
+func (f *fieldNode) match(n *queryNote) bool {
+	switch f.field {
+	case "title":
+		return strings.Contains(n.lowerTitle(), f.lower)
+	case "text":
+		return strings.Contains(n.lowerText(), f.lower)
+	case "tag":
+		return StringInSlice(f.value, n.tags, true)
+	case "uuid":
+		return n.note.UUID == f.value
+	case "pinned":
+		return n.note.Content.GetAppData().OrgStandardNotesSN.Pinned == f.flag
+	case "trash":
+		trashed := n.note.Content.Trashed != nil && *n.note.Content.Trashed
+
+		return trashed == f.flag
+	case "updated":
+		return f.matchTime(time.UnixMicro(n.note.UpdatedAtTimestamp))
+	case "created":
+		return f.matchTime(time.UnixMicro(n.note.CreatedAtTimestamp))
+	}
+
+	return false
+}
+
+func (f *fieldNode) matchTime(t time.Time) bool {
+	switch f.op {
+	case ">":
+		return !t.Before(f.to)
+	case ">=":
+		return !t.Before(f.from)
+	case "<":
+		return t.Before(f.from)
+	case "<=":
+		return t.Before(f.to)
+	default:
+		return !t.Before(f.from) && t.Before(f.to)
+	}
+}
+
+// filter returns the items.Filter equivalent to the term, if there is one
+func (f *fieldNode) filter() (items.Filter, bool) {
+	switch f.field {
+	case "title":
+		return items.Filter{
+			Type:       common.SNItemTypeNote,
+			Key:        "Title",
+			Comparison: "~",
+			Value:      "(?i)" + regexp.QuoteMeta(f.value),
+		}, true
+	case "uuid":
+		return items.Filter{
+			Type:       common.SNItemTypeNote,
+			Key:        "uuid",
+			Comparison: "==",
+			Value:      f.value,
+		}, true
+	case "trash":
+		comparison := "!="
+		if f.flag {
+			comparison = "=="
+		}
+
+		return items.Filter{
+			Type:       common.SNItemTypeNote,
+			Key:        "Trash",
+			Comparison: comparison,
+			Value:      "true",
+		}, true
+	}
+
+	// text filters skip notes without a title and tag filters stop at the first tag that doesn't match
+	return items.Filter{}, false
+}
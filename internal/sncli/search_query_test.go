@@ -0,0 +1,132 @@
+package sncli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	q, err := ParseSearchQuery(`title:"standup" AND tag:work -tag:archive updated:>2026-01-01 pinned:true "exact phrase" database`)
+	require.NoError(t, err)
+
+	require.Len(t, q.Filters, 1)
+	assert.Equal(t, "Title", q.Filters[0].Key)
+	assert.Equal(t, "~", q.Filters[0].Comparison)
+	assert.Equal(t, "(?i)standup", q.Filters[0].Value)
+	assert.Equal(t, "exact phrase database", q.Text)
+	assert.False(t, q.Trash)
+	assert.True(t, q.Evaluated())
+
+	q, err = ParseSearchQuery("standup notes")
+	require.NoError(t, err)
+	assert.Empty(t, q.Filters)
+	assert.Equal(t, "standup notes", q.Text)
+	assert.False(t, q.Evaluated())
+
+	// words with a colon that isn't a field are plain words
+	q, err = ParseSearchQuery("https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", q.Text)
+
+	q, err = ParseSearchQuery("(tag:work OR tag:home) -trash:true")
+	require.NoError(t, err)
+	assert.Empty(t, q.Text)
+	assert.True(t, q.Trash)
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{query: `title:"standup`, pos: 6, msg: "missing closing quote"},
+		{query: `notes "standup`, pos: 6, msg: "missing closing quote"},
+		{query: `(tag:work OR tag:home`, pos: 21, msg: `expected ")" to close "(" at position 1`},
+		{query: `tag:work)`, pos: 8, msg: `unexpected ")"`},
+		{query: `tag:work OR`, pos: 11, msg: "expected a term but found end of query"},
+		{query: `AND tag:work`, pos: 0, msg: "expected a term but found AND"},
+		{query: `()`, pos: 1, msg: `expected a term but found ")"`},
+		{query: `tag: work`, pos: 4, msg: "missing value for tag:"},
+		{query: `notes - tag:work`, pos: 6, msg: "expected a term after -"},
+		{query: `pinned:yes`, pos: 7, msg: "pinned: expects true or false"},
+		{query: `updated:>2026-13-01`, pos: 9, msg: "updated: expects a date such as 2026-01-31, a time such as 2026-01-31T09:00:00Z or a period such as 7.days.ago"},
+	} {
+		_, err := ParseSearchQuery(tc.query)
+
+		var qe *QueryError
+		require.ErrorAs(t, err, &qe, tc.query)
+		assert.Equal(t, tc.pos, qe.Pos, tc.query)
+		assert.Equal(t, tc.msg, qe.Msg, tc.query)
+	}
+}
+
+func TestSearchQueryFilterNotes(t *testing.T) {
+	newNote := func(title, text string, updated time.Time, pinned, trashed bool) *items.Note {
+		note, err := items.NewNote(title, text, nil)
+		require.NoError(t, err)
+
+		note.UpdatedAtTimestamp = updated.UnixMicro()
+
+		appData := note.Content.GetAppData()
+		appData.OrgStandardNotesSN.Pinned = pinned
+		note.Content.SetAppData(appData)
+
+		if trashed {
+			note.Content.Trashed = &trashed
+		}
+
+		return &note
+	}
+
+	standup := newNote("Standup", "Discussed the exact  phrase in the migration.", time.Date(2026, 2, 1, 9, 0, 0, 0, time.Local), true, false)
+	archived := newNote("Old standup", "Connected the reporting database.", time.Date(2025, 6, 1, 9, 0, 0, 0, time.Local), false, false)
+	shopping := newNote("Shopping", "Milk and eggs.", time.Date(2026, 1, 1, 18, 0, 0, 0, time.Local), false, true)
+
+	noteTags := map[string][]string{
+		standup.UUID:  {"Work"},
+		archived.UUID: {"work", "Archive"},
+	}
+
+	filter := func(query string) []string {
+		t.Helper()
+
+		q, err := ParseSearchQuery(query)
+		require.NoError(t, err, query)
+
+		var titles []string
+		for _, item := range q.FilterNotes(items.Items{standup, archived, shopping}, noteTags) {
+			titles = append(titles, item.(*items.Note).Content.GetTitle())
+		}
+
+		return titles
+	}
+
+	assert.Equal(t, []string{"Standup"}, filter(`title:"standup" AND tag:work -tag:archive updated:>2026-01-01 pinned:true "exact phrase"`))
+	assert.Equal(t, []string{"Standup", "Old standup"}, filter("title:STANDUP"))
+	assert.Equal(t, []string{"Old standup"}, filter("tag:archive"))
+	assert.Equal(t, []string{"Standup", "Shopping"}, filter("-tag:archive"))
+	assert.Equal(t, []string{"Old standup", "Shopping"}, filter("tag:archive OR trash:true"))
+	assert.Equal(t, []string{"Shopping"}, filter("trash:true"))
+	assert.Equal(t, []string{"Standup", "Old standup"}, filter("trash:false"))
+
+	// dates without a time cover the whole day
+	assert.Equal(t, []string{"Shopping"}, filter("updated:2026-01-01"))
+	assert.Equal(t, []string{"Standup"}, filter("updated:>2026-01-01"))
+	assert.Equal(t, []string{"Standup", "Shopping"}, filter("updated:>=2026-01-01"))
+	assert.Equal(t, []string{"Old standup"}, filter("updated:<2026-01-01"))
+	assert.Equal(t, []string{"Old standup", "Shopping"}, filter("updated:<=2026-01-01"))
+
+	// words in groups and negations are stemmed as they are in the index
+	assert.Equal(t, []string{"Standup", "Old standup"}, filter("-(connection OR milk) OR report"))
+	// top level words are left to the index
+	assert.Equal(t, []string{"Standup", "Old standup"}, filter("connected -milk"))
+	assert.Equal(t, []string{"Old standup"}, filter("(connected OR eggs) -milk"))
+	assert.Equal(t, []string{"Standup", "Shopping"}, filter(`NOT "reporting database"`))
+	assert.Equal(t, []string{"Standup"}, filter(`text:"exact  phrase"`))
+	assert.Equal(t, []string{"Standup"}, filter(`uuid:`+standup.UUID))
+}
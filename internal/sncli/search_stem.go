@@ -0,0 +1,239 @@
+package sncli
+
+import "sort"
+
+// porterRule replaces a suffix of a word
+type porterRule struct {
+	suffix      string
+	replacement string
+}
+
+var (
+	porterStep2 = sortPorterRules([]porterRule{
+		{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"}, {"izer", "ize"},
+		{"abli", "able"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"},
+		{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"},
+		{"fulness", "ful"}, {"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+	})
+	porterStep3 = sortPorterRules([]porterRule{
+		{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"}, {"ical", "ic"},
+		{"ful", ""}, {"ness", ""},
+	})
+	porterStep4 = sortPorterRules([]porterRule{
+		{"al", ""}, {"ance", ""}, {"ence", ""}, {"er", ""}, {"ic", ""}, {"able", ""}, {"ible", ""},
+		{"ant", ""}, {"ement", ""}, {"ment", ""}, {"ent", ""}, {"ou", ""}, {"ism", ""},
+		{"ate", ""}, {"iti", ""}, {"ous", ""}, {"ive", ""}, {"ize", ""},
+	})
+)
+
+// sortPorterRules orders rules longest suffix first, so the longest matching suffix is found first
+func sortPorterRules(rules []porterRule) []porterRule {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].suffix) > len(rules[j].suffix)
+	})
+
+	return rules
+}
+
+// stem reduces an English word to its stem using the Porter algorithm, so that
+// "connected", "connecting" and "connection" are indexed as the same term.
+// Words that are short or contain characters other than a-z are returned unchanged.
+func stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+
+	for x := 0; x < len(word); x++ {
+		if word[x] < 'a' || word[x] > 'z' {
+			return word
+		}
+	}
+
+	w := []byte(word)
+	w = porterStep1a(w)
+	w = porterStep1b(w)
+	w = porterStep1c(w)
+	w = applyPorterRules(w, porterStep2, 0)
+	w = applyPorterRules(w, porterStep3, 0)
+	w = porterStep4Apply(w)
+	w = porterStep5(w)
+
+	return string(w)
+}
+
+// isConsonant reports whether the letter at i is a consonant. Y is a consonant
+// at the start of a word or after a vowel.
+func isConsonant(w []byte, i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !isConsonant(w, i-1)
+	default:
+		return true
+	}
+}
+
+// porterMeasure counts the vowel-consonant sequences in w
+func porterMeasure(w []byte) int {
+	n, i := 0, 0
+
+	for i < len(w) && isConsonant(w, i) {
+		i++
+	}
+
+	for i < len(w) {
+		for i < len(w) && !isConsonant(w, i) {
+			i++
+		}
+
+		if i >= len(w) {
+			break
+		}
+
+		for i < len(w) && isConsonant(w, i) {
+			i++
+		}
+
+		n++
+	}
+
+	return n
+}
+
+func hasVowel(w []byte) bool {
+	for i := range w {
+		if !isConsonant(w, i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func endsDoubleConsonant(w []byte) bool {
+	l := len(w)
+
+	return l >= 2 && w[l-1] == w[l-2] && isConsonant(w, l-1)
+}
+
+// endsCVC reports whether w ends consonant-vowel-consonant, where the final consonant is not w, x or y
+func endsCVC(w []byte) bool {
+	l := len(w)
+	if l < 3 || !isConsonant(w, l-3) || isConsonant(w, l-2) || !isConsonant(w, l-1) {
+		return false
+	}
+
+	return w[l-1] != 'w' && w[l-1] != 'x' && w[l-1] != 'y'
+}
+
+func hasSuffix(w []byte, suffix string) bool {
+	return len(w) >= len(suffix) && string(w[len(w)-len(suffix):]) == suffix
+}
+
+func replaceSuffix(w []byte, suffix, replacement string) []byte {
+	return append(w[:len(w)-len(suffix)], replacement...)
+}
+
+func porterStep1a(w []byte) []byte {
+	switch {
+	case hasSuffix(w, "sses"):
+		return replaceSuffix(w, "sses", "ss")
+	case hasSuffix(w, "ies"):
+		return replaceSuffix(w, "ies", "i")
+	case hasSuffix(w, "ss"):
+		return w
+	case hasSuffix(w, "s"):
+		return w[:len(w)-1]
+	}
+
+	return w
+}
+
+func porterStep1b(w []byte) []byte {
+	if hasSuffix(w, "eed") {
+		if porterMeasure(w[:len(w)-3]) > 0 {
+			return w[:len(w)-1]
+		}
+
+		return w
+	}
+
+	var stemmed []byte
+
+	switch {
+	case hasSuffix(w, "ed") && hasVowel(w[:len(w)-2]):
+		stemmed = w[:len(w)-2]
+	case hasSuffix(w, "ing") && hasVowel(w[:len(w)-3]):
+		stemmed = w[:len(w)-3]
+	default:
+		return w
+	}
+
+	switch {
+	case hasSuffix(stemmed, "at"), hasSuffix(stemmed, "bl"), hasSuffix(stemmed, "iz"):
+		return append(stemmed, 'e')
+	case endsDoubleConsonant(stemmed):
+		if last := stemmed[len(stemmed)-1]; last != 'l' && last != 's' && last != 'z' {
+			return stemmed[:len(stemmed)-1]
+		}
+	case porterMeasure(stemmed) == 1 && endsCVC(stemmed):
+		return append(stemmed, 'e')
+	}
+
+	return stemmed
+}
+
+func porterStep1c(w []byte) []byte {
+	if hasSuffix(w, "y") && hasVowel(w[:len(w)-1]) {
+		w[len(w)-1] = 'i'
+	}
+
+	return w
+}
+
+// applyPorterRules replaces the longest matching suffix if the remaining stem's measure exceeds minMeasure
+func applyPorterRules(w []byte, rules []porterRule, minMeasure int) []byte {
+	for _, rule := range rules {
+		if !hasSuffix(w, rule.suffix) {
+			continue
+		}
+
+		if porterMeasure(w[:len(w)-len(rule.suffix)]) > minMeasure {
+			return replaceSuffix(w, rule.suffix, rule.replacement)
+		}
+
+		return w
+	}
+
+	return w
+}
+
+func porterStep4Apply(w []byte) []byte {
+	// -ion is only removed after s or t
+	if hasSuffix(w, "ion") {
+		stemmed := w[:len(w)-3]
+		if porterMeasure(stemmed) > 1 && (hasSuffix(stemmed, "s") || hasSuffix(stemmed, "t")) {
+			return stemmed
+		}
+
+		return w
+	}
+
+	return applyPorterRules(w, porterStep4, 1)
+}
+
+func porterStep5(w []byte) []byte {
+	if hasSuffix(w, "e") {
+		stemmed := w[:len(w)-1]
+		if m := porterMeasure(stemmed); m > 1 || (m == 1 && !endsCVC(stemmed)) {
+			w = stemmed
+		}
+	}
+
+	if porterMeasure(w) > 1 && endsDoubleConsonant(w) && hasSuffix(w, "l") {
+		w = w[:len(w)-1]
+	}
+
+	return w
+}
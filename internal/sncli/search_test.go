@@ -0,0 +1,228 @@
+package sncli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/jonhadfield/gosn-v2/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStem(t *testing.T) {
+	for word, expected := range map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"cats":           "cat",
+		"feed":           "feed",
+		"agreed":         "agre",
+		"plastered":      "plaster",
+		"motoring":       "motor",
+		"sing":           "sing",
+		"conflated":      "conflat",
+		"hopping":        "hop",
+		"falling":        "fall",
+		"filing":         "file",
+		"happy":          "happi",
+		"relational":     "relat",
+		"generalization": "gener",
+		"connection":     "connect",
+		"connecting":     "connect",
+		"connected":      "connect",
+		"running":        "run",
+		"go":             "go",
+		"café":           "café",
+		"k8s":            "k8s",
+	} {
+		assert.Equal(t, expected, stem(word), word)
+	}
+}
+
+func testSearchIndex(t *testing.T) *SearchIndex {
+	t.Helper()
+
+	idx := newSearchIndex(filepath.Join(t.TempDir(), "test.idx"), make([]byte, 32))
+	idx.addDoc(SearchIndexDoc{UUID: "note-1"}, "Standup notes", "Discussed the database migration and connection pooling.")
+	idx.addDoc(SearchIndexDoc{UUID: "note-2"}, "Database tuning", "Indexes for the reporting queries.")
+	idx.addDoc(SearchIndexDoc{UUID: "note-3"}, "Shopping", "Milk, eggs and bread.")
+
+	return idx
+}
+
+func TestSearchIndexSearch(t *testing.T) {
+	idx := testSearchIndex(t)
+
+	hits := idx.Search("database")
+	require.Len(t, hits, 2)
+	// title matches rank above text matches
+	assert.Equal(t, "note-2", hits[0].UUID)
+	assert.True(t, hits[0].InTitle)
+	assert.False(t, hits[0].InBody)
+	assert.Equal(t, "note-1", hits[1].UUID)
+	assert.False(t, hits[1].InTitle)
+	assert.True(t, hits[1].InBody)
+
+	// terms are stemmed, so other forms of a word match
+	hits = idx.Search("connections")
+	require.Len(t, hits, 1)
+	assert.Equal(t, "note-1", hits[0].UUID)
+
+	// every term must match
+	hits = idx.Search("database reporting")
+	require.Len(t, hits, 1)
+	assert.Equal(t, "note-2", hits[0].UUID)
+
+	assert.Empty(t, idx.Search("database shopping"))
+	assert.Empty(t, idx.Search("the"))
+
+	idx.removeDoc("note-2")
+	hits = idx.Search("database")
+	require.Len(t, hits, 1)
+	assert.Equal(t, "note-1", hits[0].UUID)
+	assert.Empty(t, idx.Postings[idx.termIDs["report"]])
+
+	// re-adding a removed note reuses nothing from its old slot
+	idx.addDoc(SearchIndexDoc{UUID: "note-2"}, "Reporting", "")
+	hits = idx.Search("report")
+	require.Len(t, hits, 1)
+	assert.Equal(t, "note-2", hits[0].UUID)
+	assert.Equal(t, 3, idx.Len())
+}
+
+func TestSearchIndexCompact(t *testing.T) {
+	idx := newSearchIndex("", nil)
+
+	for x := range 1500 {
+		idx.addDoc(SearchIndexDoc{UUID: fmt.Sprintf("note-%d", x)}, fmt.Sprintf("title %d", x), fmt.Sprintf("word%d common", x%3))
+	}
+
+	for x := range 1400 {
+		idx.removeDoc(fmt.Sprintf("note-%d", x))
+	}
+
+	idx.compact()
+	assert.Len(t, idx.Docs, 100)
+	assert.Equal(t, 100, idx.Len())
+	assert.Len(t, idx.Search("common"), 100)
+
+	hits := idx.Search("1450")
+	require.Len(t, hits, 1)
+	assert.Equal(t, "note-1450", hits[0].UUID)
+	assert.True(t, hits[0].InTitle)
+	assert.Empty(t, idx.Search("1399"))
+}
+
+func TestSearchIndexSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	s := &cache.Session{
+		Session:     &session.Session{MasterKey: "0123456789abcdef"},
+		CacheDBPath: filepath.Join(dir, "sncli-test.db"),
+	}
+
+	idx, err := LoadSearchIndex(s)
+	require.NoError(t, err)
+	assert.Zero(t, idx.Len())
+
+	idx.addDoc(SearchIndexDoc{UUID: "note-1", UpdatedAt: 1}, "Standup notes", "Database migration")
+	idx.Tags["tag-1"] = SearchIndexTag{Title: "Work", Notes: []string{"note-1"}}
+	require.NoError(t, idx.Save())
+
+	data, err := os.ReadFile(filepath.Join(dir, "sncli-test.idx"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "Standup")
+
+	loaded, err := LoadSearchIndex(s)
+	require.NoError(t, err)
+	require.Len(t, loaded.Search("migrating"), 1)
+	assert.Equal(t, map[string]bool{"note-1": true}, loaded.TaggedNotes([]string{"work"}))
+
+	// an index encrypted with another key is discarded and rebuilt
+	s.Session.MasterKey = "fedcba9876543210"
+	loaded, err = LoadSearchIndex(s)
+	require.NoError(t, err)
+	assert.Zero(t, loaded.Len())
+}
+
+func BenchmarkSearchIndexSearch(b *testing.B) {
+	idx := newSearchIndex("", nil)
+
+	for _, item := range genNotes(20000, 3) {
+		note := item.(*items.Note)
+		idx.addDoc(SearchIndexDoc{UUID: note.UUID}, note.Content.GetTitle(), note.Content.GetText())
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		idx.Search("lorem ipsum")
+	}
+}
+
+func BenchmarkLoadSearchIndex(b *testing.B) {
+	s := &cache.Session{
+		Session:     &session.Session{MasterKey: "0123456789abcdef"},
+		CacheDBPath: filepath.Join(b.TempDir(), "sncli-bench.db"),
+	}
+
+	idx, err := LoadSearchIndex(s)
+	require.NoError(b, err)
+
+	for _, item := range genNotes(20000, 3) {
+		note := item.(*items.Note)
+		idx.addDoc(SearchIndexDoc{UUID: note.UUID}, note.Content.GetTitle(), note.Content.GetText())
+	}
+
+	require.NoError(b, idx.Save())
+
+	b.ResetTimer()
+
+	for range b.N {
+		if _, err := LoadSearchIndex(s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGrepText(t *testing.T) {
+	text := "one\nTODO(alice) two\nthree\nfour\nfive\nsix\nTODO(bob) seven and TODO(carol)\neight"
+	re := regexp.MustCompile(`TODO\(\w+\)`)
+
+	groups := GrepText(text, re, 0, 0)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []GrepLine{{Number: 2, Text: "TODO(alice) two", Matches: [][]int{{0, 11}}}}, groups[0])
+	assert.Equal(t, 7, groups[1][0].Number)
+	assert.Equal(t, [][]int{{0, 9}, {20, 31}}, groups[1][0].Matches)
+
+	// context either side, without repeating lines shared by adjacent matches
+	groups = GrepText(text, re, 1, 1)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []int{1, 2, 3}, grepLineNumbers(groups[0]))
+	assert.Equal(t, []int{6, 7, 8}, grepLineNumbers(groups[1]))
+
+	groups = GrepText(text, re, 2, 2)
+	require.Len(t, groups, 1)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8}, grepLineNumbers(groups[0]))
+	assert.Empty(t, groups[0][2].Matches)
+
+	groups = GrepText("a\nb\r\nmatch\nmatch\nc", regexp.MustCompile("match"), 1, 0)
+	require.Len(t, groups, 1)
+	assert.Equal(t, []int{2, 3, 4}, grepLineNumbers(groups[0]))
+	assert.Equal(t, "b", groups[0][0].Text)
+
+	assert.Empty(t, GrepText(text, regexp.MustCompile("missing"), 3, 3))
+}
+
+func grepLineNumbers(group []GrepLine) []int {
+	numbers := make([]int, 0, len(group))
+	for _, line := range group {
+		numbers = append(numbers, line.Number)
+	}
+
+	return numbers
+}
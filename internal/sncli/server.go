@@ -0,0 +1,989 @@
+package sncli
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// DefaultServerListen is the address the REST API listens on by default
+const DefaultServerListen = "127.0.0.1:8080"
+
+// maxRequestBody is the largest request body accepted by the REST API
+const maxRequestBody = 10 << 20
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Task actions for TaskUpdate
+const (
+	TaskAdd      = "add"
+	TaskComplete = "complete"
+	TaskReopen   = "reopen"
+	TaskDelete   = "delete"
+)
+
+// APIStore reads and changes the items served by the REST API. The session
+// is filled in by the store, so inputs are passed without it.
+type APIStore interface {
+	Notes(filters items.ItemFilters) (items.Items, error)
+	AddNote(input AddNoteInput) (string, error)
+	SaveNote(note *items.Note) error
+	DeleteNotes(input DeleteNoteConfig) (int, error)
+	Tags(filters items.ItemFilters) (items.Items, error)
+	AddTags(input AddTagsInput) (AddTagsOutput, error)
+	TagNotes(input TagItemsConfig) error
+	DeleteTags(input DeleteTagConfig) (int, error)
+	Checklists() (items.Tasklists, items.AdvancedChecklists, error)
+	UpdateTask(update TaskUpdate) error
+}
+
+// TaskUpdate adds, completes, reopens or deletes a task in a checklist. Group is
+// only used with advanced checklists.
+type TaskUpdate struct {
+	Checklist string
+	Advanced  bool
+	Group     string
+	Title     string
+	Action    string
+}
+
+// SessionStore is the APIStore backed by a session and its cache
+type SessionStore struct {
+	Session *cache.Session
+}
+
+// release gives the cache back to the daemon, if one is running, once a call has finished with
+// it, so the server doesn't hold it between requests
+func (s SessionStore) release(err *error) {
+	if releaseErr := releaseDaemonLease(true); releaseErr != nil && *err == nil {
+		*err = releaseErr
+	}
+}
+
+func (s SessionStore) Notes(filters items.ItemFilters) (_ items.Items, err error) {
+	defer s.release(&err)
+
+	gnc := GetNoteConfig{Session: s.Session, Filters: filters}
+
+	return gnc.Run()
+}
+
+func (s SessionStore) AddNote(input AddNoteInput) (_ string, err error) {
+	defer s.release(&err)
+
+	input.Session = s.Session
+
+	return input.add()
+}
+
+func (s SessionStore) SaveNote(note *items.Note) (err error) {
+	defer s.release(&err)
+
+	_, err = SyncLibrary(s.Session, items.Items{note})
+
+	return err
+}
+
+func (s SessionStore) DeleteNotes(input DeleteNoteConfig) (_ int, err error) {
+	defer s.release(&err)
+
+	input.Session = s.Session
+
+	return input.Run()
+}
+
+func (s SessionStore) Tags(filters items.ItemFilters) (_ items.Items, err error) {
+	defer s.release(&err)
+
+	gtc := GetTagConfig{Session: s.Session, Filters: filters}
+
+	return gtc.Run()
+}
+
+func (s SessionStore) AddTags(input AddTagsInput) (_ AddTagsOutput, err error) {
+	defer s.release(&err)
+
+	input.Session = s.Session
+
+	return input.Run()
+}
+
+func (s SessionStore) TagNotes(input TagItemsConfig) (err error) {
+	defer s.release(&err)
+
+	input.Session = s.Session
+
+	return input.Run()
+}
+
+func (s SessionStore) DeleteTags(input DeleteTagConfig) (_ int, err error) {
+	defer s.release(&err)
+
+	input.Session = s.Session
+
+	return input.Run()
+}
+
+func (s SessionStore) Checklists() (_ items.Tasklists, _ items.AdvancedChecklists, err error) {
+	defer s.release(&err)
+
+	return getAllLists(s.Session)
+}
+
+func (s SessionStore) UpdateTask(u TaskUpdate) (err error) {
+	defer s.release(&err)
+
+	if u.Advanced {
+		switch u.Action {
+		case TaskAdd:
+			input := AddAdvancedChecklistTaskInput{Session: s.Session, UUID: u.Checklist, Title: u.Title, Group: u.Group}
+
+			return input.Run()
+		case TaskComplete:
+			input := CompleteAdvancedTaskInput{Session: s.Session, UUID: u.Checklist, Title: u.Title, Group: u.Group}
+
+			return input.Run()
+		case TaskReopen:
+			input := ReopenAdvancedTaskInput{Session: s.Session, UUID: u.Checklist, Title: u.Title, Group: u.Group}
+
+			return input.Run()
+		case TaskDelete:
+			input := DeleteAdvancedChecklistTaskInput{Session: s.Session, UUID: u.Checklist, Title: u.Title, Group: u.Group}
+
+			return input.Run()
+		}
+	} else {
+		switch u.Action {
+		case TaskAdd:
+			input := AddTaskInput{Session: s.Session, UUID: u.Checklist, Title: u.Title}
+
+			return input.Run()
+		case TaskComplete:
+			input := CompleteTaskInput{Session: s.Session, UUID: u.Checklist, Title: u.Title}
+
+			return input.Run()
+		case TaskReopen:
+			input := ReopenTaskInput{Session: s.Session, UUID: u.Checklist, Title: u.Title}
+
+			return input.Run()
+		case TaskDelete:
+			input := DeleteTaskInput{Session: s.Session, UUID: u.Checklist, Title: u.Title}
+
+			return input.Run()
+		}
+	}
+
+	return fmt.Errorf("unknown task action %q", u.Action)
+}
+
+// ChecklistJSON is a checklist as returned by the REST API. Simple checklists have
+// tasks and advanced checklists have groups of tasks.
+type ChecklistJSON struct {
+	UUID      string               `json:"uuid"`
+	Title     string               `json:"title"`
+	Type      string               `json:"type"`
+	UpdatedAt string               `json:"updated_at"`
+	Trashed   bool                 `json:"trashed"`
+	Tasks     []ChecklistTaskJSON  `json:"tasks,omitempty"`
+	Groups    []ChecklistGroupJSON `json:"groups,omitempty"`
+}
+
+type ChecklistGroupJSON struct {
+	Name  string              `json:"name"`
+	Tasks []ChecklistTaskJSON `json:"tasks"`
+}
+
+type ChecklistTaskJSON struct {
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+}
+
+func tasklistToJSON(list items.Tasklist) ChecklistJSON {
+	cl := ChecklistJSON{
+		UUID:      list.UUID,
+		Title:     list.Title,
+		Type:      "checklist",
+		UpdatedAt: list.UpdatedAt.UTC().Format(timeLayout),
+		Trashed:   list.Trashed,
+		Tasks:     []ChecklistTaskJSON{},
+	}
+
+	for _, task := range list.Tasks {
+		cl.Tasks = append(cl.Tasks, ChecklistTaskJSON{Title: task.Title, Completed: task.Completed})
+	}
+
+	return cl
+}
+
+func advancedChecklistToJSON(list items.AdvancedChecklist) ChecklistJSON {
+	cl := ChecklistJSON{
+		UUID:      list.UUID,
+		Title:     list.Title,
+		Type:      "advanced",
+		UpdatedAt: list.UpdatedAt.UTC().Format(timeLayout),
+		Trashed:   list.Trashed,
+		Groups:    []ChecklistGroupJSON{},
+	}
+
+	for _, group := range list.Groups {
+		g := ChecklistGroupJSON{Name: group.Name, Tasks: []ChecklistTaskJSON{}}
+
+		for _, task := range group.Tasks {
+			g.Tasks = append(g.Tasks, ChecklistTaskJSON{Title: task.Description, Completed: task.Completed})
+		}
+
+		cl.Groups = append(cl.Groups, g)
+	}
+
+	return cl
+}
+
+// hasTask reports whether the checklist has the task, in the group for advanced checklists
+func (cl ChecklistJSON) hasTask(group, title string) bool {
+	tasks := cl.Tasks
+
+	if cl.Type == "advanced" {
+		tasks = nil
+
+		for _, g := range cl.Groups {
+			if g.Name == group {
+				tasks = g.Tasks
+			}
+		}
+	}
+
+	for _, task := range tasks {
+		if task.Title == title {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Server serves a REST API for notes, tags and checklists. Requests must have
+// the token in an Authorization: Bearer header, except for the OpenAPI document.
+// Requests are handled one at a time as they share the session and cache.
+type Server struct {
+	Store APIStore
+	Token string
+
+	mux   *http.ServeMux
+	guard chan struct{}
+}
+
+// NewServer returns a server for the store, requiring the token
+func NewServer(store APIStore, token string) *Server {
+	srv := &Server{
+		Store: store,
+		Token: token,
+		mux:   http.NewServeMux(),
+		guard: make(chan struct{}, 1),
+	}
+
+	srv.mux.HandleFunc("GET /openapi.json", srv.openAPI)
+	srv.mux.HandleFunc("GET /v1/notes", srv.authorized(srv.listNotes))
+	srv.mux.HandleFunc("POST /v1/notes", srv.authorized(srv.createNote))
+	srv.mux.HandleFunc("GET /v1/notes/{uuid}", srv.authorized(srv.getNote))
+	srv.mux.HandleFunc("PATCH /v1/notes/{uuid}", srv.authorized(srv.updateNote))
+	srv.mux.HandleFunc("DELETE /v1/notes/{uuid}", srv.authorized(srv.deleteNote))
+	srv.mux.HandleFunc("GET /v1/tags", srv.authorized(srv.listTags))
+	srv.mux.HandleFunc("POST /v1/tags", srv.authorized(srv.createTag))
+	srv.mux.HandleFunc("POST /v1/tags/apply", srv.authorized(srv.applyTags))
+	srv.mux.HandleFunc("GET /v1/tags/{uuid}", srv.authorized(srv.getTag))
+	srv.mux.HandleFunc("DELETE /v1/tags/{uuid}", srv.authorized(srv.deleteTag))
+	srv.mux.HandleFunc("GET /v1/checklists", srv.authorized(srv.listChecklists))
+	srv.mux.HandleFunc("GET /v1/checklists/{uuid}", srv.authorized(srv.getChecklist))
+	srv.mux.HandleFunc("POST /v1/checklists/{uuid}/tasks", srv.authorized(srv.addTask))
+	srv.mux.HandleFunc("PATCH /v1/checklists/{uuid}/tasks", srv.authorized(srv.updateTask))
+	srv.mux.HandleFunc("DELETE /v1/checklists/{uuid}/tasks", srv.authorized(srv.deleteTask))
+
+	return srv
+}
+
+// GenerateAPIToken returns a random token for the REST API
+func GenerateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mux.ServeHTTP(w, r)
+}
+
+// authorized checks the bearer token and runs the handler once no other request is being handled
+func (srv *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || srv.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(srv.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sn-cli"`)
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+
+			return
+		}
+
+		select {
+		case srv.guard <- struct{}{}:
+		case <-r.Context().Done():
+			return
+		}
+
+		defer func() {
+			<-srv.guard
+		}()
+
+		next(w, r)
+	}
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, apiError{Error: err.Error()})
+}
+
+func readAPIJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+
+		return false
+	}
+
+	return true
+}
+
+func (srv *Server) openAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPIDocument)
+}
+
+func uuidFilter(contentType, uuid string) items.ItemFilters {
+	return items.ItemFilters{
+		Filters: []items.Filter{{Type: contentType, Key: "uuid", Comparison: "==", Value: uuid}},
+	}
+}
+
+func (srv *Server) findNote(uuid string) (*items.Note, error) {
+	notes, err := srv.Store.Notes(uuidFilter(common.SNItemTypeNote, uuid))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range RemoveDeleted(notes) {
+		if note, ok := item.(*items.Note); ok && note.UUID == uuid {
+			return note, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (srv *Server) findTag(uuid string) (*items.Tag, error) {
+	tags, err := srv.Store.Tags(uuidFilter(common.SNItemTypeTag, uuid))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range RemoveDeleted(tags) {
+		if tag, ok := item.(*items.Tag); ok && tag.UUID == uuid {
+			return tag, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (srv *Server) listNotes(w http.ResponseWriter, r *http.Request) {
+	filters := items.ItemFilters{Filters: []items.Filter{{Type: common.SNItemTypeNote}}}
+
+	query := r.URL.Query()
+
+	for _, f := range []struct{ param, key string }{{"title", "Title"}, {"text", "Text"}} {
+		for _, value := range query[f.param] {
+			filters.Filters = append(filters.Filters, items.Filter{
+				Type:       common.SNItemTypeNote,
+				Key:        f.key,
+				Comparison: "contains",
+				Value:      value,
+			})
+		}
+	}
+
+	tagged, err := srv.taggedNotes(query["tag"])
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	notes, err := srv.Store.Notes(filters)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	out := []NoteJSON{}
+
+	for _, item := range RemoveDeleted(notes) {
+		note, ok := item.(*items.Note)
+		if !ok || (tagged != nil && !tagged[note.UUID]) {
+			continue
+		}
+
+		out = append(out, NoteToJSON(note))
+	}
+
+	writeAPIJSON(w, http.StatusOK, map[string][]NoteJSON{"items": out})
+}
+
+// taggedNotes returns the notes referenced by every tag title, matched case-insensitively,
+// or nil if there are no titles
+func (srv *Server) taggedNotes(titles []string) (map[string]bool, error) {
+	if len(titles) == 0 {
+		return nil, nil
+	}
+
+	tags, err := srv.Store.Tags(items.ItemFilters{Filters: []items.Filter{{Type: common.SNItemTypeTag}}})
+	if err != nil {
+		return nil, err
+	}
+
+	var tagged map[string]bool
+
+	for _, title := range titles {
+		referenced := make(map[string]bool)
+
+		for _, item := range RemoveDeleted(tags) {
+			tag, ok := item.(*items.Tag)
+			if !ok || !strings.EqualFold(tag.Content.GetTitle(), title) {
+				continue
+			}
+
+			for _, ref := range tag.Content.References() {
+				if ref.ContentType == common.SNItemTypeNote && (tagged == nil || tagged[ref.UUID]) {
+					referenced[ref.UUID] = true
+				}
+			}
+		}
+
+		tagged = referenced
+	}
+
+	return tagged, nil
+}
+
+func (srv *Server) getNote(w http.ResponseWriter, r *http.Request) {
+	note, err := srv.findNote(r.PathValue("uuid"))
+
+	switch {
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+	case note == nil:
+		writeAPIError(w, http.StatusNotFound, errors.New("note not found"))
+	default:
+		writeAPIJSON(w, http.StatusOK, NoteToJSON(note))
+	}
+}
+
+type createNoteRequest struct {
+	Title string   `json:"title"`
+	Text  string   `json:"text"`
+	Tags  []string `json:"tags"`
+}
+
+func (srv *Server) createNote(w http.ResponseWriter, r *http.Request) {
+	var req createNoteRequest
+	if !readAPIJSON(w, r, &req) {
+		return
+	}
+
+	if strings.TrimSpace(req.Title) == "" {
+		writeAPIError(w, http.StatusBadRequest, errors.New("title is required"))
+
+		return
+	}
+
+	uuid, err := srv.Store.AddNote(AddNoteInput{Title: req.Title, Text: req.Text, Tags: req.Tags})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	note, err := srv.findNote(uuid)
+	if err != nil || note == nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Errorf("note %s was added but couldn't be read back: %v", uuid, err))
+
+		return
+	}
+
+	w.Header().Set("Location", "/v1/notes/"+uuid)
+	writeAPIJSON(w, http.StatusCreated, NoteToJSON(note))
+}
+
+type updateNoteRequest struct {
+	Title   *string `json:"title"`
+	Text    *string `json:"text"`
+	Pinned  *bool   `json:"pinned"`
+	Trashed *bool   `json:"trashed"`
+}
+
+func (srv *Server) updateNote(w http.ResponseWriter, r *http.Request) {
+	var req updateNoteRequest
+	if !readAPIJSON(w, r, &req) {
+		return
+	}
+
+	note, err := srv.findNote(r.PathValue("uuid"))
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	if note == nil {
+		writeAPIError(w, http.StatusNotFound, errors.New("note not found"))
+
+		return
+	}
+
+	if req.Title != nil && strings.TrimSpace(*req.Title) == "" {
+		writeAPIError(w, http.StatusBadRequest, errors.New("title can't be empty"))
+
+		return
+	}
+
+	// the library's copy-on-change helpers leave the note read from the store untouched
+	var lib Library
+
+	updated := note
+
+	if req.Title != nil || req.Text != nil {
+		title, text := updated.Content.GetTitle(), updated.Content.GetText()
+		if req.Title != nil {
+			title = *req.Title
+		}
+
+		if req.Text != nil {
+			text = *req.Text
+		}
+
+		updated = lib.EditNote(updated, title, text)[0].(*items.Note)
+	}
+
+	if req.Pinned != nil {
+		updated = lib.PinNote(updated, *req.Pinned)[0].(*items.Note)
+	}
+
+	if req.Trashed != nil {
+		updated = lib.TrashNote(updated, *req.Trashed)[0].(*items.Note)
+	}
+
+	if updated != note {
+		if err = srv.Store.SaveNote(updated); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+
+			return
+		}
+	}
+
+	writeAPIJSON(w, http.StatusOK, NoteToJSON(updated))
+}
+
+func (srv *Server) deleteNote(w http.ResponseWriter, r *http.Request) {
+	uuid := r.PathValue("uuid")
+
+	note, err := srv.findNote(uuid)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	if note == nil {
+		writeAPIError(w, http.StatusNotFound, errors.New("note not found"))
+
+		return
+	}
+
+	if _, err = srv.Store.DeleteNotes(DeleteNoteConfig{NoteUUIDs: []string{uuid}}); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) listTags(w http.ResponseWriter, r *http.Request) {
+	filters := items.ItemFilters{Filters: []items.Filter{{Type: common.SNItemTypeTag}}}
+
+	for _, title := range r.URL.Query()["title"] {
+		filters.Filters = append(filters.Filters, items.Filter{
+			Type:       common.SNItemTypeTag,
+			Key:        "Title",
+			Comparison: "contains",
+			Value:      title,
+		})
+	}
+
+	tags, err := srv.Store.Tags(filters)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	out := []TagJSON{}
+
+	for _, item := range RemoveDeleted(tags) {
+		if tag, ok := item.(*items.Tag); ok {
+			out = append(out, TagToJSON(tag))
+		}
+	}
+
+	writeAPIJSON(w, http.StatusOK, map[string][]TagJSON{"tags": out})
+}
+
+func (srv *Server) getTag(w http.ResponseWriter, r *http.Request) {
+	tag, err := srv.findTag(r.PathValue("uuid"))
+
+	switch {
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+	case tag == nil:
+		writeAPIError(w, http.StatusNotFound, errors.New("tag not found"))
+	default:
+		writeAPIJSON(w, http.StatusOK, TagToJSON(tag))
+	}
+}
+
+type createTagRequest struct {
+	Title      string `json:"title"`
+	ParentUUID string `json:"parent_uuid"`
+}
+
+func (srv *Server) createTag(w http.ResponseWriter, r *http.Request) {
+	var req createTagRequest
+	if !readAPIJSON(w, r, &req) {
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		writeAPIError(w, http.StatusBadRequest, errors.New("title is required"))
+
+		return
+	}
+
+	out, err := srv.Store.AddTags(AddTagsInput{Tags: []string{title}, ParentUUID: req.ParentUUID})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	tags, err := srv.Store.Tags(items.ItemFilters{
+		Filters: []items.Filter{{Type: common.SNItemTypeTag, Key: "Title", Comparison: "==", Value: title}},
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	tags = RemoveDeleted(tags)
+	if len(tags) == 0 {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Errorf("tag %q was added but couldn't be read back", title))
+
+		return
+	}
+
+	tag := tags[0].(*items.Tag)
+
+	// an existing tag with the title is returned as is
+	status := http.StatusOK
+	if len(out.Added) > 0 {
+		status = http.StatusCreated
+		w.Header().Set("Location", "/v1/tags/"+tag.UUID)
+	}
+
+	writeAPIJSON(w, status, TagToJSON(tag))
+}
+
+type applyTagsRequest struct {
+	Tags      []string `json:"tags"`
+	NoteUUIDs []string `json:"note_uuids"`
+	Title     string   `json:"title"`
+	Text      string   `json:"text"`
+}
+
+func (srv *Server) applyTags(w http.ResponseWriter, r *http.Request) {
+	var req applyTagsRequest
+	if !readAPIJSON(w, r, &req) {
+		return
+	}
+
+	var tags []string
+
+	for _, tag := range req.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	switch {
+	case len(tags) == 0:
+		writeAPIError(w, http.StatusBadRequest, errors.New("tags are required"))
+
+		return
+	case len(req.NoteUUIDs) == 0 && strings.TrimSpace(req.Title) == "" && strings.TrimSpace(req.Text) == "":
+		writeAPIError(w, http.StatusBadRequest, errors.New("note_uuids, title or text is required to match notes"))
+
+		return
+	}
+
+	err := srv.Store.TagNotes(TagItemsConfig{
+		FindTitle: req.Title,
+		FindText:  req.Text,
+		FindUUIDs: req.NoteUUIDs,
+		NewTags:   tags,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "note not found" {
+			status = http.StatusNotFound
+		}
+
+		writeAPIError(w, status, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) deleteTag(w http.ResponseWriter, r *http.Request) {
+	uuid := r.PathValue("uuid")
+
+	tag, err := srv.findTag(uuid)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	if tag == nil {
+		writeAPIError(w, http.StatusNotFound, errors.New("tag not found"))
+
+		return
+	}
+
+	if _, err = srv.Store.DeleteTags(DeleteTagConfig{TagUUIDs: []string{uuid}}); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) checklists() ([]ChecklistJSON, error) {
+	std, adv, err := srv.Store.Checklists()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []ChecklistJSON{}
+
+	for _, list := range std {
+		out = append(out, tasklistToJSON(list))
+	}
+
+	for _, list := range adv {
+		out = append(out, advancedChecklistToJSON(list))
+	}
+
+	return out, nil
+}
+
+func (srv *Server) findChecklist(uuid string) (*ChecklistJSON, error) {
+	lists, err := srv.checklists()
+	if err != nil {
+		return nil, err
+	}
+
+	for x := range lists {
+		if lists[x].UUID == uuid {
+			return &lists[x], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (srv *Server) listChecklists(w http.ResponseWriter, _ *http.Request) {
+	lists, err := srv.checklists()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, map[string][]ChecklistJSON{"checklists": lists})
+}
+
+func (srv *Server) getChecklist(w http.ResponseWriter, r *http.Request) {
+	list, err := srv.findChecklist(r.PathValue("uuid"))
+
+	switch {
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+	case list == nil:
+		writeAPIError(w, http.StatusNotFound, errors.New("checklist not found"))
+	default:
+		writeAPIJSON(w, http.StatusOK, list)
+	}
+}
+
+type taskRequest struct {
+	Title     string `json:"title"`
+	Group     string `json:"group"`
+	Completed *bool  `json:"completed"`
+}
+
+func (srv *Server) addTask(w http.ResponseWriter, r *http.Request) {
+	var req taskRequest
+	if !readAPIJSON(w, r, &req) {
+		return
+	}
+
+	srv.changeTask(w, r, req, TaskAdd)
+}
+
+func (srv *Server) updateTask(w http.ResponseWriter, r *http.Request) {
+	var req taskRequest
+	if !readAPIJSON(w, r, &req) {
+		return
+	}
+
+	if req.Completed == nil {
+		writeAPIError(w, http.StatusBadRequest, errors.New("completed is required"))
+
+		return
+	}
+
+	action := TaskReopen
+	if *req.Completed {
+		action = TaskComplete
+	}
+
+	srv.changeTask(w, r, req, action)
+}
+
+func (srv *Server) deleteTask(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	srv.changeTask(w, r, taskRequest{Title: query.Get("title"), Group: query.Get("group")}, TaskDelete)
+}
+
+// changeTask checks the checklist and task exist, then makes the change and returns the updated checklist
+func (srv *Server) changeTask(w http.ResponseWriter, r *http.Request, req taskRequest, action string) {
+	if strings.TrimSpace(req.Title) == "" {
+		writeAPIError(w, http.StatusBadRequest, errors.New("title is required"))
+
+		return
+	}
+
+	uuid := r.PathValue("uuid")
+
+	list, err := srv.findChecklist(uuid)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	if list == nil {
+		writeAPIError(w, http.StatusNotFound, errors.New("checklist not found"))
+
+		return
+	}
+
+	advanced := list.Type == "advanced"
+	if advanced && req.Group == "" {
+		writeAPIError(w, http.StatusBadRequest, errors.New("group is required for advanced checklists"))
+
+		return
+	}
+
+	if action != TaskAdd && !list.hasTask(req.Group, req.Title) {
+		writeAPIError(w, http.StatusNotFound, errors.New("task not found"))
+
+		return
+	}
+
+	if err = srv.Store.UpdateTask(TaskUpdate{
+		Checklist: uuid,
+		Advanced:  advanced,
+		Group:     req.Group,
+		Title:     req.Title,
+		Action:    action,
+	}); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	if list, err = srv.findChecklist(uuid); err != nil || list == nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Errorf("checklist was updated but couldn't be read back: %v", err))
+
+		return
+	}
+
+	status := http.StatusOK
+	if action == TaskAdd {
+		status = http.StatusCreated
+	}
+
+	writeAPIJSON(w, status, list)
+}
+
+// HTTPServer returns an http.Server for the server on the address
+func (srv *Server) HTTPServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+}
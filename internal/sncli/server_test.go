@@ -0,0 +1,387 @@
+package sncli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAPIToken = "secret"
+
+// memoryStore is an APIStore holding items in memory
+type memoryStore struct {
+	notes    []*items.Note
+	tags     []*items.Tag
+	std      items.Tasklists
+	adv      items.AdvancedChecklists
+	tagged   []TagItemsConfig
+	updates  []TaskUpdate
+	failWith error
+}
+
+func (m *memoryStore) Notes(filters items.ItemFilters) (items.Items, error) {
+	if m.failWith != nil {
+		return nil, m.failWith
+	}
+
+	var all items.Items
+	for _, note := range m.notes {
+		all = append(all, note)
+	}
+
+	all.Filter(filters)
+
+	return all, nil
+}
+
+func (m *memoryStore) AddNote(input AddNoteInput) (string, error) {
+	note, err := items.NewNote(input.Title, input.Text, nil)
+	if err != nil {
+		return "", err
+	}
+
+	m.notes = append(m.notes, &note)
+
+	return note.UUID, nil
+}
+
+func (m *memoryStore) SaveNote(note *items.Note) error {
+	for x := range m.notes {
+		if m.notes[x].UUID == note.UUID {
+			m.notes[x] = note
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) DeleteNotes(input DeleteNoteConfig) (int, error) {
+	m.notes = slices.DeleteFunc(m.notes, func(note *items.Note) bool {
+		return slices.Contains(input.NoteUUIDs, note.UUID)
+	})
+
+	return len(input.NoteUUIDs), nil
+}
+
+func (m *memoryStore) Tags(filters items.ItemFilters) (items.Items, error) {
+	var all items.Items
+	for _, tag := range m.tags {
+		all = append(all, tag)
+	}
+
+	all.Filter(filters)
+
+	return all, nil
+}
+
+func (m *memoryStore) AddTags(input AddTagsInput) (AddTagsOutput, error) {
+	var out AddTagsOutput
+
+	for _, title := range input.Tags {
+		if slices.ContainsFunc(m.tags, func(tag *items.Tag) bool { return tag.Content.GetTitle() == title }) {
+			out.Existing = append(out.Existing, title)
+
+			continue
+		}
+
+		tag, err := items.NewTag(title, nil)
+		if err != nil {
+			return out, err
+		}
+
+		m.tags = append(m.tags, &tag)
+		out.Added = append(out.Added, title)
+	}
+
+	return out, nil
+}
+
+func (m *memoryStore) TagNotes(input TagItemsConfig) error {
+	m.tagged = append(m.tagged, input)
+
+	return nil
+}
+
+func (m *memoryStore) DeleteTags(input DeleteTagConfig) (int, error) {
+	m.tags = slices.DeleteFunc(m.tags, func(tag *items.Tag) bool {
+		return slices.Contains(input.TagUUIDs, tag.UUID)
+	})
+
+	return len(input.TagUUIDs), nil
+}
+
+func (m *memoryStore) Checklists() (items.Tasklists, items.AdvancedChecklists, error) {
+	return m.std, m.adv, nil
+}
+
+func (m *memoryStore) UpdateTask(u TaskUpdate) error {
+	m.updates = append(m.updates, u)
+
+	if u.Advanced {
+		return nil
+	}
+
+	for x := range m.std {
+		if m.std[x].UUID != u.Checklist {
+			continue
+		}
+
+		switch u.Action {
+		case TaskAdd:
+			m.std[x].Tasks = append(m.std[x].Tasks, items.Task{Title: u.Title})
+		case TaskComplete:
+			return m.std[x].CompleteTask(u.Title)
+		case TaskDelete:
+			return m.std[x].DeleteTask(u.Title)
+		}
+	}
+
+	return nil
+}
+
+func testServer(t *testing.T) (*memoryStore, *httptest.Server) {
+	t.Helper()
+
+	store := &memoryStore{}
+
+	for _, title := range []string{"Standup", "Groceries"} {
+		_, err := store.AddNote(AddNoteInput{Title: title, Text: title + " text"})
+		require.NoError(t, err)
+	}
+
+	work, err := items.NewTag("Work", items.ItemReferences{{UUID: store.notes[0].UUID, ContentType: common.SNItemTypeNote}})
+	require.NoError(t, err)
+
+	store.tags = append(store.tags, &work)
+
+	store.std = items.Tasklists{{UUID: "list-1", Title: "Chores", Tasks: items.Tasks{{Title: "dishes"}}}}
+	store.adv = items.AdvancedChecklists{{
+		UUID:   "list-2",
+		Title:  "Project",
+		Groups: []items.AdvancedChecklistGroup{{Name: "todo", Tasks: items.AdvancedChecklistTasks{{Description: "plan"}}}},
+	}}
+
+	srv := httptest.NewServer(NewServer(store, testAPIToken))
+	t.Cleanup(srv.Close)
+
+	return store, srv
+}
+
+func apiRequest(t *testing.T, srv *httptest.Server, method, path, body string, out any) int {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testAPIToken)
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+
+	return resp.StatusCode
+}
+
+func TestServerAuth(t *testing.T) {
+	_, srv := testServer(t)
+
+	for _, header := range []string{"", "Bearer wrong", "Basic " + testAPIToken} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/notes", nil)
+		require.NoError(t, err)
+
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, header)
+		assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer")
+	}
+
+	// the OpenAPI document doesn't need the token and describes every route
+	resp, err := srv.Client().Get(srv.URL + "/openapi.json")
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Contains(t, doc.Paths["/v1/notes/{uuid}"], "patch")
+	assert.Contains(t, doc.Paths["/v1/checklists/{uuid}/tasks"], "delete")
+}
+
+func TestServerNotes(t *testing.T) {
+	store, srv := testServer(t)
+
+	var list struct {
+		Items []NoteJSON `json:"items"`
+	}
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodGet, "/v1/notes", "", &list))
+	assert.Len(t, list.Items, 2)
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodGet, "/v1/notes?title=Grocer", "", &list))
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "Groceries", list.Items[0].Content.Title)
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodGet, "/v1/notes?tag=work", "", &list))
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "Standup", list.Items[0].Content.Title)
+
+	var note NoteJSON
+	require.Equal(t, http.StatusCreated, apiRequest(t, srv, http.MethodPost, "/v1/notes", `{"title":"Ideas","text":"first"}`, &note))
+	assert.Equal(t, "Ideas", note.Content.Title)
+	assert.Equal(t, common.SNItemTypeNote, note.ContentType)
+	assert.Len(t, store.notes, 3)
+
+	var apiErr apiError
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, srv, http.MethodPost, "/v1/notes", `{"text":"no title"}`, &apiErr))
+	assert.Equal(t, "title is required", apiErr.Error)
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, srv, http.MethodPost, "/v1/notes", `{"title":"x","unknown":1}`, &apiErr))
+
+	var updated NoteJSON
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodPatch, "/v1/notes/"+note.UUID, `{"text":"second","pinned":true}`, &updated))
+	assert.Equal(t, "Ideas", updated.Content.Title)
+	assert.Equal(t, "second", updated.Content.Text)
+	assert.True(t, updated.Content.AppData.OrgStandardNotesSN.Pinned)
+	assert.Equal(t, "second", store.notes[2].Content.GetText())
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodGet, "/v1/notes/"+note.UUID, "", &note))
+	assert.Equal(t, "second", note.Content.Text)
+
+	assert.Equal(t, http.StatusNoContent, apiRequest(t, srv, http.MethodDelete, "/v1/notes/"+note.UUID, "", nil))
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, srv, http.MethodGet, "/v1/notes/"+note.UUID, "", &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, srv, http.MethodDelete, "/v1/notes/"+note.UUID, "", &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, srv, http.MethodPatch, "/v1/notes/missing", `{"text":"x"}`, &apiErr))
+
+	store.failWith = errors.New("sync failed")
+	assert.Equal(t, http.StatusInternalServerError, apiRequest(t, srv, http.MethodGet, "/v1/notes", "", &apiErr))
+	assert.Equal(t, "sync failed", apiErr.Error)
+}
+
+func TestServerTags(t *testing.T) {
+	store, srv := testServer(t)
+
+	var list struct {
+		Tags []TagJSON `json:"tags"`
+	}
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodGet, "/v1/tags", "", &list))
+	require.Len(t, list.Tags, 1)
+	assert.Equal(t, "Work", list.Tags[0].Content.Title)
+
+	var tag TagJSON
+	require.Equal(t, http.StatusCreated, apiRequest(t, srv, http.MethodPost, "/v1/tags", `{"title":"Home"}`, &tag))
+	assert.Equal(t, "Home", tag.Content.Title)
+
+	// existing tags are returned as they are
+	var existing TagJSON
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodPost, "/v1/tags", `{"title":"Home"}`, &existing))
+	assert.Equal(t, tag.UUID, existing.UUID)
+
+	var apiErr apiError
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, srv, http.MethodPost, "/v1/tags/apply", `{"tags":["Home"]}`, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, srv, http.MethodPost, "/v1/tags/apply", `{"tags":[" "],"title":"x"}`, &apiErr))
+
+	noteUUID := store.notes[1].UUID
+	require.Equal(t, http.StatusNoContent, apiRequest(t, srv, http.MethodPost, "/v1/tags/apply", `{"tags":["Home"],"note_uuids":["`+noteUUID+`"]}`, nil))
+	require.Len(t, store.tagged, 1)
+	assert.Equal(t, []string{noteUUID}, store.tagged[0].FindUUIDs)
+	assert.Equal(t, []string{"Home"}, store.tagged[0].NewTags)
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodGet, "/v1/tags/"+tag.UUID, "", &tag))
+	assert.Equal(t, http.StatusNoContent, apiRequest(t, srv, http.MethodDelete, "/v1/tags/"+tag.UUID, "", nil))
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, srv, http.MethodGet, "/v1/tags/"+tag.UUID, "", &apiErr))
+}
+
+func TestServerChecklists(t *testing.T) {
+	store, srv := testServer(t)
+
+	var list struct {
+		Checklists []ChecklistJSON `json:"checklists"`
+	}
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodGet, "/v1/checklists", "", &list))
+	require.Len(t, list.Checklists, 2)
+	assert.Equal(t, "advanced", list.Checklists[1].Type)
+	assert.Equal(t, "plan", list.Checklists[1].Groups[0].Tasks[0].Title)
+
+	var cl ChecklistJSON
+	require.Equal(t, http.StatusCreated, apiRequest(t, srv, http.MethodPost, "/v1/checklists/list-1/tasks", `{"title":"laundry"}`, &cl))
+	assert.Equal(t, []ChecklistTaskJSON{{Title: "dishes"}, {Title: "laundry"}}, cl.Tasks)
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodPatch, "/v1/checklists/list-1/tasks", `{"title":"dishes","completed":true}`, &cl))
+	assert.True(t, cl.Tasks[0].Completed)
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodDelete, "/v1/checklists/list-1/tasks?title=laundry", "", &cl))
+	assert.Len(t, cl.Tasks, 1)
+
+	var apiErr apiError
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, srv, http.MethodDelete, "/v1/checklists/list-1/tasks?title=missing", "", &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, srv, http.MethodGet, "/v1/checklists/missing", "", &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, srv, http.MethodPatch, "/v1/checklists/list-1/tasks", `{"title":"dishes"}`, &apiErr))
+
+	// advanced checklist tasks are in groups
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, srv, http.MethodPost, "/v1/checklists/list-2/tasks", `{"title":"build"}`, &apiErr))
+	assert.Equal(t, "group is required for advanced checklists", apiErr.Error)
+
+	require.Equal(t, http.StatusOK, apiRequest(t, srv, http.MethodPatch, "/v1/checklists/list-2/tasks", `{"title":"plan","group":"todo","completed":true}`, &cl))
+	assert.Equal(t, TaskUpdate{Checklist: "list-2", Advanced: true, Group: "todo", Title: "plan", Action: TaskComplete}, store.updates[len(store.updates)-1])
+}
+
+func TestSessionStoreReleasesDaemonCache(t *testing.T) {
+	d, _ := testDaemon(t)
+
+	store := SessionStore{Session: testDaemonSession(t, d)}
+
+	// hand back anything still held so the daemon can stop if the store keeps the cache
+	t.Cleanup(func() {
+		_ = releaseDaemonLease(false)
+	})
+
+	client, err := DialDaemon(d.Session.CacheDBPath)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	// each request gives the cache back, so the next one, and other commands, can have it
+	for range 2 {
+		_, err = store.Notes(items.ItemFilters{})
+		require.NoError(t, err)
+
+		status, err := client.Status()
+		require.NoError(t, err)
+		require.False(t, status.Leased)
+	}
+
+	require.NoError(t, client.Call("acquire", nil, nil))
+	require.NoError(t, client.Call("release", nil, nil))
+}
@@ -0,0 +1,500 @@
+package sncli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// vectorCacheVersion is increased whenever the stored format changes, forcing vectors to be recalculated
+const vectorCacheVersion = 1
+
+// tfidfEmbedderName identifies vectors from the TF-IDF embedder, including the tokenising they depend on
+const tfidfEmbedderName = "tfidf-v1"
+
+// Embedder turns notes into vectors that are compared by cosine similarity to find related notes
+type Embedder interface {
+	// Name identifies the embedder and its model, so vectors cached by another aren't reused
+	Name() string
+	// Embed returns a vector for each note, in the same order
+	Embed(notes []*items.Note) ([]Vector, error)
+}
+
+// CorpusWeighter is implemented by embedders whose vectors depend on all the notes being compared,
+// such as TF-IDF, where a term's weight depends on how many notes contain it
+type CorpusWeighter interface {
+	// Weigh returns the vectors, keyed by note UUID, weighted against each other
+	Weigh(vectors map[string]Vector) map[string]Vector
+}
+
+// Vector is a note's embedding. Term based embedders set Terms and models set Values.
+type Vector struct {
+	Terms  map[string]float64
+	Values []float32
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors, 0 if either is empty
+func CosineSimilarity(a, b Vector) float64 {
+	var dot, normA, normB float64
+
+	if len(a.Values) > 0 || len(b.Values) > 0 {
+		if len(a.Values) != len(b.Values) {
+			return 0
+		}
+
+		for x := range a.Values {
+			dot += float64(a.Values[x]) * float64(b.Values[x])
+			normA += float64(a.Values[x]) * float64(a.Values[x])
+			normB += float64(b.Values[x]) * float64(b.Values[x])
+		}
+	} else {
+		for term, weight := range a.Terms {
+			dot += weight * b.Terms[term]
+			normA += weight * weight
+		}
+
+		for _, weight := range b.Terms {
+			normB += weight * weight
+		}
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// TFIDFEmbedder embeds notes as TF-IDF vectors, using the keywords found by ContentAnalyzer
+type TFIDFEmbedder struct {
+	analyzer *ContentAnalyzer
+}
+
+// NewTFIDFEmbedder creates the default embedder, which needs no external model
+func NewTFIDFEmbedder() *TFIDFEmbedder {
+	return &TFIDFEmbedder{analyzer: NewContentAnalyzer(nil)}
+}
+
+// Name identifies the embedder
+func (e *TFIDFEmbedder) Name() string {
+	return tfidfEmbedderName
+}
+
+// Embed returns each note's term frequencies, which only depend on the note itself so can be
+// cached. Weigh applies the inverse document frequencies.
+func (e *TFIDFEmbedder) Embed(notes []*items.Note) ([]Vector, error) {
+	vectors := make([]Vector, 0, len(notes))
+
+	for _, note := range notes {
+		vectors = append(vectors, Vector{Terms: e.analyzer.termFrequencies(noteAnalysisText(note))})
+	}
+
+	return vectors, nil
+}
+
+// Weigh multiplies term frequencies by inverse document frequencies, dropping keywords that
+// appear in too few notes to relate them, as ContentAnalyzer does
+func (e *TFIDFEmbedder) Weigh(vectors map[string]Vector) map[string]Vector {
+	df := make(map[string]int)
+
+	for _, vector := range vectors {
+		for term := range vector.Terms {
+			df[term]++
+		}
+	}
+
+	numDocs := float64(len(vectors))
+	weighted := make(map[string]Vector, len(vectors))
+
+	for uuid, vector := range vectors {
+		terms := make(map[string]float64, len(vector.Terms))
+
+		for term, termFreq := range vector.Terms {
+			if df[term] < e.analyzer.minKeywordFreq {
+				continue
+			}
+
+			terms[term] = termFreq * math.Log(numDocs/float64(df[term]))
+		}
+
+		weighted[uuid] = Vector{Terms: terms}
+	}
+
+	return weighted
+}
+
+// HTTPEmbedder embeds notes using a local model served over HTTP with the Ollama embed API,
+// which takes {"model", "input"} and returns {"embeddings"}
+type HTTPEmbedder struct {
+	// URL is the embed endpoint, e.g. http://localhost:11434/api/embed
+	URL    string
+	Model  string
+	Client *http.Client
+	// BatchSize is the number of notes sent in each request, 32 if unset
+	BatchSize int
+}
+
+// Name identifies the embedder and model
+func (e *HTTPEmbedder) Name() string {
+	return "http:" + e.URL + "#" + e.Model
+}
+
+// Embed requests the vectors for the notes in batches
+func (e *HTTPEmbedder) Embed(notes []*items.Note) ([]Vector, error) {
+	batchSize := e.BatchSize
+	if batchSize <= 0 {
+		batchSize = 32
+	}
+
+	vectors := make([]Vector, 0, len(notes))
+
+	for start := 0; start < len(notes); start += batchSize {
+		input := make([]string, 0, batchSize)
+		for _, note := range notes[start:min(start+batchSize, len(notes))] {
+			input = append(input, strings.TrimSpace(note.Content.GetTitle()+"\n\n"+note.Content.GetText()))
+		}
+
+		embeddings, err := e.request(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, values := range embeddings {
+			vectors = append(vectors, Vector{Values: values})
+		}
+	}
+
+	return vectors, nil
+}
+
+func (e *HTTPEmbedder) request(input []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": e.Model, "input": input})
+	if err != nil {
+		return nil, err
+	}
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+
+	resp, err := client.Post(e.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+		return nil, fmt.Errorf("embedding request failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var out struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
+	}
+
+	if len(out.Embeddings) != len(input) {
+		return nil, fmt.Errorf("embedding response has %d vectors for %d notes", len(out.Embeddings), len(input))
+	}
+
+	return out.Embeddings, nil
+}
+
+// VectorCache holds the vector for each note by revision, so only changed notes are embedded again.
+// It is stored encrypted alongside the cache, like the search index.
+type VectorCache struct {
+	Version  int
+	Embedder string
+	Notes    map[string]CachedVector
+
+	path string
+	key  []byte
+}
+
+// CachedVector is a note's vector for the revision updated at UpdatedAt
+type CachedVector struct {
+	UpdatedAt int64
+	Vector    Vector
+}
+
+// vectorCachePath returns the location of the vector cache for a cache
+func vectorCachePath(cacheDBPath string) string {
+	return strings.TrimSuffix(cacheDBPath, filepath.Ext(cacheDBPath)) + ".vec"
+}
+
+// LoadVectorCache reads the vectors cached by the embedder. An empty cache is returned if none
+// exists, it can't be read, or it was written by a different embedder.
+func LoadVectorCache(s *cache.Session, embedder string) (*VectorCache, error) {
+	if s.CacheDBPath == "" {
+		return nil, errors.New("cache path is not set")
+	}
+
+	if s.Session == nil || s.MasterKey == "" {
+		return nil, errors.New("session has no master key to encrypt the vector cache with")
+	}
+
+	key := sha256.Sum256([]byte("sn-cli vector cache\x00" + s.MasterKey))
+
+	vc := &VectorCache{
+		Version:  vectorCacheVersion,
+		Embedder: embedder,
+		Notes:    make(map[string]CachedVector),
+		path:     vectorCachePath(s.CacheDBPath),
+		key:      key[:],
+	}
+
+	var stored VectorCache
+	if err := readEncryptedFile(vc.path, vc.key, &stored); err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errEncryptedFileUnreadable) {
+			return vc, nil
+		}
+
+		return nil, fmt.Errorf("failed to read vector cache: %w", err)
+	}
+
+	if stored.Version != vectorCacheVersion || stored.Embedder != embedder || stored.Notes == nil {
+		return vc, nil
+	}
+
+	vc.Notes = stored.Notes
+
+	return vc, nil
+}
+
+// Save writes the vector cache, encrypted, replacing the previous copy atomically
+func (vc *VectorCache) Save() error {
+	if err := writeEncryptedFile(vc.path, vc.key, vc); err != nil {
+		return fmt.Errorf("failed to write vector cache: %w", err)
+	}
+
+	return nil
+}
+
+// Update embeds the notes in the cache that are new or have changed since their vector was
+// cached and drops the vectors of removed notes. It reports whether the cache changed.
+func (vc *VectorCache) Update(s *cache.Session, cachedItems cache.Items, embedder Embedder) (bool, error) {
+	live := make(map[string]bool)
+
+	var stale cache.Items
+
+	for _, ci := range cachedItems {
+		if ci.Deleted || ci.ContentType != common.SNItemTypeNote {
+			continue
+		}
+
+		live[ci.UUID] = true
+
+		if cv, ok := vc.Notes[ci.UUID]; !ok || cv.UpdatedAt != ci.UpdatedAtTimestamp {
+			stale = append(stale, ci)
+		}
+	}
+
+	changed := false
+
+	for uuid := range vc.Notes {
+		if !live[uuid] {
+			delete(vc.Notes, uuid)
+
+			changed = true
+		}
+	}
+
+	if len(stale) == 0 {
+		return changed, nil
+	}
+
+	if len(s.ItemsKeys) == 0 {
+		if err := loadCachedItemsKeys(s, cachedItems); err != nil {
+			return changed, err
+		}
+	}
+
+	decrypted, err := stale.ToItems(s)
+	if err != nil {
+		return changed, fmt.Errorf("failed to decrypt notes to embed: %w", err)
+	}
+
+	var notes []*items.Note
+
+	for _, item := range decrypted {
+		if note, ok := item.(*items.Note); ok {
+			notes = append(notes, note)
+		}
+	}
+
+	vectors, err := embedder.Embed(notes)
+	if err != nil {
+		return changed, err
+	}
+
+	byUUID := make(map[string]Vector, len(notes))
+	for x, note := range notes {
+		byUUID[note.UUID] = vectors[x]
+	}
+
+	// notes that can't be decrypted are cached empty so they aren't retried until they change
+	for _, ci := range stale {
+		vc.Notes[ci.UUID] = CachedVector{UpdatedAt: ci.UpdatedAtTimestamp, Vector: byUUID[ci.UUID]}
+	}
+
+	return true, nil
+}
+
+// Vectors returns the cached vectors by note UUID
+func (vc *VectorCache) Vectors() map[string]Vector {
+	vectors := make(map[string]Vector, len(vc.Notes))
+	for uuid, cv := range vc.Notes {
+		vectors[uuid] = cv.Vector
+	}
+
+	return vectors
+}
+
+// SimilarConfig holds configuration for finding the notes most similar to a note
+type SimilarConfig struct {
+	Session *cache.Session
+	// UUID is the note to find similar notes for
+	UUID string
+	// Embedder creates the vectors compared, a TFIDFEmbedder if nil
+	Embedder Embedder
+	// Tags limits results to notes with any of these tag titles
+	Tags         []string
+	IncludeTrash bool
+	Limit        int
+	// Offline uses the local cache without syncing
+	Offline bool
+	Debug   bool
+}
+
+// Run brings the cached vectors up to date, embedding only new and changed notes, and returns the
+// note with the other notes ranked by cosine similarity to it. Notes with nothing in common are left out.
+func (i *SimilarConfig) Run() (*items.Note, []SearchMatch, error) {
+	embedder := i.Embedder
+	if embedder == nil {
+		embedder = NewTFIDFEmbedder()
+	}
+
+	searchConfig := SearchConfig{Session: i.Session, Offline: i.Offline, Debug: i.Debug}
+
+	cachedItems, err := searchConfig.cachedItems()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	idx, err := updatedSearchIndex(i.Session, cachedItems)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target, ok := idx.doc(i.UUID)
+	if !ok {
+		return nil, nil, fmt.Errorf("note %s not found", i.UUID)
+	}
+
+	vc, err := LoadVectorCache(i.Session, embedder.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changed, err := vc.Update(i.Session, cachedItems, embedder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if changed {
+		if err := vc.Save(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	vectors := vc.Vectors()
+	if weighter, ok := embedder.(CorpusWeighter); ok {
+		vectors = weighter.Weigh(vectors)
+	}
+
+	var tagged map[string]bool
+	if len(i.Tags) > 0 {
+		tagged = idx.TaggedNotes(i.Tags)
+	}
+
+	hits := rankSimilar(vectors, i.UUID, func(uuid string) bool {
+		doc, ok := idx.doc(uuid)
+
+		return ok && (!doc.Trashed || i.IncludeTrash) && (tagged == nil || tagged[uuid])
+	})
+
+	if i.Limit > 0 && len(hits) > i.Limit {
+		hits = hits[:i.Limit]
+	}
+
+	for x := range hits {
+		if doc, ok := idx.doc(hits[x].UUID); ok {
+			hits[x].Title = doc.Title
+		}
+	}
+
+	// the note itself is decrypted with the hits, first
+	matches, err := decryptSearchHits(i.Session, cachedItems, append([]SearchHit{{UUID: target.UUID, Title: target.Title}}, hits...))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(matches) == 0 || matches[0].Note.UUID != i.UUID {
+		return nil, nil, fmt.Errorf("failed to decrypt note %s", i.UUID)
+	}
+
+	return matches[0].Note, matches[1:], nil
+}
+
+// rankSimilar returns the notes accepted by include in order of similarity to the note, most
+// similar first, leaving out the note itself and notes with a similarity of zero
+func rankSimilar(vectors map[string]Vector, uuid string, include func(uuid string) bool) []SearchHit {
+	target, ok := vectors[uuid]
+	if !ok {
+		return nil
+	}
+
+	var hits []SearchHit
+
+	for other, vector := range vectors {
+		if other == uuid || !include(other) {
+			continue
+		}
+
+		if score := CosineSimilarity(target, vector); score > 0 {
+			hits = append(hits, SearchHit{UUID: other, Score: score})
+		}
+	}
+
+	sort.Slice(hits, func(x, y int) bool {
+		if hits[x].Score != hits[y].Score {
+			return hits[x].Score > hits[y].Score
+		}
+
+		return hits[x].UUID < hits[y].UUID
+	})
+
+	return hits
+}
@@ -0,0 +1,162 @@
+package sncli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/jonhadfield/gosn-v2/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	a := Vector{Terms: map[string]float64{"database": 1, "migration": 1}}
+
+	assert.InDelta(t, 1, CosineSimilarity(a, a), 1e-9)
+	assert.InDelta(t, 0.5, CosineSimilarity(a, Vector{Terms: map[string]float64{"database": 1, "backup": 1}}), 1e-9)
+	assert.Zero(t, CosineSimilarity(a, Vector{Terms: map[string]float64{"recipe": 1}}))
+	assert.Zero(t, CosineSimilarity(a, Vector{}))
+
+	assert.InDelta(t, 0, CosineSimilarity(Vector{Values: []float32{1, 0}}, Vector{Values: []float32{0, 1}}), 1e-9)
+	assert.InDelta(t, 1, CosineSimilarity(Vector{Values: []float32{1, 2}}, Vector{Values: []float32{2, 4}}), 1e-6)
+	// vectors from different models can't be compared
+	assert.Zero(t, CosineSimilarity(Vector{Values: []float32{1, 2}}, Vector{Values: []float32{1, 2, 3}}))
+}
+
+func TestTFIDFEmbedderRankSimilar(t *testing.T) {
+	texts := map[string][2]string{
+		"note-1": {"Postgres migration", "Steps for the postgres database migration and replica failover."},
+		"note-2": {"Database backups", "Nightly postgres database backups are copied to the replica."},
+		"note-3": {"Sourdough", "Feed the starter, then bake the sourdough loaf."},
+		"note-4": {"Bread", "Bake bread with the sourdough starter."},
+	}
+
+	var notes []*items.Note
+
+	for _, uuid := range []string{"note-1", "note-2", "note-3", "note-4"} {
+		note, err := items.NewNote(texts[uuid][0], texts[uuid][1], nil)
+		require.NoError(t, err)
+
+		note.UUID = uuid
+		notes = append(notes, &note)
+	}
+
+	embedder := NewTFIDFEmbedder()
+
+	vectors, err := embedder.Embed(notes)
+	require.NoError(t, err)
+	require.Len(t, vectors, 4)
+
+	// words are split on spaces and stop words dropped
+	assert.Contains(t, vectors[0].Terms, "postgres")
+	assert.NotContains(t, vectors[0].Terms, "the")
+
+	byUUID := make(map[string]Vector)
+	for x, note := range notes {
+		byUUID[note.UUID] = vectors[x]
+	}
+
+	weighted := embedder.Weigh(byUUID)
+	// terms in a single note can't relate it to others
+	assert.NotContains(t, weighted["note-1"].Terms, "failover")
+
+	hits := rankSimilar(weighted, "note-1", func(string) bool { return true })
+	require.Len(t, hits, 1)
+	assert.Equal(t, "note-2", hits[0].UUID)
+
+	hits = rankSimilar(weighted, "note-4", func(string) bool { return true })
+	require.Len(t, hits, 1)
+	assert.Equal(t, "note-3", hits[0].UUID)
+
+	assert.Empty(t, rankSimilar(weighted, "note-1", func(uuid string) bool { return uuid != "note-2" }))
+	assert.Empty(t, rankSimilar(weighted, "missing", func(string) bool { return true }))
+}
+
+func TestHTTPEmbedder(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "test-model", req.Model)
+
+		embeddings := make([][]float32, 0, len(req.Input))
+		for _, input := range req.Input {
+			embeddings = append(embeddings, []float32{float32(len(input)), 1})
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": embeddings})
+	}))
+	defer server.Close()
+
+	embedder := &HTTPEmbedder{URL: server.URL, Model: "test-model", BatchSize: 2}
+
+	var notes []*items.Note
+
+	for _, title := range []string{"a", "bb", "ccc"} {
+		note, err := items.NewNote(title, "", nil)
+		require.NoError(t, err)
+
+		notes = append(notes, &note)
+	}
+
+	vectors, err := embedder.Embed(notes)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+	require.Len(t, vectors, 3)
+	assert.Equal(t, []float32{3, 1}, vectors[2].Values)
+	assert.NotEqual(t, NewTFIDFEmbedder().Name(), embedder.Name())
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	})
+
+	_, err = embedder.Embed(notes)
+	require.ErrorContains(t, err, "model not found")
+}
+
+func TestVectorCacheSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	s := &cache.Session{
+		Session:     &session.Session{MasterKey: "0123456789abcdef"},
+		CacheDBPath: filepath.Join(dir, "sncli-test.db"),
+	}
+
+	vc, err := LoadVectorCache(s, tfidfEmbedderName)
+	require.NoError(t, err)
+	assert.Empty(t, vc.Notes)
+
+	vc.Notes["note-1"] = CachedVector{UpdatedAt: 1, Vector: Vector{Terms: map[string]float64{"standup": 0.5}}}
+	require.NoError(t, vc.Save())
+
+	data, err := os.ReadFile(filepath.Join(dir, "sncli-test.vec"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "standup")
+
+	loaded, err := LoadVectorCache(s, tfidfEmbedderName)
+	require.NoError(t, err)
+	assert.Equal(t, vc.Notes, loaded.Notes)
+
+	// vectors from another embedder are discarded
+	loaded, err = LoadVectorCache(s, "http:http://localhost:11434/api/embed#nomic-embed-text")
+	require.NoError(t, err)
+	assert.Empty(t, loaded.Notes)
+
+	// as are those that can't be decrypted, such as after a password change
+	s.MasterKey = "fedcba9876543210"
+	loaded, err = LoadVectorCache(s, tfidfEmbedderName)
+	require.NoError(t, err)
+	assert.Empty(t, loaded.Notes)
+}
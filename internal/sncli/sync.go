@@ -9,6 +9,16 @@ import (
 )
 
 func Sync(si cache.SyncInput, useStdErr bool) (cache.SyncOutput, error) {
+	so, err := syncWithProgress(si, useStdErr)
+	if err == nil && !si.Close && so.DB != nil {
+		refreshSearchIndex(si.Session, so.DB)
+	}
+
+	return so, err
+}
+
+// syncWithProgress syncs, showing a spinner unless debugging
+func syncWithProgress(si cache.SyncInput, useStdErr bool) (cache.SyncOutput, error) {
 	if !si.Debug {
 		prefix := color.HiWhite.Sprintf("syncing ")
 		if _, err := os.Stat(si.Session.CacheDBPath); os.IsNotExist(err) {
@@ -33,7 +43,16 @@ func Sync(si cache.SyncInput, useStdErr bool) (cache.SyncOutput, error) {
 	return sync(si)
 }
 
+// SyncCache syncs without showing progress, using the daemon if one is running
+func SyncCache(si cache.SyncInput) (cache.SyncOutput, error) {
+	return sync(si)
+}
+
 func sync(si cache.SyncInput) (cache.SyncOutput, error) {
+	if so, ok, err := syncWithDaemon(si); ok {
+		return so, err
+	}
+
 	return cache.Sync(cache.SyncInput{
 		Session: si.Session,
 		Close:   si.Close,
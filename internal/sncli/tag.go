@@ -151,11 +151,12 @@ func tagNotes(i tagNotesInput) error {
 
 func (i *TagItemsConfig) Run() error {
 	return tagNotes(tagNotesInput{
-		matchTitle: i.FindTitle,
-		matchText:  i.FindText,
-		matchTags:  []string{i.FindTag},
-		newTags:    i.NewTags,
-		session:    i.Session,
+		matchTitle:     i.FindTitle,
+		matchText:      i.FindText,
+		matchTags:      []string{i.FindTag},
+		matchNoteUUIDs: i.FindUUIDs,
+		newTags:        i.NewTags,
+		session:        i.Session,
 	})
 }
 
@@ -215,6 +216,17 @@ func (i *GetItemsConfig) Run() (items.Items, error) {
 }
 
 func (i *GetTagConfig) Run() (items.Items, error) {
+	if i.Offline {
+		items, err := LoadCachedItems(i.Session)
+		if err != nil {
+			return nil, err
+		}
+
+		items.Filter(i.Filters)
+
+		return items, nil
+	}
+
 	var so cache.SyncOutput
 	var err error
 
@@ -0,0 +1,539 @@
+package sncli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// viewDateKeypaths maps the date fields in search queries to smart view keypaths
+var viewDateKeypaths = map[string]string{
+	"updated": "userModifiedDate",
+	"created": "created_at",
+}
+
+// View is a saved search, stored as a Standard Notes smart view
+type View struct {
+	UUID  string
+	Title string
+	// Query is the smart view's predicate as a search query, empty if it can't be expressed as one
+	Query string
+	// Predicate is the smart view's predicate in the JSON form used by Standard Notes
+	Predicate any
+	// Err explains why the predicate couldn't be converted to a query
+	Err error
+}
+
+// smartViewPredicate is the JSON form of a Standard Notes smart view predicate. Compound predicates
+// have the operator and, or or not with the predicates they combine as the value.
+type smartViewPredicate struct {
+	Keypath  string `json:"keypath,omitempty"`
+	Operator string `json:"operator"`
+	Value    any    `json:"value"`
+}
+
+type AddViewInput struct {
+	Session *cache.Session
+	Title   string
+	Query   string
+	Debug   bool
+}
+
+// Run saves the query as a smart view and syncs it, returning the view
+func (i *AddViewInput) Run() (View, error) {
+	if strings.TrimSpace(i.Title) == "" {
+		return View{}, errors.New("view title is required")
+	}
+
+	predicate, err := SearchQueryPredicate(i.Query)
+	if err != nil {
+		return View{}, err
+	}
+
+	existing, err := syncAllItems(i.Session)
+	if err != nil {
+		return View{}, err
+	}
+
+	for _, view := range smartViews(existing) {
+		if strings.EqualFold(view.Content.GetTitle(), i.Title) {
+			return View{}, fmt.Errorf("view %q already exists", view.Content.GetTitle())
+		}
+	}
+
+	view := items.NewSmartView()
+	content := items.NewSmartViewContent()
+	content.SetTitle(i.Title)
+	content.SetPredicate(predicate)
+	view.Content = *content
+
+	so, err := Sync(cache.SyncInput{Session: i.Session}, true)
+	if err != nil {
+		return View{}, err
+	}
+
+	if err = cache.SaveItems(i.Session, so.DB, items.Items{&view}, true); err != nil {
+		return View{}, fmt.Errorf("failed to save view: %w", err)
+	}
+
+	if _, err = Sync(cache.SyncInput{Session: i.Session, Close: true}, true); err != nil {
+		return View{}, err
+	}
+
+	return newView(&view), nil
+}
+
+type GetViewsConfig struct {
+	Session *cache.Session
+	// Offline reads views from the local cache without syncing
+	Offline bool
+	Debug   bool
+}
+
+// Run returns the smart views ordered by title
+func (i *GetViewsConfig) Run() ([]View, error) {
+	allItems, err := i.items()
+	if err != nil {
+		return nil, err
+	}
+
+	var views []View
+	for _, sv := range smartViews(allItems) {
+		views = append(views, newView(sv))
+	}
+
+	sort.Slice(views, func(x, y int) bool {
+		return strings.ToLower(views[x].Title) < strings.ToLower(views[y].Title)
+	})
+
+	return views, nil
+}
+
+func (i *GetViewsConfig) items() (items.Items, error) {
+	if i.Offline {
+		return LoadCachedItems(i.Session)
+	}
+
+	return syncAllItems(i.Session)
+}
+
+type RunViewConfig struct {
+	Session *cache.Session
+	// View is the title or UUID of the view to run
+	View         string
+	IncludeTrash bool
+	Limit        int
+	// Offline runs the view against the local cache without syncing
+	Offline bool
+	Debug   bool
+}
+
+// Run finds the view and returns the notes matching its query in order of relevance
+func (i *RunViewConfig) Run() (View, []SearchMatch, error) {
+	views, err := (&GetViewsConfig{Session: i.Session, Offline: i.Offline, Debug: i.Debug}).Run()
+	if err != nil {
+		return View{}, nil, err
+	}
+
+	view, err := findView(views, i.View)
+	if err != nil {
+		return View{}, nil, err
+	}
+
+	if view.Err != nil {
+		return view, nil, fmt.Errorf("view %q: %w", view.Title, view.Err)
+	}
+
+	// the cache was brought up to date when finding the view
+	searchConfig := SearchConfig{
+		Session:      i.Session,
+		Query:        view.Query,
+		IncludeTrash: i.IncludeTrash,
+		Limit:        i.Limit,
+		Offline:      true,
+		Debug:        i.Debug,
+	}
+
+	matches, err := searchConfig.Run()
+
+	return view, matches, err
+}
+
+// findView returns the view with the UUID, or the title ignoring case
+func findView(views []View, titleOrUUID string) (View, error) {
+	var found []View
+
+	for _, view := range views {
+		if view.UUID == titleOrUUID {
+			return view, nil
+		}
+
+		if strings.EqualFold(view.Title, titleOrUUID) {
+			found = append(found, view)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return View{}, fmt.Errorf("view %q not found", titleOrUUID)
+	case 1:
+		return found[0], nil
+	default:
+		return View{}, fmt.Errorf("multiple views titled %q found, specify by UUID", titleOrUUID)
+	}
+}
+
+func smartViews(allItems items.Items) []*items.SmartView {
+	var views []*items.SmartView
+
+	for _, item := range allItems {
+		if item.IsDeleted() || item.GetContentType() != common.SNItemTypeSmartTag {
+			continue
+		}
+
+		if sv, ok := item.(*items.SmartView); ok {
+			views = append(views, sv)
+		}
+	}
+
+	return views
+}
+
+func newView(sv *items.SmartView) View {
+	view := View{
+		UUID:      sv.UUID,
+		Title:     sv.Content.GetTitle(),
+		Predicate: sv.Content.GetPredicate(),
+	}
+
+	view.Query, view.Err = PredicateSearchQuery(view.Predicate)
+
+	return view
+}
+
+// SearchQueryPredicate converts a search query to a smart view predicate
+func SearchQueryPredicate(query string) (any, error) {
+	q, err := ParseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.root == nil {
+		return nil, errors.New("view query is required")
+	}
+
+	return nodePredicate(q.root), nil
+}
+
+// PredicateSearchQuery converts a smart view predicate to a search query
+func PredicateSearchQuery(predicate any) (string, error) {
+	// predicates read from items are generic maps, so decode them consistently
+	data, err := json.Marshal(predicate)
+	if err != nil {
+		return "", fmt.Errorf("invalid predicate: %w", err)
+	}
+
+	var generic any
+	if err = json.Unmarshal(data, &generic); err != nil {
+		return "", fmt.Errorf("invalid predicate: %w", err)
+	}
+
+	node, err := predicateNode(generic, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	return queryString(node), nil
+}
+
+func nodePredicate(node queryNode) smartViewPredicate {
+	switch n := node.(type) {
+	case *andNode:
+		return compoundPredicate("and", n.nodes)
+	case *orNode:
+		return compoundPredicate("or", n.nodes)
+	case *notNode:
+		return smartViewPredicate{Operator: "not", Value: nodePredicate(n.node)}
+	case *termNode:
+		return textPredicate(n.word)
+	case *phraseNode:
+		return textPredicate(n.phrase)
+	case *fieldNode:
+		return fieldPredicate(n)
+	}
+
+	return smartViewPredicate{}
+}
+
+func compoundPredicate(operator string, nodes []queryNode) smartViewPredicate {
+	predicates := make([]smartViewPredicate, 0, len(nodes))
+	for _, node := range nodes {
+		predicates = append(predicates, nodePredicate(node))
+	}
+
+	return smartViewPredicate{Operator: operator, Value: predicates}
+}
+
+// textPredicate matches words or a phrase in the title or text, as smart views can't search both at once
+func textPredicate(text string) smartViewPredicate {
+	return smartViewPredicate{Operator: "or", Value: []smartViewPredicate{
+		{Keypath: "title", Operator: "includes", Value: text},
+		{Keypath: "text", Operator: "includes", Value: text},
+	}}
+}
+
+func fieldPredicate(n *fieldNode) smartViewPredicate {
+	switch n.field {
+	case "title", "text":
+		return smartViewPredicate{Keypath: n.field, Operator: "includes", Value: n.value}
+	case "tag":
+		return smartViewPredicate{Keypath: "tags", Operator: "includes", Value: smartViewPredicate{Keypath: "title", Operator: "=", Value: n.value}}
+	case "uuid":
+		return smartViewPredicate{Keypath: "uuid", Operator: "=", Value: n.value}
+	case "pinned":
+		return smartViewPredicate{Keypath: "pinned", Operator: "=", Value: n.flag}
+	case "trash":
+		return smartViewPredicate{Keypath: "trashed", Operator: "=", Value: n.flag}
+	default:
+		op := n.op
+		if op == "" {
+			op = "="
+		}
+
+		return smartViewPredicate{Keypath: viewDateKeypaths[n.field], Operator: op, Value: n.date}
+	}
+}
+
+// predicateNode converts a decoded smart view predicate to a query node. Predicates may also be
+// written as arrays of keypath, operator and value.
+func predicateNode(predicate any, now time.Time) (queryNode, error) {
+	keypath, operator, value, ok := predicateParts(predicate)
+	if !ok {
+		return nil, fmt.Errorf("unsupported predicate %v", predicate)
+	}
+
+	switch operator {
+	case "and", "or":
+		return compoundNode(operator, value, now)
+	case "not":
+		node, err := predicateNode(value, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return &notNode{node: node}, nil
+	}
+
+	unsupported := fmt.Errorf("unsupported predicate: %s %s %v", keypath, operator, value)
+
+	switch keypath {
+	case "title", "text":
+		s, ok := value.(string)
+		if !ok || operator != "includes" {
+			return nil, unsupported
+		}
+
+		return &fieldNode{field: keypath, value: s, lower: strings.ToLower(s)}, nil
+	case "tags":
+		tagKeypath, tagOperator, tagValue, ok := predicateParts(value)
+		if !ok || operator != "includes" || tagKeypath != "title" || tagOperator != "=" {
+			return nil, unsupported
+		}
+
+		title, ok := tagValue.(string)
+		if !ok {
+			return nil, unsupported
+		}
+
+		return &fieldNode{field: "tag", value: title, lower: strings.ToLower(title)}, nil
+	case "uuid":
+		s, ok := value.(string)
+		if !ok || operator != "=" {
+			return nil, unsupported
+		}
+
+		return &fieldNode{field: "uuid", value: s}, nil
+	case "pinned", "trashed":
+		b, ok := value.(bool)
+		if !ok || (operator != "=" && operator != "!=") {
+			return nil, unsupported
+		}
+
+		field := "pinned"
+		if keypath == "trashed" {
+			field = "trash"
+		}
+
+		// pinned != true is pinned:false
+		return &fieldNode{field: field, flag: b == (operator == "=")}, nil
+	case "userModifiedDate", "updated_at", "created_at":
+		s, ok := value.(string)
+		if !ok || !StringInSlice(operator, []string{"=", ">", ">=", "<", "<="}, false) {
+			return nil, unsupported
+		}
+
+		from, to, err := parseQueryTime(s, now)
+		if err != nil {
+			return nil, unsupported
+		}
+
+		node := &fieldNode{field: "updated", date: s, from: from, to: to}
+		if keypath == "created_at" {
+			node.field = "created"
+		}
+
+		if operator != "=" {
+			node.op = operator
+		}
+
+		return node, nil
+	}
+
+	return nil, unsupported
+}
+
+// predicateParts returns the keypath, operator and value of a predicate in either form
+func predicateParts(predicate any) (keypath, operator string, value any, ok bool) {
+	switch p := predicate.(type) {
+	case map[string]any:
+		keypath, _ = p["keypath"].(string)
+		operator, ok = p["operator"].(string)
+
+		return keypath, operator, p["value"], ok
+	case []any:
+		if len(p) != 3 {
+			return "", "", nil, false
+		}
+
+		keypath, _ = p[0].(string)
+		operator, ok = p[1].(string)
+
+		return keypath, operator, p[2], ok
+	}
+
+	return "", "", nil, false
+}
+
+func compoundNode(operator string, value any, now time.Time) (queryNode, error) {
+	predicates, ok := value.([]any)
+	if !ok || len(predicates) == 0 {
+		return nil, fmt.Errorf("unsupported predicate: %s of %v", operator, value)
+	}
+
+	nodes := make([]queryNode, 0, len(predicates))
+
+	for _, predicate := range predicates {
+		node, err := predicateNode(predicate, now)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	// a title or text match for the same words is how a plain search term is saved
+	if operator == "or" && len(nodes) == 2 {
+		title, titleOK := nodes[0].(*fieldNode)
+		text, textOK := nodes[1].(*fieldNode)
+
+		if titleOK && textOK && title.field == "title" && text.field == "text" && title.value == text.value {
+			return textNode(title.value), nil
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	if operator == "and" {
+		return &andNode{nodes: nodes}, nil
+	}
+
+	return &orNode{nodes: nodes}, nil
+}
+
+// textNode returns a term for a single word or a phrase for anything else
+func textNode(text string) queryNode {
+	if isQueryWord(text) {
+		return &termNode{word: text, terms: uniqueTerms(searchTerms(text))}
+	}
+
+	return &phraseNode{phrase: text, lower: strings.ToLower(strings.Join(strings.Fields(text), " "))}
+}
+
+// queryWord matches values that can be written in a query without quotes
+var queryWord = regexp.MustCompile(`^[^\s()"-][^\s()"]*$`)
+
+func isQueryWord(s string) bool {
+	if !queryWord.MatchString(s) || s == "AND" || s == "OR" || s == "NOT" {
+		return false
+	}
+
+	name, _, found := strings.Cut(s, ":")
+
+	return !found || !StringInSlice(name, searchQueryFields, true)
+}
+
+// queryString writes a query node as a search query
+func queryString(node queryNode) string {
+	switch n := node.(type) {
+	case *andNode:
+		parts := make([]string, 0, len(n.nodes))
+
+		for _, child := range n.nodes {
+			if _, ok := child.(*orNode); ok {
+				parts = append(parts, "("+queryString(child)+")")
+			} else {
+				parts = append(parts, queryString(child))
+			}
+		}
+
+		return strings.Join(parts, " ")
+	case *orNode:
+		parts := make([]string, 0, len(n.nodes))
+		for _, child := range n.nodes {
+			parts = append(parts, queryString(child))
+		}
+
+		return strings.Join(parts, " OR ")
+	case *notNode:
+		switch n.node.(type) {
+		case *andNode, *orNode:
+			return "-(" + queryString(n.node) + ")"
+		}
+
+		return "-" + queryString(n.node)
+	case *termNode:
+		return n.word
+	case *phraseNode:
+		return quoteQueryValue(n.phrase)
+	case *fieldNode:
+		switch n.field {
+		case "pinned", "trash":
+			return fmt.Sprintf("%s:%t", n.field, n.flag)
+		case "updated", "created":
+			return n.field + ":" + n.op + n.date
+		}
+
+		if isQueryWord(n.value) && !strings.Contains(n.value, ":") {
+			return n.field + ":" + n.value
+		}
+
+		return n.field + ":" + quoteQueryValue(n.value)
+	}
+
+	return ""
+}
+
+// quoteQueryValue quotes a phrase, dropping any quotes within it as phrases can't contain them
+func quoteQueryValue(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+}
@@ -0,0 +1,143 @@
+package sncli
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchQueryPredicate(t *testing.T) {
+	predicate, err := SearchQueryPredicate(`tag:work -tag:archive pinned:true updated:>7.days.ago standup`)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(predicate)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"operator": "and", "value": [
+		{"keypath": "tags", "operator": "includes", "value": {"keypath": "title", "operator": "=", "value": "work"}},
+		{"operator": "not", "value": {"keypath": "tags", "operator": "includes", "value": {"keypath": "title", "operator": "=", "value": "archive"}}},
+		{"keypath": "pinned", "operator": "=", "value": true},
+		{"keypath": "userModifiedDate", "operator": ">", "value": "7.days.ago"},
+		{"operator": "or", "value": [
+			{"keypath": "title", "operator": "includes", "value": "standup"},
+			{"keypath": "text", "operator": "includes", "value": "standup"}
+		]}
+	]}`, string(data))
+
+	_, err = SearchQueryPredicate("")
+	require.Error(t, err)
+
+	_, err = SearchQueryPredicate("(tag:work")
+	var qe *QueryError
+	require.ErrorAs(t, err, &qe)
+}
+
+func TestPredicateSearchQuery(t *testing.T) {
+	// queries survive being saved as a predicate and read back
+	for _, query := range []string{
+		`tag:work -tag:archive pinned:true updated:>7.days.ago standup`,
+		`title:"standup notes" (tag:work OR tag:home) "exact phrase"`,
+		`-(trash:true OR created:<=2026-01-01) uuid:1234`,
+		`text:"tag:work" "AND"`,
+	} {
+		predicate, err := SearchQueryPredicate(query)
+		require.NoError(t, err, query)
+
+		// as it would be after syncing
+		data, err := json.Marshal(predicate)
+		require.NoError(t, err)
+
+		var synced any
+		require.NoError(t, json.Unmarshal(data, &synced))
+
+		got, err := PredicateSearchQuery(synced)
+		require.NoError(t, err, query)
+		assert.Equal(t, query, got)
+	}
+
+	// predicates created in the Standard Notes apps, including the array form
+	for predicate, expected := range map[string]string{
+		`{"keypath": "pinned", "operator": "!=", "value": true}`:                    "pinned:false",
+		`{"keypath": "trashed", "operator": "=", "value": false}`:                   "trash:false",
+		`["title", "includes", "plan"]`:                                             "title:plan",
+		`{"keypath": "updated_at", "operator": ">=", "value": "2.weeks.ago"}`:       "updated:>=2.weeks.ago",
+		`{"operator": "and", "value": [["tags", "includes", ["title", "=", "x"]]]}`: "tag:x",
+	} {
+		var p any
+		require.NoError(t, json.Unmarshal([]byte(predicate), &p))
+
+		got, err := PredicateSearchQuery(p)
+		require.NoError(t, err, predicate)
+		assert.Equal(t, expected, got, predicate)
+	}
+
+	for _, predicate := range []string{
+		`{"keypath": "archived", "operator": "=", "value": true}`,
+		`{"keypath": "title", "operator": "startsWith", "value": "a"}`,
+		`{"operator": "or", "value": []}`,
+		`"title"`,
+	} {
+		var p any
+		require.NoError(t, json.Unmarshal([]byte(predicate), &p))
+
+		_, err := PredicateSearchQuery(p)
+		require.Error(t, err, predicate)
+	}
+}
+
+func TestParseQueryTimeAgo(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	from, _, err := parseQueryTime("7.days.ago", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 24, 12, 0, 0, 0, time.UTC), from)
+
+	from, _, err = parseQueryTime("1.month.ago", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC), from)
+
+	from, _, err = parseQueryTime("3.hours.ago", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 31, 9, 0, 0, 0, time.UTC), from)
+
+	_, _, err = parseQueryTime("7.fortnights.ago", now)
+	require.Error(t, err)
+}
+
+func TestFindView(t *testing.T) {
+	views := []View{
+		{UUID: "view-1", Title: "Work"},
+		{UUID: "view-2", Title: "Inbox"},
+		{UUID: "view-3", Title: "inbox"},
+	}
+
+	view, err := findView(views, "work")
+	require.NoError(t, err)
+	assert.Equal(t, "view-1", view.UUID)
+
+	view, err = findView(views, "view-3")
+	require.NoError(t, err)
+	assert.Equal(t, "inbox", view.Title)
+
+	_, err = findView(views, "Inbox")
+	require.ErrorContains(t, err, "multiple views")
+
+	_, err = findView(views, "missing")
+	require.ErrorContains(t, err, "not found")
+}
+
+func TestNewView(t *testing.T) {
+	sv := items.NewSmartView()
+	content := items.NewSmartViewContent()
+	content.SetTitle("Unsupported")
+	content.SetPredicate(map[string]any{"keypath": "archived", "operator": "=", "value": true})
+	sv.Content = *content
+
+	view := newView(&sv)
+	assert.Equal(t, "Unsupported", view.Title)
+	assert.Empty(t, view.Query)
+	require.Error(t, view.Err)
+}
@@ -0,0 +1,433 @@
+package sncli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/cache"
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+)
+
+// DefaultWatchInterval is how often watch syncs by default
+const DefaultWatchInterval = time.Minute
+
+// Watch event kinds
+const (
+	WatchCreated = "created"
+	WatchUpdated = "updated"
+	WatchTrashed = "trashed"
+	WatchDeleted = "deleted"
+)
+
+// WatchEvent describes an item that changed between two syncs. Changed lists the fields
+// that differ for updated items, such as title, text, tags, pinned and trashed.
+type WatchEvent struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	UUID    string    `json:"uuid"`
+	Type    string    `json:"type"`
+	Title   string    `json:"title,omitempty"`
+	Changed []string  `json:"changed,omitempty"`
+}
+
+// WatchConfig syncs on an interval and reports the items changed by each sync,
+// found by comparing the cache before and after.
+type WatchConfig struct {
+	Session  *cache.Session
+	Interval time.Duration
+	// Types limits events to the content types, such as Note or Tag, matched case-insensitively
+	Types []string
+	// Tags limits events to notes with any of the tag titles, before or after the change
+	Tags []string
+	// Exec is run through the shell for each event, with {uuid}, {type}, {title} and {event}
+	// replaced by the quoted values, which are also set in SN_UUID, SN_TYPE, SN_TITLE and SN_EVENT.
+	// On Windows {title} is left empty, so hooks read the title from SN_TITLE.
+	Exec string
+	// OnError is called when a sync or hook fails, and watching continues. Without it, Run returns the error.
+	OnError func(error)
+
+	// loadCached returns the items in the cache and load syncs first. They are replaced in tests.
+	loadCached func() (items.Items, error)
+	load       func() (items.Items, error)
+}
+
+// watchItem is the state of an item compared between syncs
+type watchItem struct {
+	contentType string
+	title       string
+	text        uint64
+	trashed     bool
+	pinned      bool
+	tags        []string
+	references  []string
+	updated     int64
+}
+
+type watchSnapshot map[string]watchItem
+
+// Run syncs on the interval, starting straight away, and reports the changes made by each sync until
+// the context is cancelled. The first sync is compared with the cache as it was, if there is one.
+func (w *WatchConfig) Run(ctx context.Context, emit func(WatchEvent) error) error {
+	if w.Interval <= 0 {
+		w.Interval = DefaultWatchInterval
+	}
+
+	if w.loadCached == nil {
+		w.loadCached = func() (items.Items, error) {
+			return LoadCachedItems(w.Session)
+		}
+	}
+
+	if w.load == nil {
+		w.load = func() (items.Items, error) {
+			return syncAndLoadItems(w.Session)
+		}
+	}
+
+	cached, err := w.loadCached()
+	if err != nil && !errors.Is(err, ErrNoCache) {
+		return err
+	}
+
+	var before watchSnapshot
+	if err == nil {
+		before = newWatchSnapshot(cached)
+	}
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		all, err := w.load()
+
+		switch {
+		case err != nil && before == nil:
+			// without a cache to compare with, there's nothing to watch
+			return err
+		case err != nil:
+			if err = w.failed(fmt.Errorf("sync failed: %w", err)); err != nil {
+				return err
+			}
+		default:
+			after := newWatchSnapshot(all)
+
+			if before != nil {
+				if err = w.report(ctx, diffWatchSnapshots(before, after, time.Now().UTC()), before, after, emit); err != nil {
+					return err
+				}
+			}
+
+			before = after
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// report emits the events passing the filters, running the hook for each
+func (w *WatchConfig) report(ctx context.Context, events []WatchEvent, before, after watchSnapshot, emit func(WatchEvent) error) error {
+	for _, event := range events {
+		if !w.matches(event, before, after) {
+			continue
+		}
+
+		if err := emit(event); err != nil {
+			return err
+		}
+
+		if w.Exec == "" {
+			continue
+		}
+
+		if err := runWatchHook(ctx, w.Exec, event); err != nil {
+			if err = w.failed(err); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *WatchConfig) failed(err error) error {
+	if w.OnError == nil {
+		return err
+	}
+
+	w.OnError(err)
+
+	return nil
+}
+
+// matches reports whether the event passes the type and tag filters
+func (w *WatchConfig) matches(event WatchEvent, before, after watchSnapshot) bool {
+	if len(w.Types) > 0 && !StringInSlice(event.Type, w.Types, true) {
+		return false
+	}
+
+	if len(w.Tags) == 0 {
+		return true
+	}
+
+	if event.Type != common.SNItemTypeNote {
+		return false
+	}
+
+	for _, snapshot := range []watchSnapshot{before, after} {
+		for _, tag := range snapshot[event.UUID].tags {
+			if StringInSlice(tag, w.Tags, true) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// syncAndLoadItems syncs and returns the decrypted items in the cache
+func syncAndLoadItems(s *cache.Session) (items.Items, error) {
+	so, err := sync(cache.SyncInput{Session: s})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshSearchIndex(s, so.DB)
+
+	var cachedItems cache.Items
+
+	err = so.DB.All(&cachedItems)
+
+	_ = so.DB.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// give the cache back to the daemon, if one is running, so it isn't held between polls
+	if err = releaseDaemonLease(true); err != nil {
+		return nil, err
+	}
+
+	return cachedItems.ToItems(s)
+}
+
+func newWatchSnapshot(all items.Items) watchSnapshot {
+	snapshot := make(watchSnapshot, len(all))
+	noteTags := make(map[string][]string)
+
+	for _, item := range all {
+		if item.IsDeleted() || item.GetContentType() == common.SNItemTypeItemsKey {
+			continue
+		}
+
+		wi := watchItem{
+			contentType: item.GetContentType(),
+			updated:     item.GetUpdatedAtTimestamp(),
+		}
+
+		if content := item.GetContent(); content != nil {
+			for _, ref := range content.References() {
+				wi.references = append(wi.references, ref.UUID)
+			}
+
+			slices.Sort(wi.references)
+		}
+
+		switch v := item.(type) {
+		case *items.Note:
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(v.Content.GetText()))
+
+			wi.title = v.Content.GetTitle()
+			wi.text = h.Sum64()
+			wi.trashed = NoteTrashed(v)
+			wi.pinned = NotePinned(v)
+		case *items.Tag:
+			wi.title = v.Content.GetTitle()
+
+			for _, ref := range v.Content.References() {
+				if ref.ContentType == common.SNItemTypeNote {
+					noteTags[ref.UUID] = append(noteTags[ref.UUID], wi.title)
+				}
+			}
+		}
+
+		snapshot[item.GetUUID()] = wi
+	}
+
+	for uuid, tags := range noteTags {
+		if wi, ok := snapshot[uuid]; ok && wi.contentType == common.SNItemTypeNote {
+			slices.Sort(tags)
+			wi.tags = tags
+			snapshot[uuid] = wi
+		}
+	}
+
+	return snapshot
+}
+
+// diffWatchSnapshots returns the events that turn before into after, ordered by type then title
+func diffWatchSnapshots(before, after watchSnapshot, now time.Time) []WatchEvent {
+	var events []WatchEvent
+
+	for uuid, a := range after {
+		event := WatchEvent{Time: now, UUID: uuid, Type: a.contentType, Title: a.title}
+
+		b, existed := before[uuid]
+		if !existed {
+			event.Event = WatchCreated
+			events = append(events, event)
+
+			continue
+		}
+
+		if event.Changed = changedWatchFields(b, a); len(event.Changed) == 0 {
+			continue
+		}
+
+		event.Event = WatchUpdated
+		if a.trashed && !b.trashed {
+			event.Event = WatchTrashed
+		}
+
+		events = append(events, event)
+	}
+
+	for uuid, b := range before {
+		if _, ok := after[uuid]; !ok {
+			events = append(events, WatchEvent{Time: now, Event: WatchDeleted, UUID: uuid, Type: b.contentType, Title: b.title})
+		}
+	}
+
+	slices.SortFunc(events, func(x, y WatchEvent) int {
+		if c := strings.Compare(x.Type, y.Type); c != 0 {
+			return c
+		}
+
+		if c := strings.Compare(x.Title, y.Title); c != 0 {
+			return c
+		}
+
+		return strings.Compare(x.UUID, y.UUID)
+	})
+
+	return events
+}
+
+// changedWatchFields lists the fields that differ. Notes and tags are compared by the fields shown
+// to users, so changes to editor state alone aren't reported, and other items by when they were updated.
+func changedWatchFields(b, a watchItem) []string {
+	var changed []string
+
+	if b.title != a.title {
+		changed = append(changed, "title")
+	}
+
+	if b.text != a.text {
+		changed = append(changed, "text")
+	}
+
+	if b.pinned != a.pinned {
+		changed = append(changed, "pinned")
+	}
+
+	if b.trashed != a.trashed {
+		changed = append(changed, "trashed")
+	}
+
+	if !slices.Equal(b.tags, a.tags) {
+		changed = append(changed, "tags")
+	}
+
+	if !slices.Equal(b.references, a.references) {
+		changed = append(changed, "references")
+	}
+
+	switch a.contentType {
+	case common.SNItemTypeNote, common.SNItemTypeTag:
+	default:
+		if len(changed) == 0 && b.updated != a.updated {
+			changed = append(changed, "content")
+		}
+	}
+
+	return changed
+}
+
+// runWatchHook runs the command for the event through the shell
+func runWatchHook(ctx context.Context, command string, event WatchEvent) error {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	cmd := exec.CommandContext(ctx, shell, flag, watchHookCommand(runtime.GOOS, command, event))
+	cmd.Env = append(os.Environ(),
+		"SN_UUID="+event.UUID,
+		"SN_TYPE="+event.Type,
+		"SN_TITLE="+event.Title,
+		"SN_EVENT="+event.Event,
+	)
+	// events are written to stdout, so keep the hook's output apart from them
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("hook for %s %s exited with status %d", event.Event, event.UUID, exitErr.ExitCode())
+		}
+
+		return fmt.Errorf("hook for %s %s failed: %w", event.Event, event.UUID, err)
+	}
+
+	return nil
+}
+
+// watchHookCommand returns the command with the event's values in place of the placeholders.
+// cmd.exe expands variables and escapes inside quotes, so titles, which any client can set,
+// aren't put in the command on Windows and {title} becomes empty, leaving SN_TITLE to read it.
+func watchHookCommand(goos, command string, event WatchEvent) string {
+	title := shellQuote(goos, event.Title)
+	if goos == "windows" {
+		title = `""`
+	}
+
+	return strings.NewReplacer(
+		"{uuid}", shellQuote(goos, event.UUID),
+		"{type}", shellQuote(goos, event.Type),
+		"{title}", title,
+		"{event}", shellQuote(goos, event.Event),
+	).Replace(command)
+}
+
+// shellQuote quotes the value for use as a single word in a command for the system's shell. POSIX
+// shells take everything in single quotes literally. cmd.exe still expands %, ! and ^ within
+// double quotes, and they can't be escaped there, so on Windows they're removed, along with
+// quotes and line breaks.
+func shellQuote(goos, s string) string {
+	if goos == "windows" {
+		return `"` + strings.Map(func(r rune) rune {
+			if strings.ContainsRune("\"%!^\r\n", r) {
+				return -1
+			}
+
+			return r
+		}, s) + `"`
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
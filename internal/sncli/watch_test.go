@@ -0,0 +1,207 @@
+package sncli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonhadfield/gosn-v2/common"
+	"github.com/jonhadfield/gosn-v2/items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func watchNote(t *testing.T, uuid, title, text string) *items.Note {
+	t.Helper()
+
+	note, err := items.NewNote(title, text, nil)
+	require.NoError(t, err)
+
+	note.UUID = uuid
+
+	return &note
+}
+
+func watchTag(t *testing.T, uuid, title string, notes ...string) *items.Tag {
+	t.Helper()
+
+	var refs items.ItemReferences
+	for _, note := range notes {
+		refs = append(refs, items.ItemReference{UUID: note, ContentType: common.SNItemTypeNote})
+	}
+
+	tag, err := items.NewTag(title, refs)
+	require.NoError(t, err)
+
+	tag.UUID = uuid
+
+	return &tag
+}
+
+func TestDiffWatchSnapshots(t *testing.T) {
+	standup := watchNote(t, "note-1", "Standup", "notes")
+	groceries := watchNote(t, "note-2", "Groceries", "milk")
+	old := watchNote(t, "note-3", "Old", "")
+
+	before := newWatchSnapshot(items.Items{standup, groceries, old, watchTag(t, "tag-1", "work")})
+
+	edited := *standup
+	edited.Content.SetText("more notes")
+
+	// editor state alone isn't a change
+	untouched := *groceries
+	untouched.Content.SetUpdateTime(time.Now())
+
+	trashed := *old
+	trashed.Content.SetTrashed(true)
+
+	created := watchNote(t, "note-4", "Ideas", "")
+
+	after := newWatchSnapshot(items.Items{&edited, &untouched, &trashed, created, watchTag(t, "tag-1", "work", "note-4")})
+
+	now := time.Now().UTC()
+	events := diffWatchSnapshots(before, after, now)
+
+	assert.Equal(t, []WatchEvent{
+		{Time: now, Event: WatchCreated, UUID: "note-4", Type: common.SNItemTypeNote, Title: "Ideas"},
+		{Time: now, Event: WatchTrashed, UUID: "note-3", Type: common.SNItemTypeNote, Title: "Old", Changed: []string{"trashed"}},
+		{Time: now, Event: WatchUpdated, UUID: "note-1", Type: common.SNItemTypeNote, Title: "Standup", Changed: []string{"text"}},
+		{Time: now, Event: WatchUpdated, UUID: "tag-1", Type: common.SNItemTypeTag, Title: "work", Changed: []string{"references"}},
+	}, events)
+
+	deleted := diffWatchSnapshots(after, newWatchSnapshot(items.Items{&edited}), now)
+	require.Len(t, deleted, 4)
+	assert.Equal(t, WatchEvent{Time: now, Event: WatchDeleted, UUID: "note-2", Type: common.SNItemTypeNote, Title: "Groceries"}, deleted[0])
+}
+
+func TestWatchRun(t *testing.T) {
+	cached := items.Items{watchNote(t, "note-1", "Standup", "notes"), watchNote(t, "note-2", "Groceries", "")}
+
+	edited := *cached[0].(*items.Note)
+	edited.Content.SetTitle("Standup notes")
+
+	syncs := []items.Items{
+		// the first sync is compared with the cache
+		{&edited, cached[1], watchTag(t, "tag-1", "Work", "note-2")},
+		nil,
+		{&edited, watchTag(t, "tag-1", "Work", "note-2")},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var errs []error
+
+	w := WatchConfig{
+		Interval: time.Millisecond,
+		Tags:     []string{"work"},
+		OnError: func(err error) {
+			errs = append(errs, err)
+		},
+		loadCached: func() (items.Items, error) {
+			return cached, nil
+		},
+		load: func() (items.Items, error) {
+			if len(syncs) == 0 {
+				cancel()
+
+				return nil, errors.New("no more syncs")
+			}
+
+			next := syncs[0]
+			syncs = syncs[1:]
+
+			if next == nil {
+				return nil, errors.New("offline")
+			}
+
+			return next, nil
+		},
+	}
+
+	var events []WatchEvent
+
+	require.NoError(t, w.Run(ctx, func(event WatchEvent) error {
+		events = append(events, event)
+
+		return nil
+	}))
+
+	// only notes tagged work, before or after the change, are reported
+	require.Len(t, events, 2)
+	assert.Equal(t, "note-2", events[0].UUID)
+	assert.Equal(t, []string{"tags"}, events[0].Changed)
+	assert.Equal(t, WatchDeleted, events[1].Event)
+	assert.Equal(t, "Groceries", events[1].Title)
+
+	require.Len(t, errs, 2)
+	assert.ErrorContains(t, errs[0], "offline")
+
+	// without a cache, a failed first sync ends the watch
+	w = WatchConfig{
+		loadCached: func() (items.Items, error) {
+			return nil, ErrNoCache
+		},
+		load: func() (items.Items, error) {
+			return nil, errors.New("offline")
+		},
+	}
+	require.ErrorContains(t, w.Run(context.Background(), func(WatchEvent) error { return nil }), "offline")
+}
+
+func TestRunWatchHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook test uses a POSIX shell")
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	event := WatchEvent{Event: WatchUpdated, UUID: "note-1", Type: common.SNItemTypeNote, Title: "it's $(rm -rf /)"}
+
+	require.NoError(t, runWatchHook(context.Background(), `printf '%s|%s|%s\n' {uuid} {title} "$SN_EVENT" > `+out, event))
+
+	got, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "note-1|it's $(rm -rf /)|updated\n", string(got))
+
+	err = runWatchHook(context.Background(), "exit 3", event)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "status 3"), err.Error())
+}
+
+func TestWatchHookCommandWindows(t *testing.T) {
+	event := WatchEvent{Event: WatchUpdated, UUID: "note-1%PATH%", Type: common.SNItemTypeNote, Title: `%USERNAME% ^& calc !x! "`}
+
+	// the title is never put in the command, and what cmd.exe would expand is removed from the rest
+	assert.Equal(t, `notify "note-1PATH" "Note" "" "updated"`, watchHookCommand("windows", "notify {uuid} {type} {title} {event}", event))
+	assert.Equal(t, `notify '%USERNAME% ^& calc !x! "'`, watchHookCommand("linux", "notify {title}", event))
+}
+
+func TestSyncAndLoadItemsReleasesDaemonCache(t *testing.T) {
+	d, _ := testDaemon(t)
+	s := testDaemonSession(t, d)
+
+	// hand back anything still held so the daemon can stop if a poll keeps the cache
+	t.Cleanup(func() {
+		_ = releaseDaemonLease(false)
+	})
+
+	client, err := DialDaemon(d.Session.CacheDBPath)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	// each poll syncs through the daemon and gives the cache back before the next one
+	for range 2 {
+		_, err = syncAndLoadItems(s)
+		require.NoError(t, err)
+
+		status, err := client.Status()
+		require.NoError(t, err)
+		require.False(t, status.Leased)
+	}
+}